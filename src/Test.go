@@ -663,7 +663,7 @@ func main() {
 	//GetEggs()
 	//TestConsumerAndProducer()
 	//MainPipline()
-	//lsm.TestKeyDb()
+	//lsm.TestKeyDb("templates/keydb")
 	//TestSegment()
 	//reflect.TestParse()
 	//TestMock()
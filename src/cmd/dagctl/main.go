@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/shark/src/util/scheduler"
+)
+
+// dagctl 根据配置文件检查、查看执行计划、执行任务图
+//
+//	dagctl validate conf/dags/profile_tag.toml
+//	dagctl plan conf/dags/profile_tag.toml
+//	dagctl run -store data/dag_runs conf/dags/profile_tag.toml
+//	dagctl run -store data/dag_runs -resume 20201010T101010-123456 conf/dags/profile_tag.toml
+const usage = `usage: dagctl <command> [flags] <definition.toml|definition.yaml>
+
+commands:
+  validate  检查配置：任务类型、参数、依赖、触发规则以及是否有环
+  plan      输出执行计划，同一层的任务可以并行执行
+  run       执行任务图
+
+run flags:
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "validate":
+		err = validate(args)
+	case "plan":
+		err = plan(args)
+	case "run":
+		err = run(args)
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(os.Stdout, usage)
+		fs, _ := runFlags()
+		fs.SetOutput(os.Stdout)
+		fs.PrintDefaults()
+		return
+	default:
+		err = fmt.Errorf("unknown command %q", cmd)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "dagctl:", err)
+		os.Exit(1)
+	}
+}
+
+func load(args []string) (*scheduler.Definition, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("expect exactly one definition file, got %d", len(args))
+	}
+	return scheduler.LoadDefinition(args[0])
+}
+
+func validate(args []string) error {
+	def, err := load(args)
+	if err != nil {
+		return err
+	}
+	if err := def.Validate(scheduler.DefaultRegistry); err != nil {
+		return err
+	}
+	fmt.Printf("%s: %d tasks ok\n", def.Name, len(def.Tasks))
+	return nil
+}
+
+func plan(args []string) error {
+	def, err := load(args)
+	if err != nil {
+		return err
+	}
+	if err := def.Validate(scheduler.DefaultRegistry); err != nil {
+		return err
+	}
+	layers, err := def.Plan()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s: %d tasks in %d layers\n", def.Name, len(def.Tasks), len(layers))
+	for i, layer := range layers {
+		fmt.Printf("  layer %d: %s\n", i+1, strings.Join(layer, ", "))
+	}
+	return nil
+}
+
+type runArgs struct {
+	parallelism int
+	failFast    bool
+	store       string
+	runID       string
+	resume      string
+}
+
+func runFlags() (*flag.FlagSet, *runArgs) {
+	ra := new(runArgs)
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	fs.IntVar(&ra.parallelism, "parallelism", 0, "最多同时执行的任务数，默认使用配置文件中的 parallelism")
+	fs.BoolVar(&ra.failFast, "fail-fast", false, "任意任务失败后取消其他任务，默认使用配置文件中的 fail_fast")
+	fs.StringVar(&ra.store, "store", "", "保存执行状态的目录，不指定时不保存，不能 resume")
+	fs.StringVar(&ra.runID, "run-id", "", "本次执行的 id，默认按时间生成")
+	fs.StringVar(&ra.resume, "resume", "", "从指定 run id 的断点继续执行，需要 -store")
+	return fs, ra
+}
+
+func run(args []string) error {
+	fs, ra := runFlags()
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	def, err := load(fs.Args())
+	if err != nil {
+		return err
+	}
+	g, err := def.Build(scheduler.DefaultRegistry)
+	if err != nil {
+		return err
+	}
+
+	opts := []scheduler.RunOption{scheduler.WithName(def.Name)}
+	if ra.failFast || def.FailFast {
+		opts = append(opts, scheduler.WithFailFast())
+	}
+	if ra.runID != "" {
+		opts = append(opts, scheduler.WithRunID(ra.runID))
+	}
+	if ra.store != "" {
+		store, err := scheduler.NewFileStore(ra.store)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, scheduler.WithStore(store))
+	}
+	parallelism := def.Parallelism
+	if ra.parallelism > 0 {
+		parallelism = ra.parallelism
+	}
+
+	// Ctrl+C 取消正在执行的任务，已经完成的状态保存在 store 中，可以 resume
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		cancel()
+	}()
+
+	var report *scheduler.Report
+	if ra.resume != "" {
+		if ra.store == "" {
+			return fmt.Errorf("-resume requires -store")
+		}
+		report, err = g.Resume(ctx, ra.resume, parallelism, opts...)
+	} else {
+		report, err = g.Run(ctx, parallelism, opts...)
+	}
+	if report != nil {
+		fmt.Printf("run %s of %s\n%s\n", report.RunID, def.Name, report)
+	}
+	return err
+}
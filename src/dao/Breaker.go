@@ -0,0 +1,38 @@
+package dao
+
+import (
+	"log"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/shark/src/util/circuitbreaker"
+)
+
+// 数据库熔断器，每个库一个，库挂了或者慢查询打满连接池时快速失败，避免请求堆积
+var breakers = circuitbreaker.NewGroup(circuitbreaker.Config{
+	SlowCallDuration:      2 * time.Second,
+	SlowCallRateThreshold: 0.8,
+	IsFailure:             isDBFailure,
+	OnStateChange: func(name string, from, to circuitbreaker.State) {
+		log.Printf("db %s circuit breaker %s -> %s", name, from, to)
+	},
+})
+
+// 记录不存在是正常的查询结果，不算失败
+func isDBFailure(err error) bool {
+	return err != nil && !gorm.IsRecordNotFoundError(err)
+}
+
+// Guard 在熔断器保护下执行一次 gorm 操作，name 一般是库名。熔断时不执行 fn，返回 circuitbreaker.ErrOpen
+//
+//	err := dao.Guard("online", func() *gorm.DB { return conn.Find(&records) })
+func Guard(name string, fn func() *gorm.DB) error {
+	return breakers.Execute(name, func() error {
+		return fn().Error
+	})
+}
+
+// BreakerStates 各个库熔断器的当前状态，用于监控
+func BreakerStates() map[string]circuitbreaker.State {
+	return breakers.States()
+}
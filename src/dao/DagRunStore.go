@@ -0,0 +1,141 @@
+package dao
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/shark/src/util/scheduler"
+)
+
+// DagRun 任务图的一次执行，对应 dag_run 表
+type DagRun struct {
+	RunId     string `gorm:"primary_key;size:64"`
+	Name      string `gorm:"size:128;index"`
+	State     string `gorm:"size:16"`
+	StartTime *time.Time
+	EndTime   *time.Time
+}
+
+// DagTaskInstance 一次执行中单个任务的状态，对应 dag_task_instance 表
+type DagTaskInstance struct {
+	RunId     string `gorm:"primary_key;size:64"`
+	TaskName  string `gorm:"primary_key;size:128"`
+	State     string `gorm:"size:16"`
+	Attempts  int
+	Error     string `gorm:"type:text"`
+	Branch    string `gorm:"size:1024"` // 分支任务选中的下游，逗号分隔
+	IsBranch  bool   // 是否分支任务，用来区分没有选中任何下游和普通任务
+	StartTime *time.Time
+	EndTime   *time.Time
+}
+
+// MySQLRunStore 把任务图的执行状态存到 mysql，实现 scheduler.RunStore，多个进程可以共享执行记录。
+// 所有操作都经过 "dag" 熔断器，数据库故障时快速失败，scheduler 只打日志，不影响任务执行
+type MySQLRunStore struct {
+	db *gorm.DB
+}
+
+// NewMySQLRunStore 创建存储，并自动建表
+func NewMySQLRunStore(db *gorm.DB) (*MySQLRunStore, error) {
+	if err := db.AutoMigrate(&DagRun{}, &DagTaskInstance{}).Error; err != nil {
+		return nil, err
+	}
+	return &MySQLRunStore{db: db}, nil
+}
+
+func (s *MySQLRunStore) SaveRun(run *scheduler.RunRecord) error {
+	row := DagRun{
+		RunId:     run.RunID,
+		Name:      run.Name,
+		State:     string(run.State),
+		StartTime: timePtr(run.Start),
+		EndTime:   timePtr(run.End),
+	}
+	return Guard("dag", func() *gorm.DB { return s.db.Save(&row) })
+}
+
+func (s *MySQLRunStore) SaveTask(runID string, task *scheduler.TaskRecord) error {
+	row := DagTaskInstance{
+		RunId:     runID,
+		TaskName:  task.Name,
+		State:     string(task.State),
+		Attempts:  task.Attempts,
+		Error:     task.Err,
+		Branch:    strings.Join(task.Branch, ","),
+		IsBranch:  task.IsBranch,
+		StartTime: timePtr(task.Start),
+		EndTime:   timePtr(task.End),
+	}
+	return Guard("dag", func() *gorm.DB { return s.db.Save(&row) })
+}
+
+func (s *MySQLRunStore) LoadRun(runID string) (*scheduler.RunRecord, error) {
+	var row DagRun
+	err := Guard("dag", func() *gorm.DB { return s.db.Where("run_id = ?", runID).First(&row) })
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, scheduler.ErrRunNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var tasks []DagTaskInstance
+	if err := Guard("dag", func() *gorm.DB { return s.db.Where("run_id = ?", runID).Find(&tasks) }); err != nil {
+		return nil, err
+	}
+	run := toRunRecord(row)
+	run.Tasks = make(map[string]*scheduler.TaskRecord, len(tasks))
+	for _, t := range tasks {
+		rec := &scheduler.TaskRecord{
+			Name:     t.TaskName,
+			State:    scheduler.TaskState(t.State),
+			Attempts: t.Attempts,
+			Err:      t.Error,
+			IsBranch: t.IsBranch,
+			Start:    timeValue(t.StartTime),
+			End:      timeValue(t.EndTime),
+		}
+		if t.Branch != "" {
+			rec.Branch = strings.Split(t.Branch, ",")
+		}
+		run.Tasks[t.TaskName] = rec
+	}
+	return run, nil
+}
+
+func (s *MySQLRunStore) ListRuns() ([]*scheduler.RunRecord, error) {
+	var rows []DagRun
+	if err := Guard("dag", func() *gorm.DB { return s.db.Order("start_time desc, run_id desc").Find(&rows) }); err != nil {
+		return nil, err
+	}
+	runs := make([]*scheduler.RunRecord, 0, len(rows))
+	for _, row := range rows {
+		runs = append(runs, toRunRecord(row))
+	}
+	return runs, nil
+}
+
+func toRunRecord(row DagRun) *scheduler.RunRecord {
+	return &scheduler.RunRecord{
+		RunID: row.RunId,
+		Name:  row.Name,
+		State: scheduler.RunState(row.State),
+		Start: timeValue(row.StartTime),
+		End:   timeValue(row.EndTime),
+	}
+}
+
+// mysql 严格模式下不能写入 0000-00-00，零值时间存成 NULL
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func timeValue(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
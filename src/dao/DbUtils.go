@@ -26,6 +26,8 @@ func QueryTaskList() []model.CustomUserProfileTag {
 	conf := config.Config().Dbs["online"]
 	conn := InitConn(conf.Username, conf.Password, conf.Host, conf.Database, conf.Port)
 	var records = make([]model.CustomUserProfileTag, 0)
-	conn.Find(&records)
+	if err := Guard("online", func() *gorm.DB { return conn.Find(&records) }); err != nil {
+		log.Println("query task list error ", err)
+	}
 	return records
 }
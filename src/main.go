@@ -2,6 +2,10 @@ package main
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/shark/src/util/ratelimiter"
+	"github.com/shark/src/util/ratelimiter/middleware"
+	"github.com/shark/src/util/scheduler"
+	"github.com/shark/src/util/scheduler/dagweb"
 	"log"
 	"net/http"
 )
@@ -9,6 +13,14 @@ import (
 func main() {
 
 	r := gin.Default()
+
+	// 限流：上传接口每个 ip 每分钟 10 次，其余接口每个 ip 每秒 100 次
+	uploadLimiter, _ := ratelimiter.NewLocalLimiter(ratelimiter.PerMinute(10))
+	defaultLimiter, _ := ratelimiter.NewLocalLimiter(ratelimiter.PerSecond(100))
+	r.Use(middleware.Gin(middleware.GinKeyByIP(),
+		middleware.Rule{Route: "/upload*", Method: http.MethodPost, Limiter: uploadLimiter},
+		middleware.Rule{Route: "*", Limiter: defaultLimiter},
+	))
 	r.GET("/", func(c *gin.Context) {
 		c.String(200, "Hello, Geektutu")
 	})
@@ -124,5 +136,18 @@ func main() {
 		})
 	})
 
+	// 任务图执行状态：dagctl run -store data/dag_runs 的执行记录，conf/dags 下的定义用来画依赖关系
+	// $ curl http://localhost:8080/dags/runs
+	// 浏览器打开 http://localhost:8080/dags/runs/<run_id>/view
+	dagStore, err := scheduler.NewFileStore("data/dag_runs")
+	if err != nil {
+		log.Fatal(err)
+	}
+	dags := dagweb.NewServer(dagStore)
+	if err := dags.LoadDefinitions("conf/dags", scheduler.DefaultRegistry); err != nil {
+		log.Println("load dag definitions error ", err)
+	}
+	dags.Register(r.Group("/dags"))
+
 	r.Run()
 }
@@ -3,6 +3,7 @@ package rpc
 import (
 	"context"
 	"github.com/shark/src/rpc/proto/greeter"
+	"github.com/shark/src/util/ratelimiter/middleware"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/health/grpc_health_v1"
@@ -66,7 +67,11 @@ func GreeterSerice() {
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
-	s := grpc.NewServer()
+	rules := rateLimitRules()
+	s := grpc.NewServer(
+		grpc.UnaryInterceptor(middleware.UnaryServerInterceptor(middleware.GrpcKeyByPeerIP(), rules...)),
+		grpc.StreamInterceptor(middleware.StreamServerInterceptor(middleware.GrpcKeyByPeerIP(), rules...)),
+	)
 	helloworld.RegisterGreeterService(s, &helloworld.GreeterService{Say2Hello: Say2Hello})
 	grpc_health_v1.RegisterHealthServer(s, &healthServer{})
 	// Register reflection service on gRPC server.
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/shark/src/rpc/proto/product"
+	"github.com/shark/src/util/ratelimiter/middleware"
 	"google.golang.org/grpc"
 	"log"
 	"net"
@@ -31,7 +32,11 @@ func QueryBatchProdInfoDetail(req *ProductSercice.ProdctInfo, stream ProductSerc
 
 func NewProductServer() {
 	fmt.Println("server begin .. start !!!!")
-	rpcServer := grpc.NewServer()
+	rules := rateLimitRules()
+	rpcServer := grpc.NewServer(
+		grpc.UnaryInterceptor(middleware.UnaryServerInterceptor(middleware.GrpcKeyByPeerIP(), rules...)),
+		grpc.StreamInterceptor(middleware.StreamServerInterceptor(middleware.GrpcKeyByPeerIP(), rules...)),
+	)
 	// 注册服务
 	ProductSercice.RegisterProductServiceService(rpcServer, &ProductSercice.ProductServiceService{QueryProdInfoDetail: QueryProdInfoDetail})
 	lis, _ := net.Listen("tcp", ":8082")
@@ -2,6 +2,8 @@ package rpc
 
 import (
 	pb "github.com/shark/src/rpc/proto"
+	"github.com/shark/src/util/ratelimiter"
+	"github.com/shark/src/util/ratelimiter/middleware"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"log"
@@ -26,9 +28,18 @@ func StartServer() {
 		log.Fatalf("failed to listen: %v", err)
 	}
 
-	s := grpc.NewServer()
+	s := grpc.NewServer(grpc.UnaryInterceptor(middleware.UnaryServerInterceptor(middleware.GrpcKeyByPeerIP(), rateLimitRules()...)))
 	grpc.EnableTracing = true
 	pb.RegisterGreeterServer(s, &server{})
 	log.Println("rpc服务已经开启")
 	s.Serve(lis)
 }
+
+// rpc 服务的限流规则：每个调用方 ip 每秒 200 次
+func rateLimitRules() []middleware.Rule {
+	limiter, err := ratelimiter.NewLocalLimiter(ratelimiter.PerSecond(200))
+	if err != nil {
+		log.Fatalf("invalid rate limit: %v", err)
+	}
+	return []middleware.Rule{{Route: "*", Limiter: limiter}}
+}
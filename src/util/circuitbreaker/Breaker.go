@@ -0,0 +1,297 @@
+package circuitbreaker
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/shark/src/util/ratelimiter"
+)
+
+// 熔断器：下游（mysql、kafka、es、grpc 服务）出故障时，调用方继续请求只会堆积超时、拖垮自己。
+// 熔断器统计最近一段时间的失败率和慢调用比例，超过阈值就"断开"，在一段时间内直接拒绝请求，给下游恢复的时间。
+//
+//	Closed   正常放行，在滑动窗口内统计失败率、慢调用率，超过阈值 -> Open
+//	Open     直接拒绝，返回 ErrOpen，经过 OpenTimeout -> HalfOpen
+//	HalfOpen 放行最多 HalfOpenMaxCalls 个探测请求，全部成功 -> Closed，任何一个失败 -> Open
+
+var (
+	ErrOpen            = errors.New("circuitbreaker: circuit breaker is open")
+	ErrTooManyRequests = errors.New("circuitbreaker: too many requests in half-open state")
+)
+
+// State 熔断器状态
+type State int
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("unknown state: %d", int(s))
+	}
+}
+
+// Config 熔断器配置，零值字段使用默认值
+type Config struct {
+	Name string
+	// Window 统计失败率的滑动窗口，默认 10s，按 1s 分桶
+	Window time.Duration
+	// MinRequests 窗口内请求数少于该值时不熔断，避免流量很小时一两个失败就熔断，默认 20
+	MinRequests int64
+	// FailureRateThreshold 失败率阈值，(0, 1]，默认 0.5
+	FailureRateThreshold float64
+	// SlowCallDuration 耗时超过该值视为慢调用，0 表示不统计慢调用
+	SlowCallDuration time.Duration
+	// SlowCallRateThreshold 慢调用比例阈值，(0, 1]，默认 1 即全部是慢调用才熔断
+	SlowCallRateThreshold float64
+	// OpenTimeout 熔断之后多久进入半开状态，默认 5s
+	OpenTimeout time.Duration
+	// HalfOpenMaxCalls 半开状态下放行的探测请求数，默认 5
+	HalfOpenMaxCalls int
+	// IsFailure 判断一次调用是否算失败，默认 err != nil 即失败。参数错误、记录不存在之类的业务错误不应该算失败
+	IsFailure func(err error) bool
+	// OnStateChange 状态变化回调，可以用来打日志、打点报警，在锁外同步调用
+	OnStateChange func(name string, from, to State)
+	// Clock 时钟，测试用
+	Clock func() time.Time
+}
+
+func (c *Config) setDefaults() {
+	if c.Window <= 0 {
+		c.Window = 10 * time.Second
+	}
+	if c.MinRequests <= 0 {
+		c.MinRequests = 20
+	}
+	if c.FailureRateThreshold <= 0 || c.FailureRateThreshold > 1 {
+		c.FailureRateThreshold = 0.5
+	}
+	if c.SlowCallRateThreshold <= 0 || c.SlowCallRateThreshold > 1 {
+		c.SlowCallRateThreshold = 1
+	}
+	if c.OpenTimeout <= 0 {
+		c.OpenTimeout = 5 * time.Second
+	}
+	if c.HalfOpenMaxCalls <= 0 {
+		c.HalfOpenMaxCalls = 5
+	}
+	if c.IsFailure == nil {
+		c.IsFailure = func(err error) bool { return err != nil }
+	}
+	if c.Clock == nil {
+		c.Clock = time.Now
+	}
+}
+
+// Counts 当前窗口内的统计
+type Counts struct {
+	Requests  int64
+	Failures  int64
+	SlowCalls int64
+}
+
+// Breaker 熔断器，并发安全
+type Breaker struct {
+	cfg Config
+
+	mu       sync.Mutex
+	state    State
+	openedAt time.Time
+	// generation 每次状态变化加一，上一个状态下发出的请求结束时不再计入统计
+	generation uint64
+	failures   *ratelimiter.Window // 每个请求记录 1（失败）或 0（成功），均值即失败率
+	slowCalls  *ratelimiter.Window // 每个请求记录 1（慢调用）或 0
+	// 半开状态下已放行、已成功的探测请求数
+	probes    int
+	successes int
+}
+
+// New 创建熔断器
+func New(cfg Config) *Breaker {
+	cfg.setDefaults()
+	tick := time.Second
+	if cfg.Window <= tick || cfg.Window%tick != 0 {
+		tick = cfg.Window / 10
+		cfg.Window = tick * 10
+	}
+	newWindow := func() *ratelimiter.Window {
+		win, err := ratelimiter.NewWindow(cfg.Window, tick, ratelimiter.WithClock(cfg.Clock), ratelimiter.WithHistogram(0))
+		if err != nil {
+			panic(err) // 上面已经保证了 window 是 tick 的整数倍
+		}
+		return win
+	}
+	return &Breaker{cfg: cfg, failures: newWindow(), slowCalls: newWindow()}
+}
+
+// Name 熔断器名称
+func (b *Breaker) Name() string {
+	return b.cfg.Name
+}
+
+// State 当前状态
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	state, change := b.currentState()
+	b.mu.Unlock()
+	b.notify(change)
+	return state
+}
+
+// Counts 当前窗口内的请求数、失败数、慢调用数
+func (b *Breaker) Counts() Counts {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	failures, slowCalls := b.failures.Snapshot(), b.slowCalls.Snapshot()
+	return Counts{Requests: failures.Count, Failures: int64(failures.Sum), SlowCalls: int64(slowCalls.Sum)}
+}
+
+// Allow 两段式调用：先 Allow 判断能否放行，请求结束后调用返回的 done 上报结果。
+// 被拒绝时返回 ErrOpen 或 ErrTooManyRequests；放行时 done 必须调用且只调用一次
+//
+//	done, err := breaker.Allow()
+//	if err != nil { return err }
+//	err = call()
+//	done(err)
+func (b *Breaker) Allow() (done func(err error), err error) {
+	b.mu.Lock()
+	state, change := b.currentState()
+	switch state {
+	case StateOpen:
+		err = ErrOpen
+	case StateHalfOpen:
+		if b.probes >= b.cfg.HalfOpenMaxCalls {
+			err = ErrTooManyRequests
+		} else {
+			b.probes++
+		}
+	}
+	generation := b.generation
+	b.mu.Unlock()
+	b.notify(change)
+	if err != nil {
+		return nil, err
+	}
+
+	start := b.cfg.Clock()
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() { b.onResult(generation, b.cfg.Clock().Sub(start), err) })
+	}, nil
+}
+
+// Execute 在熔断器保护下执行 fn，熔断时不执行 fn，直接返回 ErrOpen / ErrTooManyRequests
+func (b *Breaker) Execute(fn func() error) error {
+	done, err := b.Allow()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// fn panic 也算一次失败，然后继续向上抛
+		if e := recover(); e != nil {
+			done(fmt.Errorf("panic: %v", e))
+			panic(e)
+		}
+	}()
+	err = fn()
+	done(err)
+	return err
+}
+
+func (b *Breaker) onResult(generation uint64, elapsed time.Duration, err error) {
+	failed := b.cfg.IsFailure(err)
+	slow := b.cfg.SlowCallDuration > 0 && elapsed > b.cfg.SlowCallDuration
+
+	b.mu.Lock()
+	state, change := b.currentState()
+	if generation != b.generation {
+		// 状态已经变了，旧状态下发出的请求结果不再计入
+		b.mu.Unlock()
+		b.notify(change)
+		return
+	}
+	switch state {
+	case StateClosed:
+		b.failures.Record(boolToFloat(failed))
+		b.slowCalls.Record(boolToFloat(slow))
+		if b.shouldTrip() {
+			change = b.setState(StateOpen)
+		}
+	case StateHalfOpen:
+		if failed || slow {
+			change = b.setState(StateOpen)
+			break
+		}
+		b.successes++
+		if b.successes >= b.cfg.HalfOpenMaxCalls {
+			change = b.setState(StateClosed)
+		}
+	}
+	b.mu.Unlock()
+	b.notify(change)
+}
+
+func (b *Breaker) shouldTrip() bool {
+	failures := b.failures.Snapshot()
+	if failures.Count < b.cfg.MinRequests {
+		return false
+	}
+	if failures.Mean >= b.cfg.FailureRateThreshold {
+		return true
+	}
+	return b.cfg.SlowCallDuration > 0 && b.slowCalls.Mean() >= b.cfg.SlowCallRateThreshold
+}
+
+// currentState 熔断时间到了之后从 Open 切换到 HalfOpen，调用方持有锁
+func (b *Breaker) currentState() (State, *stateChange) {
+	if b.state == StateOpen && !b.cfg.Clock().Before(b.openedAt.Add(b.cfg.OpenTimeout)) {
+		return StateHalfOpen, b.setState(StateHalfOpen)
+	}
+	return b.state, nil
+}
+
+type stateChange struct {
+	from, to State
+}
+
+// setState 切换状态并重置统计，返回的 stateChange 由调用方在锁外通知，调用方持有锁
+func (b *Breaker) setState(to State) *stateChange {
+	from := b.state
+	if from == to {
+		return nil
+	}
+	b.state = to
+	b.generation++
+	b.probes, b.successes = 0, 0
+	b.failures.Reset()
+	b.slowCalls.Reset()
+	if to == StateOpen {
+		b.openedAt = b.cfg.Clock()
+	}
+	return &stateChange{from: from, to: to}
+}
+
+func (b *Breaker) notify(change *stateChange) {
+	if change != nil && b.cfg.OnStateChange != nil {
+		b.cfg.OnStateChange(b.cfg.Name, change.from, change.to)
+	}
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,56 @@
+package circuitbreaker
+
+import "sync"
+
+// Group 按名字管理一组共用配置的熔断器，例如每个 grpc 方法、每个数据库各一个，互不影响
+type Group struct {
+	cfg      Config
+	mu       sync.RWMutex
+	breakers map[string]*Breaker
+}
+
+// NewGroup 创建熔断器组，cfg.Name 会被每个熔断器的名字覆盖
+func NewGroup(cfg Config) *Group {
+	return &Group{cfg: cfg, breakers: make(map[string]*Breaker)}
+}
+
+// Get 获取名字对应的熔断器，不存在时创建
+func (g *Group) Get(name string) *Breaker {
+	g.mu.RLock()
+	b, ok := g.breakers[name]
+	g.mu.RUnlock()
+	if ok {
+		return b
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if b, ok = g.breakers[name]; !ok {
+		cfg := g.cfg
+		cfg.Name = name
+		b = New(cfg)
+		g.breakers[name] = b
+	}
+	return b
+}
+
+// Execute 在名字对应的熔断器保护下执行 fn
+func (g *Group) Execute(name string, fn func() error) error {
+	return g.Get(name).Execute(fn)
+}
+
+// States 所有熔断器的当前状态，用于监控
+func (g *Group) States() map[string]State {
+	g.mu.RLock()
+	breakers := make([]*Breaker, 0, len(g.breakers))
+	for _, b := range g.breakers {
+		breakers = append(breakers, b)
+	}
+	g.mu.RUnlock()
+
+	states := make(map[string]State, len(breakers))
+	for _, b := range breakers {
+		states[b.Name()] = b.State()
+	}
+	return states
+}
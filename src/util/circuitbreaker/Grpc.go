@@ -0,0 +1,65 @@
+package circuitbreaker
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// IsGrpcFailure 只有说明下游出了问题的状态码才算失败，参数错误、资源不存在等是调用方的问题，不应该触发熔断
+func IsGrpcFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Internal, codes.Unknown, codes.DataLoss:
+		return true
+	default:
+		return false
+	}
+}
+
+// UnaryClientInterceptor grpc 客户端熔断拦截器，每个方法一个熔断器，熔断时直接返回 UNAVAILABLE，不再发请求。
+// group 的 IsFailure 为空时按 IsGrpcFailure 判断失败，只影响经过拦截器的调用，不修改 group 的配置
+//
+//	breakers := circuitbreaker.NewGroup(circuitbreaker.Config{SlowCallDuration: time.Second})
+//	grpc.Dial(addr, grpc.WithUnaryInterceptor(circuitbreaker.UnaryClientInterceptor(breakers)))
+func UnaryClientInterceptor(g *Group) grpc.UnaryClientInterceptor {
+	report := grpcReport(g)
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		done, err := g.Get(method).Allow()
+		if err != nil {
+			return status.Errorf(codes.Unavailable, "%v, method: %s", err, method)
+		}
+		err = invoker(ctx, method, req, reply, cc, opts...)
+		done(report(err))
+		return err
+	}
+}
+
+// StreamClientInterceptor grpc 客户端 stream 熔断拦截器，只统计建立 stream 是否成功
+func StreamClientInterceptor(g *Group) grpc.StreamClientInterceptor {
+	report := grpcReport(g)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		done, err := g.Get(method).Allow()
+		if err != nil {
+			return nil, status.Errorf(codes.Unavailable, "%v, method: %s", err, method)
+		}
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		done(report(err))
+		return cs, err
+	}
+}
+
+// grpcReport 返回上报给熔断器的错误。group 配置了 IsFailure 时原样上报由它判断，
+// 否则不算失败的状态码按成功上报，group 默认的 err != nil 判断就等价于 IsGrpcFailure
+func grpcReport(g *Group) func(err error) error {
+	if g.cfg.IsFailure != nil {
+		return func(err error) error { return err }
+	}
+	return func(err error) error {
+		if IsGrpcFailure(err) {
+			return err
+		}
+		return nil
+	}
+}
@@ -0,0 +1,240 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errDown = errors.New("downstream is down")
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1600000000, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+type transition struct {
+	from, to State
+}
+
+func newBreaker(clock *fakeClock, transitions *[]transition) *Breaker {
+	return New(Config{
+		Name:             "test",
+		MinRequests:      10,
+		OpenTimeout:      5 * time.Second,
+		HalfOpenMaxCalls: 2,
+		SlowCallDuration: 100 * time.Millisecond,
+		Clock:            clock.Now,
+		OnStateChange: func(name string, from, to State) {
+			*transitions = append(*transitions, transition{from, to})
+		},
+	})
+}
+
+func TestBreaker_Lifecycle(t *testing.T) {
+	clock := newFakeClock()
+	var transitions []transition
+	b := newBreaker(clock, &transitions)
+
+	// 请求数不够 MinRequests，全部失败也不熔断
+	for i := 0; i < 9; i++ {
+		b.Execute(func() error { return errDown })
+	}
+	if b.State() != StateClosed {
+		t.Fatalf("should stay closed below MinRequests, got %s", b.State())
+	}
+	// 第 10 个请求，失败率 100% 超过 50%
+	b.Execute(func() error { return errDown })
+	if b.State() != StateOpen {
+		t.Fatalf("should trip, got %s", b.State())
+	}
+
+	called := false
+	if err := b.Execute(func() error { called = true; return nil }); err != ErrOpen || called {
+		t.Fatalf("open breaker should reject without calling fn, err %v", err)
+	}
+
+	// 熔断时间到了进入半开，最多放行 2 个探测请求
+	clock.Advance(5 * time.Second)
+	if b.State() != StateHalfOpen {
+		t.Fatalf("want half-open got %s", b.State())
+	}
+	done1, err := b.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done2, err := b.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Allow(); err != ErrTooManyRequests {
+		t.Fatalf("third probe want ErrTooManyRequests got %v", err)
+	}
+	done1(nil)
+	done2(nil)
+	if b.State() != StateClosed {
+		t.Fatalf("probes succeeded, want closed got %s", b.State())
+	}
+
+	want := []transition{{StateClosed, StateOpen}, {StateOpen, StateHalfOpen}, {StateHalfOpen, StateClosed}}
+	if len(transitions) != len(want) {
+		t.Fatalf("transitions want %v got %v", want, transitions)
+	}
+	for i := range want {
+		if transitions[i] != want[i] {
+			t.Fatalf("transitions want %v got %v", want, transitions)
+		}
+	}
+}
+
+func TestBreaker_HalfOpenFailure(t *testing.T) {
+	clock := newFakeClock()
+	var transitions []transition
+	b := newBreaker(clock, &transitions)
+	for i := 0; i < 10; i++ {
+		b.Execute(func() error { return errDown })
+	}
+	clock.Advance(5 * time.Second)
+	if err := b.Execute(func() error { return errDown }); err != errDown {
+		t.Fatalf("probe should be called, got %v", err)
+	}
+	if b.State() != StateOpen {
+		t.Fatalf("failed probe should reopen, got %s", b.State())
+	}
+	// 重新计时
+	clock.Advance(4 * time.Second)
+	if b.State() != StateOpen {
+		t.Fatalf("open timeout should restart, got %s", b.State())
+	}
+}
+
+func TestBreaker_SlowCalls(t *testing.T) {
+	clock := newFakeClock()
+	var transitions []transition
+	b := newBreaker(clock, &transitions)
+	for i := 0; i < 10; i++ {
+		err := b.Execute(func() error {
+			clock.Advance(200 * time.Millisecond)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if b.State() != StateOpen {
+		t.Fatalf("all calls are slow, want open got %s", b.State())
+	}
+}
+
+func TestBreaker_WindowSlides(t *testing.T) {
+	clock := newFakeClock()
+	var transitions []transition
+	b := newBreaker(clock, &transitions)
+	// 失败分散在窗口之外，不会累积到阈值
+	for i := 0; i < 30; i++ {
+		if i%3 == 0 {
+			b.Execute(func() error { return errDown })
+		} else {
+			b.Execute(func() error { return nil })
+		}
+		clock.Advance(time.Second)
+	}
+	if b.State() != StateClosed {
+		t.Fatalf("failure rate 33%% should not trip, got %s", b.State())
+	}
+	// 窗口只保留最近 10 秒，当前这一秒还没有请求
+	if c := b.Counts(); c.Requests != 9 {
+		t.Fatalf("window should keep last 10 seconds, got %+v", c)
+	}
+}
+
+func TestBreaker_StaleResultIgnored(t *testing.T) {
+	clock := newFakeClock()
+	var transitions []transition
+	b := newBreaker(clock, &transitions)
+	// 熔断之前发出的慢请求在熔断之后才返回，不能影响半开状态的判断
+	done, _ := b.Allow()
+	for i := 0; i < 10; i++ {
+		b.Execute(func() error { return errDown })
+	}
+	clock.Advance(5 * time.Second)
+	done(errDown)
+	if b.State() != StateHalfOpen {
+		t.Fatalf("stale result should be ignored, got %s", b.State())
+	}
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	clock := newFakeClock()
+	g := NewGroup(Config{MinRequests: 2, Clock: clock.Now})
+	interceptor := UnaryClientInterceptor(g)
+	calls := 0
+	invoke := func(method string, code codes.Code) error {
+		return interceptor(context.Background(), method, nil, nil, nil,
+			func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				calls++
+				return status.Error(code, "err")
+			})
+	}
+
+	// 业务错误不算失败
+	for i := 0; i < 5; i++ {
+		invoke("/helloworld.Greeter/SayHello", codes.InvalidArgument)
+	}
+	if g.Get("/helloworld.Greeter/SayHello").State() != StateClosed {
+		t.Fatal("InvalidArgument should not trip the breaker")
+	}
+
+	invoke("/ProductService/QueryProdInfoDetail", codes.Unavailable)
+	invoke("/ProductService/QueryProdInfoDetail", codes.Unavailable)
+	calls = 0
+	err := invoke("/ProductService/QueryProdInfoDetail", codes.OK)
+	if status.Code(err) != codes.Unavailable || calls != 0 {
+		t.Fatalf("open breaker should fail fast with UNAVAILABLE, got %v, calls %d", err, calls)
+	}
+	// 每个方法一个熔断器
+	if err := invoke("/helloworld.Greeter/SayHello", codes.OK); err != nil {
+		t.Fatalf("other method should not be affected, got %v", err)
+	}
+	states := g.States()
+	if states["/ProductService/QueryProdInfoDetail"] != StateOpen || states["/helloworld.Greeter/SayHello"] != StateClosed {
+		t.Fatalf("unexpected states %v", states)
+	}
+}
+
+func TestUnaryClientInterceptor_GroupConfigUntouched(t *testing.T) {
+	clock := newFakeClock()
+	g := NewGroup(Config{MinRequests: 2, Clock: clock.Now})
+	UnaryClientInterceptor(g)
+	StreamClientInterceptor(g)
+	// 不经过拦截器的调用仍然按默认的 err != nil 判断失败
+	invalid := status.Error(codes.InvalidArgument, "bad request")
+	for i := 0; i < 2; i++ {
+		g.Execute("mysql", func() error { return invalid })
+	}
+	if g.Get("mysql").State() != StateOpen {
+		t.Fatal("building grpc interceptors should not change the group's IsFailure")
+	}
+}
@@ -108,6 +108,8 @@ type (
 
 	// WorkPool implements a work pool with the specified concurrency level and queue capacity.
 	// WorkPool 是代表工作池的公共类型。它实现了两个 channel。
+	//
+	// Deprecated: 使用 github.com/shark/src/util/workerpool.Pool
 	WorkPool struct {
 		shutdownQueueChannel chan string    // Channel used to shut down the queue routine.
 		shutdownWorkChannel  chan struct{}  // Channel used to shut down the work routines.
@@ -0,0 +1,287 @@
+package dag
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Graph 有向图，m[node] 为 node 的前置依赖，和 DagSort 的输入一致。
+// 和 DagSort 不同，依赖了不存在的节点会在 New 时报错，有环时 Layers、Sort 等返回 CycleError 和环上的路径
+type Graph struct {
+	deps       map[string][]string // 节点 -> 前置依赖，去重排序
+	dependents map[string][]string // 节点 -> 直接下游，排序
+	nodes      []string            // 所有节点，排序
+}
+
+// MissingError 依赖了图中不存在的节点
+type MissingError struct {
+	Node string
+	Dep  string
+}
+
+func (e *MissingError) Error() string {
+	return fmt.Sprintf("dag: %s depends on unknown node %s", e.Node, e.Dep)
+}
+
+// CycleError 图中有环，Path 为环上的节点，首尾相同，按依赖方向排列：a -> b 表示 b 依赖 a
+type CycleError struct {
+	Path []string
+}
+
+func (e *CycleError) Error() string {
+	return "dag: cycle " + strings.Join(e.Path, " -> ")
+}
+
+// New 根据依赖关系创建图，m 不会被修改
+func New(m map[string][]string) (*Graph, error) {
+	g := &Graph{
+		deps:       make(map[string][]string, len(m)),
+		dependents: make(map[string][]string, len(m)),
+	}
+	for node := range m {
+		g.nodes = append(g.nodes, node)
+	}
+	sort.Strings(g.nodes)
+	for _, node := range g.nodes {
+		seen := make(map[string]bool, len(m[node]))
+		var deps []string
+		for _, dep := range m[node] {
+			if seen[dep] {
+				continue
+			}
+			if _, ok := m[dep]; !ok {
+				return nil, &MissingError{Node: node, Dep: dep}
+			}
+			seen[dep] = true
+			deps = append(deps, dep)
+		}
+		sort.Strings(deps)
+		g.deps[node] = deps
+		for _, dep := range deps {
+			g.dependents[dep] = append(g.dependents[dep], node)
+		}
+	}
+	// nodes 有序，dependents 按 node 的顺序追加，已经是有序的
+	return g, nil
+}
+
+// Nodes 所有节点，按名字排序
+func (g *Graph) Nodes() []string {
+	return append([]string(nil), g.nodes...)
+}
+
+// Has 节点是否存在
+func (g *Graph) Has(node string) bool {
+	_, ok := g.deps[node]
+	return ok
+}
+
+// Deps 节点的前置依赖
+func (g *Graph) Deps(node string) []string {
+	return append([]string(nil), g.deps[node]...)
+}
+
+// Dependents 节点的直接下游
+func (g *Graph) Dependents(node string) []string {
+	return append([]string(nil), g.dependents[node]...)
+}
+
+// Layers Kahn 算法分层：第 0 层没有依赖，第 i 层的节点只依赖前 i 层，同一层之间没有依赖，可以并行执行。
+// 每个节点所在的层等于它最长依赖链的长度，层内按名字排序
+func (g *Graph) Layers() ([][]string, error) {
+	remaining := make(map[string]int, len(g.nodes))
+	var layer []string
+	for _, node := range g.nodes {
+		remaining[node] = len(g.deps[node])
+		if remaining[node] == 0 {
+			layer = append(layer, node)
+		}
+	}
+	var layers [][]string
+	visited := 0
+	for len(layer) > 0 {
+		layers = append(layers, layer)
+		visited += len(layer)
+		var next []string
+		for _, node := range layer {
+			for _, d := range g.dependents[node] {
+				remaining[d]--
+				if remaining[d] == 0 {
+					next = append(next, d)
+				}
+			}
+		}
+		sort.Strings(next)
+		layer = next
+	}
+	if visited != len(g.nodes) {
+		return nil, &CycleError{Path: g.FindCycle()}
+	}
+	return layers, nil
+}
+
+// Sort 拓扑序，依赖总是排在前面，即 Layers 按层展开
+func (g *Graph) Sort() ([]string, error) {
+	layers, err := g.Layers()
+	if err != nil {
+		return nil, err
+	}
+	order := make([]string, 0, len(g.nodes))
+	for _, layer := range layers {
+		order = append(order, layer...)
+	}
+	return order, nil
+}
+
+// FindCycle 返回一个环，首尾节点相同，没有环时返回 nil
+func (g *Graph) FindCycle() []string {
+	const (
+		white = iota // 未访问
+		gray         // 在当前 dfs 路径上
+		black        // 已经访问完，从它出发没有环
+	)
+	color := make(map[string]int, len(g.nodes))
+	var stack []string
+	var cycle []string
+	var visit func(node string) bool
+	visit = func(node string) bool {
+		color[node] = gray
+		stack = append(stack, node)
+		for _, next := range g.dependents[node] {
+			switch color[next] {
+			case gray:
+				// next 在栈上，从 next 到栈顶再回到 next 就是环
+				for i := len(stack) - 1; i >= 0; i-- {
+					if stack[i] == next {
+						cycle = append(append([]string(nil), stack[i:]...), next)
+						return true
+					}
+				}
+			case white:
+				if visit(next) {
+					return true
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		color[node] = black
+		return false
+	}
+	for _, node := range g.nodes {
+		if color[node] == white && visit(node) {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// Ancestors 节点所有直接和间接的上游，不包含自己，按名字排序
+func (g *Graph) Ancestors(node string) []string {
+	return g.walk(node, g.deps)
+}
+
+// Descendants 节点所有直接和间接的下游，不包含自己，按名字排序。部分重跑时需要重跑这些节点
+func (g *Graph) Descendants(node string) []string {
+	return g.walk(node, g.dependents)
+}
+
+func (g *Graph) walk(node string, edges map[string][]string) []string {
+	if !g.Has(node) {
+		return nil
+	}
+	seen := map[string]bool{node: true}
+	queue := []string{node}
+	var res []string
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, next := range edges[cur] {
+			if !seen[next] {
+				seen[next] = true
+				res = append(res, next)
+				queue = append(queue, next)
+			}
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// TransitiveReduction 传递规约：去掉可以通过其它路径到达的依赖，例如 c 依赖 a、b，b 依赖 a，则去掉 c -> a。
+// 节点和可达关系不变，只对无环图有意义
+func (g *Graph) TransitiveReduction() (*Graph, error) {
+	order, err := g.Sort()
+	if err != nil {
+		return nil, err
+	}
+	// 按拓扑序计算每个节点的所有上游
+	ancestors := make(map[string]map[string]bool, len(order))
+	for _, node := range order {
+		set := make(map[string]bool)
+		for _, dep := range g.deps[node] {
+			set[dep] = true
+			for a := range ancestors[dep] {
+				set[a] = true
+			}
+		}
+		ancestors[node] = set
+	}
+	m := make(map[string][]string, len(order))
+	for _, node := range order {
+		deps := g.deps[node]
+		kept := []string{}
+		for _, dep := range deps {
+			redundant := false
+			for _, other := range deps {
+				if other != dep && ancestors[other][dep] {
+					redundant = true
+					break
+				}
+			}
+			if !redundant {
+				kept = append(kept, dep)
+			}
+		}
+		m[node] = kept
+	}
+	return New(m)
+}
+
+// CriticalPath 关键路径：节点权重（例如任务的耗时）之和最大的依赖链，决定了整个图执行完的最短时间。
+// 没有权重的节点按 0 计算，返回路径（按依赖方向）和路径的总权重
+func (g *Graph) CriticalPath(weights map[string]float64) ([]string, float64, error) {
+	order, err := g.Sort()
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(order) == 0 {
+		return nil, 0, nil
+	}
+	dist := make(map[string]float64, len(order)) // 以节点结尾的最长路径
+	prev := make(map[string]string, len(order))
+	for _, node := range order {
+		best, from := 0.0, ""
+		for _, dep := range g.deps[node] {
+			if from == "" || dist[dep] > best {
+				best, from = dist[dep], dep
+			}
+		}
+		dist[node] = best + weights[node]
+		prev[node] = from
+	}
+	end := order[0]
+	for _, node := range order {
+		if dist[node] > dist[end] {
+			end = node
+		}
+	}
+	var path []string
+	for node := end; node != ""; node = prev[node] {
+		path = append(path, node)
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path, dist[end], nil
+}
@@ -0,0 +1,125 @@
+package dag
+
+import (
+	"reflect"
+	"testing"
+)
+
+// etl 数据流程：extract -> clean -> (tag, stat) -> load，load 多余地直接依赖了 extract
+func etl() map[string][]string {
+	return map[string][]string{
+		"extract": nil,
+		"clean":   {"extract"},
+		"tag":     {"clean"},
+		"stat":    {"clean", "extract"},
+		"load":    {"tag", "stat", "extract"},
+		"notify":  nil,
+	}
+}
+
+func TestGraph_Layers(t *testing.T) {
+	g, err := New(etl())
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers, err := g.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"extract", "notify"}, {"clean"}, {"stat", "tag"}, {"load"}}
+	if !reflect.DeepEqual(layers, want) {
+		t.Fatalf("layers want %v got %v", want, layers)
+	}
+	order, _ := g.Sort()
+	if !reflect.DeepEqual(order, []string{"extract", "notify", "clean", "stat", "tag", "load"}) {
+		t.Fatalf("unexpected order %v", order)
+	}
+}
+
+func TestGraph_Invalid(t *testing.T) {
+	if _, err := New(map[string][]string{"a": {"b"}}); err == nil {
+		t.Fatal("missing node should fail")
+	} else if e, ok := err.(*MissingError); !ok || e.Node != "a" || e.Dep != "b" {
+		t.Fatalf("want MissingError got %v", err)
+	}
+
+	g, err := New(map[string][]string{"a": {"c"}, "b": {"a"}, "c": {"b"}, "d": {"a"}, "e": nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = g.Layers()
+	e, ok := err.(*CycleError)
+	if !ok || !reflect.DeepEqual(e.Path, []string{"a", "b", "c", "a"}) {
+		t.Fatalf("want cycle a -> b -> c -> a got %v", err)
+	}
+	if err.Error() != "dag: cycle a -> b -> c -> a" {
+		t.Fatalf("unexpected message %s", err)
+	}
+	if _, _, err := g.CriticalPath(nil); err == nil {
+		t.Fatal("critical path of cyclic graph should fail")
+	}
+
+	self, _ := New(map[string][]string{"a": {"a"}})
+	if cycle := self.FindCycle(); !reflect.DeepEqual(cycle, []string{"a", "a"}) {
+		t.Fatalf("self loop want [a a] got %v", cycle)
+	}
+	acyclic, _ := New(etl())
+	if cycle := acyclic.FindCycle(); cycle != nil {
+		t.Fatalf("unexpected cycle %v", cycle)
+	}
+}
+
+func TestGraph_Reachability(t *testing.T) {
+	g, _ := New(etl())
+	if got := g.Ancestors("stat"); !reflect.DeepEqual(got, []string{"clean", "extract"}) {
+		t.Fatalf("ancestors of stat got %v", got)
+	}
+	if got := g.Descendants("clean"); !reflect.DeepEqual(got, []string{"load", "stat", "tag"}) {
+		t.Fatalf("descendants of clean got %v", got)
+	}
+	if got := g.Descendants("load"); len(got) != 0 {
+		t.Fatalf("load has no descendants, got %v", got)
+	}
+	if g.Ancestors("nope") != nil {
+		t.Fatal("unknown node should have no ancestors")
+	}
+
+	r, err := g.TransitiveReduction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Deps("load"); !reflect.DeepEqual(got, []string{"stat", "tag"}) {
+		t.Fatalf("reduced deps of load got %v", got)
+	}
+	if got := r.Deps("stat"); !reflect.DeepEqual(got, []string{"clean"}) {
+		t.Fatalf("reduced deps of stat got %v", got)
+	}
+	// 规约不改变可达关系
+	for _, node := range g.Nodes() {
+		if !reflect.DeepEqual(g.Ancestors(node), r.Ancestors(node)) {
+			t.Fatalf("ancestors of %s changed: %v -> %v", node, g.Ancestors(node), r.Ancestors(node))
+		}
+	}
+}
+
+func TestGraph_CriticalPath(t *testing.T) {
+	g, _ := New(etl())
+	weights := map[string]float64{"extract": 3, "clean": 2, "tag": 5, "stat": 1, "load": 1, "notify": 7}
+	path, total, err := g.CriticalPath(weights)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(path, []string{"extract", "clean", "tag", "load"}) || total != 11 {
+		t.Fatalf("critical path got %v %v", path, total)
+	}
+
+	weights["notify"] = 20
+	if path, total, _ = g.CriticalPath(weights); !reflect.DeepEqual(path, []string{"notify"}) || total != 20 {
+		t.Fatalf("critical path got %v %v", path, total)
+	}
+
+	empty, _ := New(nil)
+	if path, total, err := empty.CriticalPath(nil); path != nil || total != 0 || err != nil {
+		t.Fatalf("empty graph got %v %v %v", path, total, err)
+	}
+}
@@ -11,6 +11,7 @@ import (
 显然，图中应该无环，这也就是说从某点出发的边，
 最终不会回到该点。下面的代码用深度优先搜索了整张图，获得了符合要求的课程序列
 dfs思想 --》 拓扑排序
+不检查环和缺失的节点，需要分层、检查环时用 Graph
 */
 func DagSort(m map[string][]string) []string {
 	var order []string
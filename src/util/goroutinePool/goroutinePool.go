@@ -15,6 +15,9 @@ func (task *Task) Execute() {
 	_ = task.f() // 执行任务中已经绑定好的业务方法
 }
 
+// Pool 固定数量的 worker 从 channel 中取任务执行
+//
+// Deprecated: 使用 github.com/shark/src/util/workerpool.Pool
 type Pool struct {
 	EntryChannel chan *Task // 对外的ask入口
 	JobsChannel  chan *Task // 内部的Task队列
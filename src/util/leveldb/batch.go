@@ -0,0 +1,131 @@
+package leveldb
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// batchHeaderSize 8 字节起始 seq + 4 字节记录数
+const batchHeaderSize = 12
+
+// ErrBadBatch 日志中的 WriteBatch 格式不对
+var ErrBadBatch = errors.New("leveldb: bad write batch")
+
+// WriteBatch 一次原子写入的多个操作，编码格式和 leveldb 相同：
+// [8 字节 seq][4 字节记录数] 之后每条记录为 [1 字节类型][varint 长度 + key][varint 长度 + value（删除时没有）]，
+// 第 i 条记录的 seq 为起始 seq + i。整个 batch 作为一条日志记录写入 WAL
+type WriteBatch struct {
+	rep []byte
+}
+
+// NewWriteBatch 创建空的 batch
+func NewWriteBatch() *WriteBatch {
+	return &WriteBatch{rep: make([]byte, batchHeaderSize)}
+}
+
+// DecodeWriteBatch 解析日志中的 batch，只检查头部，记录在 Iterate 时校验
+func DecodeWriteBatch(data []byte) (*WriteBatch, error) {
+	if len(data) < batchHeaderSize {
+		return nil, ErrBadBatch
+	}
+	return &WriteBatch{rep: data}, nil
+}
+
+// Put 写入 key
+func (b *WriteBatch) Put(key, value []byte) {
+	b.setCount(b.Count() + 1)
+	b.rep = append(b.rep, byte(TypeValue))
+	b.rep = appendBytes(b.rep, key)
+	b.rep = appendBytes(b.rep, value)
+}
+
+// Delete 删除 key
+func (b *WriteBatch) Delete(key []byte) {
+	b.setCount(b.Count() + 1)
+	b.rep = append(b.rep, byte(TypeDeletion))
+	b.rep = appendBytes(b.rep, key)
+}
+
+// Clear 清空，可以重复使用
+func (b *WriteBatch) Clear() {
+	b.rep = b.rep[:batchHeaderSize]
+	for i := range b.rep {
+		b.rep[i] = 0
+	}
+}
+
+// Count 记录数
+func (b *WriteBatch) Count() int {
+	return int(binary.LittleEndian.Uint32(b.rep[8:12]))
+}
+
+func (b *WriteBatch) setCount(n int) {
+	binary.LittleEndian.PutUint32(b.rep[8:12], uint32(n))
+}
+
+// Sequence 第一条记录的 seq
+func (b *WriteBatch) Sequence() int64 {
+	return int64(binary.LittleEndian.Uint64(b.rep[:8]))
+}
+
+// SetSequence 设置第一条记录的 seq，写入前由 DB 分配
+func (b *WriteBatch) SetSequence(seq int64) {
+	binary.LittleEndian.PutUint64(b.rep[:8], uint64(seq))
+}
+
+// Contents 编码后的内容，写入 WAL
+func (b *WriteBatch) Contents() []byte {
+	return b.rep
+}
+
+// Iterate 按顺序回调每条记录，格式错误时返回 ErrBadBatch
+func (b *WriteBatch) Iterate(fn func(seq int64, t ValueType, key, value []byte)) error {
+	data := b.rep[batchHeaderSize:]
+	seq := b.Sequence()
+	n := 0
+	for len(data) > 0 {
+		t := ValueType(data[0])
+		data = data[1:]
+		key, rest, ok := readBytes(data)
+		if !ok {
+			return ErrBadBatch
+		}
+		data = rest
+		var value []byte
+		switch t {
+		case TypeValue:
+			if value, data, ok = readBytes(data); !ok {
+				return ErrBadBatch
+			}
+		case TypeDeletion:
+		default:
+			return ErrBadBatch
+		}
+		fn(seq+int64(n), t, key, value)
+		n++
+	}
+	if n != b.Count() {
+		return ErrBadBatch
+	}
+	return nil
+}
+
+// InsertInto 把所有记录写入 mem
+func (b *WriteBatch) InsertInto(mem *MemTable) error {
+	return b.Iterate(mem.Add)
+}
+
+func appendBytes(dst, b []byte) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], uint64(len(b)))
+	return append(append(dst, buf[:n]...), b...)
+}
+
+func readBytes(data []byte) ([]byte, []byte, bool) {
+	size, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < size {
+		return nil, nil, false
+	}
+	end := n + int(size)
+	return data[n:end:end], data[end:], true
+}
@@ -1,7 +1,10 @@
 package leveldb
 
 import (
-	"github.com/emirpasic/gods/utils"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/rand"
 	"sync"
 )
 
@@ -13,6 +16,12 @@ const (
 	TypeValue    ValueType = 2
 )
 
+// MaxSequence seq 编码在 8 字节尾部的高 56 位
+const MaxSequence int64 = 1<<56 - 1
+
+// ErrBadInternalKey 编码后的 internal key 长度不够或者类型不对
+var ErrBadInternalKey = errors.New("leveldb: bad internal key")
+
 type InternalKey struct {
 	Seq       int64     // seq number,原子自增
 	Type      ValueType // add or delete
@@ -20,6 +29,58 @@ type InternalKey struct {
 	UserValue []byte    // real value [delete with empty]
 }
 
+// Encode 编码为 user key + 8 字节尾部（seq << 8 | type，小端），和 leveldb 的格式相同
+func (k *InternalKey) Encode() []byte {
+	buf := make([]byte, len(k.UserKey)+8)
+	copy(buf, k.UserKey)
+	binary.LittleEndian.PutUint64(buf[len(k.UserKey):], uint64(k.Seq)<<8|uint64(k.Type))
+	return buf
+}
+
+// DecodeInternalKey 解析 Encode 的结果，UserKey 引用 b 的内存，UserValue 为空
+func DecodeInternalKey(b []byte) (*InternalKey, error) {
+	if len(b) < 8 {
+		return nil, ErrBadInternalKey
+	}
+	n := len(b) - 8
+	trailer := binary.LittleEndian.Uint64(b[n:])
+	k := &InternalKey{UserKey: b[:n:n], Seq: int64(trailer >> 8), Type: ValueType(trailer & 0xff)}
+	if k.Type != TypeDeletion && k.Type != TypeValue {
+		return nil, ErrBadInternalKey
+	}
+	return k, nil
+}
+
+// Comparator 比较两个 key：a < b 返回负数，a == b 返回 0，a > b 返回正数
+type Comparator func(a, b interface{}) int
+
+// BytewiseComparator 按字节序比较 user key
+func BytewiseComparator(a, b []byte) int {
+	return bytes.Compare(a, b)
+}
+
+// InternalKeyComparator 比较 *InternalKey：user key 升序，相同 user key 按 seq 降序、type 降序，
+// 这样同一个 user key 最新的版本排在最前面
+func InternalKeyComparator(userCmp func(a, b []byte) int) Comparator {
+	return func(a, b interface{}) int {
+		x, y := a.(*InternalKey), b.(*InternalKey)
+		if c := userCmp(x.UserKey, y.UserKey); c != 0 {
+			return c
+		}
+		switch {
+		case x.Seq > y.Seq:
+			return -1
+		case x.Seq < y.Seq:
+			return 1
+		case x.Type > y.Type:
+			return -1
+		case x.Type < y.Type:
+			return 1
+		}
+		return 0
+	}
+}
+
 const (
 	kMaxHeight = 12
 	kBranching = 4
@@ -27,16 +88,22 @@ const (
 
 type Node struct {
 	key  interface{}
-	next []*Node
+	next []*Node // 各层的后继，通过 atomic 读写
 }
+
+// SkipList 只插入不删除的跳表，和 leveldb 的 SkipList 相同：写入通过 locker 串行化，
+// 读不加锁，节点的指针通过 atomic 发布，读者看到的要么是插入前的链表，要么是插入后的链表
 type SkipList struct {
-	maxHeight  int
+	maxHeight  int32 // 当前最高层数，通过 atomic 读写
 	head       *Node
-	comparator utils.Comparator
-	locker     sync.RWMutex
+	comparator Comparator
+	locker     sync.Mutex // 只用于串行化写入，读不加锁
+	rnd        *rand.Rand
 }
 
+// MemTable 写入先进入内存中的跳表，写满之后转为只读并刷成 SSTable
 type MemTable struct {
 	table       *SkipList
+	userCmp     func(a, b []byte) int
 	memoryUsage uint64
 }
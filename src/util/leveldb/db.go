@@ -0,0 +1,836 @@
+package leveldb
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrNotFound key 不存在或者已经被删除
+	ErrNotFound = errors.New("leveldb: not found")
+	// ErrClosed DB 已经关闭
+	ErrClosed = errors.New("leveldb: closed")
+)
+
+// Options DB 的选项，零值使用默认值
+type Options struct {
+	Comparator          func(a, b []byte) int // user key 的比较，默认按字节序。打开已有的 DB 时必须和创建时相同
+	WriteBufferSize     uint64                // MemTable 超过这个大小时转为只读并刷盘，默认 4MB
+	L0CompactionTrigger int                   // L0 文件数达到这个值时开始合并到 L1，默认 4
+	L0StopWritesTrigger int                   // L0 文件数达到这个值时写入阻塞到 compaction 完成，默认 12
+	BaseLevelSize       int64                 // L1 的大小上限，之后每层乘以 10，默认 10MB
+	MaxFileSize         int64                 // compaction 输出的单个 SSTable 的大小，默认 2MB
+	BlockSize           int                   // SSTable 的块大小，默认 4KB
+	BlockCacheSize      int64                 // 块缓存大小，默认 8MB
+	MaxOpenFiles        int                   // 同时打开的 SSTable 数的上限，超过时关闭最久没有使用的，默认 1000
+}
+
+func (o *Options) withDefaults() Options {
+	opts := Options{}
+	if o != nil {
+		opts = *o
+	}
+	if opts.Comparator == nil {
+		opts.Comparator = BytewiseComparator
+	}
+	if opts.WriteBufferSize == 0 {
+		opts.WriteBufferSize = 4 << 20
+	}
+	if opts.L0CompactionTrigger <= 0 {
+		opts.L0CompactionTrigger = 4
+	}
+	if opts.L0StopWritesTrigger <= 0 {
+		opts.L0StopWritesTrigger = 12
+	}
+	if opts.BaseLevelSize <= 0 {
+		opts.BaseLevelSize = 10 << 20
+	}
+	if opts.MaxFileSize <= 0 {
+		opts.MaxFileSize = 2 << 20
+	}
+	if opts.BlockCacheSize <= 0 {
+		opts.BlockCacheSize = 8 << 20
+	}
+	if opts.MaxOpenFiles <= 0 {
+		opts.MaxOpenFiles = 1000
+	}
+	return opts
+}
+
+// ReadOptions 读取选项
+type ReadOptions struct {
+	// Snapshot 不为 nil 时读取快照时刻的数据，否则读取最新的数据
+	Snapshot *Snapshot
+}
+
+// Snapshot 某一时刻的只读视图，用完之后需要 ReleaseSnapshot，否则 compaction 会一直保留旧版本
+type Snapshot struct {
+	seq int64
+}
+
+// DB 可嵌入的 LSM 存储，结构和 leveldb 相同：
+// 写入先追加到 WAL，再写 MemTable；MemTable 写满之后转为只读（imm），由后台 goroutine 刷成 L0 的 SSTable，
+// L0 文件过多或者某一层过大时，后台把它和下一层重叠的文件合并（leveled compaction）。
+// 文件列表的每次变化作为 VersionEdit 追加到 MANIFEST，CURRENT 指向当前的 MANIFEST。
+// 读取依次查找 MemTable、imm、L0（从新到旧）、L1...，迭代器把它们合并成一个有序视图
+type DB struct {
+	dir       string
+	opts      Options
+	tableOpts *TableOptions
+
+	mu             sync.Mutex
+	cond           *sync.Cond // 后台任务等待工作，写入等待 MemTable 腾出空间
+	writers        []*writer  // 等待写入的队列，只有队首写入，写日志和 MemTable 时不持有 mu
+	mem            *MemTable
+	imm            *MemTable
+	wal            *WAL
+	logNumber      uint64
+	vset           *VersionSet
+	tables         *tableCache
+	snapshots      map[*Snapshot]bool
+	pendingOutputs map[uint64]bool // 正在写的 SSTable，清理文件时不能删除
+	bgErr          error
+	closed         bool
+	bgDone         chan struct{}
+}
+
+func logFileName(dir string, number uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%06d.log", number))
+}
+
+func tableFileName(dir string, number uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%06d.ldb", number))
+}
+
+func manifestFileName(dir string, number uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("MANIFEST-%06d", number))
+}
+
+// parseFileName 解析 DB 目录下的文件名，返回类型（log、ldb、manifest）和编号
+func parseFileName(name string) (string, uint64, bool) {
+	if strings.HasPrefix(name, "MANIFEST-") {
+		n, err := strconv.ParseUint(strings.TrimPrefix(name, "MANIFEST-"), 10, 64)
+		return "manifest", n, err == nil
+	}
+	ext := filepath.Ext(name)
+	if ext != ".log" && ext != ".ldb" {
+		return "", 0, false
+	}
+	n, err := strconv.ParseUint(strings.TrimSuffix(name, ext), 10, 64)
+	return ext[1:], n, err == nil
+}
+
+// Open 打开 dir 下的 DB，不存在时创建。打开时重放 MANIFEST，把上次没有刷盘的日志写成 L0 文件
+func Open(dir string, opts *Options) (*DB, error) {
+	o := opts.withDefaults()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	db := &DB{
+		dir:            dir,
+		opts:           o,
+		snapshots:      make(map[*Snapshot]bool),
+		pendingOutputs: make(map[uint64]bool),
+		bgDone:         make(chan struct{}),
+	}
+	db.tableOpts = &TableOptions{BlockSize: o.BlockSize, Comparator: o.Comparator, Cache: NewBlockCache(o.BlockCacheSize)}
+	db.cond = sync.NewCond(&db.mu)
+	db.tables = newTableCache(dir, db.tableOpts, o.MaxOpenFiles)
+	db.vset = newVersionSet(dir, &db.opts)
+	db.mem = NewMemTable(o.Comparator)
+
+	db.mu.Lock()
+	err := db.recover()
+	db.mu.Unlock()
+	if err != nil {
+		db.tables.close()
+		db.vset.close()
+		if db.wal != nil {
+			db.wal.Close()
+		}
+		return nil, err
+	}
+	go db.backgroundLoop()
+	return db, nil
+}
+
+// recover 调用方持有 mu
+func (db *DB) recover() error {
+	if _, err := os.Stat(filepath.Join(db.dir, "CURRENT")); err == nil {
+		if err := db.vset.recover(); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	// 重放 MANIFEST 记录的日志编号之后的所有日志
+	files, err := ioutil.ReadDir(db.dir)
+	if err != nil {
+		return err
+	}
+	var logs []uint64
+	for _, f := range files {
+		if typ, n, ok := parseFileName(f.Name()); ok && typ == "log" && n >= db.vset.logNumber {
+			logs = append(logs, n)
+		}
+	}
+	sort.Slice(logs, func(i, j int) bool { return logs[i] < logs[j] })
+	edit := &VersionEdit{}
+	for _, n := range logs {
+		db.vset.markFileNumberUsed(n)
+		mem, maxSeq, err := RecoverLogFile(logFileName(db.dir, n), db.opts.Comparator)
+		if err != nil {
+			return err
+		}
+		if maxSeq > db.vset.lastSequence {
+			db.vset.lastSequence = maxSeq
+		}
+		if err := db.writeLevel0Table(mem, edit); err != nil {
+			return err
+		}
+	}
+
+	db.logNumber = db.vset.newFileNumber()
+	if db.wal, err = OpenWAL(logFileName(db.dir, db.logNumber)); err != nil {
+		return err
+	}
+	edit.SetLogNumber(db.logNumber)
+	if err := db.vset.logAndApply(edit); err != nil {
+		return err
+	}
+	db.deleteObsoleteFiles()
+	return nil
+}
+
+// Put 写入 key
+func (db *DB) Put(key, value []byte, opts WriteOptions) error {
+	b := NewWriteBatch()
+	b.Put(key, value)
+	return db.Write(b, opts)
+}
+
+// Delete 删除 key
+func (db *DB) Delete(key []byte, opts WriteOptions) error {
+	b := NewWriteBatch()
+	b.Delete(key)
+	return db.Write(b, opts)
+}
+
+// writer 写入队列中的一个写入，batch 为 nil 时表示 Flush，强制切换 MemTable
+type writer struct {
+	batch *WriteBatch
+	opts  WriteOptions
+	cond  *sync.Cond
+}
+
+// Write 原子地写入 batch 中的所有操作：分配连续的 seq，写 WAL，再写 MemTable
+func (db *DB) Write(b *WriteBatch, opts WriteOptions) error {
+	if b.Count() == 0 {
+		return nil
+	}
+	return db.write(b, opts)
+}
+
+// write 在写入队列中排队，轮到自己时写入。
+// 同一时间只有队首的写入在写日志和 MemTable，所以写日志（包括 fsync）和写 MemTable 时可以释放 mu，
+// 读取不会被写入阻塞；lastSequence 在写完 MemTable 之后才增加，读取看不到写了一半的 batch
+func (db *DB) write(b *WriteBatch, opts WriteOptions) error {
+	w := &writer{batch: b, opts: opts, cond: sync.NewCond(&db.mu)}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.writers = append(db.writers, w)
+	for db.writers[0] != w {
+		w.cond.Wait()
+	}
+	defer func() {
+		db.writers = db.writers[1:]
+		if len(db.writers) > 0 {
+			db.writers[0].cond.Signal()
+		} else {
+			db.cond.Broadcast()
+		}
+	}()
+
+	if err := db.makeRoomForWrite(b == nil); err != nil || b == nil {
+		return err
+	}
+	b.SetSequence(db.vset.lastSequence + 1)
+	wal, mem := db.wal, db.mem
+	db.mu.Unlock()
+	err := wal.Write(b, opts)
+	if err != nil {
+		db.mu.Lock()
+		// 日志可能写了一半，之后的写入都不能保证恢复的顺序
+		db.bgErr = err
+		db.cond.Broadcast()
+		return err
+	}
+	err = b.InsertInto(mem)
+	db.mu.Lock()
+	if err != nil {
+		return err
+	}
+	db.vset.lastSequence += int64(b.Count())
+	return nil
+}
+
+// makeRoomForWrite MemTable 写满时切换到新的 MemTable 和日志，上一个 imm 还没有刷完或者 L0 文件过多时等待。
+// force 时只要 MemTable 不为空就切换。调用方持有 mu 并且位于写入队列的队首
+func (db *DB) makeRoomForWrite(force bool) error {
+	for {
+		usage := db.mem.ApproximateMemoryUsage()
+		switch {
+		case db.closed:
+			return ErrClosed
+		case db.bgErr != nil:
+			return db.bgErr
+		case force && usage == 0, !force && usage < db.opts.WriteBufferSize:
+			return nil
+		case db.imm != nil, len(db.vset.current.files[0]) >= db.opts.L0StopWritesTrigger:
+			db.cond.Wait()
+		default:
+			if err := db.switchMemTable(); err != nil {
+				return err
+			}
+			force = false
+		}
+	}
+}
+
+// switchMemTable 当前的 MemTable 转为 imm，写新的日志文件。调用方持有 mu 并且位于写入队列的队首
+func (db *DB) switchMemTable() error {
+	number := db.vset.newFileNumber()
+	wal, err := OpenWAL(logFileName(db.dir, number))
+	if err != nil {
+		return err
+	}
+	db.wal.Close()
+	db.wal, db.logNumber = wal, number
+	db.imm, db.mem = db.mem, NewMemTable(db.opts.Comparator)
+	db.cond.Broadcast()
+	return nil
+}
+
+// Flush 把当前的 MemTable 刷成 L0 文件，阻塞到刷盘完成
+func (db *DB) Flush() error {
+	// 切换 MemTable 要和写入互斥，所以也在写入队列中排队
+	if err := db.write(nil, WriteOptions{}); err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for db.imm != nil && db.bgErr == nil && !db.closed {
+		db.cond.Wait()
+	}
+	if db.closed {
+		return ErrClosed
+	}
+	return db.bgErr
+}
+
+// Get 读取 key，不存在时返回 ErrNotFound
+func (db *DB) Get(key []byte, opts *ReadOptions) ([]byte, error) {
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		return nil, ErrClosed
+	}
+	seq := db.vset.lastSequence
+	if opts != nil && opts.Snapshot != nil {
+		seq = opts.Snapshot.seq
+	}
+	mem, imm, v := db.mem, db.imm, db.vset.current
+	v.ref()
+	db.mu.Unlock()
+	defer func() {
+		db.mu.Lock()
+		v.unref()
+		db.mu.Unlock()
+	}()
+
+	value, deleted, found := mem.Get(key, seq)
+	if !found && imm != nil {
+		value, deleted, found = imm.Get(key, seq)
+	}
+	if !found {
+		var err error
+		if value, deleted, found, err = v.get(db.tables, key, seq); err != nil {
+			return nil, err
+		}
+	}
+	if !found || deleted {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), value...), nil
+}
+
+// NewIterator 创建迭代器，合并 MemTable、imm 和当前 Version 的所有文件，用完之后需要 Close
+func (db *DB) NewIterator(opts *ReadOptions) *Iterator {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		// 关闭之后不能再打开文件，返回一个 Err 为 ErrClosed 的空迭代器
+		cmp := InternalKeyComparator(db.opts.Comparator)
+		return &Iterator{db: db, it: newMergingIterator(cmp, []internalIterator{errIterator{ErrClosed}})}
+	}
+	seq := db.vset.lastSequence
+	if opts != nil && opts.Snapshot != nil {
+		seq = opts.Snapshot.seq
+	}
+	v := db.vset.current
+	v.ref()
+	children := []internalIterator{memInternalIterator{db.mem.NewInternalIterator()}}
+	if db.imm != nil {
+		children = append(children, memInternalIterator{db.imm.NewInternalIterator()})
+	}
+	for _, files := range v.files {
+		for _, f := range files {
+			children = append(children, db.tables.iterator(f.Number))
+		}
+	}
+	return &Iterator{
+		db:       db,
+		version:  v,
+		it:       newMergingIterator(InternalKeyComparator(db.opts.Comparator), children),
+		snapshot: seq,
+	}
+}
+
+// GetSnapshot 创建当前时刻的快照
+func (db *DB) GetSnapshot() *Snapshot {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	s := &Snapshot{seq: db.vset.lastSequence}
+	db.snapshots[s] = true
+	return s
+}
+
+// ReleaseSnapshot 释放快照，之后 compaction 可以丢弃只有它能看到的旧版本
+func (db *DB) ReleaseSnapshot(s *Snapshot) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	delete(db.snapshots, s)
+}
+
+// smallestSnapshot 所有快照中最小的 seq，没有快照时为最新的 seq。调用方持有 mu
+func (db *DB) smallestSnapshot() int64 {
+	smallest := db.vset.lastSequence
+	for s := range db.snapshots {
+		if s.seq < smallest {
+			smallest = s.seq
+		}
+	}
+	return smallest
+}
+
+// LevelFiles 每层的文件数
+func (db *DB) LevelFiles() []int {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	counts := make([]int, numLevels)
+	for level, files := range db.vset.current.files {
+		counts[level] = len(files)
+	}
+	return counts
+}
+
+// Close 停止后台任务并关闭文件，没有刷盘的数据在日志中，下次打开时恢复
+func (db *DB) Close() error {
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		return nil
+	}
+	db.closed = true
+	db.cond.Broadcast()
+	// 等待正在写日志的写入完成，排队中的写入会返回 ErrClosed
+	for len(db.writers) > 0 {
+		db.cond.Wait()
+	}
+	db.mu.Unlock()
+	<-db.bgDone
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	err := db.wal.Close()
+	db.vset.close()
+	db.tables.close()
+	return err
+}
+
+// backgroundLoop 后台刷盘和 compaction，同一时间只有一个任务
+func (db *DB) backgroundLoop() {
+	defer close(db.bgDone)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for {
+		for !db.closed && db.bgErr == nil && db.imm == nil && db.vset.current.compactionScore < 1 {
+			db.cond.Wait()
+		}
+		if db.closed || db.bgErr != nil {
+			return
+		}
+		var err error
+		if db.imm != nil {
+			err = db.compactMemTable()
+		} else {
+			err = db.compact(db.vset.pickCompaction())
+		}
+		if err != nil {
+			log.Printf("leveldb: background compaction in %s: %v", db.dir, err)
+			db.bgErr = err
+		}
+		db.cond.Broadcast()
+	}
+}
+
+// compactMemTable 把 imm 刷成 L0 文件，之后 imm 对应的日志可以删除。调用方持有 mu
+func (db *DB) compactMemTable() error {
+	edit := &VersionEdit{}
+	if err := db.writeLevel0Table(db.imm, edit); err != nil {
+		return err
+	}
+	edit.SetLogNumber(db.logNumber)
+	if err := db.vset.logAndApply(edit); err != nil {
+		return err
+	}
+	db.imm = nil
+	db.deleteObsoleteFiles()
+	return nil
+}
+
+// writeLevel0Table 把 mem 写成 SSTable 并加到 edit 的 L0，写文件时释放 mu。调用方持有 mu
+func (db *DB) writeLevel0Table(mem *MemTable, edit *VersionEdit) error {
+	number := db.vset.newFileNumber()
+	db.pendingOutputs[number] = true
+	defer delete(db.pendingOutputs, number)
+
+	db.mu.Unlock()
+	meta, err := db.buildTable(number, func(b *TableBuilder) error {
+		it := mem.NewInternalIterator()
+		for it.SeekToFirst(); it.Valid(); it.Next() {
+			k := it.Key().(*InternalKey)
+			if err := b.Add(k, k.UserValue); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	db.mu.Lock()
+	if err != nil || meta == nil {
+		return err
+	}
+	edit.AddFile(0, meta)
+	return nil
+}
+
+// buildTable 创建编号为 number 的 SSTable，fill 写入记录，没有记录时删除文件并返回 nil
+func (db *DB) buildTable(number uint64, fill func(b *TableBuilder) error) (*FileMeta, error) {
+	f, err := os.Create(tableFileName(db.dir, number))
+	if err != nil {
+		return nil, err
+	}
+	b := NewTableBuilder(f, db.tableOpts)
+	err = fill(b)
+	var info TableInfo
+	if err == nil {
+		info, err = b.Finish()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil || info.Entries == 0 {
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return &FileMeta{Number: number, Size: info.Size, Smallest: info.Smallest, Largest: info.Largest}, nil
+}
+
+// compact 执行一次 compaction：合并输入文件，丢弃被新版本覆盖并且所有快照都看不到的旧版本，以及不再需要的删除标记，
+// 按 MaxFileSize 切分输出到下一层。合并时释放 mu。调用方持有 mu
+func (db *DB) compact(c *compaction) error {
+	if c == nil {
+		return nil
+	}
+	defer c.version.unref()
+	if c.isTrivialMove() {
+		f := c.inputs[0][0]
+		edit := &VersionEdit{}
+		edit.DeleteFile(c.level, f.Number)
+		edit.AddFile(c.level+1, f)
+		edit.SetCompactPointer(c.level, f.Largest)
+		return db.vset.logAndApply(edit)
+	}
+
+	smallestSnapshot := db.smallestSnapshot()
+	var children []internalIterator
+	for _, files := range c.inputs {
+		for _, f := range files {
+			children = append(children, db.tables.iterator(f.Number))
+		}
+	}
+	it := newMergingIterator(InternalKeyComparator(db.opts.Comparator), children)
+	defer it.Close()
+
+	var outputs []*FileMeta
+	var builder *TableBuilder
+	var file *os.File
+	var number uint64
+	finishOutput := func() error {
+		if builder == nil {
+			return nil
+		}
+		info, err := builder.Finish()
+		if err == nil {
+			err = file.Sync()
+		}
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+		builder = nil
+		if err != nil {
+			return err
+		}
+		outputs = append(outputs, &FileMeta{Number: number, Size: info.Size, Smallest: info.Smallest, Largest: info.Largest})
+		return nil
+	}
+	defer func() {
+		for _, f := range outputs {
+			delete(db.pendingOutputs, f.Number)
+		}
+		if builder != nil {
+			delete(db.pendingOutputs, number)
+		}
+	}()
+
+	db.mu.Unlock()
+	err := func() error {
+		var lastKey []byte
+		lastSeq := MaxSequence + 1 // 当前 user key 上一个版本的 seq，新的 user key 时为最大值
+		for it.SeekToFirst(); it.Valid(); it.Next() {
+			k := it.Key()
+			if lastKey == nil || db.opts.Comparator(k.UserKey, lastKey) != 0 {
+				lastKey = append(lastKey[:0], k.UserKey...)
+				lastSeq = MaxSequence + 1
+				// 同一个 user key 的所有版本放在同一个文件里，L1 以上的文件才不会重叠
+				if builder != nil && builder.FileSize() >= db.opts.MaxFileSize {
+					if err := finishOutput(); err != nil {
+						return err
+					}
+				}
+			}
+			drop := false
+			if lastSeq <= smallestSnapshot {
+				// 更新的版本对所有快照可见，这个版本不会再被读到
+				drop = true
+			} else if k.Type == TypeDeletion && k.Seq <= smallestSnapshot && c.isBaseLevelForKey(k.UserKey) {
+				// 更深的层没有这个 key，删除标记没有要遮盖的数据
+				drop = true
+			}
+			lastSeq = k.Seq
+			if drop {
+				continue
+			}
+			if builder == nil {
+				db.mu.Lock()
+				number = db.vset.newFileNumber()
+				db.pendingOutputs[number] = true
+				db.mu.Unlock()
+				f, err := os.Create(tableFileName(db.dir, number))
+				if err != nil {
+					return err
+				}
+				file, builder = f, NewTableBuilder(f, db.tableOpts)
+			}
+			if err := builder.Add(k, k.UserValue); err != nil {
+				return err
+			}
+		}
+		if err := it.Err(); err != nil {
+			return err
+		}
+		return finishOutput()
+	}()
+	db.mu.Lock()
+	if err != nil {
+		if builder != nil {
+			file.Close()
+		}
+		return err
+	}
+	if err := db.vset.logAndApply(c.edit(outputs)); err != nil {
+		return err
+	}
+	db.deleteObsoleteFiles()
+	return nil
+}
+
+// deleteObsoleteFiles 删除已经刷盘的日志、旧的 MANIFEST 和不再被任何 Version 引用的 SSTable。调用方持有 mu
+func (db *DB) deleteObsoleteFiles() {
+	files, err := ioutil.ReadDir(db.dir)
+	if err != nil {
+		return
+	}
+	live := db.vset.liveFiles()
+	for _, f := range files {
+		typ, number, ok := parseFileName(f.Name())
+		if !ok {
+			continue
+		}
+		var keep bool
+		switch typ {
+		case "log":
+			keep = number >= db.vset.logNumber || number == db.logNumber
+		case "manifest":
+			keep = number >= db.vset.manifestNumber
+		case "ldb":
+			keep = live[number] || db.pendingOutputs[number]
+			if !keep {
+				db.tables.evict(number)
+			}
+		}
+		if !keep {
+			os.Remove(filepath.Join(db.dir, f.Name()))
+		}
+	}
+}
+
+// tableCache 打开的 SSTable，按文件编号缓存，最多 capacity 个，超过时按 LRU 关闭。
+// 正在使用的 SSTable 带引用计数，被淘汰或者删除时等最后一个使用者释放之后才关闭文件
+type tableCache struct {
+	mu       sync.Mutex
+	dir      string
+	opts     *TableOptions
+	capacity int
+	tables   map[uint64]*openTable
+	lru      *list.List // 队首是最近使用的
+}
+
+type openTable struct {
+	number uint64
+	file   *os.File
+	reader *TableReader
+	refs   int // 缓存本身持有一个引用
+	elem   *list.Element
+}
+
+func newTableCache(dir string, opts *TableOptions, capacity int) *tableCache {
+	return &tableCache{dir: dir, opts: opts, capacity: capacity, tables: make(map[uint64]*openTable), lru: list.New()}
+}
+
+// get 返回打开的 SSTable，用完之后调用 release
+func (c *tableCache) get(number uint64) (*TableReader, func(), error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.tables[number]
+	if ok {
+		c.lru.MoveToFront(t.elem)
+	} else {
+		var err error
+		if t, err = c.open(number); err != nil {
+			return nil, nil, err
+		}
+		t.refs = 1
+		t.elem = c.lru.PushFront(t)
+		c.tables[number] = t
+		for c.lru.Len() > c.capacity {
+			c.remove(c.lru.Back().Value.(*openTable))
+		}
+	}
+	t.refs++
+	var once sync.Once
+	return t.reader, func() { once.Do(func() { c.release(t) }) }, nil
+}
+
+func (c *tableCache) open(number uint64) (*openTable, error) {
+	f, err := os.Open(tableFileName(c.dir, number))
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r, err := OpenTable(f, info.Size(), c.opts)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("leveldb: open table %06d: %w", number, err)
+	}
+	return &openTable{number: number, file: f, reader: r}, nil
+}
+
+func (c *tableCache) iterator(number uint64) internalIterator {
+	t, release, err := c.get(number)
+	if err != nil {
+		return errIterator{err: err}
+	}
+	return tableCacheIterator{TableIterator: t.NewIterator(), release: release}
+}
+
+func (c *tableCache) release(t *openTable) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.unref(t)
+}
+
+// remove 从缓存中移除，调用方持有 mu
+func (c *tableCache) remove(t *openTable) {
+	delete(c.tables, t.number)
+	c.lru.Remove(t.elem)
+	c.unref(t)
+}
+
+func (c *tableCache) unref(t *openTable) {
+	t.refs--
+	if t.refs == 0 {
+		t.file.Close()
+	}
+}
+
+// evict 文件被删除时关闭
+func (c *tableCache) evict(number uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t, ok := c.tables[number]; ok {
+		c.remove(t)
+	}
+}
+
+// len 打开的 SSTable 数（不包括已经淘汰但是还在使用的）
+func (c *tableCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+func (c *tableCache) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, t := range c.tables {
+		c.remove(t)
+	}
+}
+
+// tableCacheIterator Close 时释放 SSTable 的引用
+type tableCacheIterator struct {
+	*TableIterator
+	release func()
+}
+
+func (it tableCacheIterator) Close() {
+	it.release()
+}
@@ -0,0 +1,306 @@
+package leveldb
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// smallOptions 很小的 MemTable 和层大小，少量数据就能触发刷盘和多层 compaction
+func smallOptions() *Options {
+	return &Options{
+		WriteBufferSize:     16 << 10,
+		L0CompactionTrigger: 2,
+		BaseLevelSize:       32 << 10,
+		MaxFileSize:         16 << 10,
+		BlockSize:           1024,
+	}
+}
+
+func mustGet(t *testing.T, db *DB, key string, opts *ReadOptions) string {
+	t.Helper()
+	v, err := db.Get([]byte(key), opts)
+	if err == ErrNotFound {
+		return "<nil>"
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(v)
+}
+
+func scanAll(t *testing.T, db *DB, opts *ReadOptions) map[string]string {
+	t.Helper()
+	it := db.NewIterator(opts)
+	defer it.Close()
+	got := map[string]string{}
+	var last []byte
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		if last != nil && bytes.Compare(last, it.Key()) >= 0 {
+			t.Fatalf("iterator out of order: %s then %s", last, it.Key())
+		}
+		last = it.Key()
+		got[string(it.Key())] = string(it.Value())
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestDBReopen(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Put([]byte("a"), []byte("1"), WriteOptions{})
+	db.Put([]byte("b"), []byte("2"), WriteOptions{Sync: true})
+	db.Delete([]byte("a"), WriteOptions{})
+	if got := mustGet(t, db, "b", nil); got != "2" {
+		t.Fatalf("b want 2 got %s", got)
+	}
+	db.Close()
+	if _, err := db.Get([]byte("b"), nil); err != ErrClosed {
+		t.Fatalf("get after close want ErrClosed got %v", err)
+	}
+	it := db.NewIterator(nil)
+	it.SeekToFirst()
+	if it.Valid() || it.Err() != ErrClosed {
+		t.Fatalf("iterator after close want ErrClosed got %v", it.Err())
+	}
+	it.Close()
+
+	// 没有刷盘的数据从日志恢复
+	db, err = Open(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if got := mustGet(t, db, "a", nil); got != "<nil>" {
+		t.Fatalf("a should stay deleted, got %s", got)
+	}
+	if got := mustGet(t, db, "b", nil); got != "2" {
+		t.Fatalf("b want 2 got %s", got)
+	}
+	db.Put([]byte("c"), []byte("3"), WriteOptions{})
+	if got := scanAll(t, db, nil); !reflect.DeepEqual(got, map[string]string{"b": "2", "c": "3"}) {
+		t.Fatalf("scan got %v", got)
+	}
+}
+
+func TestDBCompaction(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir, smallOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	model := map[string]string{}
+	r := rand.New(rand.NewSource(3))
+	for i := 0; i < 20000; i++ {
+		key := fmt.Sprintf("key-%05d", r.Intn(5000))
+		if r.Intn(5) == 0 {
+			db.Delete([]byte(key), WriteOptions{})
+			delete(model, key)
+		} else {
+			value := fmt.Sprintf("value-%d-%s", i, bytes.Repeat([]byte("x"), r.Intn(50)))
+			db.Put([]byte(key), []byte(value), WriteOptions{})
+			model[key] = value
+		}
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	// 等后台 compaction 把数据推到 L1 以下
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		files := db.LevelFiles()
+		if files[0] < 2 && files[1]+files[2] > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("compaction did not run: %v", files)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	check := func(db *DB) {
+		for i := 0; i < 5000; i++ {
+			key := fmt.Sprintf("key-%05d", i)
+			want, ok := model[key]
+			if !ok {
+				want = "<nil>"
+			}
+			if got := mustGet(t, db, key, nil); got != want {
+				t.Fatalf("%s want %q got %q", key, want, got)
+			}
+		}
+		if got := scanAll(t, db, nil); !reflect.DeepEqual(got, model) {
+			t.Fatalf("scan mismatch: %d keys vs %d", len(got), len(model))
+		}
+	}
+	check(db)
+
+	// 被合并掉的文件已经删除
+	tables, _ := filepath.Glob(filepath.Join(dir, "*.ldb"))
+	total := 0
+	for _, n := range db.LevelFiles() {
+		total += n
+	}
+	if len(tables) != total {
+		t.Fatalf("%d table files on disk, %d live", len(tables), total)
+	}
+	db.Close()
+
+	// 打开的文件数比 SSTable 少，读取时按 LRU 关闭和重新打开
+	opts := smallOptions()
+	opts.MaxOpenFiles = 3
+	db, err = Open(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check(db)
+	if n := db.tables.len(); n > 3 {
+		t.Fatalf("%d tables open, want at most 3", n)
+	}
+}
+
+func TestDBSnapshot(t *testing.T) {
+	db, err := Open(t.TempDir(), smallOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.Put([]byte("k"), []byte("v1"), WriteOptions{})
+	db.Put([]byte("gone"), []byte("x"), WriteOptions{})
+	snap := db.GetSnapshot()
+	db.Put([]byte("k"), []byte("v2"), WriteOptions{})
+	db.Delete([]byte("gone"), WriteOptions{})
+	b := NewWriteBatch()
+	b.Put([]byte("new"), []byte("n"))
+	b.Put([]byte("k"), []byte("v3"))
+	db.Write(b, WriteOptions{})
+
+	// 写入足够的数据触发多次刷盘和 compaction，快照看到的旧版本必须保留
+	for i := 0; i < 5000; i++ {
+		db.Put([]byte(fmt.Sprintf("fill-%05d", i)), bytes.Repeat([]byte("f"), 40), WriteOptions{})
+	}
+	db.Flush()
+	ro := &ReadOptions{Snapshot: snap}
+	if got := mustGet(t, db, "k", ro); got != "v1" {
+		t.Fatalf("snapshot read want v1 got %s", got)
+	}
+	if got := mustGet(t, db, "gone", ro); got != "x" {
+		t.Fatalf("snapshot should still see deleted key, got %s", got)
+	}
+	if got := mustGet(t, db, "k", nil); got != "v3" {
+		t.Fatalf("latest want v3 got %s", got)
+	}
+	snapScan := scanAll(t, db, ro)
+	if len(snapScan) != 2 || snapScan["k"] != "v1" {
+		t.Fatalf("snapshot iterator got %d keys, k=%s", len(snapScan), snapScan["k"])
+	}
+
+	it := db.NewIterator(nil)
+	it.Seek([]byte("k"))
+	var keys []string
+	for ; it.Valid(); it.Next() {
+		keys = append(keys, string(it.Key()))
+	}
+	it.Close()
+	if !sort.StringsAreSorted(keys) || len(keys) != 2 || keys[0] != "k" || keys[1] != "new" {
+		t.Fatalf("seek k got %v", keys)
+	}
+	db.ReleaseSnapshot(snap)
+}
+
+func TestDBConcurrentWrites(t *testing.T) {
+	db, err := Open(t.TempDir(), smallOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// 多个 goroutine 同时写入（部分 fsync）、Flush 和读取，写入在队列中串行，读取不持有写入的锁
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 300; i++ {
+				b := NewWriteBatch()
+				b.Put([]byte(fmt.Sprintf("w%d-%04d", w, i)), bytes.Repeat([]byte{'v'}, 64))
+				b.Put([]byte(fmt.Sprintf("w%d-last", w)), []byte(fmt.Sprint(i)))
+				if err := db.Write(b, WriteOptions{Sync: i%50 == 0}); err != nil {
+					t.Error(err)
+					return
+				}
+				if i%100 == 0 {
+					if err := db.Flush(); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}
+		}(w)
+	}
+	stop := make(chan struct{})
+	var readers sync.WaitGroup
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			// batch 是原子的：读到 last = i 时，w-i 一定已经写入
+			for w := 0; w < 4; w++ {
+				last, err := db.Get([]byte(fmt.Sprintf("w%d-last", w)), nil)
+				if err == ErrNotFound {
+					continue
+				}
+				var i int
+				fmt.Sscan(string(last), &i)
+				if _, err := db.Get([]byte(fmt.Sprintf("w%d-%04d", w, i)), nil); err != nil {
+					t.Errorf("w%d-%04d: %v", w, i, err)
+					return
+				}
+			}
+		}
+	}()
+	wg.Wait()
+	close(stop)
+	readers.Wait()
+
+	got := scanAll(t, db, nil)
+	if len(got) != 4*301 {
+		t.Fatalf("got %d keys, want %d", len(got), 4*301)
+	}
+}
+
+func TestVersionEditEncoding(t *testing.T) {
+	e := &VersionEdit{}
+	e.SetLogNumber(7)
+	e.SetNextFileNumber(12)
+	e.SetLastSequence(1000)
+	e.SetCompactPointer(1, []byte("cp"))
+	e.DeleteFile(0, 3)
+	e.AddFile(1, &FileMeta{Number: 9, Size: 4096, Smallest: []byte("a0000000x"), Largest: []byte("z0000000x")})
+	got, err := DecodeVersionEdit(e.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, e) {
+		t.Fatalf("round trip\nwant %+v\ngot  %+v", e, got)
+	}
+	if _, err := DecodeVersionEdit([]byte{99}); err != ErrBadManifest {
+		t.Fatalf("want ErrBadManifest got %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package leveldb
+
+// bloom 过滤器，和 leveldb 的 BloomFilterPolicy 相同：k 个哈希值由一个哈希通过 double hashing 得到，
+// 编码为位数组加上最后 1 字节的 k
+
+// bloomHash leveldb 的 Hash（类似 murmur），seed 相同
+func bloomHash(data []byte) uint32 {
+	const (
+		seed = 0xbc9f1d34
+		m    = 0xc6a4a793
+	)
+	h := uint32(seed) ^ uint32(len(data))*m
+	for ; len(data) >= 4; data = data[4:] {
+		h += uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16 | uint32(data[3])<<24
+		h *= m
+		h ^= h >> 16
+	}
+	switch len(data) {
+	case 3:
+		h += uint32(data[2]) << 16
+		fallthrough
+	case 2:
+		h += uint32(data[1]) << 8
+		fallthrough
+	case 1:
+		h += uint32(data[0])
+		h *= m
+		h ^= h >> 24
+	}
+	return h
+}
+
+// newBloomFilter 为 keys 创建过滤器，每个 key 占 bitsPerKey 位
+func newBloomFilter(keys [][]byte, bitsPerKey int) []byte {
+	// k = bitsPerKey * ln2 时误判率最低
+	k := uint8(float64(bitsPerKey) * 0.69)
+	if k < 1 {
+		k = 1
+	}
+	if k > 30 {
+		k = 30
+	}
+	bits := len(keys) * bitsPerKey
+	if bits < 64 {
+		bits = 64
+	}
+	bytes := (bits + 7) / 8
+	bits = bytes * 8
+	filter := make([]byte, bytes+1)
+	for _, key := range keys {
+		h := bloomHash(key)
+		delta := h>>17 | h<<15
+		for i := uint8(0); i < k; i++ {
+			pos := h % uint32(bits)
+			filter[pos/8] |= 1 << (pos % 8)
+			h += delta
+		}
+	}
+	filter[bytes] = k
+	return filter
+}
+
+// bloomMayContain key 是否可能在过滤器中，返回 false 时一定不在
+func bloomMayContain(filter, key []byte) bool {
+	if len(filter) < 2 {
+		return true
+	}
+	bits := uint32(len(filter)-1) * 8
+	k := filter[len(filter)-1]
+	if k > 30 {
+		// 新的编码方式，保守地认为可能存在
+		return true
+	}
+	h := bloomHash(key)
+	delta := h>>17 | h<<15
+	for i := uint8(0); i < k; i++ {
+		pos := h % bits
+		if filter[pos/8]&(1<<(pos%8)) == 0 {
+			return false
+		}
+		h += delta
+	}
+	return true
+}
@@ -0,0 +1,192 @@
+package leveldb
+
+// internalIterator 按 internal key 排序遍历所有版本的迭代器，MemTable、SSTable 和合并迭代器都实现这个接口
+type internalIterator interface {
+	Valid() bool
+	SeekToFirst()
+	Seek(key *InternalKey)
+	Next()
+	Key() *InternalKey // UserValue 为记录的值
+	Err() error
+	Close() // 释放迭代器持有的 SSTable
+}
+
+// memInternalIterator 把 SkipListIterator 适配为 internalIterator
+type memInternalIterator struct {
+	it *SkipListIterator
+}
+
+func (m memInternalIterator) Valid() bool           { return m.it.Valid() }
+func (m memInternalIterator) SeekToFirst()          { m.it.SeekToFirst() }
+func (m memInternalIterator) Seek(key *InternalKey) { m.it.Seek(key) }
+func (m memInternalIterator) Next()                 { m.it.Next() }
+func (m memInternalIterator) Key() *InternalKey     { return m.it.Key().(*InternalKey) }
+func (m memInternalIterator) Err() error            { return nil }
+func (m memInternalIterator) Close()                {}
+
+// errIterator 打开失败时返回，没有任何记录
+type errIterator struct {
+	err error
+}
+
+func (e errIterator) Valid() bool           { return false }
+func (e errIterator) SeekToFirst()          {}
+func (e errIterator) Seek(key *InternalKey) {}
+func (e errIterator) Next()                 {}
+func (e errIterator) Key() *InternalKey     { return nil }
+func (e errIterator) Err() error            { return e.err }
+func (e errIterator) Close()                {}
+
+// mergingIterator 合并多个有序的迭代器，每次返回所有子迭代器中最小的 key。
+// 子迭代器的数量是 MemTable + L0 文件数 + 其它层的文件数，直接线性查找最小值
+type mergingIterator struct {
+	cmp      Comparator
+	children []internalIterator
+	current  internalIterator
+}
+
+func newMergingIterator(cmp Comparator, children []internalIterator) *mergingIterator {
+	return &mergingIterator{cmp: cmp, children: children}
+}
+
+func (m *mergingIterator) Valid() bool {
+	return m.current != nil
+}
+
+func (m *mergingIterator) SeekToFirst() {
+	for _, c := range m.children {
+		c.SeekToFirst()
+	}
+	m.findSmallest()
+}
+
+func (m *mergingIterator) Seek(key *InternalKey) {
+	for _, c := range m.children {
+		c.Seek(key)
+	}
+	m.findSmallest()
+}
+
+func (m *mergingIterator) Next() {
+	m.current.Next()
+	m.findSmallest()
+}
+
+func (m *mergingIterator) Key() *InternalKey {
+	return m.current.Key()
+}
+
+func (m *mergingIterator) Err() error {
+	for _, c := range m.children {
+		if err := c.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mergingIterator) Close() {
+	for _, c := range m.children {
+		c.Close()
+	}
+}
+
+func (m *mergingIterator) findSmallest() {
+	m.current = nil
+	var smallest *InternalKey
+	for _, c := range m.children {
+		if !c.Valid() {
+			continue
+		}
+		if k := c.Key(); smallest == nil || m.cmp(k, smallest) < 0 {
+			m.current, smallest = c, k
+		}
+	}
+}
+
+// Iterator DB 的快照迭代器：每个 user key 只返回快照中的最新版本，已删除的 key 被跳过。
+// 迭代器持有创建时的 Version，用完之后需要 Close，否则 compaction 之后的旧文件不会被删除
+type Iterator struct {
+	db       *DB
+	version  *Version
+	it       *mergingIterator
+	snapshot int64
+	key      []byte
+	value    []byte
+	valid    bool
+}
+
+// Valid 是否指向一个 key
+func (it *Iterator) Valid() bool {
+	return it.valid
+}
+
+// Key 当前的 key
+func (it *Iterator) Key() []byte {
+	return it.key
+}
+
+// Value 当前 key 的值
+func (it *Iterator) Value() []byte {
+	return it.value
+}
+
+// Err 读取文件的错误，出错时 Valid 返回 false
+func (it *Iterator) Err() error {
+	return it.it.Err()
+}
+
+// SeekToFirst 移动到第一个 key
+func (it *Iterator) SeekToFirst() {
+	it.it.SeekToFirst()
+	it.findVisible()
+}
+
+// Seek 移动到第一个大于等于 key 的 key
+func (it *Iterator) Seek(key []byte) {
+	it.it.Seek(&InternalKey{UserKey: key, Seq: it.snapshot, Type: TypeValue})
+	it.findVisible()
+}
+
+// Next 移动到下一个 key
+func (it *Iterator) Next() {
+	it.skipUserKey(it.key)
+	it.findVisible()
+}
+
+// Close 释放持有的 Version，可以重复调用
+func (it *Iterator) Close() {
+	if it.version == nil {
+		return
+	}
+	it.it.Close()
+	it.db.mu.Lock()
+	it.version.unref()
+	it.db.mu.Unlock()
+	it.version = nil
+}
+
+// findVisible 和 MemIterator.findVisible 相同
+func (it *Iterator) findVisible() {
+	it.valid = false
+	for it.it.Valid() {
+		k := it.it.Key()
+		if k.Seq > it.snapshot {
+			it.it.Next()
+			continue
+		}
+		if k.Type == TypeValue {
+			it.key = append([]byte(nil), k.UserKey...)
+			it.value = k.UserValue
+			it.valid = true
+			return
+		}
+		it.skipUserKey(k.UserKey)
+	}
+}
+
+func (it *Iterator) skipUserKey(key []byte) {
+	for it.it.Valid() && it.db.opts.Comparator(it.it.Key().UserKey, key) == 0 {
+		it.it.Next()
+	}
+}
@@ -0,0 +1,227 @@
+package leveldb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// 日志格式和 leveldb 相同：文件由 32KB 的块组成，每条记录按块切分为若干片段，
+// 每个片段为 [4 字节 crc32c][2 字节长度][1 字节类型][数据]，块末尾不足一个头部的空间填 0
+const (
+	logBlockSize  = 32 * 1024
+	logHeaderSize = 7
+
+	recordZero   = 0 // 预分配文件中的 0，读到时跳过
+	recordFull   = 1
+	recordFirst  = 2
+	recordMiddle = 3
+	recordLast   = 4
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// maskCRC 和 leveldb 一样对 crc 做一次变换，避免数据本身包含 crc 时的问题
+func maskCRC(crc uint32) uint32 {
+	return (crc>>15 | crc<<17) + 0xa282ead8
+}
+
+// recordCRC 类型字节和数据的 crc32c
+func recordCRC(typ byte, data []byte) uint32 {
+	crc := crc32.Update(0, crc32c, []byte{typ})
+	return maskCRC(crc32.Update(crc, crc32c, data))
+}
+
+// LogWriter 按 leveldb 日志格式追加写记录
+type LogWriter struct {
+	w           io.Writer
+	blockOffset int // 当前块已经写了多少字节
+}
+
+// NewLogWriter 从 w 的开头写日志
+func NewLogWriter(w io.Writer) *LogWriter {
+	return &LogWriter{w: w}
+}
+
+// NewLogWriterAt 追加到已经写了 size 字节的日志后面
+func NewLogWriterAt(w io.Writer, size int64) *LogWriter {
+	return &LogWriter{w: w, blockOffset: int(size % logBlockSize)}
+}
+
+// AddRecord 写入一条记录，超过块剩余空间时切分为 FIRST/MIDDLE/LAST 片段
+func (w *LogWriter) AddRecord(data []byte) error {
+	begin := true
+	for {
+		if leftover := logBlockSize - w.blockOffset; leftover < logHeaderSize {
+			// 剩余空间放不下头部，填 0 之后换到下一个块
+			if leftover > 0 {
+				if _, err := w.w.Write(make([]byte, leftover)); err != nil {
+					return err
+				}
+			}
+			w.blockOffset = 0
+		}
+		n := logBlockSize - w.blockOffset - logHeaderSize
+		if n > len(data) {
+			n = len(data)
+		}
+		end := n == len(data)
+		var typ byte
+		switch {
+		case begin && end:
+			typ = recordFull
+		case begin:
+			typ = recordFirst
+		case end:
+			typ = recordLast
+		default:
+			typ = recordMiddle
+		}
+		if err := w.emit(typ, data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+		begin = false
+		if end {
+			return nil
+		}
+	}
+}
+
+// emit 头部和数据一次写入
+func (w *LogWriter) emit(typ byte, data []byte) error {
+	buf := make([]byte, logHeaderSize+len(data))
+	binary.LittleEndian.PutUint32(buf[:4], recordCRC(typ, data))
+	binary.LittleEndian.PutUint16(buf[4:6], uint16(len(data)))
+	buf[6] = typ
+	copy(buf[logHeaderSize:], data)
+	_, err := w.w.Write(buf)
+	w.blockOffset += len(buf)
+	return err
+}
+
+var (
+	errBadRecord = errors.New("leveldb: bad log record")
+	// ErrLogCorrupted 传给 LogReader 的 reporter，说明跳过了一段损坏的日志
+	ErrLogCorrupted = errors.New("leveldb: log corrupted")
+)
+
+// LogReader 读取 LogWriter 写的记录。损坏的片段（crc 不对、长度越界）所在块的剩余部分被跳过，
+// 通过 reporter 报告丢弃的字节数；文件末尾写了一半的记录视为正常结束，不报告
+type LogReader struct {
+	r        io.Reader
+	reporter func(dropped int, reason error)
+	buf      []byte
+	data     []byte // 当前块还没有读的部分
+	eof      bool
+}
+
+// NewLogReader 创建读取器，reporter 可以为 nil
+func NewLogReader(r io.Reader, reporter func(dropped int, reason error)) *LogReader {
+	return &LogReader{r: r, reporter: reporter, buf: make([]byte, logBlockSize)}
+}
+
+func (r *LogReader) report(dropped int, reason string) {
+	if r.reporter != nil {
+		r.reporter(dropped, fmt.Errorf("%w: %s", ErrLogCorrupted, reason))
+	}
+}
+
+// ReadRecord 读取下一条完整的记录，没有更多记录时返回 io.EOF
+func (r *LogReader) ReadRecord() ([]byte, error) {
+	var scratch []byte
+	inFragment := false
+	for {
+		typ, frag, err := r.readPhysical()
+		switch {
+		case err == io.EOF:
+			// 末尾不完整的分片记录是写到一半崩溃，直接丢弃
+			return nil, io.EOF
+		case err == errBadRecord:
+			if inFragment {
+				r.report(len(scratch), "error in middle of record")
+				inFragment, scratch = false, nil
+			}
+			continue
+		case err != nil:
+			return nil, err
+		}
+		switch typ {
+		case recordFull:
+			if inFragment {
+				r.report(len(scratch), "partial record without end")
+			}
+			return append([]byte(nil), frag...), nil
+		case recordFirst:
+			if inFragment {
+				r.report(len(scratch), "partial record without end")
+			}
+			scratch = append([]byte(nil), frag...)
+			inFragment = true
+		case recordMiddle:
+			if !inFragment {
+				r.report(len(frag), "missing start of fragmented record")
+				continue
+			}
+			scratch = append(scratch, frag...)
+		case recordLast:
+			if !inFragment {
+				r.report(len(frag), "missing start of fragmented record")
+				continue
+			}
+			return append(scratch, frag...), nil
+		default:
+			r.report(len(frag), "unknown record type")
+			inFragment, scratch = false, nil
+		}
+	}
+}
+
+// readPhysical 读取下一个片段，返回 io.EOF 或者 errBadRecord（已经跳过损坏的部分）
+func (r *LogReader) readPhysical() (byte, []byte, error) {
+	for {
+		if len(r.data) < logHeaderSize {
+			if r.eof {
+				// 末尾不完整的头部是写到一半崩溃
+				r.data = nil
+				return 0, nil, io.EOF
+			}
+			// 跳过块末尾的填充，读下一个块
+			n, err := io.ReadFull(r.r, r.buf)
+			r.data = r.buf[:n]
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				r.eof = true
+			} else if err != nil {
+				return 0, nil, err
+			}
+			continue
+		}
+		length := int(binary.LittleEndian.Uint16(r.data[4:6]))
+		typ := r.data[6]
+		if logHeaderSize+length > len(r.data) {
+			dropped := len(r.data)
+			r.data = nil
+			if r.eof {
+				// 数据没有写完
+				return 0, nil, io.EOF
+			}
+			r.report(dropped, "bad record length")
+			return 0, nil, errBadRecord
+		}
+		if typ == recordZero && length == 0 {
+			r.data = nil
+			return 0, nil, errBadRecord
+		}
+		frag := r.data[logHeaderSize : logHeaderSize+length]
+		if recordCRC(typ, frag) != binary.LittleEndian.Uint32(r.data[:4]) {
+			// 长度可能也损坏了，丢弃整个块剩余的部分
+			r.report(len(r.data), "checksum mismatch")
+			r.data = nil
+			return 0, nil, errBadRecord
+		}
+		r.data = r.data[logHeaderSize+length:]
+		return typ, frag, nil
+	}
+}
@@ -0,0 +1,131 @@
+package leveldb
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeLog(t *testing.T, records ...[]byte) []byte {
+	var buf bytes.Buffer
+	w := NewLogWriter(&buf)
+	for _, r := range records {
+		if err := w.AddRecord(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func readLog(data []byte) ([]string, int) {
+	dropped := 0
+	r := NewLogReader(bytes.NewReader(data), func(n int, reason error) { dropped += n })
+	var records []string
+	for {
+		rec, err := r.ReadRecord()
+		if err != nil {
+			return records, dropped
+		}
+		records = append(records, string(rec))
+	}
+}
+
+func TestLogFragments(t *testing.T) {
+	// 跨越多个块的记录，以及正好让块末尾剩余不足一个头部的记录
+	big := strings.Repeat("x", 3*logBlockSize)
+	pad := strings.Repeat("p", logBlockSize-2*logHeaderSize-3)
+	records := []string{"", "small", big, pad, "after-pad", "end"}
+	var in [][]byte
+	for _, r := range records {
+		in = append(in, []byte(r))
+	}
+	data := writeLog(t, in...)
+	got, dropped := readLog(data)
+	if dropped != 0 || len(got) != len(records) {
+		t.Fatalf("want %d records got %d (dropped %d)", len(records), len(got), dropped)
+	}
+	for i := range records {
+		if got[i] != records[i] {
+			t.Fatalf("record %d mismatch: len %d vs %d", i, len(got[i]), len(records[i]))
+		}
+	}
+}
+
+func TestLogTornWrite(t *testing.T) {
+	data := writeLog(t, []byte("one"), []byte("two"), []byte(strings.Repeat("z", 2*logBlockSize)))
+	// 截断在最后一条记录的任意位置，前两条都能读出来，不报告损坏
+	for _, cut := range []int{1, logHeaderSize, logBlockSize, len(data) - 25} {
+		got, dropped := readLog(data[:len(data)-cut])
+		if len(got) != 2 || got[1] != "two" || dropped != 0 {
+			t.Fatalf("cut %d: got %d records dropped %d", cut, len(got), dropped)
+		}
+	}
+}
+
+func TestLogBitFlip(t *testing.T) {
+	var records [][]byte
+	for i := 0; i < 3000; i++ {
+		records = append(records, []byte(fmt.Sprintf("record-%04d", i)))
+	}
+	data := writeLog(t, records...)
+	// 第一个块中间翻转一位，只丢失第一个块剩余的记录，后面的块正常
+	data[logBlockSize/2] ^= 0x10
+	got, dropped := readLog(data)
+	if dropped == 0 {
+		t.Fatal("corruption should be reported")
+	}
+	if len(got) == 0 || got[0] != "record-0000" || got[len(got)-1] != "record-2999" {
+		t.Fatalf("unexpected records around corruption: %d", len(got))
+	}
+	if len(got) >= 3000 || len(got) < 3000-logBlockSize/(logHeaderSize+11) {
+		t.Fatalf("should drop at most one block, got %d records", len(got))
+	}
+}
+
+func TestWALRecover(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "000001.log")
+	wal, err := OpenWAL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := NewWriteBatch()
+	b.SetSequence(1)
+	b.Put([]byte("a"), []byte("1"))
+	b.Put([]byte("b"), []byte("2"))
+	if err := wal.Write(b, WriteOptions{Sync: true}); err != nil {
+		t.Fatal(err)
+	}
+	b.Clear()
+	b.SetSequence(3)
+	b.Delete([]byte("a"))
+	b.Put([]byte("c"), []byte("3"))
+	if err := wal.Write(b, WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	wal.Close()
+
+	mem, maxSeq, err := RecoverLogFile(path, nil)
+	if err != nil || maxSeq != 4 {
+		t.Fatalf("recover: max seq %d err %v", maxSeq, err)
+	}
+	if _, deleted, _ := mem.Get([]byte("a"), maxSeq); !deleted {
+		t.Fatal("a should be deleted")
+	}
+	if v, _, _ := mem.Get([]byte("a"), 2); string(v) != "1" {
+		t.Fatalf("a at seq 2 want 1 got %q", v)
+	}
+	if v, _, _ := mem.Get([]byte("c"), maxSeq); string(v) != "3" {
+		t.Fatalf("c want 3 got %q", v)
+	}
+
+	// 损坏的 batch 内容（crc 正确）返回错误
+	bad := writeLog(t, []byte("not a batch but long enough"))
+	if _, err := RecoverLog(bytes.NewReader(bad), NewMemTable(nil)); err == nil {
+		t.Fatal("bad batch should fail recovery")
+	}
+	if _, err := RecoverLog(bytes.NewReader(nil), NewMemTable(nil)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,129 @@
+package leveldb
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// nodeOverhead 每个节点除 key、value、next 之外大致的内存占用
+const nodeOverhead = int(unsafe.Sizeof(Node{}) + unsafe.Sizeof(InternalKey{}))
+
+// NewMemTable 创建按 userCmp 排序 user key 的 MemTable，userCmp 为 nil 时按字节序
+func NewMemTable(userCmp func(a, b []byte) int) *MemTable {
+	if userCmp == nil {
+		userCmp = BytewiseComparator
+	}
+	return &MemTable{table: NewSkipList(InternalKeyComparator(userCmp)), userCmp: userCmp}
+}
+
+// Add 写入一条记录，删除时 t 为 TypeDeletion，value 为空。同一个 seq 只能写一次
+func (m *MemTable) Add(seq int64, t ValueType, key, value []byte) {
+	k := &InternalKey{
+		Seq:       seq,
+		Type:      t,
+		UserKey:   append([]byte(nil), key...),
+		UserValue: append([]byte(nil), value...),
+	}
+	m.table.Insert(k)
+	// 指针数组按最高层估算，偏大一些
+	usage := nodeOverhead + len(key) + len(value) + kMaxHeight*int(unsafe.Sizeof(&Node{}))
+	atomic.AddUint64(&m.memoryUsage, uint64(usage))
+}
+
+// Get 查找 seq 之前（包含）key 的最新版本。found 为 true 表示 MemTable 中有结论：
+// deleted 为 false 时 value 为结果，为 true 时 key 已被删除；found 为 false 时需要继续查找更旧的数据
+func (m *MemTable) Get(key []byte, seq int64) (value []byte, deleted bool, found bool) {
+	it := m.table.NewIterator()
+	// 同一个 user key 按 seq 降序，seek 到 seq 之前的第一个版本
+	it.Seek(&InternalKey{UserKey: key, Seq: seq, Type: TypeValue})
+	if !it.Valid() {
+		return nil, false, false
+	}
+	k := it.Key().(*InternalKey)
+	if m.userCmp(k.UserKey, key) != 0 {
+		return nil, false, false
+	}
+	if k.Type == TypeDeletion {
+		return nil, true, true
+	}
+	return k.UserValue, false, true
+}
+
+// ApproximateMemoryUsage 估算的内存占用，用于判断是否需要刷盘
+func (m *MemTable) ApproximateMemoryUsage() uint64 {
+	return atomic.LoadUint64(&m.memoryUsage)
+}
+
+// NewInternalIterator 遍历所有版本（包括删除标记）的迭代器，Key 返回 *InternalKey，用于刷盘和合并
+func (m *MemTable) NewInternalIterator() *SkipListIterator {
+	return m.table.NewIterator()
+}
+
+// MemIterator 快照迭代器：每个 user key 只返回 seq 不大于 snapshot 的最新版本，已删除的 key 被跳过。
+// 创建之后的写入 seq 更大，不会出现在结果中
+type MemIterator struct {
+	mem      *MemTable
+	it       *SkipListIterator
+	snapshot int64
+}
+
+// NewIterator 创建 snapshot 时刻的快照迭代器，使用前需要 Seek 或者 SeekToFirst
+func (m *MemTable) NewIterator(snapshot int64) *MemIterator {
+	return &MemIterator{mem: m, it: m.table.NewIterator(), snapshot: snapshot}
+}
+
+// Valid 是否指向一个 key
+func (it *MemIterator) Valid() bool {
+	return it.it.Valid()
+}
+
+// Key 当前的 user key
+func (it *MemIterator) Key() []byte {
+	return it.it.Key().(*InternalKey).UserKey
+}
+
+// Value 当前 key 的值
+func (it *MemIterator) Value() []byte {
+	return it.it.Key().(*InternalKey).UserValue
+}
+
+// SeekToFirst 移动到第一个可见的 key
+func (it *MemIterator) SeekToFirst() {
+	it.it.SeekToFirst()
+	it.findVisible()
+}
+
+// Seek 移动到第一个大于等于 key 的可见 key
+func (it *MemIterator) Seek(key []byte) {
+	it.it.Seek(&InternalKey{UserKey: key, Seq: it.snapshot, Type: TypeValue})
+	it.findVisible()
+}
+
+// Next 移动到下一个可见的 key
+func (it *MemIterator) Next() {
+	it.skipUserKey(it.Key())
+	it.findVisible()
+}
+
+// findVisible 从当前位置开始找到第一个快照可见并且没有被删除的版本
+func (it *MemIterator) findVisible() {
+	for it.it.Valid() {
+		k := it.it.Key().(*InternalKey)
+		if k.Seq > it.snapshot {
+			it.it.Next()
+			continue
+		}
+		// 第一个不大于 snapshot 的版本就是快照中的最新版本
+		if k.Type == TypeValue {
+			return
+		}
+		it.skipUserKey(k.UserKey)
+	}
+}
+
+// skipUserKey 跳过 key 剩余的所有版本
+func (it *MemIterator) skipUserKey(key []byte) {
+	for it.it.Valid() && it.mem.userCmp(it.it.Key().(*InternalKey).UserKey, key) == 0 {
+		it.it.Next()
+	}
+}
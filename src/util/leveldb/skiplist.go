@@ -0,0 +1,165 @@
+package leveldb
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"unsafe"
+)
+
+// NewSkipList 创建按 comparator 排序的跳表
+func NewSkipList(comparator Comparator) *SkipList {
+	return &SkipList{
+		maxHeight:  1,
+		head:       newNode(nil, kMaxHeight),
+		comparator: comparator,
+		rnd:        rand.New(rand.NewSource(0xdeadbeef)),
+	}
+}
+
+func newNode(key interface{}, height int) *Node {
+	return &Node{key: key, next: make([]*Node, height)}
+}
+
+func (n *Node) getNext(level int) *Node {
+	return (*Node)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&n.next[level]))))
+}
+
+func (n *Node) setNext(level int, x *Node) {
+	atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&n.next[level])), unsafe.Pointer(x))
+}
+
+func (list *SkipList) getMaxHeight() int {
+	return int(atomic.LoadInt32(&list.maxHeight))
+}
+
+// randomHeight 每升高一层的概率为 1/kBranching
+func (list *SkipList) randomHeight() int {
+	height := 1
+	for height < kMaxHeight && list.rnd.Intn(kBranching) == 0 {
+		height++
+	}
+	return height
+}
+
+// Insert 插入 key，跳表中不能已经存在相等的 key
+func (list *SkipList) Insert(key interface{}) {
+	list.locker.Lock()
+	defer list.locker.Unlock()
+	var prev [kMaxHeight]*Node
+	x := list.findGreaterOrEqual(key, prev[:])
+	if x != nil && list.comparator(key, x.key) == 0 {
+		panic("leveldb: duplicate key in skiplist")
+	}
+	height := list.randomHeight()
+	if maxHeight := list.getMaxHeight(); height > maxHeight {
+		for i := maxHeight; i < height; i++ {
+			prev[i] = list.head
+		}
+		// 读者先看到新的高度时 head 在这些层的后继为 nil，不影响查找
+		atomic.StoreInt32(&list.maxHeight, int32(height))
+	}
+	x = newNode(key, height)
+	for i := 0; i < height; i++ {
+		// 先设置新节点的后继，再把新节点发布给读者
+		x.next[i] = prev[i].getNext(i)
+		prev[i].setNext(i, x)
+	}
+}
+
+// Contains 跳表中是否有和 key 相等的节点
+func (list *SkipList) Contains(key interface{}) bool {
+	x := list.findGreaterOrEqual(key, nil)
+	return x != nil && list.comparator(key, x.key) == 0
+}
+
+// findGreaterOrEqual 第一个大于等于 key 的节点，prev 不为 nil 时记录每层的前驱
+func (list *SkipList) findGreaterOrEqual(key interface{}, prev []*Node) *Node {
+	x := list.head
+	for level := list.getMaxHeight() - 1; ; level-- {
+		next := x.getNext(level)
+		for next != nil && list.comparator(next.key, key) < 0 {
+			x = next
+			next = x.getNext(level)
+		}
+		if prev != nil {
+			prev[level] = x
+		}
+		if level == 0 {
+			return next
+		}
+	}
+}
+
+// findLessThan 最后一个小于 key 的节点，没有时返回 head
+func (list *SkipList) findLessThan(key interface{}) *Node {
+	x := list.head
+	for level := list.getMaxHeight() - 1; level >= 0; level-- {
+		for next := x.getNext(level); next != nil && list.comparator(next.key, key) < 0; next = x.getNext(level) {
+			x = next
+		}
+	}
+	return x
+}
+
+// findLast 最后一个节点，跳表为空时返回 head
+func (list *SkipList) findLast() *Node {
+	x := list.head
+	for level := list.getMaxHeight() - 1; level >= 0; level-- {
+		for next := x.getNext(level); next != nil; next = x.getNext(level) {
+			x = next
+		}
+	}
+	return x
+}
+
+// SkipListIterator 跳表的迭代器，可以和写入并发使用
+type SkipListIterator struct {
+	list *SkipList
+	node *Node
+}
+
+// NewIterator 创建迭代器，使用前需要 Seek
+func (list *SkipList) NewIterator() *SkipListIterator {
+	return &SkipListIterator{list: list}
+}
+
+// Valid 是否指向一个节点
+func (it *SkipListIterator) Valid() bool {
+	return it.node != nil
+}
+
+// Key 当前节点的 key
+func (it *SkipListIterator) Key() interface{} {
+	return it.node.key
+}
+
+// Next 移动到下一个节点
+func (it *SkipListIterator) Next() {
+	it.node = it.node.getNext(0)
+}
+
+// Prev 移动到前一个节点，没有前向指针，需要重新查找
+func (it *SkipListIterator) Prev() {
+	it.node = it.list.findLessThan(it.node.key)
+	if it.node == it.list.head {
+		it.node = nil
+	}
+}
+
+// Seek 移动到第一个大于等于 key 的节点
+func (it *SkipListIterator) Seek(key interface{}) {
+	it.node = it.list.findGreaterOrEqual(key, nil)
+}
+
+// SeekToFirst 移动到第一个节点
+func (it *SkipListIterator) SeekToFirst() {
+	it.node = it.list.head.getNext(0)
+}
+
+// SeekToLast 移动到最后一个节点
+func (it *SkipListIterator) SeekToLast() {
+	it.node = it.list.findLast()
+	if it.node == it.list.head {
+		it.node = nil
+	}
+}
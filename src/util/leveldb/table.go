@@ -0,0 +1,328 @@
+package leveldb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/shark/src/util/cache/lru"
+)
+
+// SSTable 格式，参考 leveldb：
+//
+//	[data block 1] ... [data block n] [filter block] [index block] [footer]
+//
+// data block 中的 key 为编码后的 internal key，按 internal key 排序，相邻的 key 做前缀压缩：
+// 每条记录为 [varint 共享前缀长度][varint 非共享长度][varint value 长度][非共享部分][value]，
+// 每 restartInterval 条记录设置一个重启点（不做前缀压缩），块末尾是重启点的偏移数组和个数，用于二分查找。
+// 每个块后面跟着 1 字节压缩类型（总是 0，不压缩）和 4 字节 crc32c。
+// filter block 是整个表所有 user key 的 bloom 过滤器；index block 的 key 为每个 data block 的最后一个 key，value 为块的位置。
+// footer 固定 40 字节：filter block 和 index block 的位置（各 16 字节）和 8 字节 magic
+const (
+	blockTrailerSize = 5
+	footerSize       = 40
+	tableMagic       = 0xdb4775248b80fb57
+)
+
+var (
+	// ErrTableCorrupted SSTable 文件损坏
+	ErrTableCorrupted = errors.New("leveldb: table corrupted")
+	// ErrKeyOrder TableBuilder.Add 的 key 不是递增的
+	ErrKeyOrder = errors.New("leveldb: keys added out of order")
+)
+
+// TableOptions SSTable 的读写选项，零值使用默认值
+type TableOptions struct {
+	BlockSize       int                   // data block 压缩前的大小，默认 4KB
+	RestartInterval int                   // 重启点间隔，默认 16
+	BitsPerKey      int                   // bloom 过滤器每个 key 的位数，默认 10，约 1% 误判
+	Comparator      func(a, b []byte) int // user key 的比较，默认按字节序
+	Cache           *BlockCache           // 读取时的块缓存，为 nil 时不缓存
+}
+
+func (o *TableOptions) withDefaults() TableOptions {
+	opts := TableOptions{}
+	if o != nil {
+		opts = *o
+	}
+	if opts.BlockSize <= 0 {
+		opts.BlockSize = 4096
+	}
+	if opts.RestartInterval <= 0 {
+		opts.RestartInterval = 16
+	}
+	if opts.BitsPerKey <= 0 {
+		opts.BitsPerKey = 10
+	}
+	if opts.Comparator == nil {
+		opts.Comparator = BytewiseComparator
+	}
+	return opts
+}
+
+// compareInternalKey 比较编码后的 internal key，顺序和 InternalKeyComparator 相同
+func compareInternalKey(userCmp func(a, b []byte) int, a, b []byte) int {
+	if c := userCmp(a[:len(a)-8], b[:len(b)-8]); c != 0 {
+		return c
+	}
+	ta, tb := binary.LittleEndian.Uint64(a[len(a)-8:]), binary.LittleEndian.Uint64(b[len(b)-8:])
+	switch {
+	case ta > tb:
+		return -1
+	case ta < tb:
+		return 1
+	}
+	return 0
+}
+
+// blockHandle 块在文件中的位置，不包括 trailer
+type blockHandle struct {
+	offset, size uint64
+}
+
+func (h blockHandle) encode() []byte {
+	buf := make([]byte, 2*binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, h.offset)
+	n += binary.PutUvarint(buf[n:], h.size)
+	return buf[:n]
+}
+
+func decodeBlockHandle(b []byte) (blockHandle, error) {
+	offset, n := binary.Uvarint(b)
+	if n <= 0 {
+		return blockHandle{}, ErrTableCorrupted
+	}
+	size, m := binary.Uvarint(b[n:])
+	if m <= 0 {
+		return blockHandle{}, ErrTableCorrupted
+	}
+	return blockHandle{offset: offset, size: size}, nil
+}
+
+// blockBuilder 构造一个前缀压缩的块
+type blockBuilder struct {
+	restartInterval int
+	buf             []byte
+	restarts        []uint32
+	counter         int // 距离上一个重启点的记录数
+	lastKey         []byte
+}
+
+func newBlockBuilder(restartInterval int) *blockBuilder {
+	return &blockBuilder{restartInterval: restartInterval, restarts: []uint32{0}}
+}
+
+func (b *blockBuilder) add(key, value []byte) {
+	shared := 0
+	if b.counter < b.restartInterval {
+		for shared < len(key) && shared < len(b.lastKey) && key[shared] == b.lastKey[shared] {
+			shared++
+		}
+	} else {
+		b.restarts = append(b.restarts, uint32(len(b.buf)))
+		b.counter = 0
+	}
+	var tmp [binary.MaxVarintLen64]byte
+	for _, v := range []int{shared, len(key) - shared, len(value)} {
+		n := binary.PutUvarint(tmp[:], uint64(v))
+		b.buf = append(b.buf, tmp[:n]...)
+	}
+	b.buf = append(b.buf, key[shared:]...)
+	b.buf = append(b.buf, value...)
+	b.lastKey = append(b.lastKey[:0], key...)
+	b.counter++
+}
+
+// finish 追加重启点数组，返回块的内容
+func (b *blockBuilder) finish() []byte {
+	var tmp [4]byte
+	for _, r := range append(b.restarts, uint32(len(b.restarts))) {
+		binary.LittleEndian.PutUint32(tmp[:], r)
+		b.buf = append(b.buf, tmp[:]...)
+	}
+	return b.buf
+}
+
+func (b *blockBuilder) reset() {
+	b.buf = b.buf[:0]
+	b.restarts = b.restarts[:1]
+	b.counter = 0
+	b.lastKey = b.lastKey[:0]
+}
+
+func (b *blockBuilder) empty() bool {
+	return len(b.buf) == 0
+}
+
+// estimatedSize 块 finish 之后的大小
+func (b *blockBuilder) estimatedSize() int {
+	return len(b.buf) + 4*len(b.restarts) + 4
+}
+
+// block 读到内存中的块
+type block struct {
+	data        []byte
+	restarts    int // 重启点数组的偏移
+	numRestarts int
+}
+
+// Len 实现 lru.Value，按块的大小计算缓存占用
+func (b *block) Len() int {
+	return len(b.data)
+}
+
+func newBlock(data []byte) (*block, error) {
+	if len(data) < 4 {
+		return nil, ErrTableCorrupted
+	}
+	n := int(binary.LittleEndian.Uint32(data[len(data)-4:]))
+	restarts := len(data) - 4 - 4*n
+	if n < 1 || restarts < 0 {
+		return nil, ErrTableCorrupted
+	}
+	return &block{data: data, restarts: restarts, numRestarts: n}, nil
+}
+
+func (b *block) restartPoint(i int) int {
+	return int(binary.LittleEndian.Uint32(b.data[b.restarts+4*i:]))
+}
+
+// blockIter 块内的迭代器
+type blockIter struct {
+	b     *block
+	cmp   func(a, b []byte) int
+	next  int // 下一条记录的偏移
+	key   []byte
+	value []byte
+	valid bool
+	err   error
+}
+
+func (b *block) iter(cmp func(a, b []byte) int) *blockIter {
+	return &blockIter{b: b, cmp: cmp}
+}
+
+func (it *blockIter) Valid() bool {
+	return it.valid
+}
+
+// seekRestart 移动到第 i 个重启点之前，下一次 parseNext 读取重启点处的记录
+func (it *blockIter) seekRestart(i int) {
+	it.next = it.b.restartPoint(i)
+	it.key = nil
+	it.valid = false
+}
+
+// parseNext 解析下一条记录，重启点处的记录没有共享前缀
+func (it *blockIter) parseNext() bool {
+	if it.next >= it.b.restarts {
+		it.valid = false
+		return false
+	}
+	data := it.b.data[it.next:it.b.restarts]
+	var vals [3]uint64
+	pos := 0
+	for i := range vals {
+		v, n := binary.Uvarint(data[pos:])
+		if n <= 0 {
+			return it.corrupt()
+		}
+		vals[i] = v
+		pos += n
+	}
+	shared, nonShared, valueLen := int(vals[0]), int(vals[1]), int(vals[2])
+	if shared > len(it.key) || pos+nonShared+valueLen > len(data) {
+		return it.corrupt()
+	}
+	key := make([]byte, shared+nonShared)
+	copy(key, it.key[:shared])
+	copy(key[shared:], data[pos:pos+nonShared])
+	it.key = key
+	it.value = data[pos+nonShared : pos+nonShared+valueLen]
+	it.next += pos + nonShared + valueLen
+	it.valid = true
+	return true
+}
+
+func (it *blockIter) corrupt() bool {
+	it.err = ErrTableCorrupted
+	it.valid = false
+	return false
+}
+
+func (it *blockIter) SeekToFirst() {
+	it.seekRestart(0)
+	it.parseNext()
+}
+
+func (it *blockIter) Next() {
+	it.parseNext()
+}
+
+// Seek 移动到第一个大于等于 target 的记录：先二分查找最后一个小于 target 的重启点，再顺序查找
+func (it *blockIter) Seek(target []byte) {
+	i := sort.Search(it.b.numRestarts, func(i int) bool {
+		it.seekRestart(i)
+		return !it.parseNext() || it.cmp(it.key, target) >= 0
+	})
+	if i > 0 {
+		i--
+	}
+	it.seekRestart(i)
+	for it.parseNext() && it.cmp(it.key, target) < 0 {
+	}
+}
+
+// BlockCache 多个 SSTable 共享的块缓存，按块的字节数淘汰，复用 cache/lru
+type BlockCache struct {
+	mu     sync.Mutex
+	lru    *lru.Cache
+	nextID uint64
+}
+
+// NewBlockCache 创建最多缓存 capacity 字节的块缓存
+func NewBlockCache(capacity int64) *BlockCache {
+	return &BlockCache{lru: lru.New(capacity, nil)}
+}
+
+// newID 每个打开的 TableReader 一个 id，作为缓存 key 的前缀
+func (c *BlockCache) newID() uint64 {
+	return atomic.AddUint64(&c.nextID, 1)
+}
+
+func (c *BlockCache) get(id, offset uint64) (*block, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.lru.Get(cacheKey(id, offset))
+	if !ok {
+		return nil, false
+	}
+	return v.(*block), true
+}
+
+func (c *BlockCache) add(id, offset uint64, b *block) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru.Add(cacheKey(id, offset), b)
+}
+
+// Len 缓存的块数
+func (c *BlockCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+func cacheKey(id, offset uint64) string {
+	return fmt.Sprintf("%d/%d", id, offset)
+}
+
+// blockCRC 块内容和压缩类型的 crc32c
+func blockCRC(data []byte, compression byte) uint32 {
+	crc := crc32.Update(0, crc32c, data)
+	return maskCRC(crc32.Update(crc, crc32c, []byte{compression}))
+}
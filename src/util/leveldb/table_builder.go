@@ -0,0 +1,144 @@
+package leveldb
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// TableBuilder 按 internal key 递增的顺序写入记录，生成 SSTable
+type TableBuilder struct {
+	w            io.Writer
+	opts         TableOptions
+	offset       uint64
+	data         *blockBuilder
+	index        *blockBuilder
+	userKeys     [][]byte // 用于生成 bloom 过滤器
+	lastKey      []byte
+	smallest     []byte
+	pendingIndex bool // 上一个 data block 刚写完，等下一个 key 到来时写它的 index
+	pendingBlock blockHandle
+	entries      int
+	err          error
+}
+
+// TableInfo 生成的 SSTable 的信息
+type TableInfo struct {
+	Smallest []byte // 最小的 internal key（编码后）
+	Largest  []byte // 最大的 internal key（编码后）
+	Entries  int
+	Size     int64
+}
+
+// NewTableBuilder 创建写到 w 的 TableBuilder
+func NewTableBuilder(w io.Writer, opts *TableOptions) *TableBuilder {
+	o := opts.withDefaults()
+	return &TableBuilder{
+		w:     w,
+		opts:  o,
+		data:  newBlockBuilder(o.RestartInterval),
+		index: newBlockBuilder(1),
+	}
+}
+
+// Add 写入一条记录，key 必须大于之前写入的 key
+func (b *TableBuilder) Add(key *InternalKey, value []byte) error {
+	if b.err != nil {
+		return b.err
+	}
+	encoded := key.Encode()
+	if b.lastKey != nil && compareInternalKey(b.opts.Comparator, b.lastKey, encoded) >= 0 {
+		return ErrKeyOrder
+	}
+	if b.pendingIndex {
+		b.index.add(b.lastKey, b.pendingBlock.encode())
+		b.pendingIndex = false
+	}
+	if b.smallest == nil {
+		b.smallest = encoded
+	}
+	b.userKeys = append(b.userKeys, key.UserKey)
+	b.lastKey = encoded
+	b.data.add(encoded, value)
+	b.entries++
+	if b.data.estimatedSize() >= b.opts.BlockSize {
+		b.flush()
+	}
+	return b.err
+}
+
+// flush 写出当前的 data block
+func (b *TableBuilder) flush() {
+	if b.data.empty() {
+		return
+	}
+	b.pendingBlock, b.err = b.writeBlock(b.data.finish())
+	b.data.reset()
+	b.pendingIndex = true
+}
+
+// writeBlock 写入块和 trailer
+func (b *TableBuilder) writeBlock(data []byte) (blockHandle, error) {
+	handle := blockHandle{offset: b.offset, size: uint64(len(data))}
+	var trailer [blockTrailerSize]byte
+	binary.LittleEndian.PutUint32(trailer[1:], blockCRC(data, trailer[0]))
+	if _, err := b.w.Write(data); err != nil {
+		return handle, err
+	}
+	if _, err := b.w.Write(trailer[:]); err != nil {
+		return handle, err
+	}
+	b.offset += uint64(len(data)) + blockTrailerSize
+	return handle, nil
+}
+
+// Finish 写出剩余的 data block、filter block、index block 和 footer
+func (b *TableBuilder) Finish() (TableInfo, error) {
+	if b.err != nil {
+		return TableInfo{}, b.err
+	}
+	b.flush()
+	if b.err != nil {
+		return TableInfo{}, b.err
+	}
+	filter, err := b.writeBlock(newBloomFilter(b.userKeys, b.opts.BitsPerKey))
+	if err != nil {
+		return TableInfo{}, err
+	}
+	if b.pendingIndex {
+		b.index.add(b.lastKey, b.pendingBlock.encode())
+		b.pendingIndex = false
+	}
+	index, err := b.writeBlock(b.index.finish())
+	if err != nil {
+		return TableInfo{}, err
+	}
+	var footer [footerSize]byte
+	binary.LittleEndian.PutUint64(footer[0:], filter.offset)
+	binary.LittleEndian.PutUint64(footer[8:], filter.size)
+	binary.LittleEndian.PutUint64(footer[16:], index.offset)
+	binary.LittleEndian.PutUint64(footer[24:], index.size)
+	binary.LittleEndian.PutUint64(footer[32:], tableMagic)
+	if _, err := b.w.Write(footer[:]); err != nil {
+		return TableInfo{}, err
+	}
+	b.offset += footerSize
+	return TableInfo{Smallest: b.smallest, Largest: b.lastKey, Entries: b.entries, Size: int64(b.offset)}, nil
+}
+
+// BuildTable 把 MemTable 的所有版本（包括删除标记）写成 SSTable
+func BuildTable(w io.Writer, mem *MemTable, opts *TableOptions) (TableInfo, error) {
+	builder := NewTableBuilder(w, opts)
+	it := mem.NewInternalIterator()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		k := it.Key().(*InternalKey)
+		if err := builder.Add(k, k.UserValue); err != nil {
+			return TableInfo{}, err
+		}
+	}
+	return builder.Finish()
+}
+
+// FileSize 已经写出的字节数
+func (b *TableBuilder) FileSize() int64 {
+	return int64(b.offset)
+}
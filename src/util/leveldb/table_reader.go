@@ -0,0 +1,208 @@
+package leveldb
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// TableReader 读取 TableBuilder 生成的 SSTable，可以并发使用
+type TableReader struct {
+	r       io.ReaderAt
+	opts    TableOptions
+	index   *block
+	filter  []byte
+	cacheID uint64
+}
+
+// OpenTable 读取 footer、index block 和 filter block，size 为文件大小
+func OpenTable(r io.ReaderAt, size int64, opts *TableOptions) (*TableReader, error) {
+	if size < footerSize {
+		return nil, ErrTableCorrupted
+	}
+	var footer [footerSize]byte
+	if _, err := r.ReadAt(footer[:], size-footerSize); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint64(footer[32:]) != tableMagic {
+		return nil, ErrTableCorrupted
+	}
+	t := &TableReader{r: r, opts: opts.withDefaults()}
+	filter := blockHandle{offset: binary.LittleEndian.Uint64(footer[0:]), size: binary.LittleEndian.Uint64(footer[8:])}
+	index := blockHandle{offset: binary.LittleEndian.Uint64(footer[16:]), size: binary.LittleEndian.Uint64(footer[24:])}
+	for _, h := range []blockHandle{filter, index} {
+		if h.offset+h.size+blockTrailerSize > uint64(size) {
+			return nil, ErrTableCorrupted
+		}
+	}
+	var err error
+	if t.filter, err = t.readRaw(filter); err != nil {
+		return nil, err
+	}
+	data, err := t.readRaw(index)
+	if err != nil {
+		return nil, err
+	}
+	if t.index, err = newBlock(data); err != nil {
+		return nil, err
+	}
+	if t.opts.Cache != nil {
+		t.cacheID = t.opts.Cache.newID()
+	}
+	return t, nil
+}
+
+// readRaw 读取块并校验 crc
+func (t *TableReader) readRaw(h blockHandle) ([]byte, error) {
+	buf := make([]byte, h.size+blockTrailerSize)
+	if _, err := t.r.ReadAt(buf, int64(h.offset)); err != nil {
+		return nil, err
+	}
+	data, trailer := buf[:h.size], buf[h.size:]
+	if blockCRC(data, trailer[0]) != binary.LittleEndian.Uint32(trailer[1:]) {
+		return nil, ErrTableCorrupted
+	}
+	return data, nil
+}
+
+// readBlock 读取 data block，优先从缓存中读取
+func (t *TableReader) readBlock(h blockHandle) (*block, error) {
+	cache := t.opts.Cache
+	if cache != nil {
+		if b, ok := cache.get(t.cacheID, h.offset); ok {
+			return b, nil
+		}
+	}
+	data, err := t.readRaw(h)
+	if err != nil {
+		return nil, err
+	}
+	b, err := newBlock(data)
+	if err != nil {
+		return nil, err
+	}
+	if cache != nil {
+		cache.add(t.cacheID, h.offset, b)
+	}
+	return b, nil
+}
+
+func (t *TableReader) compare(a, b []byte) int {
+	return compareInternalKey(t.opts.Comparator, a, b)
+}
+
+// Get 查找 seq 之前（包含）key 的最新版本，返回值的含义和 MemTable.Get 相同。先用 bloom 过滤器排除不存在的 key
+func (t *TableReader) Get(key []byte, seq int64) (value []byte, deleted bool, found bool, err error) {
+	if !bloomMayContain(t.filter, key) {
+		return nil, false, false, nil
+	}
+	it := t.NewIterator()
+	it.Seek(&InternalKey{UserKey: key, Seq: seq, Type: TypeValue})
+	if !it.Valid() {
+		return nil, false, false, it.Err()
+	}
+	k := it.Key()
+	if t.opts.Comparator(k.UserKey, key) != 0 {
+		return nil, false, false, nil
+	}
+	if k.Type == TypeDeletion {
+		return nil, true, true, nil
+	}
+	return k.UserValue, false, true, nil
+}
+
+// TableIterator SSTable 中所有记录（包括删除标记）的迭代器：先在 index block 中找到 data block，再在块内查找
+type TableIterator struct {
+	t     *TableReader
+	index *blockIter
+	data  *blockIter
+	err   error
+}
+
+// NewIterator 创建迭代器，使用前需要 Seek 或者 SeekToFirst
+func (t *TableReader) NewIterator() *TableIterator {
+	return &TableIterator{t: t, index: t.index.iter(t.compare)}
+}
+
+// Valid 是否指向一条记录
+func (it *TableIterator) Valid() bool {
+	return it.err == nil && it.data != nil && it.data.Valid()
+}
+
+// Err 读取或者解析过程中的错误
+func (it *TableIterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.index.err
+}
+
+// Key 当前记录，UserValue 为记录的值，和 MemTable.NewInternalIterator 的 key 一致
+func (it *TableIterator) Key() *InternalKey {
+	k, err := DecodeInternalKey(it.data.key)
+	if err != nil {
+		it.err = err
+		return &InternalKey{}
+	}
+	k.UserValue = it.data.value
+	return k
+}
+
+// SeekToFirst 移动到第一条记录
+func (it *TableIterator) SeekToFirst() {
+	it.index.SeekToFirst()
+	if it.loadBlock() {
+		it.data.SeekToFirst()
+	}
+	it.skipEmpty()
+}
+
+// Seek 移动到第一个大于等于 key 的记录
+func (it *TableIterator) Seek(key *InternalKey) {
+	target := key.Encode()
+	// index 的 key 是每个块最后的 key，第一个大于等于 target 的块包含目标
+	it.index.Seek(target)
+	if it.loadBlock() {
+		it.data.Seek(target)
+	}
+	it.skipEmpty()
+}
+
+// Next 移动到下一条记录
+func (it *TableIterator) Next() {
+	it.data.Next()
+	it.skipEmpty()
+}
+
+// loadBlock 读取 index 当前指向的 data block
+func (it *TableIterator) loadBlock() bool {
+	it.data = nil
+	if !it.index.Valid() || it.err != nil {
+		return false
+	}
+	h, err := decodeBlockHandle(it.index.value)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	b, err := it.t.readBlock(h)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	it.data = b.iter(it.t.compare)
+	return true
+}
+
+// skipEmpty 当前块读完时移动到下一个块
+func (it *TableIterator) skipEmpty() {
+	for it.data != nil && !it.data.Valid() {
+		if it.data.err != nil {
+			it.err = it.data.err
+			return
+		}
+		it.index.Next()
+		if it.loadBlock() {
+			it.data.SeekToFirst()
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package leveldb
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func buildTestTable(t *testing.T, opts *TableOptions) (*MemTable, []byte) {
+	mem := NewMemTable(nil)
+	seq := int64(0)
+	for i := 0; i < 2000; i++ {
+		seq++
+		mem.Add(seq, TypeValue, []byte(fmt.Sprintf("key-%05d", i)), []byte(fmt.Sprintf("v%d", i)))
+	}
+	// 部分 key 有新版本和删除标记
+	for i := 0; i < 2000; i += 10 {
+		seq++
+		if i%20 == 0 {
+			mem.Add(seq, TypeDeletion, []byte(fmt.Sprintf("key-%05d", i)), nil)
+		} else {
+			mem.Add(seq, TypeValue, []byte(fmt.Sprintf("key-%05d", i)), []byte("new"))
+		}
+	}
+	var buf bytes.Buffer
+	info, err := BuildTable(&buf, mem, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Entries != 2200 || info.Size != int64(buf.Len()) {
+		t.Fatalf("unexpected table info %+v", info)
+	}
+	if k, _ := DecodeInternalKey(info.Smallest); string(k.UserKey) != "key-00000" {
+		t.Fatalf("smallest %s", k.UserKey)
+	}
+	return mem, buf.Bytes()
+}
+
+func TestTableGet(t *testing.T) {
+	cache := NewBlockCache(1 << 20)
+	opts := &TableOptions{BlockSize: 512, Cache: cache}
+	mem, data := buildTestTable(t, opts)
+	table, err := OpenTable(bytes.NewReader(data), int64(len(data)), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2000; i++ {
+		key := []byte(fmt.Sprintf("key-%05d", i))
+		for _, seq := range []int64{int64(i), 2000, MaxSequence} {
+			wantV, wantDel, wantFound := mem.Get(key, seq)
+			v, del, found, err := table.Get(key, seq)
+			if err != nil || !bytes.Equal(v, wantV) || del != wantDel || found != wantFound {
+				t.Fatalf("get %s@%d: got %q %v %v %v want %q %v %v", key, seq, v, del, found, err, wantV, wantDel, wantFound)
+			}
+		}
+	}
+	if cache.Len() == 0 {
+		t.Fatal("blocks should be cached")
+	}
+
+	// 不存在的 key 大部分被 bloom 过滤器排除
+	falsePositive := 0
+	for i := 0; i < 10000; i++ {
+		if bloomMayContain(table.filter, []byte(fmt.Sprintf("missing-%d", i))) {
+			falsePositive++
+		}
+		if _, _, found, _ := table.Get([]byte(fmt.Sprintf("missing-%d", i)), MaxSequence); found {
+			t.Fatal("missing key found")
+		}
+	}
+	if falsePositive > 300 {
+		t.Fatalf("bloom false positive rate too high: %d/10000", falsePositive)
+	}
+}
+
+func TestTableIterator(t *testing.T) {
+	mem, data := buildTestTable(t, &TableOptions{BlockSize: 256, RestartInterval: 4})
+	table, err := OpenTable(bytes.NewReader(data), int64(len(data)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 和 MemTable 的内部迭代器逐条比较
+	want := mem.NewInternalIterator()
+	want.SeekToFirst()
+	it := table.NewIterator()
+	n := 0
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		if !want.Valid() {
+			t.Fatal("table has more entries than memtable")
+		}
+		w, got := want.Key().(*InternalKey), it.Key()
+		if !bytes.Equal(w.UserKey, got.UserKey) || w.Seq != got.Seq || w.Type != got.Type || !bytes.Equal(w.UserValue, got.UserValue) {
+			t.Fatalf("entry %d: want %s@%d got %s@%d", n, w.UserKey, w.Seq, got.UserKey, got.Seq)
+		}
+		want.Next()
+		n++
+	}
+	if it.Err() != nil || n != 2200 {
+		t.Fatalf("iterated %d entries, err %v", n, it.Err())
+	}
+
+	it.Seek(&InternalKey{UserKey: []byte("key-01000x"), Seq: MaxSequence, Type: TypeValue})
+	if !it.Valid() || string(it.Key().UserKey) != "key-01001" {
+		t.Fatalf("seek landed on %s", it.Key().UserKey)
+	}
+	it.Seek(&InternalKey{UserKey: []byte("zzz"), Seq: MaxSequence, Type: TypeValue})
+	if it.Valid() {
+		t.Fatal("seek past the end should be invalid")
+	}
+}
+
+func TestTableCorruption(t *testing.T) {
+	_, data := buildTestTable(t, nil)
+	if _, err := OpenTable(bytes.NewReader(data[:len(data)-1]), int64(len(data)-1), nil); err != ErrTableCorrupted {
+		t.Fatalf("truncated table: want ErrTableCorrupted got %v", err)
+	}
+	data[10] ^= 0xff
+	table, err := OpenTable(bytes.NewReader(data), int64(len(data)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := table.Get([]byte("key-00001"), MaxSequence); err != ErrTableCorrupted {
+		t.Fatalf("corrupted block: want ErrTableCorrupted got %v", err)
+	}
+
+	b := NewTableBuilder(&bytes.Buffer{}, nil)
+	b.Add(&InternalKey{UserKey: []byte("b"), Seq: 1, Type: TypeValue}, nil)
+	if err := b.Add(&InternalKey{UserKey: []byte("a"), Seq: 2, Type: TypeValue}, nil); err != ErrKeyOrder {
+		t.Fatalf("want ErrKeyOrder got %v", err)
+	}
+}
@@ -0,0 +1,452 @@
+package leveldb
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// numLevels 和 leveldb 一样分 7 层：L0 的文件由 MemTable 直接刷出，相互之间可能重叠；L1 及以上每层的文件按 key 排序并且不重叠
+const numLevels = 7
+
+// Version 某一时刻所有层的文件列表，创建之后不再修改。读操作和迭代器持有 Version 的引用，
+// 被引用的 Version 中的文件不会被删除
+type Version struct {
+	vset  *VersionSet
+	files [numLevels][]*FileMeta
+	refs  int
+
+	// 下一次 compaction 的层和分数，分数不小于 1 时需要 compaction
+	compactionLevel int
+	compactionScore float64
+}
+
+// VersionSet 管理当前的 Version 和 MANIFEST，所有方法由 DB.mu 保护
+type VersionSet struct {
+	dir            string
+	opts           *Options
+	current        *Version
+	live           map[*Version]bool // current 和所有被引用的 Version
+	nextFileNumber uint64
+	logNumber      uint64
+	lastSequence   int64
+	manifestNumber uint64
+	compactPointer [numLevels][]byte
+	manifestFile   *os.File
+	manifest       *LogWriter
+}
+
+func newVersionSet(dir string, opts *Options) *VersionSet {
+	vs := &VersionSet{dir: dir, opts: opts, nextFileNumber: 1, live: make(map[*Version]bool)}
+	vs.setCurrent(&Version{vset: vs})
+	return vs
+}
+
+func (v *Version) ref() {
+	v.refs++
+	v.vset.live[v] = true
+}
+
+func (v *Version) unref() {
+	v.refs--
+	if v.refs == 0 && v != v.vset.current {
+		delete(v.vset.live, v)
+	}
+}
+
+func (vs *VersionSet) setCurrent(v *Version) {
+	if old := vs.current; old != nil && old.refs == 0 {
+		delete(vs.live, old)
+	}
+	v.finalize()
+	vs.current = v
+	vs.live[v] = true
+}
+
+func (vs *VersionSet) newFileNumber() uint64 {
+	n := vs.nextFileNumber
+	vs.nextFileNumber++
+	return n
+}
+
+// markFileNumberUsed 恢复时发现的日志文件编号不能再分配
+func (vs *VersionSet) markFileNumberUsed(n uint64) {
+	if vs.nextFileNumber <= n {
+		vs.nextFileNumber = n + 1
+	}
+}
+
+func (vs *VersionSet) userCmp(a, b []byte) int {
+	return vs.opts.Comparator(a, b)
+}
+
+func (vs *VersionSet) compare(a, b []byte) int {
+	return compareInternalKey(vs.opts.Comparator, a, b)
+}
+
+func userKey(ikey []byte) []byte {
+	return ikey[:len(ikey)-8]
+}
+
+// apply 在 base 的基础上应用 edit 得到新的 Version
+func (vs *VersionSet) apply(base *Version, e *VersionEdit) (*Version, error) {
+	v := &Version{vset: vs}
+	for level := range base.files {
+		for _, f := range base.files[level] {
+			if !e.DeletedFiles[deletedFile{level: level, number: f.Number}] {
+				v.files[level] = append(v.files[level], f)
+			}
+		}
+	}
+	for _, f := range e.NewFiles {
+		if f.level < 0 || f.level >= numLevels {
+			return nil, ErrBadManifest
+		}
+		v.files[f.level] = append(v.files[f.level], f.meta)
+	}
+	// L0 按文件编号（新旧）排序，其它层按 key 排序
+	sort.Slice(v.files[0], func(i, j int) bool { return v.files[0][i].Number < v.files[0][j].Number })
+	for level := 1; level < numLevels; level++ {
+		files := v.files[level]
+		sort.Slice(files, func(i, j int) bool { return vs.compare(files[i].Smallest, files[j].Smallest) < 0 })
+	}
+	return v, nil
+}
+
+// applyCounters 记录 edit 中的计数器
+func (vs *VersionSet) applyCounters(e *VersionEdit) {
+	if e.hasLogNumber {
+		vs.logNumber = e.LogNumber
+	}
+	if e.hasNextFileNumber {
+		vs.markFileNumberUsed(e.NextFileNumber - 1)
+	}
+	if e.hasLastSequence && e.LastSequence > vs.lastSequence {
+		vs.lastSequence = e.LastSequence
+	}
+	for level, key := range e.CompactPointer {
+		if level >= 0 && level < numLevels {
+			vs.compactPointer[level] = key
+		}
+	}
+}
+
+// logAndApply 把 edit 写入 MANIFEST 并切换到新的 Version。还没有 MANIFEST 时先写一个完整的快照
+func (vs *VersionSet) logAndApply(e *VersionEdit) error {
+	if !e.hasLogNumber {
+		e.SetLogNumber(vs.logNumber)
+	}
+	e.SetNextFileNumber(vs.nextFileNumber)
+	e.SetLastSequence(vs.lastSequence)
+	v, err := vs.apply(vs.current, e)
+	if err != nil {
+		return err
+	}
+	if vs.manifest == nil {
+		if err := vs.writeSnapshot(); err != nil {
+			return err
+		}
+	}
+	if err := vs.manifest.AddRecord(e.Encode()); err != nil {
+		return err
+	}
+	if err := vs.manifestFile.Sync(); err != nil {
+		return err
+	}
+	vs.applyCounters(e)
+	vs.setCurrent(v)
+	return nil
+}
+
+// writeSnapshot 创建新的 MANIFEST，第一条记录为当前 Version 的完整内容，然后更新 CURRENT
+func (vs *VersionSet) writeSnapshot() error {
+	number := vs.newFileNumber()
+	f, err := os.Create(manifestFileName(vs.dir, number))
+	if err != nil {
+		return err
+	}
+	snapshot := &VersionEdit{}
+	snapshot.SetLogNumber(vs.logNumber)
+	snapshot.SetNextFileNumber(vs.nextFileNumber)
+	snapshot.SetLastSequence(vs.lastSequence)
+	for level, key := range vs.compactPointer {
+		if key != nil {
+			snapshot.SetCompactPointer(level, key)
+		}
+	}
+	for level, files := range vs.current.files {
+		for _, meta := range files {
+			snapshot.AddFile(level, meta)
+		}
+	}
+	w := NewLogWriter(f)
+	if err := w.AddRecord(snapshot.Encode()); err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = setCurrentFile(vs.dir, number)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if vs.manifestFile != nil {
+		vs.manifestFile.Close()
+	}
+	vs.manifestFile, vs.manifest, vs.manifestNumber = f, w, number
+	return nil
+}
+
+// setCurrentFile 通过临时文件和 rename 原子地更新 CURRENT
+func setCurrentFile(dir string, manifest uint64) error {
+	tmp := filepath.Join(dir, fmt.Sprintf("%06d.dbtmp", manifest))
+	name := filepath.Base(manifestFileName(dir, manifest))
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err = f.WriteString(name + "\n"); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, filepath.Join(dir, "CURRENT"))
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// recover 读取 CURRENT 指向的 MANIFEST，依次重放所有的 edit
+func (vs *VersionSet) recover() error {
+	current, err := ioutil.ReadFile(filepath.Join(vs.dir, "CURRENT"))
+	if err != nil {
+		return err
+	}
+	name := strings.TrimSpace(string(current))
+	f, err := os.Open(filepath.Join(vs.dir, name))
+	if err != nil {
+		return fmt.Errorf("leveldb: open manifest %s: %w", name, err)
+	}
+	defer f.Close()
+	var corruption error
+	reader := NewLogReader(f, func(dropped int, reason error) {
+		corruption = reason
+	})
+	v := vs.current
+	hasLog, hasNext := false, false
+	for {
+		record, err := reader.ReadRecord()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		e, err := DecodeVersionEdit(record)
+		if err != nil {
+			return err
+		}
+		if v, err = vs.apply(v, e); err != nil {
+			return err
+		}
+		vs.applyCounters(e)
+		hasLog = hasLog || e.hasLogNumber
+		hasNext = hasNext || e.hasNextFileNumber
+	}
+	// MANIFEST 的每条记录都 fsync 过，中间有损坏时不能确定文件列表
+	if corruption != nil {
+		return fmt.Errorf("leveldb: manifest %s: %w", name, corruption)
+	}
+	if !hasLog || !hasNext {
+		return fmt.Errorf("%w: %s has no log number or next file number", ErrBadManifest, name)
+	}
+	var number uint64
+	fmt.Sscanf(name, "MANIFEST-%d", &number)
+	vs.markFileNumberUsed(number)
+	vs.setCurrent(v)
+	return nil
+}
+
+// liveFiles 所有被引用的 Version 中的文件
+func (vs *VersionSet) liveFiles() map[uint64]bool {
+	live := make(map[uint64]bool)
+	for v := range vs.live {
+		for _, files := range v.files {
+			for _, f := range files {
+				live[f.Number] = true
+			}
+		}
+	}
+	return live
+}
+
+func (vs *VersionSet) close() {
+	if vs.manifestFile != nil {
+		vs.manifestFile.Close()
+	}
+}
+
+// maxBytesForLevel L1 为 BaseLevelSize，之后每层乘以 10
+func (vs *VersionSet) maxBytesForLevel(level int) float64 {
+	size := float64(vs.opts.BaseLevelSize)
+	for ; level > 1; level-- {
+		size *= 10
+	}
+	return size
+}
+
+// finalize 计算下一次 compaction 的层：L0 按文件数，其它层按总大小
+func (v *Version) finalize() {
+	v.compactionLevel, v.compactionScore = -1, 0
+	if v.vset == nil || v.vset.opts == nil {
+		return
+	}
+	for level := 0; level < numLevels-1; level++ {
+		var score float64
+		if level == 0 {
+			score = float64(len(v.files[0])) / float64(v.vset.opts.L0CompactionTrigger)
+		} else {
+			var total int64
+			for _, f := range v.files[level] {
+				total += f.Size
+			}
+			score = float64(total) / v.vset.maxBytesForLevel(level)
+		}
+		if score > v.compactionScore {
+			v.compactionLevel, v.compactionScore = level, score
+		}
+	}
+}
+
+// overlapping level 中和 [smallest, largest]（user key）有重叠的文件
+func (v *Version) overlapping(level int, smallest, largest []byte) []*FileMeta {
+	var files []*FileMeta
+	for _, f := range v.files[level] {
+		if v.vset.userCmp(userKey(f.Largest), smallest) < 0 || v.vset.userCmp(userKey(f.Smallest), largest) > 0 {
+			continue
+		}
+		files = append(files, f)
+	}
+	return files
+}
+
+// get 按 L0（从新到旧）、L1、L2... 的顺序查找，返回值的含义和 MemTable.Get 相同
+func (v *Version) get(tables *tableCache, key []byte, seq int64) ([]byte, bool, bool, error) {
+	var candidates []*FileMeta
+	l0 := v.overlapping(0, key, key)
+	for i := len(l0) - 1; i >= 0; i-- {
+		candidates = append(candidates, l0[i])
+	}
+	lookup := (&InternalKey{UserKey: key, Seq: seq, Type: TypeValue}).Encode()
+	for level := 1; level < numLevels; level++ {
+		files := v.files[level]
+		// 第一个 largest 不小于 key 的文件
+		i := sort.Search(len(files), func(i int) bool { return v.vset.compare(files[i].Largest, lookup) >= 0 })
+		if i < len(files) && v.vset.userCmp(key, userKey(files[i].Smallest)) >= 0 {
+			candidates = append(candidates, files[i])
+		}
+	}
+	for _, f := range candidates {
+		t, release, err := tables.get(f.Number)
+		if err != nil {
+			return nil, false, false, err
+		}
+		value, deleted, found, err := t.Get(key, seq)
+		release()
+		if err != nil || found {
+			return value, deleted, found, err
+		}
+	}
+	return nil, false, false, nil
+}
+
+// compaction 一次 compaction 的输入：inputs[0] 在 level，inputs[1] 在 level+1
+type compaction struct {
+	level   int
+	inputs  [2][]*FileMeta
+	version *Version
+}
+
+// pickCompaction 选择下一次 compaction，不需要时返回 nil。
+// L0 的文件相互重叠，一次合并所有 L0 文件；其它层从上次结束的位置开始轮流选择一个文件
+func (vs *VersionSet) pickCompaction() *compaction {
+	v := vs.current
+	if v.compactionScore < 1 {
+		return nil
+	}
+	c := &compaction{level: v.compactionLevel, version: v}
+	files := v.files[c.level]
+	if c.level == 0 {
+		c.inputs[0] = append(c.inputs[0], files...)
+	} else {
+		pick := files[0]
+		if ptr := vs.compactPointer[c.level]; ptr != nil {
+			for _, f := range files {
+				if vs.compare(f.Largest, ptr) > 0 {
+					pick = f
+					break
+				}
+			}
+		}
+		c.inputs[0] = []*FileMeta{pick}
+	}
+	smallest, largest := c.userRange(c.inputs[0])
+	c.inputs[1] = v.overlapping(c.level+1, smallest, largest)
+	v.ref()
+	return c
+}
+
+// userRange 文件的 user key 范围
+func (c *compaction) userRange(files []*FileMeta) ([]byte, []byte) {
+	cmp := c.version.vset.userCmp
+	smallest, largest := userKey(files[0].Smallest), userKey(files[0].Largest)
+	for _, f := range files[1:] {
+		if cmp(userKey(f.Smallest), smallest) < 0 {
+			smallest = userKey(f.Smallest)
+		}
+		if cmp(userKey(f.Largest), largest) > 0 {
+			largest = userKey(f.Largest)
+		}
+	}
+	return smallest, largest
+}
+
+// isTrivialMove 只有一个输入文件并且下一层没有重叠时，直接把文件移到下一层
+func (c *compaction) isTrivialMove() bool {
+	return c.level > 0 && len(c.inputs[0]) == 1 && len(c.inputs[1]) == 0
+}
+
+// isBaseLevelForKey 更深的层中没有 key，删除标记可以丢弃
+func (c *compaction) isBaseLevelForKey(key []byte) bool {
+	for level := c.level + 2; level < numLevels; level++ {
+		if len(c.version.overlapping(level, key, key)) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// edit 删除输入文件，输出文件加到 level+1
+func (c *compaction) edit(outputs []*FileMeta) *VersionEdit {
+	e := &VersionEdit{}
+	for i, files := range c.inputs {
+		for _, f := range files {
+			e.DeleteFile(c.level+i, f.Number)
+		}
+	}
+	for _, f := range outputs {
+		e.AddFile(c.level+1, f)
+	}
+	last := c.inputs[0][len(c.inputs[0])-1]
+	e.SetCompactPointer(c.level, last.Largest)
+	return e
+}
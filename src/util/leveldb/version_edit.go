@@ -0,0 +1,175 @@
+package leveldb
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// ErrBadManifest MANIFEST 中的记录格式不对
+var ErrBadManifest = errors.New("leveldb: bad manifest record")
+
+// FileMeta 一个 SSTable 文件的元数据
+type FileMeta struct {
+	Number   uint64
+	Size     int64
+	Smallest []byte // 最小的 internal key（编码后）
+	Largest  []byte // 最大的 internal key（编码后）
+}
+
+// VersionEdit 两个 Version 之间的差异，每次 flush 或者 compaction 之后作为一条记录追加到 MANIFEST，
+// 打开 DB 时依次重放得到当前的文件列表
+type VersionEdit struct {
+	LogNumber      uint64 // 小于这个编号的日志已经写入 SSTable
+	NextFileNumber uint64
+	LastSequence   int64
+	CompactPointer map[int][]byte // level -> 下一次 compaction 从这个 key 之后开始
+	DeletedFiles   map[deletedFile]bool
+	NewFiles       []newFile
+
+	hasLogNumber, hasNextFileNumber, hasLastSequence bool
+}
+
+type deletedFile struct {
+	level  int
+	number uint64
+}
+
+type newFile struct {
+	level int
+	meta  *FileMeta
+}
+
+// 记录的字段编号，和 leveldb 一致
+const (
+	tagLogNumber      = 2
+	tagNextFileNumber = 3
+	tagLastSequence   = 4
+	tagCompactPointer = 5
+	tagDeletedFile    = 6
+	tagNewFile        = 7
+)
+
+func (e *VersionEdit) SetLogNumber(n uint64) {
+	e.LogNumber, e.hasLogNumber = n, true
+}
+
+func (e *VersionEdit) SetNextFileNumber(n uint64) {
+	e.NextFileNumber, e.hasNextFileNumber = n, true
+}
+
+func (e *VersionEdit) SetLastSequence(seq int64) {
+	e.LastSequence, e.hasLastSequence = seq, true
+}
+
+func (e *VersionEdit) SetCompactPointer(level int, key []byte) {
+	if e.CompactPointer == nil {
+		e.CompactPointer = make(map[int][]byte)
+	}
+	e.CompactPointer[level] = key
+}
+
+// DeleteFile 从 level 中删除文件
+func (e *VersionEdit) DeleteFile(level int, number uint64) {
+	if e.DeletedFiles == nil {
+		e.DeletedFiles = make(map[deletedFile]bool)
+	}
+	e.DeletedFiles[deletedFile{level: level, number: number}] = true
+}
+
+// AddFile 向 level 中添加文件
+func (e *VersionEdit) AddFile(level int, meta *FileMeta) {
+	e.NewFiles = append(e.NewFiles, newFile{level: level, meta: meta})
+}
+
+// Encode 编码为 [varint tag][字段] 的序列
+func (e *VersionEdit) Encode() []byte {
+	var buf []byte
+	putUvarint := func(v uint64) {
+		var tmp [binary.MaxVarintLen64]byte
+		n := binary.PutUvarint(tmp[:], v)
+		buf = append(buf, tmp[:n]...)
+	}
+	if e.hasLogNumber {
+		putUvarint(tagLogNumber)
+		putUvarint(e.LogNumber)
+	}
+	if e.hasNextFileNumber {
+		putUvarint(tagNextFileNumber)
+		putUvarint(e.NextFileNumber)
+	}
+	if e.hasLastSequence {
+		putUvarint(tagLastSequence)
+		putUvarint(uint64(e.LastSequence))
+	}
+	for level, key := range e.CompactPointer {
+		putUvarint(tagCompactPointer)
+		putUvarint(uint64(level))
+		buf = appendBytes(buf, key)
+	}
+	for f := range e.DeletedFiles {
+		putUvarint(tagDeletedFile)
+		putUvarint(uint64(f.level))
+		putUvarint(f.number)
+	}
+	for _, f := range e.NewFiles {
+		putUvarint(tagNewFile)
+		putUvarint(uint64(f.level))
+		putUvarint(f.meta.Number)
+		putUvarint(uint64(f.meta.Size))
+		buf = appendBytes(buf, f.meta.Smallest)
+		buf = appendBytes(buf, f.meta.Largest)
+	}
+	return buf
+}
+
+// DecodeVersionEdit 解析 Encode 的结果
+func DecodeVersionEdit(data []byte) (*VersionEdit, error) {
+	e := &VersionEdit{}
+	bad := false
+	getUvarint := func() uint64 {
+		v, n := binary.Uvarint(data)
+		if n <= 0 {
+			bad = true
+			return 0
+		}
+		data = data[n:]
+		return v
+	}
+	getBytes := func() []byte {
+		b, rest, ok := readBytes(data)
+		if !ok {
+			bad = true
+			return nil
+		}
+		data = rest
+		return append([]byte(nil), b...)
+	}
+	for len(data) > 0 && !bad {
+		switch getUvarint() {
+		case tagLogNumber:
+			e.SetLogNumber(getUvarint())
+		case tagNextFileNumber:
+			e.SetNextFileNumber(getUvarint())
+		case tagLastSequence:
+			e.SetLastSequence(int64(getUvarint()))
+		case tagCompactPointer:
+			level := int(getUvarint())
+			e.SetCompactPointer(level, getBytes())
+		case tagDeletedFile:
+			level := int(getUvarint())
+			e.DeleteFile(level, getUvarint())
+		case tagNewFile:
+			level := int(getUvarint())
+			meta := &FileMeta{Number: getUvarint(), Size: int64(getUvarint())}
+			meta.Smallest = getBytes()
+			meta.Largest = getBytes()
+			e.AddFile(level, meta)
+		default:
+			bad = true
+		}
+	}
+	if bad {
+		return nil, ErrBadManifest
+	}
+	return e, nil
+}
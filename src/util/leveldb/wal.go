@@ -0,0 +1,102 @@
+package leveldb
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// WriteOptions 写入选项
+type WriteOptions struct {
+	// Sync 为 true 时写入 WAL 之后 fsync 才返回，否则只写到操作系统的缓存，进程崩溃不丢数据，机器掉电可能丢失最近的写入
+	Sync bool
+}
+
+// WAL 预写日志：每个 WriteBatch 先作为一条记录写到日志文件，再写 MemTable，重启时从日志恢复 MemTable
+type WAL struct {
+	file   *os.File
+	writer *LogWriter
+}
+
+// OpenWAL 打开日志文件，已经存在时追加到末尾。
+// 原来的末尾有写了一半的记录时，追加的记录和它在同一个块里会被读取方一起跳过，所以恢复之后应该写新的文件
+func OpenWAL(path string) (*WAL, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &WAL{file: f, writer: NewLogWriterAt(f, info.Size())}, nil
+}
+
+// Write 写入一个 batch
+func (l *WAL) Write(b *WriteBatch, opts WriteOptions) error {
+	if err := l.writer.AddRecord(b.Contents()); err != nil {
+		return err
+	}
+	if opts.Sync {
+		return l.file.Sync()
+	}
+	return nil
+}
+
+// Sync fsync 日志文件
+func (l *WAL) Sync() error {
+	return l.file.Sync()
+}
+
+// Close 关闭日志文件
+func (l *WAL) Close() error {
+	return l.file.Close()
+}
+
+// RecoverLog 读取日志中的所有 batch 写入 mem，返回最大的 seq。损坏的记录被跳过并打印日志，末尾写了一半的记录被忽略
+func RecoverLog(r io.Reader, mem *MemTable) (int64, error) {
+	reader := NewLogReader(r, func(dropped int, reason error) {
+		log.Printf("leveldb: recover log dropped %d bytes: %v", dropped, reason)
+	})
+	var maxSeq int64
+	for {
+		record, err := reader.ReadRecord()
+		if err == io.EOF {
+			return maxSeq, nil
+		}
+		if err != nil {
+			return maxSeq, err
+		}
+		b, err := DecodeWriteBatch(record)
+		if err == nil {
+			err = b.InsertInto(mem)
+		}
+		if err != nil {
+			// crc 校验通过但是内容不对，说明写入方有问题，不能静默跳过
+			return maxSeq, fmt.Errorf("leveldb: recover log: %w", err)
+		}
+		if last := b.Sequence() + int64(b.Count()) - 1; last > maxSeq {
+			maxSeq = last
+		}
+	}
+}
+
+// RecoverLogFile 从日志文件恢复 MemTable，文件不存在时返回空的 MemTable
+func RecoverLogFile(path string, userCmp func(a, b []byte) int) (*MemTable, int64, error) {
+	mem := NewMemTable(userCmp)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return mem, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	maxSeq, err := RecoverLog(f, mem)
+	if err != nil {
+		return nil, 0, err
+	}
+	return mem, maxSeq, nil
+}
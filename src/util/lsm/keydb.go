@@ -2,7 +2,7 @@ package lsm
 
 import (
 	"fmt"
-	"github.com/robaho/keydb"
+	"time"
 )
 
 // LSM Tree (Log-structured merge-tree)
@@ -15,35 +15,42 @@ import (
 //       对于内存，高效读的数据结构选择比较多，针对不同的场景有很多的选择，本项目使用的是 AVL树 。
 //       对于磁盘，高效的数据结构往往都来自于索引和并发io。在本项目中，使用了 key/data文件（索引）、分段segment（并发）、快照读来（并发）技术。
 
-func TestKeyDb() {
-	// 从指定目录打开一个数据库实例，所有的数据最终会写入到此目录中
-	db, err := keydb.Open("/Users/zhangdanfeng/GoPro/src/github.com/shark/templates/keydb", true)
+// TestKeyDb 在 dir 下演示 Store 的基本用法，dir 例如 templates/keydb
+func TestKeyDb(dir string) (err error) {
+	// 从指定目录打开一个数据库实例，所有的数据最终会写入到此目录中，后台每分钟合并一次 segment
+	s, err := OpenKeyDB(Options{Dir: dir, MergeInterval: time.Minute, SyncCommit: true, MergeOnClose: true})
 	if err != nil {
-		panic(err)
+		return err
 	}
+	// 关闭时显式合并
+	defer func() {
+		if cerr := s.Close(); err == nil {
+			err = cerr
+		}
+	}()
 	// 开启一个操作gogo表的事务，注意在keydb中单个事务只能读写同一个表
-	// 单个表的数据最终会落地在以表名开头的一系列文件中
-	tx, err := db.BeginTX("gogo")
+	// 单个表的数据最终会落地在以表名开头的一系列文件中，事务的所有修改在提交时一起落盘
+	err = s.Update("gogo", func(tx Tx) error {
+		// 往此事务中写入数据，此时数据仍未持久化到磁盘，是内存操作，速度快
+		if err := tx.Put([]byte("k1"), []byte("v1")); err != nil {
+			return err
+		}
+		return tx.Put([]byte("k2"), []byte("v2"))
+	})
 	if err != nil {
-		panic(err)
-	}
-	// 往此事务中写入一个数据，此时数据仍未持久化到磁盘，是内存操作，速度快
-	err = tx.Put([]byte("k1"), []byte("v1"))
-	if err != nil {
-		panic(err)
+		return err
 	}
 	// 按key读取数据，未命中内存的时候才会去磁盘中读取
-	value, err := tx.Get([]byte("k1"))
+	value, err := s.Get("gogo", []byte("k1"))
 	if err != nil {
-		panic(err)
+		return err
 	}
-	fmt.Printf("value:%v", value)
-	// 此次事务的所有修改一起落盘
-	if err = tx.CommitSync(); err != nil {
-		panic(err)
-	}
-	// 关闭数据库，并显示调用合并方法
-	if err = db.CloseWithMerge(1); err != nil {
-		panic(err)
+	fmt.Printf("value:%s\n", value)
+	// 按前缀遍历
+	keys, err := Keys(s, "gogo", []byte("k"), 0)
+	if err != nil {
+		return err
 	}
+	fmt.Printf("keys:%q\n", keys)
+	return nil
 }
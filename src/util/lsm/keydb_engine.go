@@ -0,0 +1,103 @@
+package lsm
+
+import (
+	"github.com/robaho/keydb"
+)
+
+// OpenKeyDB 打开 opts.Dir 下的 keydb 数据库
+func OpenKeyDB(opts Options) (*KeyDBStore, error) {
+	return openStore(opts, openKeyDBEngine)
+}
+
+func openKeyDBEngine(dir string) (engine, error) {
+	db, err := keydb.Open(dir, true)
+	if err != nil {
+		return nil, mapKeyDBErr(err)
+	}
+	return keydbEngine{db}, nil
+}
+
+// keydbEngine 把 keydb 适配为 engine，并转换错误
+type keydbEngine struct {
+	db *keydb.Database
+}
+
+func (e keydbEngine) BeginTX(table string) (engineTx, error) {
+	tx, err := e.db.BeginTX(table)
+	if err != nil {
+		return nil, mapKeyDBErr(err)
+	}
+	return keydbEngineTx{tx}, nil
+}
+
+func (e keydbEngine) Close() error {
+	return mapKeyDBErr(e.db.Close())
+}
+
+func (e keydbEngine) CloseWithMerge(segments int) error {
+	return mapKeyDBErr(e.db.CloseWithMerge(segments))
+}
+
+type keydbEngineTx struct {
+	tx *keydb.Transaction
+}
+
+func (t keydbEngineTx) Get(key []byte) ([]byte, error) {
+	value, err := t.tx.Get(key)
+	return value, mapKeyDBErr(err)
+}
+
+func (t keydbEngineTx) Put(key, value []byte) error {
+	return mapKeyDBErr(t.tx.Put(key, value))
+}
+
+func (t keydbEngineTx) Remove(key []byte) ([]byte, error) {
+	value, err := t.tx.Remove(key)
+	return value, mapKeyDBErr(err)
+}
+
+func (t keydbEngineTx) Lookup(lower, upper []byte) (engineIterator, error) {
+	it, err := t.tx.Lookup(lower, upper)
+	if err != nil {
+		return nil, mapKeyDBErr(err)
+	}
+	return keydbIterator{it}, nil
+}
+
+func (t keydbEngineTx) Commit() error {
+	return mapKeyDBErr(t.tx.Commit())
+}
+
+func (t keydbEngineTx) CommitSync() error {
+	return mapKeyDBErr(t.tx.CommitSync())
+}
+
+func (t keydbEngineTx) Rollback() error {
+	return mapKeyDBErr(t.tx.Rollback())
+}
+
+type keydbIterator struct {
+	it keydb.LookupIterator
+}
+
+func (i keydbIterator) Next() ([]byte, []byte, error) {
+	key, value, err := i.it.Next()
+	return key, value, mapKeyDBErr(err)
+}
+
+// mapKeyDBErr 把 keydb 的错误转换为本包的错误
+func mapKeyDBErr(err error) error {
+	switch err {
+	case keydb.KeyNotFound:
+		return ErrNotFound
+	case keydb.EmptyKey:
+		return ErrEmptyKey
+	case keydb.KeyTooLong:
+		return ErrKeyTooLong
+	case keydb.DatabaseClosed:
+		return ErrClosed
+	case keydb.EndOfIterator:
+		return errEndOfIterator
+	}
+	return err
+}
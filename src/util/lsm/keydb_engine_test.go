@@ -0,0 +1,59 @@
+package lsm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeyDBStore(t *testing.T) {
+	testStore(t, func(t *testing.T) Store {
+		s, err := OpenKeyDB(Options{Dir: t.TempDir()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
+
+func TestKeyDBStoreMerge(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenKeyDB(Options{Dir: dir, MergeInterval: 10 * time.Millisecond, SyncCommit: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 后台合并和写入交替进行，数据不丢
+	for i := 0; i < 50; i++ {
+		if err := s.Put("t", []byte{'k', byte(i)}, []byte{byte(i + 1)}); err != nil {
+			t.Fatal(err)
+		}
+		if i%10 == 0 {
+			time.Sleep(15 * time.Millisecond)
+		}
+	}
+	if err := s.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = OpenKeyDB(Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	keys, err := Keys(s, "t", []byte("k"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 50 {
+		t.Fatalf("got %d keys after reopen, want 50", len(keys))
+	}
+	for i := 0; i < 50; i++ {
+		v, err := s.Get("t", []byte{'k', byte(i)})
+		if err != nil || len(v) != 1 || v[0] != byte(i+1) {
+			t.Fatalf("get k%d = %v, %v", i, v, err)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package lsm
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Options KeyDBStore 的配置
+type Options struct {
+	// Dir 数据目录，不存在时自动创建
+	Dir string
+	// MergeInterval 后台合并 segment 的间隔，为 0 时不做后台合并
+	MergeInterval time.Duration
+	// MergeSegments 合并之后每个表保留的 segment 数，默认为 1
+	MergeSegments int
+	// SyncCommit 提交事务时是否同步刷盘
+	SyncCommit bool
+	// MergeOnClose Close 时是否合并
+	MergeOnClose bool
+}
+
+// engine KeyDBStore 用到的 keydb 接口，keydb_engine.go 中是 keydb 的实现，测试中可以替换。
+// 错误已经转换为本包的错误
+type engine interface {
+	BeginTX(table string) (engineTx, error)
+	Close() error
+	CloseWithMerge(segments int) error
+}
+
+type engineTx interface {
+	Get(key []byte) ([]byte, error)
+	Put(key, value []byte) error
+	Remove(key []byte) ([]byte, error)
+	// Lookup 遍历 [lower, upper]，结束时 Next 返回 errEndOfIterator
+	Lookup(lower, upper []byte) (engineIterator, error)
+	Commit() error
+	CommitSync() error
+	Rollback() error
+}
+
+type engineIterator interface {
+	Next() (key, value []byte, err error)
+}
+
+var errEndOfIterator = errors.New("lsm: end of iterator")
+
+// KeyDBStore 基于 keydb 的 Store。
+// keydb 只在 CloseWithMerge 时合并 segment，所以后台合并需要短暂地关闭并重新打开数据库，期间所有操作被阻塞
+type KeyDBStore struct {
+	opts Options
+	open func(dir string) (engine, error)
+
+	mu     sync.RWMutex // 普通操作持有读锁，合并和关闭持有写锁
+	db     engine
+	err    error // 重新打开失败的错误，之后所有操作都返回它
+	closed bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+var _ Store = (*KeyDBStore)(nil)
+
+func openStore(opts Options, open func(dir string) (engine, error)) (*KeyDBStore, error) {
+	if opts.MergeSegments <= 0 {
+		opts.MergeSegments = 1
+	}
+	db, err := open(opts.Dir)
+	if err != nil {
+		return nil, wrapErr("open", "", err)
+	}
+	s := &KeyDBStore{
+		opts: opts,
+		open: open,
+		db:   db,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if opts.MergeInterval > 0 {
+		go s.mergeLoop()
+	} else {
+		close(s.done)
+	}
+	return s, nil
+}
+
+func (s *KeyDBStore) Get(table string, key []byte) (value []byte, err error) {
+	err = s.View(table, func(tx Tx) error {
+		value, err = tx.Get(key)
+		return err
+	})
+	return value, wrapErr("get", table, err)
+}
+
+func (s *KeyDBStore) Put(table string, key, value []byte) error {
+	return wrapErr("put", table, s.Update(table, func(tx Tx) error {
+		return tx.Put(key, value)
+	}))
+}
+
+func (s *KeyDBStore) Delete(table string, key []byte) error {
+	return wrapErr("delete", table, s.Update(table, func(tx Tx) error {
+		return tx.Delete(key)
+	}))
+}
+
+func (s *KeyDBStore) Update(table string, fn func(tx Tx) error) error {
+	return s.do(table, false, fn)
+}
+
+func (s *KeyDBStore) View(table string, fn func(tx Tx) error) error {
+	return s.do(table, true, fn)
+}
+
+func (s *KeyDBStore) do(table string, readOnly bool, fn func(tx Tx) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if err := s.checkOpen(); err != nil {
+		return wrapErr("begin", table, err)
+	}
+	tx, err := s.db.BeginTX(table)
+	if err != nil {
+		return wrapErr("begin", table, err)
+	}
+	if err = fn(&keydbTx{tx: tx, table: table, readOnly: readOnly}); err != nil || readOnly {
+		tx.Rollback()
+		return err
+	}
+	if s.opts.SyncCommit {
+		err = tx.CommitSync()
+	} else {
+		err = tx.Commit()
+	}
+	return wrapErr("commit", table, err)
+}
+
+// Merge 立即合并所有表的 segment
+func (s *KeyDBStore) Merge() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkOpen(); err != nil {
+		return wrapErr("merge", "", err)
+	}
+	if err := s.db.CloseWithMerge(s.opts.MergeSegments); err != nil {
+		s.err = err
+		return wrapErr("merge", "", err)
+	}
+	db, err := s.open(s.opts.Dir)
+	if err != nil {
+		s.err = err
+		return wrapErr("merge", "", err)
+	}
+	s.db = db
+	return nil
+}
+
+func (s *KeyDBStore) mergeLoop() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.opts.MergeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			// 出错时 s.err 已经记录，后续操作会返回它
+			if s.Merge() != nil {
+				return
+			}
+		}
+	}
+}
+
+// Close 停止后台合并并关闭数据库，MergeOnClose 时关闭前合并
+func (s *KeyDBStore) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return wrapErr("close", "", ErrClosed)
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	close(s.stop)
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return wrapErr("close", "", s.err)
+	}
+	var err error
+	if s.opts.MergeOnClose {
+		err = s.db.CloseWithMerge(s.opts.MergeSegments)
+	} else {
+		err = s.db.Close()
+	}
+	return wrapErr("close", "", err)
+}
+
+func (s *KeyDBStore) checkOpen() error {
+	if s.closed {
+		return ErrClosed
+	}
+	return s.err
+}
+
+type keydbTx struct {
+	tx       engineTx
+	table    string
+	readOnly bool
+}
+
+func (t *keydbTx) Get(key []byte) ([]byte, error) {
+	if err := checkKey(key); err != nil {
+		return nil, wrapErr("get", t.table, err)
+	}
+	value, err := t.tx.Get(key)
+	return value, wrapErr("get", t.table, err)
+}
+
+func (t *keydbTx) Put(key, value []byte) error {
+	if t.readOnly {
+		return wrapErr("put", t.table, ErrReadOnly)
+	}
+	if err := checkPut(key, value); err != nil {
+		return wrapErr("put", t.table, err)
+	}
+	return wrapErr("put", t.table, t.tx.Put(key, value))
+}
+
+func (t *keydbTx) Delete(key []byte) error {
+	if t.readOnly {
+		return wrapErr("delete", t.table, ErrReadOnly)
+	}
+	if err := checkKey(key); err != nil {
+		return wrapErr("delete", t.table, err)
+	}
+	_, err := t.tx.Remove(key)
+	if err == ErrNotFound {
+		err = nil
+	}
+	return wrapErr("delete", t.table, err)
+}
+
+func (t *keydbTx) Scan(lower, upper []byte, fn func(key, value []byte) bool) error {
+	it, err := t.tx.Lookup(lower, upper)
+	if err != nil {
+		return wrapErr("scan", t.table, err)
+	}
+	for {
+		key, value, err := it.Next()
+		if err == errEndOfIterator {
+			return nil
+		}
+		if err != nil {
+			return wrapErr("scan", t.table, err)
+		}
+		if !fn(key, value) {
+			return nil
+		}
+	}
+}
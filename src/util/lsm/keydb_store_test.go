@@ -0,0 +1,241 @@
+package lsm
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDisk 模拟 keydb 的数据目录，fakeEngine 提交的数据保存在这里，重新打开时读回
+type fakeDisk struct {
+	mu       sync.Mutex
+	tables   map[string]map[string][]byte
+	merges   int
+	failOpen error
+}
+
+func newFakeDisk() *fakeDisk {
+	return &fakeDisk{tables: make(map[string]map[string][]byte)}
+}
+
+func (d *fakeDisk) open(dir string) (engine, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.failOpen != nil {
+		return nil, d.failOpen
+	}
+	return &fakeEngine{disk: d}, nil
+}
+
+type fakeEngine struct {
+	disk   *fakeDisk
+	closed bool // 由 disk.mu 保护
+}
+
+func (e *fakeEngine) BeginTX(table string) (engineTx, error) {
+	e.disk.mu.Lock()
+	defer e.disk.mu.Unlock()
+	if e.closed {
+		return nil, ErrClosed
+	}
+	return &fakeTx{e: e, table: table, writes: make(map[string][]byte)}, nil
+}
+
+func (e *fakeEngine) Close() error {
+	e.disk.mu.Lock()
+	defer e.disk.mu.Unlock()
+	if e.closed {
+		return ErrClosed
+	}
+	e.closed = true
+	return nil
+}
+
+func (e *fakeEngine) CloseWithMerge(segments int) error {
+	if err := e.Close(); err != nil {
+		return err
+	}
+	e.disk.mu.Lock()
+	e.disk.merges++
+	e.disk.mu.Unlock()
+	return nil
+}
+
+// fakeTx 和 keydb 一样，写入在提交之前只在事务内可见，空 value 表示删除
+type fakeTx struct {
+	e      *fakeEngine
+	table  string
+	writes map[string][]byte
+}
+
+func (t *fakeTx) Get(key []byte) ([]byte, error) {
+	if v, ok := t.writes[string(key)]; ok {
+		if len(v) == 0 {
+			return nil, ErrNotFound
+		}
+		return v, nil
+	}
+	t.e.disk.mu.Lock()
+	defer t.e.disk.mu.Unlock()
+	if v, ok := t.e.disk.tables[t.table][string(key)]; ok {
+		return v, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (t *fakeTx) Put(key, value []byte) error {
+	t.writes[string(key)] = append([]byte(nil), value...)
+	return nil
+}
+
+func (t *fakeTx) Remove(key []byte) ([]byte, error) {
+	v, err := t.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	t.writes[string(key)] = nil
+	return v, nil
+}
+
+func (t *fakeTx) Lookup(lower, upper []byte) (engineIterator, error) {
+	merged := make(map[string][]byte)
+	t.e.disk.mu.Lock()
+	for k, v := range t.e.disk.tables[t.table] {
+		merged[k] = v
+	}
+	t.e.disk.mu.Unlock()
+	for k, v := range t.writes {
+		merged[k] = v
+	}
+	it := &fakeIterator{}
+	for k, v := range merged {
+		if len(v) == 0 || (lower != nil && k < string(lower)) || (upper != nil && k > string(upper)) {
+			continue
+		}
+		it.keys = append(it.keys, k)
+		it.values = append(it.values, v)
+	}
+	sort.Sort(it)
+	return it, nil
+}
+
+func (t *fakeTx) Commit() error {
+	t.e.disk.mu.Lock()
+	defer t.e.disk.mu.Unlock()
+	if t.e.closed {
+		return ErrClosed
+	}
+	table := t.e.disk.tables[t.table]
+	if table == nil {
+		table = make(map[string][]byte)
+		t.e.disk.tables[t.table] = table
+	}
+	for k, v := range t.writes {
+		if len(v) == 0 {
+			delete(table, k)
+		} else {
+			table[k] = v
+		}
+	}
+	return nil
+}
+
+func (t *fakeTx) CommitSync() error { return t.Commit() }
+func (t *fakeTx) Rollback() error   { return nil }
+
+type fakeIterator struct {
+	keys   []string
+	values [][]byte
+}
+
+func (it *fakeIterator) Len() int           { return len(it.keys) }
+func (it *fakeIterator) Less(i, j int) bool { return it.keys[i] < it.keys[j] }
+func (it *fakeIterator) Swap(i, j int) {
+	it.keys[i], it.keys[j] = it.keys[j], it.keys[i]
+	it.values[i], it.values[j] = it.values[j], it.values[i]
+}
+
+func (it *fakeIterator) Next() ([]byte, []byte, error) {
+	if len(it.keys) == 0 {
+		return nil, nil, errEndOfIterator
+	}
+	k, v := it.keys[0], it.values[0]
+	it.keys, it.values = it.keys[1:], it.values[1:]
+	return []byte(k), v, nil
+}
+
+func TestKeyDBStoreFakeEngine(t *testing.T) {
+	testStore(t, func(t *testing.T) Store {
+		s, err := openStore(Options{}, newFakeDisk().open)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
+
+func TestKeyDBStoreBackgroundMerge(t *testing.T) {
+	disk := newFakeDisk()
+	s, err := openStore(Options{MergeInterval: time.Millisecond, MergeOnClose: true}, disk.open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 后台合并会关闭并重新打开数据库，和写入交替进行时数据不丢
+	for i := 0; i < 100; i++ {
+		if err := s.Put("t", []byte{'k', byte(i)}, []byte{byte(i + 1)}); err != nil {
+			t.Fatal(err)
+		}
+		if i%20 == 0 {
+			time.Sleep(3 * time.Millisecond)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	disk.mu.Lock()
+	merges := disk.merges
+	disk.mu.Unlock()
+	if merges < 2 {
+		t.Fatalf("want background merges and a merge on close, got %d", merges)
+	}
+
+	s, err = openStore(Options{}, disk.open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	keys, err := Keys(s, "t", []byte("k"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 100 {
+		t.Fatalf("got %d keys after reopen, want 100", len(keys))
+	}
+	if v, err := s.Get("t", []byte{'k', 42}); err != nil || !bytes.Equal(v, []byte{43}) {
+		t.Fatalf("get k42 = %v, %v", v, err)
+	}
+}
+
+func TestKeyDBStoreReopenFailure(t *testing.T) {
+	disk := newFakeDisk()
+	s, err := openStore(Options{}, disk.open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	boom := errors.New("boom")
+	disk.failOpen = boom
+	if err := s.Merge(); !errors.Is(err, boom) {
+		t.Fatalf("merge err = %v, want boom", err)
+	}
+	// 重新打开失败之后所有操作都返回这个错误
+	if err := s.Put("t", []byte("k"), []byte("v")); !errors.Is(err, boom) {
+		t.Fatalf("put after failed reopen = %v, want boom", err)
+	}
+	if err := s.Close(); !errors.Is(err, boom) {
+		t.Fatalf("close after failed reopen = %v, want boom", err)
+	}
+}
@@ -0,0 +1,210 @@
+package lsm
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+
+	"github.com/shark/src/util/skiplist"
+)
+
+// MemStore Store 的内存实现，每个表是一个 OrderedMap，用于测试。
+// 事务的写入先缓存在事务里，提交时在写锁下一次性生效；事务内可以读到自己的写入，但不隔离其它事务已提交的修改
+type MemStore struct {
+	mu     sync.RWMutex
+	tables map[string]*skiplist.OrderedMap
+	closed bool
+}
+
+var _ Store = (*MemStore)(nil)
+
+func NewMemStore() *MemStore {
+	return &MemStore{tables: make(map[string]*skiplist.OrderedMap)}
+}
+
+func (s *MemStore) Get(table string, key []byte) (value []byte, err error) {
+	err = s.View(table, func(tx Tx) error {
+		value, err = tx.Get(key)
+		return err
+	})
+	return value, wrapErr("get", table, err)
+}
+
+func (s *MemStore) Put(table string, key, value []byte) error {
+	return wrapErr("put", table, s.Update(table, func(tx Tx) error {
+		return tx.Put(key, value)
+	}))
+}
+
+func (s *MemStore) Delete(table string, key []byte) error {
+	return wrapErr("delete", table, s.Update(table, func(tx Tx) error {
+		return tx.Delete(key)
+	}))
+}
+
+func (s *MemStore) Update(table string, fn func(tx Tx) error) error {
+	tx := &memTx{s: s, table: table, writes: make(map[string][]byte)}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return wrapErr("commit", table, ErrClosed)
+	}
+	if len(tx.writes) == 0 {
+		return nil
+	}
+	t := s.tables[table]
+	if t == nil {
+		t = skiplist.NewOrderedMap(skiplist.BytesComparator)
+		s.tables[table] = t
+	}
+	for k, v := range tx.writes {
+		if v == nil {
+			t.Delete([]byte(k))
+		} else {
+			t.Set([]byte(k), v)
+		}
+	}
+	return nil
+}
+
+func (s *MemStore) View(table string, fn func(tx Tx) error) error {
+	return fn(&memTx{s: s, table: table, readOnly: true})
+}
+
+// Close 之后所有操作返回 ErrClosed，数据被丢弃
+func (s *MemStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return wrapErr("close", "", ErrClosed)
+	}
+	s.closed = true
+	s.tables = nil
+	return nil
+}
+
+// table 在读锁下返回表，表不存在时返回 nil
+func (s *MemStore) table(name string) (*skiplist.OrderedMap, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, ErrClosed
+	}
+	return s.tables[name], nil
+}
+
+type memTx struct {
+	s        *MemStore
+	table    string
+	readOnly bool
+	writes   map[string][]byte // 未提交的写入，nil 表示删除
+}
+
+func (tx *memTx) Get(key []byte) ([]byte, error) {
+	if err := checkKey(key); err != nil {
+		return nil, wrapErr("get", tx.table, err)
+	}
+	if v, ok := tx.writes[string(key)]; ok {
+		if v == nil {
+			return nil, wrapErr("get", tx.table, ErrNotFound)
+		}
+		return append([]byte(nil), v...), nil
+	}
+	t, err := tx.s.table(tx.table)
+	if err != nil {
+		return nil, wrapErr("get", tx.table, err)
+	}
+	if t != nil {
+		if v, ok := t.Get(key); ok {
+			return append([]byte(nil), v.([]byte)...), nil
+		}
+	}
+	return nil, wrapErr("get", tx.table, ErrNotFound)
+}
+
+func (tx *memTx) Put(key, value []byte) error {
+	if tx.readOnly {
+		return wrapErr("put", tx.table, ErrReadOnly)
+	}
+	if err := checkPut(key, value); err != nil {
+		return wrapErr("put", tx.table, err)
+	}
+	tx.writes[string(key)] = append([]byte(nil), value...)
+	return nil
+}
+
+func (tx *memTx) Delete(key []byte) error {
+	if tx.readOnly {
+		return wrapErr("delete", tx.table, ErrReadOnly)
+	}
+	if err := checkKey(key); err != nil {
+		return wrapErr("delete", tx.table, err)
+	}
+	tx.writes[string(key)] = nil
+	return nil
+}
+
+// Scan 把表中的记录和事务内的写入合并后遍历
+func (tx *memTx) Scan(lower, upper []byte, fn func(key, value []byte) bool) error {
+	t, err := tx.s.table(tx.table)
+	if err != nil {
+		return wrapErr("scan", tx.table, err)
+	}
+	inRange := func(k []byte) bool {
+		return (lower == nil || bytes.Compare(k, lower) >= 0) && (upper == nil || bytes.Compare(k, upper) <= 0)
+	}
+	// 事务内的写入按 key 排序，和表的迭代器做归并
+	pending := make([]string, 0, len(tx.writes))
+	for k := range tx.writes {
+		if inRange([]byte(k)) {
+			pending = append(pending, k)
+		}
+	}
+	sort.Strings(pending)
+
+	var it *skiplist.Iterator
+	if t != nil {
+		if lower == nil {
+			it = t.Iterator()
+		} else {
+			it = t.Seek(lower)
+		}
+	}
+	var key, value []byte
+	next := func() bool {
+		if it == nil || !it.Next() {
+			it = nil
+			return false
+		}
+		key, value = it.Key().([]byte), it.Value().([]byte)
+		return true
+	}
+	hasBase := next()
+	for hasBase || len(pending) > 0 {
+		var k, v []byte
+		switch {
+		case !hasBase || (len(pending) > 0 && bytes.Compare([]byte(pending[0]), key) <= 0):
+			if hasBase && pending[0] == string(key) {
+				hasBase = next()
+			}
+			k, v = []byte(pending[0]), tx.writes[pending[0]]
+			pending = pending[1:]
+			if v == nil {
+				continue
+			}
+		default:
+			k, v = key, value
+			hasBase = next()
+		}
+		if upper != nil && bytes.Compare(k, upper) > 0 {
+			return nil
+		}
+		if !fn(k, v) {
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package lsm
+
+import (
+	"bytes"
+	"errors"
+)
+
+// MaxKeyLen key 的最大长度，和 keydb 的限制相同
+const MaxKeyLen = 1024
+
+var (
+	// ErrNotFound key 不存在
+	ErrNotFound = errors.New("lsm: key not found")
+	// ErrEmptyKey key 为空
+	ErrEmptyKey = errors.New("lsm: empty key")
+	// ErrKeyTooLong key 超过 MaxKeyLen
+	ErrKeyTooLong = errors.New("lsm: key too long")
+	// ErrEmptyValue value 为空。keydb 用空 value 表示删除，所以不允许写入空 value，删除用 Delete
+	ErrEmptyValue = errors.New("lsm: empty value")
+	// ErrClosed Store 已经关闭
+	ErrClosed = errors.New("lsm: store closed")
+	// ErrReadOnly 在 View 的事务中写入
+	ErrReadOnly = errors.New("lsm: read-only transaction")
+)
+
+// Error 带上操作和表名的错误，通过 errors.Is 判断具体的错误，例如 errors.Is(err, ErrNotFound)
+type Error struct {
+	Op    string
+	Table string
+	Err   error
+}
+
+func (e *Error) Error() string {
+	return "lsm: " + e.Op + " " + e.Table + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Store 按表组织的有序 KV 存储。KeyDBStore 是基于 keydb 的持久化实现，MemStore 是用于测试的内存实现
+type Store interface {
+	// Get 读取 key，不存在时返回 ErrNotFound
+	Get(table string, key []byte) ([]byte, error)
+	// Put 写入 key，单独的一个事务
+	Put(table string, key, value []byte) error
+	// Delete 删除 key，key 不存在时不报错
+	Delete(table string, key []byte) error
+	// Update 在 table 上执行读写事务，fn 返回 nil 时提交，否则回滚并返回 fn 的错误
+	Update(table string, fn func(tx Tx) error) error
+	// View 在 table 上执行只读事务，结束后总是回滚
+	View(table string, fn func(tx Tx) error) error
+	Close() error
+}
+
+// Tx 单个表上的事务，只能在 Update/View 的回调中使用
+type Tx interface {
+	Get(key []byte) ([]byte, error)
+	Put(key, value []byte) error
+	Delete(key []byte) error
+	// Scan 按 key 的字节序遍历 [lower, upper] 内的记录，lower/upper 为 nil 时不限制，fn 返回 false 时停止。
+	// 回调中的 key、value 只在回调内有效
+	Scan(lower, upper []byte, fn func(key, value []byte) bool) error
+}
+
+// ScanPrefix 遍历以 prefix 开头的所有记录
+func ScanPrefix(tx Tx, prefix []byte, fn func(key, value []byte) bool) error {
+	return tx.Scan(prefix, nil, func(key, value []byte) bool {
+		if !bytes.HasPrefix(key, prefix) {
+			return false
+		}
+		return fn(key, value)
+	})
+}
+
+// ScanRange 在只读事务中遍历 table 的 [lower, upper]，见 Tx.Scan
+func ScanRange(s Store, table string, lower, upper []byte, fn func(key, value []byte) bool) error {
+	return s.View(table, func(tx Tx) error {
+		return tx.Scan(lower, upper, fn)
+	})
+}
+
+// Keys 以 prefix 开头的所有 key，最多 limit 个（limit <= 0 时不限制）
+func Keys(s Store, table string, prefix []byte, limit int) ([][]byte, error) {
+	var keys [][]byte
+	err := s.View(table, func(tx Tx) error {
+		return ScanPrefix(tx, prefix, func(key, value []byte) bool {
+			keys = append(keys, append([]byte(nil), key...))
+			return limit <= 0 || len(keys) < limit
+		})
+	})
+	return keys, err
+}
+
+// checkKey 检查 key 和 value，所有实现使用相同的限制
+func checkKey(key []byte) error {
+	switch {
+	case len(key) == 0:
+		return ErrEmptyKey
+	case len(key) > MaxKeyLen:
+		return ErrKeyTooLong
+	}
+	return nil
+}
+
+func checkPut(key, value []byte) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	if len(value) == 0 {
+		return ErrEmptyValue
+	}
+	return nil
+}
+
+func wrapErr(op, table string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	return &Error{Op: op, Table: table, Err: err}
+}
@@ -0,0 +1,227 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// testStore 所有 Store 实现都要通过的用例
+func testStore(t *testing.T, open func(t *testing.T) Store) {
+	t.Run("CRUD", func(t *testing.T) {
+		s := open(t)
+		if _, err := s.Get("t", []byte("a")); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("get missing: %v", err)
+		}
+		if err := s.Put("t", []byte("a"), []byte("1")); err != nil {
+			t.Fatal(err)
+		}
+		if v, err := s.Get("t", []byte("a")); err != nil || string(v) != "1" {
+			t.Fatalf("get = %q, %v", v, err)
+		}
+		// 表之间互不影响
+		if _, err := s.Get("other", []byte("a")); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("get other table: %v", err)
+		}
+		if err := s.Delete("t", []byte("a")); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Delete("t", []byte("a")); err != nil {
+			t.Fatalf("delete missing: %v", err)
+		}
+		if _, err := s.Get("t", []byte("a")); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("get deleted: %v", err)
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		s := open(t)
+		cases := []struct {
+			err  error
+			want error
+		}{
+			{s.Put("t", nil, []byte("v")), ErrEmptyKey},
+			{s.Put("t", make([]byte, MaxKeyLen+1), []byte("v")), ErrKeyTooLong},
+			{s.Put("t", []byte("k"), nil), ErrEmptyValue},
+			{s.View("t", func(tx Tx) error { return tx.Put([]byte("k"), []byte("v")) }), ErrReadOnly},
+		}
+		for i, c := range cases {
+			if !errors.Is(c.err, c.want) {
+				t.Errorf("case %d: err = %v, want %v", i, c.err, c.want)
+			}
+			var e *Error
+			if !errors.As(c.err, &e) || e.Table != "t" {
+				t.Errorf("case %d: err = %#v, want *Error on table t", i, c.err)
+			}
+		}
+	})
+
+	t.Run("Tx", func(t *testing.T) {
+		s := open(t)
+		if err := s.Put("t", []byte("a"), []byte("1")); err != nil {
+			t.Fatal(err)
+		}
+		// 回滚的事务不生效
+		boom := errors.New("boom")
+		err := s.Update("t", func(tx Tx) error {
+			if err := tx.Put([]byte("b"), []byte("2")); err != nil {
+				return err
+			}
+			if err := tx.Delete([]byte("a")); err != nil {
+				return err
+			}
+			return boom
+		})
+		if err != boom {
+			t.Fatalf("update err = %v, want boom", err)
+		}
+		if _, err := s.Get("t", []byte("b")); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("rolled back put is visible: %v", err)
+		}
+		if _, err := s.Get("t", []byte("a")); err != nil {
+			t.Fatalf("rolled back delete is visible: %v", err)
+		}
+		// 事务内可以读到自己的写入，提交后一起生效
+		err = s.Update("t", func(tx Tx) error {
+			if err := tx.Put([]byte("b"), []byte("2")); err != nil {
+				return err
+			}
+			if err := tx.Delete([]byte("a")); err != nil {
+				return err
+			}
+			if v, err := tx.Get([]byte("b")); err != nil || string(v) != "2" {
+				return fmt.Errorf("get own put = %q, %v", v, err)
+			}
+			if _, err := tx.Get([]byte("a")); !errors.Is(err, ErrNotFound) {
+				return fmt.Errorf("get own delete: %v", err)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if keys, _ := Keys(s, "t", nil, 0); !reflect.DeepEqual(keys, [][]byte{[]byte("b")}) {
+			t.Fatalf("keys = %q", keys)
+		}
+	})
+
+	t.Run("Scan", func(t *testing.T) {
+		s := open(t)
+		rnd := rand.New(rand.NewSource(1))
+		model := map[string]string{}
+		for i := 0; i < 300; i++ {
+			k := fmt.Sprintf("%c%03d", 'a'+rnd.Intn(3), rnd.Intn(100))
+			if rnd.Intn(4) == 0 {
+				delete(model, k)
+				if err := s.Delete("t", []byte(k)); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				model[k] = fmt.Sprint(i)
+				if err := s.Put("t", []byte(k), []byte(model[k])); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		expect := func(lower, upper string) []string {
+			var r []string
+			for k, v := range model {
+				if (lower == "" || k >= lower) && (upper == "" || k <= upper) {
+					r = append(r, k+"="+v)
+				}
+			}
+			sort.Strings(r)
+			return r
+		}
+		bound := func(s string) []byte {
+			if s == "" {
+				return nil
+			}
+			return []byte(s)
+		}
+		for _, r := range [][2]string{{"", ""}, {"a050", ""}, {"", "b020"}, {"a010", "c090"}, {"b050", "b050"}, {"z", ""}} {
+			var got []string
+			err := ScanRange(s, "t", bound(r[0]), bound(r[1]), func(k, v []byte) bool {
+				got = append(got, string(k)+"="+string(v))
+				return true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := expect(r[0], r[1]); !reflect.DeepEqual(got, want) {
+				t.Errorf("scan %q: got %v, want %v", r, got, want)
+			}
+		}
+
+		keys, err := Keys(s, "t", []byte("b"), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var want []string
+		for _, kv := range expect("b", "b\xff") {
+			want = append(want, kv[:4])
+		}
+		var got []string
+		for _, k := range keys {
+			got = append(got, string(k))
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("keys b: got %v, want %v", got, want)
+		}
+		if keys, _ := Keys(s, "t", []byte("a"), 3); len(keys) != 3 {
+			t.Errorf("keys limit 3: got %d", len(keys))
+		}
+	})
+
+	t.Run("ScanTx", func(t *testing.T) {
+		s := open(t)
+		for _, k := range []string{"k1", "k3", "k5"} {
+			if err := s.Put("t", []byte(k), []byte("old")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var got []string
+		err := s.Update("t", func(tx Tx) error {
+			tx.Put([]byte("k2"), []byte("new"))
+			tx.Put([]byte("k3"), []byte("new"))
+			tx.Delete([]byte("k5"))
+			tx.Put([]byte("x"), []byte("new"))
+			return ScanPrefix(tx, []byte("k"), func(k, v []byte) bool {
+				got = append(got, string(k)+"="+string(v))
+				return true
+			})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"k1=old", "k2=new", "k3=new"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("scan in tx: got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		s := open(t)
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Get("t", []byte("a")); !errors.Is(err, ErrClosed) {
+			t.Errorf("get after close: %v", err)
+		}
+		if err := s.Put("t", []byte("a"), []byte("1")); !errors.Is(err, ErrClosed) {
+			t.Errorf("put after close: %v", err)
+		}
+		if err := s.Close(); !errors.Is(err, ErrClosed) {
+			t.Errorf("close twice: %v", err)
+		}
+	})
+}
+
+func TestMemStore(t *testing.T) {
+	testStore(t, func(t *testing.T) Store {
+		return NewMemStore()
+	})
+}
@@ -0,0 +1,460 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"sync"
+)
+
+// 通用的多阶段流水线，替代 wokerpool/muti_chan_woker.go、exterSort、Test.go MainPipline 里手写的 channel 流水线：
+//
+//	p := pipeline.New()
+//	a := p.Source("a", apps)                                  // []string
+//	b := p.Stage("b", func(ctx context.Context, app string) (int, error) {...}, a).Workers(3)
+//	c := p.Stage("c", func(ctx context.Context, app string) (string, error) {...}, a)
+//	d := p.Join("d", func(ctx context.Context, size int, owner string) (Report, error) {...}, b, c)
+//	err := p.Run(ctx, d, func(r Report) error {...}, pipeline.Ordered())
+//
+//   - 每个阶段可以设置并发数，一个阶段的输出可以被多个阶段消费（fan-out）
+//   - Join 等待同一个数据在所有输入阶段的结果都到齐之后再执行（fan-in），数据按进入 Source 的序号对应，
+//     所以 Join 的所有输入必须来自同一个 Source，否则构建时报错
+//   - 阶段函数的参数和返回值类型在构建时检查，不匹配时 Run 返回错误
+//   - 任意一个阶段出错时取消所有阶段，Run 等待所有 goroutine 退出后返回第一个错误，不会泄漏 goroutine
+//   - 默认按完成顺序输出，Ordered 按进入 Source 的顺序输出
+
+// Skip 阶段函数返回 Skip 时丢弃这个数据，下游和 Join 都不会再处理它
+var Skip = errors.New("pipeline: skip")
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// Pipeline 流水线，由 Source、Stage、Join 构建，构建时的错误在 Run 时返回
+type Pipeline struct {
+	nodes []*Node
+	err   error
+}
+
+// Node 流水线中的一个阶段
+type Node struct {
+	p       *Pipeline
+	id      int
+	name    string
+	inputs  []*Node
+	source  *Node // 数据来自哪个 Source
+	workers int
+	out     reflect.Type  // 输出数据的类型
+	fn      reflect.Value // 阶段函数，Source 为空
+	items   reflect.Value // Source 的数据，slice 或者 channel
+}
+
+func New() *Pipeline {
+	return &Pipeline{}
+}
+
+func (p *Pipeline) fail(format string, args ...interface{}) {
+	if p.err == nil {
+		p.err = fmt.Errorf("pipeline: "+format, args...)
+	}
+}
+
+func (p *Pipeline) add(n *Node) *Node {
+	n.p, n.id = p, len(p.nodes)
+	if n.workers == 0 {
+		n.workers = 1
+	}
+	p.nodes = append(p.nodes, n)
+	return n
+}
+
+// Source 数据源，items 为 slice、数组或者 channel，channel 被关闭时数据源结束
+func (p *Pipeline) Source(name string, items interface{}) *Node {
+	n := &Node{name: name, items: reflect.ValueOf(items)}
+	switch n.items.Kind() {
+	case reflect.Slice, reflect.Array:
+		n.out = n.items.Type().Elem()
+	case reflect.Chan:
+		if n.items.Type().ChanDir()&reflect.RecvDir == 0 {
+			p.fail("source %s: channel is send-only", name)
+		}
+		n.out = n.items.Type().Elem()
+	default:
+		p.fail("source %s: want slice or channel, got %T", name, items)
+		n.out = reflect.TypeOf((*interface{})(nil)).Elem()
+	}
+	n.source = n
+	return p.add(n)
+}
+
+// Stage 处理 input 的每一个输出，fn 的类型为 func(context.Context, In) (Out, error)
+func (p *Pipeline) Stage(name string, fn interface{}, input *Node) *Node {
+	return p.Join(name, fn, input)
+}
+
+// Join 等待同一个数据在所有 inputs 中的结果，fn 的类型为 func(context.Context, In1, In2, ...) (Out, error)。
+// 数据按在 Source 中的序号对应，inputs 必须来自同一个 Source。任意一个输入丢弃了这个数据（Skip）时，Join 也丢弃它
+func (p *Pipeline) Join(name string, fn interface{}, inputs ...*Node) *Node {
+	n := &Node{name: name, inputs: inputs, fn: reflect.ValueOf(fn)}
+	p.add(n)
+	if len(inputs) == 0 {
+		p.fail("stage %s: no input", name)
+	}
+	for _, in := range inputs {
+		if in == nil || in.p != p {
+			p.fail("stage %s: input from another pipeline", name)
+			continue
+		}
+		if n.source == nil {
+			n.source = in.source
+		} else if in.source != n.source {
+			p.fail("stage %s: inputs come from different sources %s and %s", name, n.source.name, in.source.name)
+		}
+	}
+	t := n.fn.Type()
+	if n.fn.Kind() != reflect.Func || t.NumIn() != len(inputs)+1 || t.In(0) != contextType ||
+		t.NumOut() != 2 || t.Out(1) != errorType {
+		p.fail("stage %s: want func(context.Context, %d inputs) (T, error), got %T", name, len(inputs), fn)
+		n.out = reflect.TypeOf((*interface{})(nil)).Elem()
+		return n
+	}
+	for i, in := range inputs {
+		if in != nil && !in.out.AssignableTo(t.In(i+1)) {
+			p.fail("stage %s: input %s produces %s, want %s", name, in.name, in.out, t.In(i+1))
+		}
+	}
+	n.out = t.Out(0)
+	return n
+}
+
+// Workers 阶段的并发数，默认为 1。Source 只有一个 goroutine，设置无效
+func (n *Node) Workers(workers int) *Node {
+	if workers > 0 {
+		n.workers = workers
+	}
+	return n
+}
+
+// RunOption Run 的可选配置
+type RunOption func(*runOptions)
+
+type runOptions struct {
+	ordered bool
+}
+
+// Ordered 按数据进入 Source 的顺序调用 sink，默认按完成的顺序
+func Ordered() RunOption {
+	return func(o *runOptions) {
+		o.ordered = true
+	}
+}
+
+// envelope 在阶段之间传递的数据，seq 为数据进入 Source 的序号，丢弃的数据也会传递下去，Join 据此判断数据是否到齐。
+// vals 为阶段的输出，Join 汇合之后为每个输入的输出
+type envelope struct {
+	seq  int
+	vals []reflect.Value
+	skip bool
+}
+
+// Run 执行 target 和它依赖的所有阶段，target 的每个输出调用一次 sink，sink 的类型为 func(Out) error。
+// 阻塞到所有阶段结束，返回第一个错误
+func (p *Pipeline) Run(ctx context.Context, target *Node, sink interface{}, opts ...RunOption) error {
+	if p.err != nil {
+		return p.err
+	}
+	if target == nil || target.p != p {
+		return errors.New("pipeline: target from another pipeline")
+	}
+	sinkFn := reflect.ValueOf(sink)
+	if sinkFn.Kind() != reflect.Func || sinkFn.Type().NumIn() != 1 || sinkFn.Type().NumOut() != 1 ||
+		sinkFn.Type().Out(0) != errorType || !target.out.AssignableTo(sinkFn.Type().In(0)) {
+		return fmt.Errorf("pipeline: sink want func(%s) error, got %T", target.out, sink)
+	}
+	o := &runOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	r := newRun(ctx, p, target)
+	defer r.cancel()
+	r.start()
+
+	var next int
+	pending := make(map[int]envelope)
+	deliver := func(env envelope) error {
+		if env.skip {
+			return nil
+		}
+		return callSink(sinkFn, env.vals[0])
+	}
+	for env := range r.sink {
+		if r.ctx.Err() != nil {
+			continue // 已经出错，排空上游
+		}
+		var err error
+		if !o.ordered {
+			err = deliver(env)
+		} else {
+			pending[env.seq] = env
+			for e, ok := pending[next]; ok && err == nil; e, ok = pending[next] {
+				delete(pending, next)
+				next++
+				err = deliver(e)
+			}
+		}
+		if err != nil {
+			r.setErr(fmt.Errorf("pipeline: sink: %w", err))
+		}
+	}
+	r.wg.Wait()
+	if r.err == nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return r.err
+}
+
+// run 一次执行的状态
+type run struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	p      *Pipeline
+	target *Node
+	active map[int]bool            // 需要执行的阶段：target 和它依赖的阶段
+	outs   map[int][]chan envelope // 每个阶段到每个消费者的 channel
+	sink   chan envelope           // target 到 sink 的 channel
+	wg     sync.WaitGroup
+	once   sync.Once
+	err    error
+}
+
+func newRun(ctx context.Context, p *Pipeline, target *Node) *run {
+	r := &run{p: p, target: target, active: make(map[int]bool), outs: make(map[int][]chan envelope)}
+	r.ctx, r.cancel = context.WithCancel(ctx)
+	var mark func(n *Node)
+	mark = func(n *Node) {
+		if r.active[n.id] {
+			return
+		}
+		r.active[n.id] = true
+		for _, in := range n.inputs {
+			mark(in)
+		}
+	}
+	mark(target)
+	return r
+}
+
+func (r *run) setErr(err error) {
+	r.once.Do(func() {
+		r.err = err
+		r.cancel()
+	})
+}
+
+// send 发送到 ch，ctx 结束时返回 false
+func (r *run) send(ch chan<- envelope, env envelope) bool {
+	select {
+	case ch <- env:
+		return true
+	case <-r.ctx.Done():
+		return false
+	}
+}
+
+// start 为每个阶段创建到消费者的 channel 并启动 goroutine
+func (r *run) start() {
+	inputs := make(map[int][]chan envelope)
+	for _, n := range r.p.nodes {
+		if !r.active[n.id] {
+			continue
+		}
+		for _, in := range n.inputs {
+			ch := make(chan envelope, in.workers)
+			r.outs[in.id] = append(r.outs[in.id], ch)
+			inputs[n.id] = append(inputs[n.id], ch)
+		}
+	}
+	r.sink = make(chan envelope, r.target.workers)
+	r.outs[r.target.id] = append(r.outs[r.target.id], r.sink)
+	for _, n := range r.p.nodes {
+		if !r.active[n.id] {
+			continue
+		}
+		if n.fn.IsValid() {
+			r.startStage(n, inputs[n.id])
+		} else {
+			r.startSource(n)
+		}
+	}
+}
+
+// broadcast 把一个输出发给阶段的所有消费者
+func (r *run) broadcast(n *Node, env envelope) bool {
+	for _, ch := range r.outs[n.id] {
+		if !r.send(ch, env) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *run) closeOuts(n *Node) {
+	for _, ch := range r.outs[n.id] {
+		close(ch)
+	}
+}
+
+func (r *run) startSource(n *Node) {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer r.closeOuts(n)
+		if n.items.Kind() != reflect.Chan {
+			for i := 0; i < n.items.Len(); i++ {
+				if !r.broadcast(n, envelope{seq: i, vals: []reflect.Value{n.items.Index(i)}}) {
+					return
+				}
+			}
+			return
+		}
+		cases := []reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(r.ctx.Done())},
+			{Dir: reflect.SelectRecv, Chan: n.items},
+		}
+		for seq := 0; ; seq++ {
+			chosen, v, ok := reflect.Select(cases)
+			if chosen == 0 || !ok {
+				return
+			}
+			if !r.broadcast(n, envelope{seq: seq, vals: []reflect.Value{v}}) {
+				return
+			}
+		}
+	}()
+}
+
+func (r *run) startStage(n *Node, inputs []chan envelope) {
+	work := inputs[0]
+	if len(inputs) > 1 {
+		work = make(chan envelope, n.workers)
+		r.wg.Add(1)
+		go r.join(inputs, work)
+	}
+	var workers sync.WaitGroup
+	workers.Add(n.workers)
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		workers.Wait()
+		r.closeOuts(n)
+	}()
+	for i := 0; i < n.workers; i++ {
+		go func() {
+			defer workers.Done()
+			for env := range work {
+				if r.ctx.Err() != nil {
+					continue // 已经出错，排空上游，让上游的 goroutine 退出
+				}
+				if !env.skip {
+					args := append([]reflect.Value{reflect.ValueOf(r.ctx)}, env.vals...)
+					out, err := callStage(n.fn, args)
+					switch {
+					case err == Skip:
+						env = envelope{seq: env.seq, skip: true}
+					case err != nil:
+						r.setErr(fmt.Errorf("pipeline: stage %s: %w", n.name, err))
+						continue
+					default:
+						env = envelope{seq: env.seq, vals: []reflect.Value{out}}
+					}
+				}
+				r.broadcast(n, env)
+			}
+		}()
+	}
+}
+
+// join 按 seq 汇合多个输入，所有输入都到齐之后发给 work
+func (r *run) join(inputs []chan envelope, work chan<- envelope) {
+	defer r.wg.Done()
+	defer close(work)
+	type tagged struct {
+		idx int
+		env envelope
+	}
+	merged := make(chan tagged)
+	var readers sync.WaitGroup
+	readers.Add(len(inputs))
+	for i, in := range inputs {
+		go func(i int, in chan envelope) {
+			defer readers.Done()
+			for env := range in {
+				select {
+				case merged <- tagged{i, env}:
+				case <-r.ctx.Done():
+					// 继续排空 in，让上游退出
+				}
+			}
+		}(i, in)
+	}
+	go func() {
+		readers.Wait()
+		close(merged)
+	}()
+
+	type entry struct {
+		env envelope
+		n   int
+	}
+	pending := make(map[int]*entry)
+	for t := range merged {
+		e, ok := pending[t.env.seq]
+		if !ok {
+			e = &entry{env: envelope{seq: t.env.seq, vals: make([]reflect.Value, len(inputs))}}
+			pending[t.env.seq] = e
+		}
+		e.n++
+		if t.env.skip {
+			e.env.skip = true
+		} else {
+			e.env.vals[t.idx] = t.env.vals[0]
+		}
+		if e.n < len(inputs) {
+			continue
+		}
+		delete(pending, t.env.seq)
+		// 出错之后 send 立即返回，继续排空 merged，让读取 goroutine 退出
+		r.send(work, e.env)
+	}
+}
+
+// callStage 调用阶段函数，panic 转成 error
+func callStage(fn reflect.Value, args []reflect.Value) (out reflect.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	res := fn.Call(args)
+	if e := res[1].Interface(); e != nil {
+		return reflect.Value{}, e.(error)
+	}
+	return res[0], nil
+}
+
+// callSink 调用 sink，panic 转成 error
+func callSink(fn reflect.Value, val reflect.Value) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	if e := fn.Call([]reflect.Value{val})[0].Interface(); e != nil {
+		return e.(error)
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type product struct {
+	name   string
+	size   int
+	result string
+}
+
+// abcd muti_chan_woker.go 中的 A/B/C/D 四个步骤：B、C 依赖 A，D 依赖 B 和 C
+func abcd(apps []string) (*Pipeline, *Node) {
+	jitter := func() { time.Sleep(time.Duration(rand.Intn(3)) * time.Millisecond) }
+	p := New()
+	a := p.Source("a", apps)
+	b := p.Stage("b", func(ctx context.Context, app string) (product, error) {
+		jitter()
+		return product{name: app, size: len(app)}, nil
+	}, a).Workers(3)
+	c := p.Stage("c", func(ctx context.Context, app string) (string, error) {
+		jitter()
+		return strings.ToUpper(app), nil
+	}, a).Workers(2)
+	d := p.Join("d", func(ctx context.Context, prod product, upper string) (product, error) {
+		prod.result = upper
+		return prod, nil
+	}, b, c).Workers(2)
+	return p, d
+}
+
+func TestPipeline_Join(t *testing.T) {
+	var apps []string
+	for i := 0; i < 50; i++ {
+		apps = append(apps, fmt.Sprintf("app%d", i))
+	}
+	p, d := abcd(apps)
+
+	var got []string
+	err := p.Run(context.Background(), d, func(prod product) error {
+		// B 和 C 的结果按数据对应
+		if prod.result != strings.ToUpper(prod.name) || prod.size != len(prod.name) {
+			return fmt.Errorf("mismatched join %+v", prod)
+		}
+		got = append(got, prod.name)
+		return nil
+	}, Ordered())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, ",") != strings.Join(apps, ",") {
+		t.Fatalf("ordered output want %v got %v", apps, got)
+	}
+
+	// 不要求顺序时输出的集合相同
+	got = got[:0]
+	if err := p.Run(context.Background(), d, func(prod product) error {
+		got = append(got, prod.name)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+	want := append([]string(nil), apps...)
+	sort.Strings(want)
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("unordered output want %v got %v", want, got)
+	}
+}
+
+func TestPipeline_Skip(t *testing.T) {
+	in := make(chan int)
+	go func() {
+		defer close(in)
+		for i := 0; i < 20; i++ {
+			in <- i
+		}
+	}()
+	p := New()
+	src := p.Source("numbers", in)
+	even := p.Stage("even", func(ctx context.Context, n int) (int, error) {
+		if n%2 != 0 {
+			return 0, Skip
+		}
+		return n, nil
+	}, src).Workers(4)
+	square := p.Stage("square", func(ctx context.Context, n int) (int, error) {
+		return n * n, nil
+	}, src).Workers(4)
+	sum := p.Join("sum", func(ctx context.Context, n, sq int) (string, error) {
+		return fmt.Sprintf("%d:%d", n, sq), nil
+	}, even, square)
+
+	var got []string
+	if err := p.Run(context.Background(), sum, func(s string) error {
+		got = append(got, s)
+		return nil
+	}, Ordered()); err != nil {
+		t.Fatal(err)
+	}
+	want := "0:0,2:4,4:16,6:36,8:64,10:100,12:144,14:196,16:256,18:324"
+	if strings.Join(got, ",") != want {
+		t.Fatalf("want %s got %s", want, strings.Join(got, ","))
+	}
+}
+
+func TestPipeline_ErrorCancels(t *testing.T) {
+	before := runtime.NumGoroutine()
+	items := make([]int, 10000)
+	for i := range items {
+		items[i] = i
+	}
+	var processed int64
+	boom := errors.New("boom")
+	p := New()
+	src := p.Source("items", items)
+	a := p.Stage("a", func(ctx context.Context, n int) (int, error) {
+		atomic.AddInt64(&processed, 1)
+		if n == 100 {
+			return 0, boom
+		}
+		return n, nil
+	}, src).Workers(4)
+	b := p.Stage("b", func(ctx context.Context, n int) (int, error) { return n, nil }, a).Workers(2)
+	c := p.Stage("c", func(ctx context.Context, n int) (int, error) { return n, nil }, a)
+	d := p.Join("d", func(ctx context.Context, x, y int) (int, error) { return x + y, nil }, b, c)
+
+	err := p.Run(context.Background(), d, func(int) error { return nil })
+	if !errors.Is(err, boom) || !strings.Contains(err.Error(), "stage a") {
+		t.Fatalf("want boom from stage a got %v", err)
+	}
+	if n := atomic.LoadInt64(&processed); n >= int64(len(items)) {
+		t.Fatalf("error should stop the pipeline early, processed %d", n)
+	}
+
+	// sink 出错和 panic 同样取消整个流水线
+	err = p.Run(context.Background(), b, func(n int) error {
+		if n == 10 {
+			return boom
+		}
+		return nil
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("want boom from sink got %v", err)
+	}
+	panicky := p.Stage("panic", func(ctx context.Context, n int) (int, error) { panic("oops") }, src)
+	if err := p.Run(context.Background(), panicky, func(int) error { return nil }); err == nil || !strings.Contains(err.Error(), "oops") {
+		t.Fatalf("panic should become error, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	slow := p.Stage("slow", func(ctx context.Context, n int) (int, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}, src)
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if err := p.Run(ctx, slow, func(int) error { return nil }); !errors.Is(err, context.Canceled) {
+		t.Fatalf("want Canceled got %v", err)
+	}
+
+	// 所有 goroutine 都已退出
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Fatalf("goroutine leak: before %d after %d", before, n)
+	}
+}
+
+func TestPipeline_TypeCheck(t *testing.T) {
+	p := New()
+	src := p.Source("numbers", []int{1, 2, 3})
+	p.Stage("bad", func(ctx context.Context, s string) (string, error) { return s, nil }, src)
+	if err := p.Run(context.Background(), src, func(int) error { return nil }); err == nil || !strings.Contains(err.Error(), "produces int, want string") {
+		t.Fatalf("want type error got %v", err)
+	}
+
+	p = New()
+	src = p.Source("numbers", []int{1, 2, 3})
+	p.Stage("no ctx", func(n int) (int, error) { return n, nil }, src)
+	if err := p.Run(context.Background(), src, func(int) error { return nil }); err == nil {
+		t.Fatal("stage without context should be rejected")
+	}
+
+	p = New()
+	src = p.Source("numbers", []int{1, 2, 3})
+	if err := p.Run(context.Background(), src, func(string) error { return nil }); err == nil {
+		t.Fatal("sink with wrong type should be rejected")
+	}
+	if err := New().Run(context.Background(), New().Source("x", 1), func(int) error { return nil }); err == nil {
+		t.Fatal("non slice source should be rejected")
+	}
+
+	// Join 按 Source 中的序号对应，不同 Source 的数据不能 Join
+	p = New()
+	a, b := p.Source("a", []int{1, 2}), p.Source("b", []int{3, 4})
+	sum := p.Join("sum", func(ctx context.Context, x, y int) (int, error) { return x + y, nil }, a, b)
+	if err := p.Run(context.Background(), sum, func(int) error { return nil }); err == nil || !strings.Contains(err.Error(), "different sources a and b") {
+		t.Fatalf("join across sources should be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,204 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrFull 队列已满，TryPush 返回
+	ErrFull = errors.New("queue: full")
+	// ErrClosed 队列已经关闭：Push 不再接受数据，Pop 在取完剩余的数据之后返回
+	ErrClosed = errors.New("queue: closed")
+)
+
+// BoundedQueue 有界阻塞队列，环形数组实现。
+// 和 MyQueue 不同，关闭之后 Pop 仍然可以取出剩余的数据，所有阻塞操作都可以通过 ctx 取消
+type BoundedQueue struct {
+	mu       sync.Mutex
+	notEmpty *sync.Cond // 有数据或者关闭，唤醒 Pop
+	notFull  *sync.Cond // 有空位或者关闭，唤醒 Push
+	empty    *sync.Cond // 队列被取空或者关闭，唤醒 Wait
+	buf      []interface{}
+	head     int // 队头在 buf 中的位置
+	n        int
+	closed   bool
+}
+
+// NewBounded 创建容量为 capacity 的队列，capacity 小于 1 时为 1
+func NewBounded(capacity int) *BoundedQueue {
+	if capacity < 1 {
+		capacity = 1
+	}
+	q := &BoundedQueue{buf: make([]interface{}, capacity)}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	q.empty = sync.NewCond(&q.mu)
+	return q
+}
+
+// Push 插入队列，队列满时阻塞
+func (q *BoundedQueue) Push(v interface{}) error {
+	return q.PushContext(context.Background(), v)
+}
+
+// TryPush 插入队列，队列满时立即返回 ErrFull
+func (q *BoundedQueue) TryPush(v interface{}) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	if q.n == len(q.buf) {
+		return ErrFull
+	}
+	q.push(v)
+	return nil
+}
+
+// PushContext 插入队列，队列满时阻塞到有空位、队列关闭或者 ctx 结束
+func (q *BoundedQueue) PushContext(ctx context.Context, v interface{}) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for !q.closed && q.n == len(q.buf) {
+		if err := q.wait(ctx, q.notFull); err != nil {
+			return err
+		}
+	}
+	if q.closed {
+		return ErrClosed
+	}
+	q.push(v)
+	return nil
+}
+
+// Pop 取出队头，队列为空时阻塞，关闭并且取空之后返回 ok == false
+func (q *BoundedQueue) Pop() (v interface{}, ok bool) {
+	v, err := q.PopContext(context.Background())
+	return v, err == nil
+}
+
+// TryPop 取出队头，队列为空时立即返回 ok == false
+func (q *BoundedQueue) TryPop() (v interface{}, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.n == 0 {
+		return nil, false
+	}
+	return q.pop(), true
+}
+
+// PopContext 取出队头，队列为空时阻塞到有数据、ctx 结束（返回 ctx.Err()）或者关闭并且取空（返回 ErrClosed）
+func (q *BoundedQueue) PopContext(ctx context.Context) (interface{}, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.n == 0 && !q.closed {
+		if err := q.wait(ctx, q.notEmpty); err != nil {
+			return nil, err
+		}
+	}
+	if q.n == 0 {
+		return nil, ErrClosed
+	}
+	return q.pop(), nil
+}
+
+// PopBatch 批量取出最多 max 个数据，用于批量消费：凑满 max 个立即返回，否则最多等待 timeout，返回已经取到的数据（可能为空）。
+// 队列关闭并且取空之后返回 ErrClosed
+func (q *BoundedQueue) PopBatch(max int, timeout time.Duration) ([]interface{}, error) {
+	if max < 1 {
+		max = 1
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var batch []interface{}
+	for len(batch) < max {
+		for q.n > 0 && len(batch) < max {
+			batch = append(batch, q.pop())
+		}
+		if len(batch) == max || q.closed {
+			break
+		}
+		if q.wait(ctx, q.notEmpty) != nil {
+			break
+		}
+	}
+	if len(batch) == 0 && q.closed {
+		return nil, ErrClosed
+	}
+	return batch, nil
+}
+
+// Drain 取出队列中所有的数据，不阻塞
+func (q *BoundedQueue) Drain() []interface{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	items := make([]interface{}, 0, q.n)
+	for q.n > 0 {
+		items = append(items, q.pop())
+	}
+	return items
+}
+
+// Len 队列长度
+func (q *BoundedQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.n
+}
+
+// Cap 队列容量
+func (q *BoundedQueue) Cap() int {
+	return len(q.buf)
+}
+
+// Close 关闭队列，之后 Push 返回 ErrClosed，Pop 取完剩余的数据之后返回 ErrClosed，重复关闭无影响
+func (q *BoundedQueue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	q.closed = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+	q.empty.Broadcast()
+}
+
+// Wait 阻塞到队列被取空或者关闭
+func (q *BoundedQueue) Wait() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.n > 0 && !q.closed {
+		q.empty.Wait()
+	}
+}
+
+// push 调用方持有锁并且确认有空位
+func (q *BoundedQueue) push(v interface{}) {
+	q.buf[(q.head+q.n)%len(q.buf)] = v
+	q.n++
+	q.notEmpty.Signal()
+}
+
+// pop 调用方持有锁并且确认有数据
+func (q *BoundedQueue) pop() interface{} {
+	v := q.buf[q.head]
+	q.buf[q.head] = nil
+	q.head = (q.head + 1) % len(q.buf)
+	q.n--
+	q.notFull.Signal()
+	if q.n == 0 {
+		q.empty.Broadcast()
+	}
+	return v
+}
+
+// wait 在持有锁的情况下等待 cond，ctx 结束时返回 ctx.Err()，唤醒之后调用方需要重新检查条件
+func (q *BoundedQueue) wait(ctx context.Context, cond *sync.Cond) error {
+	return waitCond(ctx, &q.mu, cond)
+}
@@ -0,0 +1,153 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBoundedQueue(t *testing.T) {
+	q := NewBounded(2)
+	if err := q.Push(1); err != nil {
+		t.Fatal(err)
+	}
+	q.Push(2)
+	if err := q.TryPush(3); err != ErrFull {
+		t.Fatalf("want ErrFull got %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := q.PushContext(ctx, 3); err != context.DeadlineExceeded {
+		t.Fatalf("push on full queue should time out, got %v", err)
+	}
+
+	// 取出一个之后阻塞的 Push 返回
+	done := make(chan error)
+	go func() { done <- q.Push(3) }()
+	if v, ok := q.Pop(); !ok || v != 1 {
+		t.Fatalf("want 1 got %v", v)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if items := q.Drain(); len(items) != 2 || items[0] != 2 || items[1] != 3 {
+		t.Fatalf("drain want [2 3] got %v", items)
+	}
+	if _, ok := q.TryPop(); ok {
+		t.Fatal("queue should be empty")
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := q.PopContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("pop on empty queue should time out, got %v", err)
+	}
+
+	// 关闭之后不能再 Push，剩余的数据还能取出
+	q.Push(4)
+	q.Close()
+	if err := q.Push(5); err != ErrClosed {
+		t.Fatalf("want ErrClosed got %v", err)
+	}
+	if v, err := q.PopContext(context.Background()); err != nil || v != 4 {
+		t.Fatalf("want 4 got %v %v", v, err)
+	}
+	if _, err := q.PopContext(context.Background()); err != ErrClosed {
+		t.Fatalf("want ErrClosed got %v", err)
+	}
+}
+
+func TestBoundedQueue_PopBatch(t *testing.T) {
+	q := NewBounded(10)
+	for i := 0; i < 5; i++ {
+		q.Push(i)
+	}
+	// 凑满 max 个立即返回
+	start := time.Now()
+	batch, err := q.PopBatch(3, time.Second)
+	if err != nil || len(batch) != 3 || time.Since(start) > 100*time.Millisecond {
+		t.Fatalf("full batch should return at once, got %v %v", batch, err)
+	}
+	// 不够时等到超时，期间到达的数据也算在内
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.Push(5)
+	}()
+	batch, err = q.PopBatch(10, 50*time.Millisecond)
+	if err != nil || len(batch) != 3 || batch[2] != 5 {
+		t.Fatalf("want [3 4 5] got %v %v", batch, err)
+	}
+	if batch, err = q.PopBatch(10, 5*time.Millisecond); err != nil || len(batch) != 0 {
+		t.Fatalf("want empty batch got %v %v", batch, err)
+	}
+	q.Push(6)
+	q.Close()
+	if batch, err = q.PopBatch(10, time.Second); err != nil || len(batch) != 1 {
+		t.Fatalf("closed queue should return remaining items, got %v %v", batch, err)
+	}
+	if _, err = q.PopBatch(10, time.Second); err != ErrClosed {
+		t.Fatalf("want ErrClosed got %v", err)
+	}
+}
+
+func TestBoundedQueue_Concurrent(t *testing.T) {
+	q := NewBounded(4)
+	const producers, perProducer = 4, 1000
+	var wg sync.WaitGroup
+	for i := 0; i < producers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perProducer; j++ {
+				q.Push(j)
+			}
+		}()
+	}
+	var mu sync.Mutex
+	got := 0
+	var consumers sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		consumers.Add(1)
+		go func() {
+			defer consumers.Done()
+			for {
+				if _, ok := q.Pop(); !ok {
+					return
+				}
+				mu.Lock()
+				got++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	q.Wait()
+	q.Close()
+	consumers.Wait()
+	if got != producers*perProducer {
+		t.Fatalf("want %d got %d", producers*perProducer, got)
+	}
+}
+
+func TestMyQueue_Wait(t *testing.T) {
+	q := New()
+	for i := 0; i < 100; i++ {
+		q.Push(i)
+	}
+	go func() {
+		for i := 0; i < 100; i++ {
+			q.Pop()
+		}
+	}()
+	done := make(chan struct{})
+	go func() {
+		q.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Wait should return after the queue is drained")
+	}
+}
@@ -2,7 +2,6 @@ package queue
 
 import (
 	"github.com/eapache/queue"
-	"runtime"
 	"sync"
 	"sync/atomic"
 )
@@ -12,9 +11,10 @@ type MyQueue struct {
 	sync.Mutex
 	popable *sync.Cond // Go的标准库中有一个类型叫条件变量：sync.Cond。这种类型与互斥锁和读写锁不同，它不是开箱即用的，它需要与互斥锁组合
 	// ,类似于java里面的Condition
-	buffer *queue.Queue
-	closed bool
-	count  int32
+	drained *sync.Cond // 队列被取空或者关闭，唤醒 Wait
+	buffer  *queue.Queue
+	closed  bool
+	count   int32
 }
 
 //New 创建
@@ -23,6 +23,7 @@ func New() *MyQueue {
 		buffer: queue.New(),
 	}
 	ch.popable = sync.NewCond(&ch.Mutex)
+	ch.drained = sync.NewCond(&ch.Mutex)
 	return ch
 }
 
@@ -45,7 +46,7 @@ func (q *MyQueue) Pop() (v interface{}) {
 	if q.Len() > 0 {
 		v = buffer.Peek()
 		buffer.Remove()
-		atomic.AddInt32(&q.count, -1)
+		q.decr()
 	}
 	return
 }
@@ -60,7 +61,7 @@ func (q *MyQueue) TryPop() (v interface{}, ok bool) {
 	if q.Len() > 0 {
 		v = buffer.Peek()
 		buffer.Remove()
-		atomic.AddInt32(&q.count, -1)
+		q.decr()
 		ok = true
 	} else if q.closed {
 		ok = true
@@ -69,6 +70,13 @@ func (q *MyQueue) TryPop() (v interface{}, ok bool) {
 	return
 }
 
+// decr 取出一个元素后计数减一，取空时唤醒 Wait，调用方持有锁
+func (q *MyQueue) decr() {
+	if atomic.AddInt32(&q.count, -1) == 0 {
+		q.drained.Broadcast()
+	}
+}
+
 // 插入队列，非阻塞
 func (q *MyQueue) Push(v interface{}) {
 	q.Mutex.Lock()
@@ -94,16 +102,15 @@ func (q *MyQueue) Close() {
 		q.closed = true
 		atomic.StoreInt32(&q.count, 0)
 		q.popable.Broadcast() //广播 notifyAll
+		q.drained.Broadcast()
 	}
 }
 
-//Wait 等待队列消费完成
+//Wait 等待队列消费完成，用条件变量等待，不再空转出让时间片；需要有界队列时用 BoundedQueue
 func (q *MyQueue) Wait() {
-	for {
-		if q.closed || q.Len() == 0 {
-			break
-		}
-
-		runtime.Gosched() //出让时间片
+	q.Mutex.Lock()
+	defer q.Mutex.Unlock()
+	for !q.closed && q.Len() > 0 {
+		q.drained.Wait()
 	}
 }
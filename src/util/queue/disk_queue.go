@@ -0,0 +1,652 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DiskQueue 持久化的 FIFO 队列，服务重启之后没有消费的数据还在。
+//
+// 数据按顺序追加写到分段文件 <dir>/<id>.seg 中，单个文件超过 segmentSize 之后写下一个文件，
+// 读完的文件被删除。每条记录为 [4 字节长度][4 字节 crc32（长度和数据）][数据]。
+// 读游标（分段 id + 偏移）保存在 <dir>/cursor 中，两个槽位轮流写，每个槽位带序号和 crc，写到一半崩溃时用另一个槽位；
+// 写游标不单独保存，打开时扫描最后一个分段得到，末尾写了一半的记录被截掉。
+// 打开时校验所有未消费的记录，中间的分段有损坏时返回 ErrCorrupted。
+//
+// 消费语义为至少一次：SyncAlways 之外的策略在崩溃之后可能重复投递最后一段已经取出的数据。
+type DiskQueue struct {
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	dir      string
+	opts     diskOptions
+
+	writer   *os.File
+	writeSeg uint64
+	writeOff int64
+
+	reader  *os.File
+	readSeg uint64
+	readOff int64
+
+	cursor    *os.File
+	cursorSeq uint64
+	count     int
+	dirty     bool // 有没有 fsync 的写入
+	closed    bool
+	stop      chan struct{}
+	done      chan struct{}
+	lastErr   error
+}
+
+// SyncPolicy 刷盘策略
+type SyncPolicy int
+
+const (
+	// SyncAlways 每次 Push 之后 fsync 数据，每次 Pop 之后 fsync 读游标，最安全也最慢
+	SyncAlways SyncPolicy = iota
+	// SyncInterval 每隔 syncInterval fsync 一次，崩溃时最多丢失（重复投递）一个间隔内的数据
+	SyncInterval
+	// SyncNever 不主动 fsync，由操作系统决定，进程崩溃不丢数据，机器掉电可能丢数据
+	SyncNever
+)
+
+var (
+	// ErrCorrupted 打开时发现已经写完的分段中有损坏的记录
+	ErrCorrupted = errors.New("queue: disk queue corrupted")
+	// ErrTooLarge 单条数据超过分段大小
+	ErrTooLarge = errors.New("queue: item too large")
+)
+
+// Codec Push/Pop 的数据和磁盘上字节的转换
+type Codec interface {
+	Encode(v interface{}) ([]byte, error)
+	Decode(data []byte) (interface{}, error)
+}
+
+// BytesCodec 默认的编码：Push 接受 []byte 和 string，Pop 返回 []byte
+type BytesCodec struct{}
+
+func (BytesCodec) Encode(v interface{}) ([]byte, error) {
+	switch b := v.(type) {
+	case []byte:
+		return b, nil
+	case string:
+		return []byte(b), nil
+	}
+	return nil, fmt.Errorf("queue: BytesCodec can't encode %T", v)
+}
+
+func (BytesCodec) Decode(data []byte) (interface{}, error) {
+	return data, nil
+}
+
+// GobCodec 用 gob 编码任意类型，自定义类型需要先 gob.Register
+type GobCodec struct{}
+
+func (GobCodec) Encode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec) Decode(data []byte) (interface{}, error) {
+	var v interface{}
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v)
+	return v, err
+}
+
+type diskOptions struct {
+	segmentSize  int64
+	sync         SyncPolicy
+	syncInterval time.Duration
+	codec        Codec
+}
+
+// DiskOption DiskQueue 的可选配置
+type DiskOption func(*diskOptions)
+
+// WithSegmentSize 单个分段文件的大小上限，默认 64MB，也是单条数据的大小上限
+func WithSegmentSize(size int64) DiskOption {
+	return func(o *diskOptions) {
+		o.segmentSize = size
+	}
+}
+
+// WithSync 刷盘策略，默认每秒 fsync 一次（SyncInterval），interval 只对 SyncInterval 有效
+func WithSync(policy SyncPolicy, interval time.Duration) DiskOption {
+	return func(o *diskOptions) {
+		o.sync = policy
+		o.syncInterval = interval
+	}
+}
+
+// WithCodec Push/Pop 使用的编码，默认 BytesCodec
+func WithCodec(codec Codec) DiskOption {
+	return func(o *diskOptions) {
+		o.codec = codec
+	}
+}
+
+const (
+	recordHeaderSize = 8
+	cursorSlotSize   = 32
+	segmentSuffix    = ".seg"
+)
+
+var _ Queue = (*DiskQueue)(nil)
+
+// OpenDisk 打开 dir 下的队列，不存在时创建
+func OpenDisk(dir string, opts ...DiskOption) (*DiskQueue, error) {
+	o := diskOptions{segmentSize: 64 << 20, sync: SyncInterval, syncInterval: time.Second, codec: BytesCodec{}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	q := &DiskQueue{dir: dir, opts: o, stop: make(chan struct{}), done: make(chan struct{})}
+	q.notEmpty = sync.NewCond(&q.mu)
+	if err := q.open(); err != nil {
+		q.closeFiles()
+		return nil, err
+	}
+	if o.sync == SyncInterval && o.syncInterval > 0 {
+		go q.syncLoop()
+	} else {
+		close(q.done)
+	}
+	return q, nil
+}
+
+func (q *DiskQueue) segmentPath(id uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", id, segmentSuffix))
+}
+
+// segments 目录下所有分段的 id，从小到大
+func (q *DiskQueue) segments() ([]uint64, error) {
+	files, err := ioutil.ReadDir(q.dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []uint64
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), segmentSuffix) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(f.Name(), segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+func (q *DiskQueue) open() error {
+	var err error
+	q.cursor, err = os.OpenFile(filepath.Join(q.dir, "cursor"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	ids, err := q.segments()
+	if err != nil {
+		return err
+	}
+	found, err := q.loadCursor()
+	if err != nil {
+		return err
+	}
+	if !found && len(ids) > 0 {
+		q.readSeg, q.readOff = ids[0], 0
+	}
+	// 已经消费完但是还没来得及删除的分段
+	var live []uint64
+	for _, id := range ids {
+		if id < q.readSeg {
+			os.Remove(q.segmentPath(id))
+		} else {
+			live = append(live, id)
+		}
+	}
+	// 游标指向的分段已经被删除，说明分段已经读完，只是游标还没有移到下一个分段（分段只在读完之后删除）
+	if len(live) > 0 && live[0] > q.readSeg {
+		q.readSeg, q.readOff = live[0], 0
+	}
+	if len(live) == 0 {
+		if q.readOff != 0 {
+			q.readSeg, q.readOff = q.readSeg+1, 0
+		}
+		live = []uint64{q.readSeg}
+	}
+	for i, id := range live {
+		if i > 0 && id != live[i-1]+1 {
+			return fmt.Errorf("%w: segment %d is missing", ErrCorrupted, live[i-1]+1)
+		}
+		start := int64(0)
+		if id == q.readSeg {
+			start = q.readOff
+		}
+		n, end, err := q.scan(id, start)
+		if err != nil {
+			return err
+		}
+		if end < 0 {
+			if i != len(live)-1 {
+				return fmt.Errorf("%w: bad record in segment %d", ErrCorrupted, id)
+			}
+			// 最后一个分段末尾写了一半的记录，截掉
+			end = -end - 1
+			if err := os.Truncate(q.segmentPath(id), end); err != nil {
+				return err
+			}
+			log.Printf("queue: truncated torn write in %s at %d", q.segmentPath(id), end)
+		}
+		q.count += n
+		q.writeSeg, q.writeOff = id, end
+	}
+	q.writer, err = os.OpenFile(q.segmentPath(q.writeSeg), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = q.writer.Seek(q.writeOff, io.SeekStart)
+	return err
+}
+
+// scan 从 start 开始校验分段中的记录，返回记录数和结束位置；遇到损坏的记录时结束位置为 -(损坏的位置)-1
+func (q *DiskQueue) scan(id uint64, start int64) (int, int64, error) {
+	f, err := os.Open(q.segmentPath(id))
+	if os.IsNotExist(err) {
+		return 0, start, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	if start > info.Size() {
+		return 0, 0, fmt.Errorf("%w: cursor %d:%d beyond segment size %d", ErrCorrupted, id, start, info.Size())
+	}
+	n, off := 0, start
+	for off < info.Size() {
+		data, err := q.readRecord(f, off)
+		if err != nil {
+			return n, -off - 1, nil
+		}
+		off += recordHeaderSize + int64(len(data))
+		n++
+	}
+	return n, off, nil
+}
+
+// readRecord 读取 off 处的记录并校验
+func (q *DiskQueue) readRecord(f *os.File, off int64) ([]byte, error) {
+	var header [recordHeaderSize]byte
+	if _, err := f.ReadAt(header[:], off); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header[:4])
+	if int64(size) > q.opts.segmentSize {
+		return nil, ErrCorrupted
+	}
+	data := make([]byte, size)
+	if _, err := f.ReadAt(data, off+recordHeaderSize); err != nil {
+		return nil, err
+	}
+	if recordCRC(header[:4], data) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, ErrCorrupted
+	}
+	return data, nil
+}
+
+// recordCRC 记录的校验和，长度也参与计算，这样全 0 的记录头（掉电之后文件末尾补的 0）校验不通过
+func recordCRC(size []byte, data []byte) uint32 {
+	return crc32.Update(crc32.ChecksumIEEE(size), crc32.IEEETable, data)
+}
+
+// loadCursor 读取两个槽位中序号较大并且校验通过的一个
+func (q *DiskQueue) loadCursor() (bool, error) {
+	buf := make([]byte, 2*cursorSlotSize)
+	n, err := q.cursor.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	found := false
+	for slot := 0; slot+cursorSlotSize <= n; slot += cursorSlotSize {
+		b := buf[slot : slot+cursorSlotSize]
+		if crc32.ChecksumIEEE(b[:24]) != binary.BigEndian.Uint32(b[24:28]) {
+			continue
+		}
+		seq := binary.BigEndian.Uint64(b[:8])
+		if !found || seq > q.cursorSeq {
+			found = true
+			q.cursorSeq = seq
+			q.readSeg = binary.BigEndian.Uint64(b[8:16])
+			q.readOff = int64(binary.BigEndian.Uint64(b[16:24]))
+		}
+	}
+	return found, nil
+}
+
+// saveCursor 把读游标写到下一个槽位
+func (q *DiskQueue) saveCursor() error {
+	q.cursorSeq++
+	var b [cursorSlotSize]byte
+	binary.BigEndian.PutUint64(b[:8], q.cursorSeq)
+	binary.BigEndian.PutUint64(b[8:16], q.readSeg)
+	binary.BigEndian.PutUint64(b[16:24], uint64(q.readOff))
+	binary.BigEndian.PutUint32(b[24:28], crc32.ChecksumIEEE(b[:24]))
+	if _, err := q.cursor.WriteAt(b[:], int64(q.cursorSeq%2)*cursorSlotSize); err != nil {
+		return err
+	}
+	if q.opts.sync == SyncAlways {
+		return q.cursor.Sync()
+	}
+	q.dirty = true
+	return nil
+}
+
+// Put 写入一条数据
+func (q *DiskQueue) Put(data []byte) error {
+	size := recordHeaderSize + int64(len(data))
+	if size > q.opts.segmentSize {
+		return ErrTooLarge
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	if q.writeOff > 0 && q.writeOff+size > q.opts.segmentSize {
+		if err := q.rotate(); err != nil {
+			return err
+		}
+	}
+	record := make([]byte, size)
+	binary.BigEndian.PutUint32(record[:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(record[4:8], recordCRC(record[:4], data))
+	copy(record[recordHeaderSize:], data)
+	if _, err := q.writer.Write(record); err != nil {
+		// 写了一部分时回退到记录开始的位置，下一次写入覆盖
+		q.writer.Truncate(q.writeOff)
+		q.writer.Seek(q.writeOff, io.SeekStart)
+		return err
+	}
+	if q.opts.sync == SyncAlways {
+		if err := q.writer.Sync(); err != nil {
+			return err
+		}
+	} else {
+		q.dirty = true
+	}
+	q.writeOff += size
+	q.count++
+	q.notEmpty.Signal()
+	return nil
+}
+
+// rotate 切换到下一个分段，调用方持有锁
+func (q *DiskQueue) rotate() error {
+	if err := q.writer.Sync(); err != nil {
+		return err
+	}
+	next, err := os.OpenFile(q.segmentPath(q.writeSeg+1), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	q.writer.Close()
+	q.writer, q.writeSeg, q.writeOff = next, q.writeSeg+1, 0
+	return nil
+}
+
+// Get 取出一条数据，队列为空时阻塞到有数据、ctx 结束或者队列关闭（返回 ErrClosed）
+func (q *DiskQueue) Get(ctx context.Context) ([]byte, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.count == 0 && !q.closed {
+		if err := waitCond(ctx, &q.mu, q.notEmpty); err != nil {
+			return nil, err
+		}
+	}
+	if q.closed {
+		return nil, ErrClosed
+	}
+	return q.next()
+}
+
+// TryGet 取出一条数据，队列为空时返回 ok == false
+func (q *DiskQueue) TryGet() (data []byte, ok bool, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil, false, ErrClosed
+	}
+	if q.count == 0 {
+		return nil, false, nil
+	}
+	data, err = q.next()
+	return data, err == nil, err
+}
+
+// next 读取读游标处的记录并前移游标，读完的分段被删除，调用方持有锁并且确认有数据
+func (q *DiskQueue) next() ([]byte, error) {
+	if q.readSeg < q.writeSeg {
+		if q.reader == nil {
+			f, err := os.Open(q.segmentPath(q.readSeg))
+			if err != nil {
+				return nil, err
+			}
+			q.reader = f
+		}
+		info, err := q.reader.Stat()
+		if err != nil {
+			return nil, err
+		}
+		if q.readOff >= info.Size() {
+			// 当前分段读完，先把游标移到下一个分段并刷盘，再删除读完的分段，
+			// 否则在两步之间崩溃时游标指向已经删除的分段
+			q.reader.Close()
+			q.reader = nil
+			done := q.readSeg
+			q.readSeg, q.readOff = q.readSeg+1, 0
+			if err := q.saveCursor(); err != nil {
+				return nil, err
+			}
+			if q.opts.sync != SyncAlways {
+				if err := q.cursor.Sync(); err != nil {
+					return nil, err
+				}
+			}
+			os.Remove(q.segmentPath(done))
+			return q.next()
+		}
+	}
+	f := q.reader
+	if q.readSeg == q.writeSeg {
+		f = q.writer
+	}
+	data, err := q.readRecord(f, q.readOff)
+	if err != nil {
+		return nil, fmt.Errorf("%w: segment %d offset %d: %v", ErrCorrupted, q.readSeg, q.readOff, err)
+	}
+	q.readOff += recordHeaderSize + int64(len(data))
+	q.count--
+	return data, q.saveCursor()
+}
+
+// Push 编码之后写入，失败时记录错误，通过 Err 获取。需要处理错误时用 Put
+func (q *DiskQueue) Push(v interface{}) {
+	data, err := q.opts.codec.Encode(v)
+	if err == nil {
+		err = q.Put(data)
+	}
+	q.setErr(err)
+}
+
+// Pop 取出并解码，队列为空时阻塞，关闭之后返回 nil（没有消费的数据留在磁盘上）。失败时返回 nil，通过 Err 获取错误
+func (q *DiskQueue) Pop() interface{} {
+	data, err := q.Get(context.Background())
+	if err != nil {
+		if err != ErrClosed {
+			q.setErr(err)
+		}
+		return nil
+	}
+	v, err := q.opts.codec.Decode(data)
+	q.setErr(err)
+	return v
+}
+
+// TryPop 取出并解码（非阻塞），返回 ok == false 表示空；和 MyQueue 一致，关闭之后返回 v == nil, ok == true
+func (q *DiskQueue) TryPop() (interface{}, bool) {
+	data, ok, err := q.TryGet()
+	if err == ErrClosed {
+		return nil, true
+	}
+	if !ok {
+		q.setErr(err)
+		return nil, false
+	}
+	v, err := q.opts.codec.Decode(data)
+	q.setErr(err)
+	return v, true
+}
+
+func (q *DiskQueue) setErr(err error) {
+	if err == nil {
+		return
+	}
+	q.mu.Lock()
+	q.lastErr = err
+	q.mu.Unlock()
+}
+
+// Err Push/Pop 最近一次的错误
+func (q *DiskQueue) Err() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.lastErr
+}
+
+// Len 没有消费的数据条数
+func (q *DiskQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.count
+}
+
+// Sync fsync 数据和读游标
+func (q *DiskQueue) Sync() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.sync()
+}
+
+func (q *DiskQueue) sync() error {
+	if !q.dirty || q.closed {
+		return nil
+	}
+	if err := q.writer.Sync(); err != nil {
+		return err
+	}
+	if err := q.cursor.Sync(); err != nil {
+		return err
+	}
+	q.dirty = false
+	return nil
+}
+
+func (q *DiskQueue) syncLoop() {
+	defer close(q.done)
+	ticker := time.NewTicker(q.opts.syncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := q.Sync(); err != nil {
+				log.Printf("queue: sync %s: %v", q.dir, err)
+			}
+		case <-q.stop:
+			return
+		}
+	}
+}
+
+// Close 刷盘并关闭文件，阻塞的 Pop 返回 nil，没有消费的数据下次 OpenDisk 时还在
+func (q *DiskQueue) Close() {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	if q.opts.sync != SyncNever {
+		q.dirty = true
+		if err := q.sync(); err != nil {
+			q.lastErr = err
+		}
+	}
+	q.closed = true
+	q.closeFiles()
+	q.notEmpty.Broadcast()
+	q.mu.Unlock()
+	close(q.stop)
+	<-q.done
+}
+
+func (q *DiskQueue) closeFiles() {
+	for _, f := range []*os.File{q.reader, q.writer, q.cursor} {
+		if f != nil {
+			f.Close()
+		}
+	}
+}
+
+// waitCond 在持有 mu 的情况下等待 cond，ctx 结束时返回 ctx.Err()。
+// sync.Cond 不支持 ctx，ctx 结束时由单独的 goroutine 广播唤醒
+func waitCond(ctx context.Context, mu *sync.Mutex, cond *sync.Cond) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if ctx.Done() == nil {
+		cond.Wait()
+		return nil
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			mu.Lock()
+			cond.Broadcast()
+			mu.Unlock()
+		case <-stop:
+		}
+	}()
+	cond.Wait()
+	if err := ctx.Err(); err != nil {
+		// 被 Signal 唤醒之后放弃等待，把通知转给其它等待者
+		cond.Signal()
+		return err
+	}
+	return nil
+}
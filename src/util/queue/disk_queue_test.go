@@ -0,0 +1,202 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDiskQueueReopen(t *testing.T) {
+	dir := t.TempDir()
+	// 分段很小，写入时会轮转出多个分段
+	q, err := OpenDisk(dir, WithSegmentSize(64), WithSync(SyncAlways, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		q.Push(fmt.Sprintf("item-%02d", i))
+	}
+	if err := q.Err(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 8; i++ {
+		if v := q.Pop(); string(v.([]byte)) != fmt.Sprintf("item-%02d", i) {
+			t.Fatalf("want item-%02d got %s", i, v)
+		}
+	}
+	q.Close()
+	if v := q.Pop(); v != nil {
+		t.Fatalf("pop after close should return nil, got %v", v)
+	}
+
+	q, err = OpenDisk(dir, WithSegmentSize(64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if q.Len() != 12 {
+		t.Fatalf("want 12 items after reopen got %d", q.Len())
+	}
+	for i := 8; i < 20; i++ {
+		data, err := q.Get(context.Background())
+		if err != nil || string(data) != fmt.Sprintf("item-%02d", i) {
+			t.Fatalf("want item-%02d got %s %v", i, data, err)
+		}
+	}
+	if _, ok, _ := q.TryGet(); ok {
+		t.Fatal("queue should be empty")
+	}
+	// 读完的分段被删除，只剩正在写的一个
+	segs, _ := filepath.Glob(filepath.Join(dir, "*.seg"))
+	if len(segs) != 1 {
+		t.Fatalf("consumed segments should be removed, got %v", segs)
+	}
+}
+
+func TestDiskQueueBlockingPop(t *testing.T) {
+	q, err := OpenDisk(t.TempDir(), WithSync(SyncNever, 0), WithCodec(GobCodec{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := q.Get(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("get on empty queue should time out, got %v", err)
+	}
+	done := make(chan interface{})
+	go func() { done <- q.Pop() }()
+	time.Sleep(10 * time.Millisecond)
+	q.Push(42)
+	if v := <-done; v != 42 {
+		t.Fatalf("want 42 got %v", v)
+	}
+}
+
+func TestDiskQueueTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	q, err := OpenDisk(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Push("a")
+	q.Push("b")
+	q.Close()
+
+	// 模拟写到一半崩溃：末尾追加半条记录
+	seg := filepath.Join(dir, fmt.Sprintf("%020d.seg", 0))
+	f, err := os.OpenFile(seg, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 0, 9, 1, 2})
+	f.Close()
+
+	q, err = OpenDisk(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Len() != 2 {
+		t.Fatalf("want 2 items got %d", q.Len())
+	}
+	q.Push("c")
+	for _, want := range []string{"a", "b", "c"} {
+		if v, ok := q.TryPop(); !ok || string(v.([]byte)) != want {
+			t.Fatalf("want %s got %v", want, v)
+		}
+	}
+	q.Close()
+}
+
+func TestDiskQueueCorrupted(t *testing.T) {
+	dir := t.TempDir()
+	q, err := OpenDisk(dir, WithSegmentSize(32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 6; i++ {
+		q.Push(fmt.Sprintf("item-%d", i))
+	}
+	q.Close()
+
+	// 改掉第一个分段中的数据，crc 校验失败
+	seg := filepath.Join(dir, fmt.Sprintf("%020d.seg", 0))
+	data, err := ioutil.ReadFile(seg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 0xff
+	ioutil.WriteFile(seg, data, 0644)
+
+	if _, err := OpenDisk(dir, WithSegmentSize(32)); !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("want ErrCorrupted got %v", err)
+	}
+}
+
+func TestDiskQueueCursorOnDeletedSegment(t *testing.T) {
+	dir := t.TempDir()
+	// 每条记录 15 字节，每个分段 4 条
+	q, err := OpenDisk(dir, WithSegmentSize(64), WithSync(SyncAlways, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		q.Push(fmt.Sprintf("item-%02d", i))
+	}
+	for i := 0; i < 4; i++ {
+		q.Pop()
+	}
+	q.Close()
+
+	// 模拟分段已经删除但是游标还停在分段末尾时崩溃
+	if err := os.Remove(filepath.Join(dir, fmt.Sprintf("%020d.seg", 0))); err != nil {
+		t.Fatal(err)
+	}
+	q, err = OpenDisk(dir, WithSegmentSize(64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if q.Len() != 6 {
+		t.Fatalf("want 6 items got %d", q.Len())
+	}
+	if v := q.Pop(); string(v.([]byte)) != "item-04" {
+		t.Fatalf("want item-04 got %s", v)
+	}
+}
+
+func TestDiskQueueZeroFilledTail(t *testing.T) {
+	dir := t.TempDir()
+	q, err := OpenDisk(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Push("a")
+	q.Close()
+
+	// 掉电之后文件末尾可能是一段 0，不能当作空记录
+	seg := filepath.Join(dir, fmt.Sprintf("%020d.seg", 0))
+	f, err := os.OpenFile(seg, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(make([]byte, 64))
+	f.Close()
+
+	q, err = OpenDisk(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if q.Len() != 1 {
+		t.Fatalf("want 1 item got %d", q.Len())
+	}
+	if info, _ := os.Stat(seg); info.Size() != recordHeaderSize+1 {
+		t.Fatalf("zero tail should be truncated, size %d", info.Size())
+	}
+}
@@ -0,0 +1,306 @@
+package queue
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// Queue MyQueue、RingQueue、SPSCQueue 共同的接口，调用方可以按场景替换实现
+type Queue interface {
+	Push(v interface{})
+	Pop() interface{}
+	TryPop() (interface{}, bool)
+	Len() int
+	Close()
+}
+
+var (
+	_ Queue = (*MyQueue)(nil)
+	_ Queue = (*RingQueue)(nil)
+	_ Queue = (*SPSCQueue)(nil)
+)
+
+// cacheLinePad 填充到独立的缓存行，避免生产者和消费者的游标伪共享
+type cacheLinePad [64]byte
+
+// roundPow2 不小于 n 的 2 的幂，用掩码代替取模
+func roundPow2(n int) uint64 {
+	size := uint64(2)
+	for size < uint64(n) {
+		size <<= 1
+	}
+	return size
+}
+
+// spinLimit 自旋这么多次还等不到就挂起，避免长时间空闲的消费者一直占用 CPU
+const spinLimit = 64
+
+// spin 自旋等待：先空转几次，之后出让时间片
+func spin(i int) {
+	if i > 16 {
+		runtime.Gosched()
+	}
+}
+
+// parker 自旋失败之后挂起等待。另一端只在有人等待时才加锁唤醒，不等待时只多一次原子读
+type parker struct {
+	waiters int32
+	mu      sync.Mutex
+	cond    *sync.Cond
+}
+
+func newParker() *parker {
+	p := &parker{}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// wait 挂起直到 ready 返回 true。先登记再检查 ready，wake 先修改状态再检查登记，不会丢失唤醒
+func (p *parker) wait(ready func() bool) {
+	atomic.AddInt32(&p.waiters, 1)
+	p.mu.Lock()
+	for !ready() {
+		p.cond.Wait()
+	}
+	p.mu.Unlock()
+	atomic.AddInt32(&p.waiters, -1)
+}
+
+func (p *parker) wake() {
+	if atomic.LoadInt32(&p.waiters) > 0 {
+		p.mu.Lock()
+		p.cond.Broadcast()
+		p.mu.Unlock()
+	}
+}
+
+type ringCell struct {
+	seq uint64 // 等于 pos 时可写，等于 pos+1 时可读
+	val interface{}
+}
+
+// RingQueue 无锁的有界多生产者多消费者环形队列（Vyukov MPMC）：每个槽位带一个序号，
+// 生产者和消费者各自 CAS 抢占游标，不需要互斥锁。用于高频的事件汇聚，
+// 队列满时 Push、队列空时 Pop 先自旋等待，超过 spinLimit 次之后挂起
+type RingQueue struct {
+	_        cacheLinePad
+	enq      uint64 // 下一个写入的位置
+	_        cacheLinePad
+	deq      uint64 // 下一个读取的位置
+	_        cacheLinePad
+	mask     uint64
+	cells    []ringCell
+	closed   int32
+	notEmpty *parker // 挂起的消费者
+	notFull  *parker // 挂起的生产者
+}
+
+// NewRing 创建容量为 capacity（向上取 2 的幂）的队列
+func NewRing(capacity int) *RingQueue {
+	size := roundPow2(capacity)
+	q := &RingQueue{mask: size - 1, cells: make([]ringCell, size), notEmpty: newParker(), notFull: newParker()}
+	for i := range q.cells {
+		q.cells[i].seq = uint64(i)
+	}
+	return q
+}
+
+// TryPush 插入队列，队列满或者已关闭时返回 false
+func (q *RingQueue) TryPush(v interface{}) bool {
+	if atomic.LoadInt32(&q.closed) == 1 {
+		return false
+	}
+	pos := atomic.LoadUint64(&q.enq)
+	for {
+		cell := &q.cells[pos&q.mask]
+		seq := atomic.LoadUint64(&cell.seq)
+		switch dif := int64(seq) - int64(pos); {
+		case dif == 0:
+			if atomic.CompareAndSwapUint64(&q.enq, pos, pos+1) {
+				cell.val = v
+				atomic.StoreUint64(&cell.seq, pos+1)
+				q.notEmpty.wake()
+				return true
+			}
+		case dif < 0:
+			// 槽位还没有被上一轮的消费者取走，队列满
+			return false
+		}
+		// 被其它生产者抢先，重新读取游标
+		pos = atomic.LoadUint64(&q.enq)
+	}
+}
+
+// Push 插入队列，队列满时等待，已关闭时丢弃
+func (q *RingQueue) Push(v interface{}) {
+	for i := 0; !q.TryPush(v); i++ {
+		if atomic.LoadInt32(&q.closed) == 1 {
+			return
+		}
+		if i < spinLimit {
+			spin(i)
+			continue
+		}
+		q.notFull.wait(func() bool {
+			pos := atomic.LoadUint64(&q.enq)
+			return atomic.LoadInt32(&q.closed) == 1 || int64(atomic.LoadUint64(&q.cells[pos&q.mask].seq))-int64(pos) >= 0
+		})
+	}
+}
+
+// TryPop 取出队头（非阻塞），返回 ok == false 表示空；和 MyQueue 一致，关闭并且取空之后返回 v == nil, ok == true
+func (q *RingQueue) TryPop() (interface{}, bool) {
+	pos := atomic.LoadUint64(&q.deq)
+	for {
+		cell := &q.cells[pos&q.mask]
+		seq := atomic.LoadUint64(&cell.seq)
+		switch dif := int64(seq) - int64(pos+1); {
+		case dif == 0:
+			if atomic.CompareAndSwapUint64(&q.deq, pos, pos+1) {
+				v := cell.val
+				cell.val = nil
+				// 留给下一轮的生产者
+				atomic.StoreUint64(&cell.seq, pos+q.mask+1)
+				q.notFull.wake()
+				return v, true
+			}
+		case dif < 0:
+			return nil, atomic.LoadInt32(&q.closed) == 1
+		}
+		pos = atomic.LoadUint64(&q.deq)
+	}
+}
+
+// Pop 取出队头，队列为空时等待，关闭并且取空之后返回 nil
+func (q *RingQueue) Pop() interface{} {
+	for i := 0; ; i++ {
+		if v, ok := q.TryPop(); ok {
+			return v
+		}
+		if i < spinLimit {
+			spin(i)
+			continue
+		}
+		q.notEmpty.wait(func() bool {
+			pos := atomic.LoadUint64(&q.deq)
+			return atomic.LoadInt32(&q.closed) == 1 || int64(atomic.LoadUint64(&q.cells[pos&q.mask].seq))-int64(pos+1) >= 0
+		})
+	}
+}
+
+// Len 队列长度，并发修改时是近似值
+func (q *RingQueue) Len() int {
+	deq := atomic.LoadUint64(&q.deq)
+	enq := atomic.LoadUint64(&q.enq)
+	if enq < deq {
+		return 0
+	}
+	return int(enq - deq)
+}
+
+// Cap 队列容量
+func (q *RingQueue) Cap() int {
+	return len(q.cells)
+}
+
+// Close 关闭队列，之后 Push 丢弃数据，Pop 取完剩余的数据之后返回 nil。应在所有生产者结束之后调用
+func (q *RingQueue) Close() {
+	atomic.StoreInt32(&q.closed, 1)
+	q.notEmpty.wake()
+	q.notFull.wake()
+}
+
+// SPSCQueue 单生产者单消费者的环形队列：只有一个 goroutine Push、一个 goroutine Pop 时使用，
+// 游标各自只有一个写者，不需要 CAS，比 RingQueue 更快。多个 goroutine 同时 Push 或者 Pop 时结果未定义
+type SPSCQueue struct {
+	_        cacheLinePad
+	head     uint64 // 消费者的位置
+	_        cacheLinePad
+	tail     uint64 // 生产者的位置
+	_        cacheLinePad
+	mask     uint64
+	buf      []interface{}
+	closed   int32
+	notEmpty *parker
+	notFull  *parker
+}
+
+// NewSPSC 创建容量为 capacity（向上取 2 的幂）的队列
+func NewSPSC(capacity int) *SPSCQueue {
+	size := roundPow2(capacity)
+	return &SPSCQueue{mask: size - 1, buf: make([]interface{}, size), notEmpty: newParker(), notFull: newParker()}
+}
+
+// TryPush 插入队列，队列满或者已关闭时返回 false
+func (q *SPSCQueue) TryPush(v interface{}) bool {
+	if atomic.LoadInt32(&q.closed) == 1 {
+		return false
+	}
+	tail := atomic.LoadUint64(&q.tail)
+	if tail-atomic.LoadUint64(&q.head) == uint64(len(q.buf)) {
+		return false
+	}
+	q.buf[tail&q.mask] = v
+	atomic.StoreUint64(&q.tail, tail+1)
+	q.notEmpty.wake()
+	return true
+}
+
+// Push 插入队列，队列满时等待，已关闭时丢弃
+func (q *SPSCQueue) Push(v interface{}) {
+	for i := 0; !q.TryPush(v); i++ {
+		if atomic.LoadInt32(&q.closed) == 1 {
+			return
+		}
+		if i < spinLimit {
+			spin(i)
+			continue
+		}
+		q.notFull.wait(func() bool {
+			return atomic.LoadInt32(&q.closed) == 1 || q.Len() < len(q.buf)
+		})
+	}
+}
+
+// TryPop 取出队头（非阻塞），语义和 RingQueue.TryPop 相同
+func (q *SPSCQueue) TryPop() (interface{}, bool) {
+	head := atomic.LoadUint64(&q.head)
+	if head == atomic.LoadUint64(&q.tail) {
+		return nil, atomic.LoadInt32(&q.closed) == 1
+	}
+	v := q.buf[head&q.mask]
+	q.buf[head&q.mask] = nil
+	atomic.StoreUint64(&q.head, head+1)
+	q.notFull.wake()
+	return v, true
+}
+
+// Pop 取出队头，队列为空时等待，关闭并且取空之后返回 nil
+func (q *SPSCQueue) Pop() interface{} {
+	for i := 0; ; i++ {
+		if v, ok := q.TryPop(); ok {
+			return v
+		}
+		if i < spinLimit {
+			spin(i)
+			continue
+		}
+		q.notEmpty.wait(func() bool {
+			return atomic.LoadInt32(&q.closed) == 1 || q.Len() > 0
+		})
+	}
+}
+
+// Len 队列长度
+func (q *SPSCQueue) Len() int {
+	head := atomic.LoadUint64(&q.head)
+	return int(atomic.LoadUint64(&q.tail) - head)
+}
+
+// Close 关闭队列，之后 Push 丢弃数据，Pop 取完剩余的数据之后返回 nil
+func (q *SPSCQueue) Close() {
+	atomic.StoreInt32(&q.closed, 1)
+	q.notEmpty.wake()
+	q.notFull.wake()
+}
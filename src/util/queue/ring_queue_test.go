@@ -0,0 +1,239 @@
+package queue
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRingQueue(t *testing.T) {
+	for name, q := range map[string]interface {
+		Queue
+		TryPush(v interface{}) bool
+	}{"mpmc": NewRing(3), "spsc": NewSPSC(3)} {
+		t.Run(name, func(t *testing.T) {
+			// 容量向上取 2 的幂
+			for i := 0; i < 4; i++ {
+				if !q.TryPush(i) {
+					t.Fatalf("push %d should succeed", i)
+				}
+			}
+			if q.TryPush(4) {
+				t.Fatal("queue should be full")
+			}
+			if q.Len() != 4 {
+				t.Fatalf("len want 4 got %d", q.Len())
+			}
+			for i := 0; i < 4; i++ {
+				if v := q.Pop(); v != i {
+					t.Fatalf("want %d got %v", i, v)
+				}
+			}
+			if _, ok := q.TryPop(); ok {
+				t.Fatal("queue should be empty")
+			}
+			// 绕过一圈之后仍然正确
+			for i := 0; i < 10; i++ {
+				q.Push(i)
+				if v, ok := q.TryPop(); !ok || v != i {
+					t.Fatalf("want %d got %v", i, v)
+				}
+			}
+			q.Push("last")
+			q.Close()
+			q.Push("dropped")
+			if v := q.Pop(); v != "last" {
+				t.Fatalf("want last got %v", v)
+			}
+			if v, ok := q.TryPop(); !ok || v != nil {
+				t.Fatalf("closed queue should return nil, true, got %v %v", v, ok)
+			}
+		})
+	}
+}
+
+func TestRingQueue_MPMC(t *testing.T) {
+	q := NewRing(64)
+	const producers, consumers, perProducer = 4, 4, 20000
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < perProducer; i++ {
+				q.Push(p*perProducer + i + 1)
+			}
+		}(p)
+	}
+	var sum, count int64
+	var cw sync.WaitGroup
+	for c := 0; c < consumers; c++ {
+		cw.Add(1)
+		go func() {
+			defer cw.Done()
+			for {
+				v := q.Pop()
+				if v == nil {
+					return
+				}
+				atomic.AddInt64(&sum, int64(v.(int)))
+				atomic.AddInt64(&count, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	q.Close()
+	cw.Wait()
+	n := int64(producers * perProducer)
+	if count != n || sum != n*(n+1)/2 {
+		t.Fatalf("want %d items sum %d, got %d items sum %d", n, n*(n+1)/2, count, sum)
+	}
+}
+
+func TestSPSCQueue_Order(t *testing.T) {
+	q := NewSPSC(16)
+	const n = 100000
+	go func() {
+		for i := 0; i < n; i++ {
+			q.Push(i)
+		}
+		q.Close()
+	}()
+	for i := 0; i < n; i++ {
+		if v := q.Pop(); v != i {
+			t.Fatalf("want %d got %v", i, v)
+		}
+	}
+	if v := q.Pop(); v != nil {
+		t.Fatalf("want nil after close got %v", v)
+	}
+}
+
+func TestRingQueue_Park(t *testing.T) {
+	ring := NewRing(2)
+	spsc := NewSPSC(2)
+	for name, q := range map[string]struct {
+		Queue
+		TryPush           func(interface{}) bool
+		notEmpty, notFull *parker
+	}{
+		"ring": {ring, ring.TryPush, ring.notEmpty, ring.notFull},
+		"spsc": {spsc, spsc.TryPush, spsc.notEmpty, spsc.notFull},
+	} {
+		// 等到对端挂起之后再唤醒它
+		parked := func(p *parker) {
+			deadline := time.Now().Add(5 * time.Second)
+			for atomic.LoadInt32(&p.waiters) == 0 {
+				if time.Now().After(deadline) {
+					t.Fatalf("%s: waiter is not parked", name)
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}
+
+		got := make(chan interface{})
+		go func() { got <- q.Pop() }()
+		parked(q.notEmpty)
+		q.Push(1)
+		if v := <-got; v != 1 {
+			t.Fatalf("%s: parked pop want 1 got %v", name, v)
+		}
+
+		for q.TryPush(0) {
+		}
+		pushed := make(chan struct{})
+		go func() { q.Push(2); close(pushed) }()
+		parked(q.notFull)
+		q.Pop()
+		<-pushed
+		q.Pop()
+		if v := q.Pop(); v != 2 {
+			t.Fatalf("%s: parked push want 2 got %v", name, v)
+		}
+
+		go func() { got <- q.Pop() }()
+		parked(q.notEmpty)
+		q.Close()
+		if v := <-got; v != nil {
+			t.Fatalf("%s: pop after close want nil got %v", name, v)
+		}
+	}
+}
+
+// chanQueue 带缓冲的 channel，作为基准测试的对照
+type chanQueue chan interface{}
+
+func (q chanQueue) Push(v interface{}) { q <- v }
+func (q chanQueue) Pop() interface{}   { return <-q }
+func (q chanQueue) TryPop() (interface{}, bool) {
+	select {
+	case v := <-q:
+		return v, true
+	default:
+		return nil, false
+	}
+}
+func (q chanQueue) Len() int { return len(q) }
+func (q chanQueue) Close()   { close(q) }
+
+const benchCap = 1024
+
+func benchQueues() map[string]func() Queue {
+	return map[string]func() Queue{
+		"MyQueue": func() Queue { return New() },
+		"Chan":    func() Queue { return make(chanQueue, benchCap) },
+		"Ring":    func() Queue { return NewRing(benchCap) },
+	}
+}
+
+// benchmark producers 个生产者、consumers 个消费者共传递 b.N 个数据
+func benchmark(b *testing.B, q Queue, producers, consumers int) {
+	var wg sync.WaitGroup
+	per := b.N / producers
+	b.ResetTimer()
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < per; i++ {
+				q.Push(i)
+			}
+		}()
+	}
+	total := per * producers
+	var taken int64
+	var cw sync.WaitGroup
+	for c := 0; c < consumers; c++ {
+		cw.Add(1)
+		go func() {
+			defer cw.Done()
+			for atomic.AddInt64(&taken, 1) <= int64(total) {
+				q.Pop()
+			}
+		}()
+	}
+	wg.Wait()
+	cw.Wait()
+}
+
+func BenchmarkQueue_SPSC(b *testing.B) {
+	queues := benchQueues()
+	queues["SPSC"] = func() Queue { return NewSPSC(benchCap) }
+	for _, name := range []string{"MyQueue", "Chan", "Ring", "SPSC"} {
+		b.Run(name, func(b *testing.B) {
+			benchmark(b, queues[name](), 1, 1)
+		})
+	}
+}
+
+func BenchmarkQueue_MPMC(b *testing.B) {
+	queues := benchQueues()
+	n := runtime.GOMAXPROCS(0)
+	for _, name := range []string{"MyQueue", "Chan", "Ring"} {
+		b.Run(name, func(b *testing.B) {
+			benchmark(b, queues[name](), n, n)
+		})
+	}
+}
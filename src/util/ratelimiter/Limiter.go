@@ -0,0 +1,111 @@
+package ratelimiter
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidLimit = errors.New("ratelimiter: rate and period must be positive")
+)
+
+// Limit 限流规则：每 Period 时间内最多放行 Rate 个请求，Burst 为允许的突发量（<=0 时等于 Rate）
+type Limit struct {
+	Rate   int64
+	Period time.Duration
+	Burst  int64
+}
+
+// PerSecond 每秒 rate 个请求
+func PerSecond(rate int64) Limit {
+	return Limit{Rate: rate, Period: time.Second, Burst: rate}
+}
+
+// PerMinute 每分钟 rate 个请求
+func PerMinute(rate int64) Limit {
+	return Limit{Rate: rate, Period: time.Minute, Burst: rate}
+}
+
+func (l Limit) burst() int64 {
+	if l.Burst <= 0 {
+		return l.Rate
+	}
+	return l.Burst
+}
+
+// interval 生成一个令牌所需的时间（GCRA 中的 emission interval）
+func (l Limit) interval() time.Duration {
+	return l.Period / time.Duration(l.Rate)
+}
+
+func (l Limit) validate() error {
+	if l.Rate <= 0 || l.Period <= 0 || l.Period < time.Duration(l.Rate) {
+		return ErrInvalidLimit
+	}
+	return nil
+}
+
+// Result 一次限流判定的结果，中间件据此设置 Retry-After / X-RateLimit-* 响应头
+type Result struct {
+	Allowed    bool
+	Limit      int64         // 窗口内的请求上限
+	Remaining  int64         // 本次判定之后还剩余的额度
+	RetryAfter time.Duration // 被拒绝时需要等待多久才能重试，-1 表示本次请求永远无法满足（n 大于桶容量）
+	ResetAfter time.Duration // 多久之后额度完全恢复
+}
+
+// Limiter 限流器，key 一般是用户id / ip / 接口名
+type Limiter interface {
+	Allow(key string) (Result, error)
+	AllowN(key string, n int64) (Result, error)
+}
+
+// Option 限流器的可选配置
+type Option func(*options)
+
+type options struct {
+	prefix      string
+	fallback    Limiter
+	noFallback  bool
+	clock       func() time.Time
+	errCallback func(error)
+	histBounds  []float64
+}
+
+// WithPrefix 设置 redis key 前缀，不同业务、不同算法之间通过前缀隔离
+func WithPrefix(prefix string) Option {
+	return func(o *options) {
+		o.prefix = prefix
+	}
+}
+
+// WithFallback redis 不可用时降级使用的限流器，传 nil 表示不降级，直接把错误返回给调用方。
+// 默认降级到同样规则的本地 GCRA 限流器，注意此时是单机限流，集群整体放行量会是 节点数*Rate
+func WithFallback(fallback Limiter) Option {
+	return func(o *options) {
+		o.fallback = fallback
+		o.noFallback = fallback == nil
+	}
+}
+
+// WithClock 注入时钟，测试用
+func WithClock(clock func() time.Time) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+// WithErrorCallback redis 出错（并且降级）时的回调，可以用来打点报警
+func WithErrorCallback(fn func(error)) Option {
+	return func(o *options) {
+		o.errCallback = fn
+	}
+}
+
+func newOptions(defaultPrefix string, opts []Option) *options {
+	o := &options{prefix: defaultPrefix, clock: time.Now}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
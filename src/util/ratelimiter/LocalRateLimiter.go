@@ -0,0 +1,84 @@
+package ratelimiter
+
+import (
+	"sync"
+	"time"
+)
+
+// 本地 GCRA(Generic Cell Rate Algorithm) 限流器
+// 每个 key 只需要记录一个 TAT(theoretical arrival time，理论到达时间)，效果等价于令牌桶，但是不需要定时补充令牌。
+// 主要用作 redis 限流器的降级方案，也可以单独用于单机限流。
+
+const sweepEvery = 1024 // 每 sweepEvery 次请求清理一次过期的 key，防止 map 无限增长
+
+type LocalLimiter struct {
+	mu    sync.Mutex
+	limit Limit
+	tat   map[string]time.Time
+	clock func() time.Time
+	calls int
+}
+
+// NewLocalLimiter 创建本地限流器
+func NewLocalLimiter(limit Limit, opts ...Option) (*LocalLimiter, error) {
+	if err := limit.validate(); err != nil {
+		return nil, err
+	}
+	o := newOptions("", opts)
+	return &LocalLimiter{
+		limit: limit,
+		tat:   make(map[string]time.Time),
+		clock: o.clock,
+	}, nil
+}
+
+// Allow 判断 key 是否可以通过一个请求
+func (l *LocalLimiter) Allow(key string) (Result, error) {
+	return l.AllowN(key, 1)
+}
+
+// AllowN 判断 key 是否可以一次通过 n 个请求
+func (l *LocalLimiter) AllowN(key string, n int64) (Result, error) {
+	interval := l.limit.interval()
+	tolerance := interval * time.Duration(l.limit.burst()) // 突发容忍度
+	increment := interval * time.Duration(n)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock()
+	l.calls++
+	if l.calls%sweepEvery == 0 {
+		l.sweep(now)
+	}
+
+	tat, ok := l.tat[key]
+	if !ok || tat.Before(now) {
+		tat = now
+	}
+	newTat := tat.Add(increment)
+	allowAt := newTat.Add(-tolerance)
+	res := Result{Limit: l.limit.burst()}
+	if diff := now.Sub(allowAt); diff < 0 {
+		if increment > tolerance {
+			res.RetryAfter = -1
+		} else {
+			res.RetryAfter = -diff
+		}
+		res.ResetAfter = tat.Sub(now)
+		return res, nil
+	}
+	l.tat[key] = newTat
+	res.Allowed = true
+	res.Remaining = int64(now.Sub(allowAt) / interval)
+	res.ResetAfter = newTat.Sub(now)
+	return res, nil
+}
+
+func (l *LocalLimiter) sweep(now time.Time) {
+	for key, tat := range l.tat {
+		if tat.Before(now) {
+			delete(l.tat, key)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package ratelimiter
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// 基于 redis + lua 的分布式限流器
+// RedisSlideRateLimiter.go 里面的 isActionAllowed 把 ZREMRANGEBYSCORE、ZCARD、ZADD、EXPIRE 分成了四次网络往返，
+// 两个网关同时判断时都会看到"还剩最后一个名额"，于是都放行了。这里把每种算法的判断+更新写成一个 lua 脚本，
+// redis 单线程执行脚本，整个判断过程是原子的。
+// 时间由客户端传入（微秒），这样脚本是确定性的，可以正常做主从复制，测试时也可以注入时钟。
+
+// RedisScripter 执行 lua 脚本需要的 redis 客户端，*redis.Client、*redis.ClusterClient、*redis.Ring 都满足
+type RedisScripter interface {
+	Eval(script string, keys []string, args ...interface{}) *redis.Cmd
+	EvalSha(sha1 string, keys []string, args ...interface{}) *redis.Cmd
+	ScriptExists(hashes ...string) *redis.BoolSliceCmd
+	ScriptLoad(script string) *redis.StringCmd
+}
+
+// 滑动日志：zset 里面记录窗口内每一个请求的时间戳，最精确，但是内存占用和 limit 成正比
+// ARGV: now, window, limit, n, member
+var slidingLogScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+local n = tonumber(ARGV[4])
+local member = ARGV[5]
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+local count = redis.call('ZCARD', key)
+if count + n > limit then
+	local retry = -1
+	if n <= limit then
+		local oldest = redis.call('ZRANGE', key, count + n - limit - 1, count + n - limit - 1, 'WITHSCORES')
+		retry = tonumber(oldest[2]) + window - now
+	end
+	local reset = 0
+	local newest = redis.call('ZRANGE', key, -1, -1, 'WITHSCORES')
+	if #newest > 0 then
+		reset = tonumber(newest[2]) + window - now
+	end
+	return {0, limit - count, retry, reset}
+end
+for i = 1, n do
+	redis.call('ZADD', key, now, member .. ':' .. i)
+end
+redis.call('PEXPIRE', key, math.ceil(window / 1000))
+return {1, limit - count - n, 0, window}
+`)
+
+// 滑动计数：只保存当前窗口和上一个窗口的计数，用上一个窗口按时间比例加权估算，内存 O(1)
+// ARGV: now, window, limit, n
+var slidingCounterScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+local n = tonumber(ARGV[4])
+
+local idx = math.floor(now / window)
+local data = redis.call('HMGET', key, 'w', 'c', 'p')
+local w = tonumber(data[1]) or -1
+local c = tonumber(data[2]) or 0
+local p = tonumber(data[3]) or 0
+if w ~= idx then
+	if w == idx - 1 then
+		p = c
+	else
+		p = 0
+	end
+	c = 0
+end
+
+local elapsed = now - idx * window
+local estimated = p * (window - elapsed) / window + c
+if estimated + n > limit then
+	local retry = -1
+	if n <= limit then
+		if c + n <= limit then
+			-- 等上一个窗口的权重衰减到足够小
+			retry = math.ceil(window - elapsed - (limit - c - n) * window / p)
+		else
+			-- 当前窗口已经不够了，等到下一个窗口里当前窗口的权重衰减到足够小
+			retry = math.ceil(window - elapsed + (c + n - limit) * window / c)
+		end
+	end
+	return {0, math.max(0, math.floor(limit - estimated)), retry, 2 * window - elapsed}
+end
+c = c + n
+redis.call('HMSET', key, 'w', string.format('%.0f', idx), 'c', c, 'p', p)
+redis.call('PEXPIRE', key, math.ceil(2 * window / 1000))
+return {1, math.max(0, math.floor(limit - estimated - n)), 0, 2 * window - elapsed}
+`)
+
+// GCRA：只保存一个理论到达时间 TAT，内存 O(1)，效果等价于令牌桶
+// ARGV: now, interval, burst, n
+var gcraScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local burst = tonumber(ARGV[3])
+local n = tonumber(ARGV[4])
+
+local tolerance = interval * burst
+local increment = interval * n
+local tat = tonumber(redis.call('GET', key)) or now
+if tat < now then
+	tat = now
+end
+local newTat = tat + increment
+local diff = now - (newTat - tolerance)
+if diff < 0 then
+	local retry = -diff
+	if increment > tolerance then
+		retry = -1
+	end
+	return {0, 0, retry, tat - now}
+end
+local ttl = newTat - now
+redis.call('SET', key, string.format('%.0f', newTat), 'PX', math.max(1, math.ceil(ttl / 1000)))
+return {1, math.floor(diff / interval), 0, ttl}
+`)
+
+// 令牌桶：hash 里保存剩余令牌数和上次补充令牌的时间，按时间差惰性补充
+// ARGV: now, period, rate(每个 period 生成的令牌数), capacity, n
+var tokenBucketScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local rate = tonumber(ARGV[3]) / tonumber(ARGV[2])
+local capacity = tonumber(ARGV[4])
+local n = tonumber(ARGV[5])
+
+local data = redis.call('HMGET', key, 'tokens', 'ts')
+local tokens = tonumber(data[1])
+local ts = tonumber(data[2])
+if tokens == nil or ts == nil then
+	tokens = capacity
+	ts = now
+end
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+local reset = math.ceil((capacity - tokens) / rate)
+if tokens < n then
+	local retry = -1
+	if n <= capacity then
+		retry = math.ceil((n - tokens) / rate)
+	end
+	return {0, math.floor(tokens), retry, reset}
+end
+tokens = tokens - n
+redis.call('HMSET', key, 'tokens', string.format('%.6f', tokens), 'ts', string.format('%.0f', now))
+redis.call('PEXPIRE', key, math.ceil(capacity / rate / 1000) + 1000)
+return {1, math.floor(tokens), 0, math.ceil((capacity - tokens) / rate)}
+`)
+
+// RedisLimiter 基于 lua 脚本的分布式限流器，四种算法共用同一套执行、解析和降级逻辑
+type RedisLimiter struct {
+	client RedisScripter
+	script *redis.Script
+	limit  Limit
+	max    int64 // 窗口内的请求上限，滑动窗口类算法是 Rate，桶类算法是 Burst
+	opts   *options
+	// args 根据当前时间和请求数构造脚本参数
+	args func(now time.Time, n int64) []interface{}
+}
+
+// NewRedisSlidingLogLimiter 滑动日志限流：任意 Period 长度的时间窗口内最多 Rate 个请求
+func NewRedisSlidingLogLimiter(client RedisScripter, limit Limit, opts ...Option) (*RedisLimiter, error) {
+	l, err := newRedisLimiter(client, slidingLogScript, limit, "ratelimiter:slidelog:", opts)
+	if err != nil {
+		return nil, err
+	}
+	l.max = limit.Rate
+	instance := instanceID()
+	var seq int64
+	l.args = func(now time.Time, n int64) []interface{} {
+		// member 必须唯一，否则同一微秒内的多个请求会被 zset 去重
+		member := fmt.Sprintf("%s:%d", instance, atomic.AddInt64(&seq, 1))
+		return []interface{}{unixMicros(now), micros(limit.Period), limit.Rate, n, member}
+	}
+	return l, nil
+}
+
+// instanceID 每个限流器实例唯一的 id，作为 zset member 的前缀。
+// 不能用 math/rand：全局的随机源默认没有播种，所有进程会得到相同的 id，member 相互覆盖导致多放行
+func instanceID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err == nil {
+		return hex.EncodeToString(b[:])
+	}
+	host, _ := os.Hostname()
+	return host + "-" + strconv.Itoa(os.Getpid()) + "-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+// NewRedisSlidingCounterLimiter 滑动计数限流：近似的滑动窗口，Period 内最多 Rate 个请求
+func NewRedisSlidingCounterLimiter(client RedisScripter, limit Limit, opts ...Option) (*RedisLimiter, error) {
+	l, err := newRedisLimiter(client, slidingCounterScript, limit, "ratelimiter:slidecounter:", opts)
+	if err != nil {
+		return nil, err
+	}
+	l.max = limit.Rate
+	l.args = func(now time.Time, n int64) []interface{} {
+		return []interface{}{unixMicros(now), micros(limit.Period), limit.Rate, n}
+	}
+	return l, nil
+}
+
+// NewRedisGCRALimiter GCRA 限流：平滑地每 Period/Rate 放行一个请求，最多允许 Burst 个突发
+func NewRedisGCRALimiter(client RedisScripter, limit Limit, opts ...Option) (*RedisLimiter, error) {
+	l, err := newRedisLimiter(client, gcraScript, limit, "ratelimiter:gcra:", opts)
+	if err != nil {
+		return nil, err
+	}
+	l.args = func(now time.Time, n int64) []interface{} {
+		return []interface{}{unixMicros(now), micros(limit.interval()), limit.burst(), n}
+	}
+	return l, nil
+}
+
+// NewRedisTokenBucketLimiter 令牌桶限流：桶容量为 Burst，每 Period 补充 Rate 个令牌
+func NewRedisTokenBucketLimiter(client RedisScripter, limit Limit, opts ...Option) (*RedisLimiter, error) {
+	l, err := newRedisLimiter(client, tokenBucketScript, limit, "ratelimiter:tokenbucket:", opts)
+	if err != nil {
+		return nil, err
+	}
+	l.args = func(now time.Time, n int64) []interface{} {
+		return []interface{}{unixMicros(now), micros(limit.Period), limit.Rate, limit.burst(), n}
+	}
+	return l, nil
+}
+
+func newRedisLimiter(client RedisScripter, script *redis.Script, limit Limit, prefix string, opts []Option) (*RedisLimiter, error) {
+	if err := limit.validate(); err != nil {
+		return nil, err
+	}
+	o := newOptions(prefix, opts)
+	if o.fallback == nil && !o.noFallback {
+		local, err := NewLocalLimiter(limit, WithClock(o.clock))
+		if err != nil {
+			return nil, err
+		}
+		o.fallback = local
+	}
+	return &RedisLimiter{client: client, script: script, limit: limit, max: limit.burst(), opts: o}, nil
+}
+
+// Allow 判断 key 是否可以通过一个请求
+func (l *RedisLimiter) Allow(key string) (Result, error) {
+	return l.AllowN(key, 1)
+}
+
+// AllowN 判断 key 是否可以一次通过 n 个请求，redis 出错时走降级限流器
+func (l *RedisLimiter) AllowN(key string, n int64) (Result, error) {
+	now := l.opts.clock()
+	res, err := l.script.Run(l.client, []string{l.opts.prefix + key}, l.args(now, n)...).Result()
+	if err == nil {
+		var r Result
+		if r, err = l.parse(res); err == nil {
+			return r, nil
+		}
+	}
+	if l.opts.errCallback != nil {
+		l.opts.errCallback(err)
+	}
+	if l.opts.fallback == nil {
+		return Result{}, err
+	}
+	return l.opts.fallback.AllowN(key, n)
+}
+
+// Limit 当前限流规则
+func (l *RedisLimiter) Limit() Limit {
+	return l.limit
+}
+
+// 脚本统一返回 {allowed, remaining, retry(us), reset(us)}
+func (l *RedisLimiter) parse(res interface{}) (Result, error) {
+	values, ok := res.([]interface{})
+	if !ok || len(values) != 4 {
+		return Result{}, fmt.Errorf("ratelimiter: unexpected script result %v", res)
+	}
+	nums := make([]int64, len(values))
+	for i, v := range values {
+		if nums[i], ok = v.(int64); !ok {
+			return Result{}, fmt.Errorf("ratelimiter: unexpected script result %v", res)
+		}
+	}
+	r := Result{
+		Allowed:    nums[0] == 1,
+		Limit:      l.max,
+		Remaining:  nums[1],
+		RetryAfter: time.Duration(nums[2]) * time.Microsecond,
+		ResetAfter: time.Duration(nums[3]) * time.Microsecond,
+	}
+	if nums[2] < 0 {
+		r.RetryAfter = -1
+	}
+	return r, nil
+}
+
+func unixMicros(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Microsecond)
+}
+
+func micros(d time.Duration) int64 {
+	return int64(d / time.Microsecond)
+}
@@ -0,0 +1,247 @@
+package ratelimiter
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1600000000, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() {
+		client.Close()
+		mr.Close()
+	})
+	return mr, client
+}
+
+type limiterFactory func(RedisScripter, Limit, ...Option) (*RedisLimiter, error)
+
+var factories = map[string]limiterFactory{
+	"slidelog":     NewRedisSlidingLogLimiter,
+	"slidecounter": NewRedisSlidingCounterLimiter,
+	"gcra":         NewRedisGCRALimiter,
+	"tokenbucket":  NewRedisTokenBucketLimiter,
+}
+
+func TestRedisLimiter_Basic(t *testing.T) {
+	for name, factory := range factories {
+		t.Run(name, func(t *testing.T) {
+			_, client := newTestRedis(t)
+			clock := newFakeClock()
+			l, err := factory(client, PerSecond(5), WithClock(clock.Now), WithFallback(nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 5; i++ {
+				res, err := l.Allow("user")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !res.Allowed {
+					t.Fatalf("request %d should be allowed", i)
+				}
+				if res.Remaining != int64(4-i) {
+					t.Fatalf("request %d remaining want %d got %d", i, 4-i, res.Remaining)
+				}
+			}
+			res, err := l.Allow("user")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Allowed {
+				t.Fatal("6th request should be rejected")
+			}
+			if res.RetryAfter <= 0 || res.RetryAfter > 2*time.Second {
+				t.Fatalf("unexpected retry after %v", res.RetryAfter)
+			}
+			if res.Limit != 5 {
+				t.Fatalf("limit want 5 got %d", res.Limit)
+			}
+
+			// 其他 key 不受影响
+			if res, _ := l.Allow("other"); !res.Allowed {
+				t.Fatal("other key should be allowed")
+			}
+
+			// 等待 RetryAfter 之后可以重新放行
+			clock.Advance(res.RetryAfter)
+			if res, _ := l.Allow("user"); !res.Allowed {
+				t.Fatalf("request after retry-after should be allowed")
+			}
+
+			// 一次请求超过上限，永远不可能满足
+			res, err = l.AllowN("user", 6)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Allowed || res.RetryAfter != -1 {
+				t.Fatalf("AllowN(6) want rejected forever, got %+v", res)
+			}
+		})
+	}
+}
+
+func TestRedisLimiter_Recover(t *testing.T) {
+	for name, factory := range factories {
+		t.Run(name, func(t *testing.T) {
+			_, client := newTestRedis(t)
+			clock := newFakeClock()
+			l, err := factory(client, PerSecond(10), WithClock(clock.Now), WithFallback(nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 10 秒内每 100ms 来 5 个请求，远超 10qps，放行量应该贴近 10qps，最多再多一个突发量
+			allowed := 0
+			for tick := 0; tick < 100; tick++ {
+				for i := 0; i < 5; i++ {
+					res, err := l.Allow("k")
+					if err != nil {
+						t.Fatal(err)
+					}
+					if res.Allowed {
+						allowed++
+					}
+				}
+				clock.Advance(100 * time.Millisecond)
+			}
+			if allowed < 90 || allowed > 110 {
+				t.Fatalf("allowed %d in 10s, want about 100", allowed)
+			}
+		})
+	}
+}
+
+func TestRedisLimiter_Concurrent(t *testing.T) {
+	for name, factory := range factories {
+		t.Run(name, func(t *testing.T) {
+			_, client := newTestRedis(t)
+			clock := newFakeClock()
+			// 模拟多个网关各自持有一个限流器实例，共享同一个 redis
+			var gateways []*RedisLimiter
+			for i := 0; i < 4; i++ {
+				l, err := factory(client, PerMinute(50), WithClock(clock.Now), WithFallback(nil))
+				if err != nil {
+					t.Fatal(err)
+				}
+				gateways = append(gateways, l)
+			}
+			var (
+				wg      sync.WaitGroup
+				mu      sync.Mutex
+				allowed int
+			)
+			for _, l := range gateways {
+				for i := 0; i < 5; i++ {
+					wg.Add(1)
+					go func(l *RedisLimiter) {
+						defer wg.Done()
+						for j := 0; j < 10; j++ {
+							res, err := l.Allow("hot")
+							if err != nil {
+								t.Error(err)
+								return
+							}
+							if res.Allowed {
+								mu.Lock()
+								allowed++
+								mu.Unlock()
+							}
+						}
+					}(l)
+				}
+			}
+			wg.Wait()
+			if allowed != 50 {
+				t.Fatalf("allowed want exactly 50 got %d", allowed)
+			}
+		})
+	}
+}
+
+func TestRedisLimiter_Prefix(t *testing.T) {
+	mr, client := newTestRedis(t)
+	l, err := NewRedisGCRALimiter(client, PerSecond(1), WithPrefix("gw:"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Allow("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if !mr.Exists("gw:alice") {
+		t.Fatalf("key with prefix not found, keys: %v", mr.Keys())
+	}
+}
+
+func TestRedisLimiter_Fallback(t *testing.T) {
+	mr, client := newTestRedis(t)
+	clock := newFakeClock()
+	var errs int
+	l, err := NewRedisTokenBucketLimiter(client, PerSecond(3), WithClock(clock.Now),
+		WithErrorCallback(func(error) { errs++ }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr.Close() // redis 挂掉
+
+	allowed := 0
+	for i := 0; i < 5; i++ {
+		res, err := l.Allow("k")
+		if err != nil {
+			t.Fatalf("fallback should hide redis error, got %v", err)
+		}
+		if res.Allowed {
+			allowed++
+		}
+	}
+	if allowed != 3 {
+		t.Fatalf("fallback allowed want 3 got %d", allowed)
+	}
+	if errs != 5 {
+		t.Fatalf("error callback want 5 calls got %d", errs)
+	}
+
+	noFallback, err := NewRedisTokenBucketLimiter(client, PerSecond(3), WithFallback(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := noFallback.Allow("k"); err == nil {
+		t.Fatal("expected redis error without fallback")
+	}
+}
+
+func TestNewRedisLimiter_InvalidLimit(t *testing.T) {
+	_, client := newTestRedis(t)
+	if _, err := NewRedisGCRALimiter(client, Limit{Rate: 0, Period: time.Second}); !errors.Is(err, ErrInvalidLimit) {
+		t.Fatalf("want ErrInvalidLimit got %v", err)
+	}
+}
@@ -3,7 +3,6 @@ package ratelimiter
 import (
 	"fmt"
 	"github.com/go-redis/redis"
-	"strconv"
 	"time"
 )
 
@@ -21,32 +20,29 @@ func DoRateLimiter() {
 
 	for i := 0; i < 20; i++ {
 		//假设对用户jankin的登录操作进行限流检测，60秒内允许登录5次
-		fmt.Println(isActionAllowed(*rdb, "jankin", "login", 60, 5))
+		fmt.Println(isActionAllowed(rdb, "jankin", "login", 60, 5))
 		//可以根据isActionAllowed方法返回的是true还是false来判断是否达到限流阈值
 	}
 }
 
 // 当然是用Redis限流的主流方法还有漏桶算法（leaky-bucket）和令牌桶算法（token-bucket），本文主要讲解简单的计数器和滑动窗口法，这两种算法都属于计数器法，后面将有更详细的实验进行介绍漏桶算法和令牌桶算法。
-func isActionAllowed(rdb redis.Client, userId, actionKey string, period, maxCount int) bool {
-	millisecond := time.Now().UnixNano() / 1e6
-	key := userId + "_" + actionKey
-	//裁剪zset，只保留窗口内的值
-	rdb.ZRemRangeByScore(key, "0", strconv.FormatInt(millisecond-int64(period*1000), 10))
-	//统计窗口的值的数量
-	ran := rdb.ZCard(key)
-	//先判断是否达到阈值
-	if int(ran.Val()) < maxCount {
-		fmt.Println("当前未到达限流阈值,插入新数据：", millisecond)
-		//符合阈值才添加数据
-		rdb.ZAdd(key, redis.Z{
-			Score:  float64(millisecond),
-			Member: millisecond,
-		})
-		//设置一个过期时间，通常只要比窗口大一点即可，这里设置大1秒
-		rdb.Expire(key, time.Duration(period+1)*time.Second)
-		return true
-	} else {
-		fmt.Println("当前已到达限流阈值")
+// 原来的实现把 ZREMRANGEBYSCORE、ZCARD、ZADD、EXPIRE 分成四次请求，并发时会超卖，现在改成 lua 脚本原子执行，见 RedisLuaRateLimiter.go
+func isActionAllowed(rdb *redis.Client, userId, actionKey string, period, maxCount int) bool {
+	limiter, err := NewRedisSlidingLogLimiter(rdb, Limit{Rate: int64(maxCount), Period: time.Duration(period) * time.Second},
+		WithPrefix(""), WithFallback(nil))
+	if err != nil {
+		fmt.Println("限流配置错误：", err)
+		return false
+	}
+	res, err := limiter.Allow(userId + "_" + actionKey)
+	if err != nil {
+		fmt.Println("限流检测失败：", err)
 		return false
 	}
+	if res.Allowed {
+		fmt.Println("当前未到达限流阈值，剩余：", res.Remaining)
+	} else {
+		fmt.Println("当前已到达限流阈值，重试间隔：", res.RetryAfter)
+	}
+	return res.Allowed
 }
@@ -2,25 +2,110 @@ package ratelimiter
 
 import (
 	"errors"
+	"math"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// Window window
+// DefaultHistogramBounds 默认的直方图分桶上界，按毫秒耗时设计（1ms ~ 10s），记录其他量纲的数据时用 WithHistogram 指定
+var DefaultHistogramBounds = []float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000, 2000, 5000, 10000}
+
+// WithHistogram 设置 Window 直方图的分桶上界（升序），分桶越细 Percentile 越准，内存占用也越大
+func WithHistogram(bounds ...float64) Option {
+	return func(o *options) {
+		o.histBounds = bounds
+	}
+}
+
+// Window 滑动统计窗口：把 window 按 tick 切成若干个桶，每个桶记录这段时间内样本的 count/sum/min/max 和直方图，
+// 查询时只汇总最近 window 时间内的桶，可以得到 QPS、均值、p99 等指标，供熔断器、限流器使用。
+//
+// 桶按 "当前时间 / tick" 定位，写入时发现桶里是过期的数据就先清空，不需要后台 goroutine 定时滑动。
+// 写入和查询都不加全局锁：桶的字段用原子操作更新，只有切换时间片清空桶时加这个桶的锁（每个 tick 一次）。
+// 代价是统计是近似的：查询时可能读到正在写入的桶的部分字段，恰好在时间片切换时写入的样本可能记到相邻的时间片。
+//
+//	win, _ := NewWindow(10*time.Second, time.Second)
+//	win.AddDuration(rtt)
+//	stats := win.Snapshot() // stats.Rate, stats.Mean, stats.P99
 type Window struct {
-	sync.RWMutex
-	window   time.Duration
-	tick     time.Duration
-	samples  []int64
-	stopOnce sync.Once
-	stopping chan struct{}
-	pos      int
-	size     int
-}
-
-// New new window
-// New(time.Second*5, time.Second)
-func NewWindow(window, tick time.Duration) (*Window, error) {
+	window  time.Duration
+	tick    time.Duration
+	bounds  []float64
+	buckets []bucket
+	clock   func() time.Time
+	aggPool sync.Pool // 查询时汇总用的 windowAgg，避免每次查询都分配直方图
+}
+
+// bucket 的字段都用原子操作读写，float64 按 math.Float64bits 存储
+type bucket struct {
+	epoch int64 // 桶对应的时间片编号，即 unixNano / tick
+	count int64
+	sum   uint64
+	min   uint64  // 没有样本时为 +Inf
+	max   uint64  // 没有样本时为 -Inf
+	hist  []int64 // hist[i] 为落在 (bounds[i-1], bounds[i]] 的样本数，最后一个是超过所有上界的样本数
+	mu    sync.Mutex
+}
+
+func (b *bucket) reset(epoch int64) {
+	atomic.StoreInt64(&b.count, 0)
+	atomic.StoreUint64(&b.sum, math.Float64bits(0))
+	atomic.StoreUint64(&b.min, math.Float64bits(math.Inf(1)))
+	atomic.StoreUint64(&b.max, math.Float64bits(math.Inf(-1)))
+	for i := range b.hist {
+		atomic.StoreInt64(&b.hist[i], 0)
+	}
+	atomic.StoreInt64(&b.epoch, epoch)
+}
+
+// addFloat 原子地把 v 加到 addr 上
+func addFloat(addr *uint64, v float64) {
+	for {
+		old := atomic.LoadUint64(addr)
+		if atomic.CompareAndSwapUint64(addr, old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// storeIf less(v, 当前值) 时原子地把 addr 设为 v，用于更新 min/max
+func storeIf(addr *uint64, v float64, less func(a, b float64) bool) {
+	for {
+		old := atomic.LoadUint64(addr)
+		if !less(v, math.Float64frombits(old)) || atomic.CompareAndSwapUint64(addr, old, math.Float64bits(v)) {
+			return
+		}
+	}
+}
+
+func lessFloat(a, b float64) bool    { return a < b }
+func greaterFloat(a, b float64) bool { return a > b }
+
+// windowAgg 多个桶的汇总
+type windowAgg struct {
+	count         int64
+	sum, min, max float64
+	hist          []int64
+}
+
+// WindowStats 窗口内的汇总指标
+type WindowStats struct {
+	Count int64
+	Sum   float64
+	Min   float64
+	Max   float64
+	Mean  float64
+	Rate  float64 // 每秒样本数，按整个窗口时长计算
+	P50   float64
+	P90   float64
+	P99   float64
+}
+
+// NewWindow 创建滑动统计窗口，window 必须是 tick 的整数倍，可选 WithClock / WithHistogram
+// NewWindow(time.Second*5, time.Second)
+func NewWindow(window, tick time.Duration, opts ...Option) (*Window, error) {
 	if window == 0 {
 		return nil, errors.New("sliding window cannot be zero")
 	}
@@ -30,73 +115,188 @@ func NewWindow(window, tick time.Duration) (*Window, error) {
 	if window <= tick || window%tick != 0 {
 		return nil, errors.New("window size has to be a multiplier of granularity size")
 	}
+	o := newOptions("", opts)
+	bounds := o.histBounds
+	if bounds == nil {
+		bounds = DefaultHistogramBounds
+	}
+	if !sort.Float64sAreSorted(bounds) {
+		return nil, errors.New("histogram bounds must be sorted")
+	}
 	win := &Window{
-		window:   window,
-		tick:     tick,
-		samples:  make([]int64, int(window/tick)),
-		stopping: make(chan struct{}, 1),
+		window:  window,
+		tick:    tick,
+		bounds:  append([]float64(nil), bounds...),
+		buckets: make([]bucket, int(window/tick)),
+		clock:   o.clock,
+	}
+	for i := range win.buckets {
+		win.buckets[i].hist = make([]int64, len(bounds)+1)
+		win.buckets[i].reset(-1)
+	}
+	win.aggPool.New = func() interface{} {
+		return &windowAgg{hist: make([]int64, len(win.bounds)+1)}
 	}
-	go win.shifter()
 	return win, nil
 }
 
-func (win *Window) shifter() {
-	ticker := time.NewTimer(win.tick) // 滑动间隔
-	for {
-		select {
-		case <-ticker.C:
-			win.slidingWindow() // 周期性触发检测
-		case <-win.stopping:
-			return
+func (win *Window) epoch() int64 {
+	return win.clock().UnixNano() / int64(win.tick)
+}
+
+// current 返回当前时间片对应的桶，桶里是上一轮的旧数据时先清空。
+// 桶已经属于更新的时间片时（写入的 goroutine 在切换时间片时被调度走了），记到新的时间片里
+func (win *Window) current() *bucket {
+	epoch := win.epoch()
+	b := &win.buckets[epoch%int64(len(win.buckets))]
+	if atomic.LoadInt64(&b.epoch) < epoch {
+		b.mu.Lock()
+		if atomic.LoadInt64(&b.epoch) < epoch {
+			b.reset(epoch)
 		}
+		b.mu.Unlock()
 	}
+	return b
 }
 
-func (win *Window) slidingWindow() {
-	win.Lock()
-	defer win.Unlock()
-	win.pos = win.pos + 1
-	if win.pos >= len(win.samples) {
-		win.pos = 0
-	}
-	win.samples[win.pos] = 0
+// Record 记录一个样本
+func (win *Window) Record(v float64) {
+	b := win.current()
+	storeIf(&b.min, v, lessFloat)
+	storeIf(&b.max, v, greaterFloat)
+	addFloat(&b.sum, v)
+	atomic.AddInt64(&b.hist[sort.SearchFloat64s(win.bounds, v)], 1)
+	atomic.AddInt64(&b.count, 1)
 }
 
-// Add increments the value of the current sample.
+// AddDuration 记录一次耗时，单位毫秒，和 DefaultHistogramBounds 对应
+func (win *Window) AddDuration(d time.Duration) {
+	win.Record(float64(d) / float64(time.Millisecond))
+}
+
+// Add 记录一个样本，值为 n。只关心次数时 Add(1)，Total 即为次数
 func (win *Window) Add(n int64) {
-	win.Lock()
-	defer win.Unlock()
-	win.samples[win.pos] += n
+	win.Record(float64(n))
 }
 
 // Reset the samples in this sliding time window.
 func (win *Window) Reset() {
-	win.Lock()
-	defer win.Unlock()
-
-	win.pos, win.size = 0, 0
-	for i := range win.samples {
-		win.samples[i] = 0
+	for i := range win.buckets {
+		b := &win.buckets[i]
+		b.mu.Lock()
+		b.reset(-1)
+		b.mu.Unlock()
 	}
 }
 
 // Total returns the sum of all values over the window
 func (win *Window) Total() int64 {
+	return int64(win.Snapshot().Sum)
+}
+
+// Count 窗口内的样本数
+func (win *Window) Count() int64 {
+	return win.Snapshot().Count
+}
+
+// Rate 窗口内平均每秒的样本数
+func (win *Window) Rate() float64 {
+	return win.Snapshot().Rate
+}
+
+// Mean 窗口内样本的均值，没有样本时为 0
+func (win *Window) Mean() float64 {
+	return win.Snapshot().Mean
+}
+
+// Percentile 窗口内样本的分位数，p 取值 (0, 1]，例如 0.99。
+// 根据直方图在桶内线性插值估算，精度取决于分桶的粒度
+func (win *Window) Percentile(p float64) float64 {
+	agg := win.aggregate()
+	defer win.aggPool.Put(agg)
+	return win.percentile(agg, p)
+}
 
-	win.RLock()
-	defer win.RUnlock()
+// Snapshot 一次性计算窗口内的所有指标
+func (win *Window) Snapshot() WindowStats {
+	agg := win.aggregate()
+	defer win.aggPool.Put(agg)
+	stats := WindowStats{
+		Count: agg.count,
+		Sum:   agg.sum,
+		Min:   agg.min,
+		Max:   agg.max,
+		Rate:  float64(agg.count) / win.window.Seconds(),
+		P50:   win.percentile(agg, 0.5),
+		P90:   win.percentile(agg, 0.9),
+		P99:   win.percentile(agg, 0.99),
+	}
+	if agg.count > 0 {
+		stats.Mean = agg.sum / float64(agg.count)
+	}
+	return stats
+}
 
-	var total int64
-	for i := range win.samples {
-		total += win.samples[i]
+// aggregate 汇总最近 window 时间内的桶，用完之后放回 aggPool
+func (win *Window) aggregate() *windowAgg {
+	agg := win.aggPool.Get().(*windowAgg)
+	agg.count, agg.sum, agg.min, agg.max = 0, 0, 0, 0
+	for j := range agg.hist {
+		agg.hist[j] = 0
+	}
+	newest := win.epoch()
+	oldest := newest - int64(len(win.buckets)) + 1
+	for i := range win.buckets {
+		b := &win.buckets[i]
+		if epoch := atomic.LoadInt64(&b.epoch); epoch < oldest || epoch > newest {
+			continue
+		}
+		count := atomic.LoadInt64(&b.count)
+		if count == 0 {
+			continue
+		}
+		min, max := math.Float64frombits(atomic.LoadUint64(&b.min)), math.Float64frombits(atomic.LoadUint64(&b.max))
+		if agg.count == 0 || min < agg.min {
+			agg.min = min
+		}
+		if agg.count == 0 || max > agg.max {
+			agg.max = max
+		}
+		agg.count += count
+		agg.sum += math.Float64frombits(atomic.LoadUint64(&b.sum))
+		for j := range b.hist {
+			agg.hist[j] += atomic.LoadInt64(&b.hist[j])
+		}
 	}
-	return total
+	return agg
 }
 
-// Stop the shifter of this sliding time window. A stopped SlidingWindow cannot
-// be started again.
-func (win *Window) Stop() {
-	win.stopOnce.Do(func() {
-		win.stopping <- struct{}{}
-	})
+func (win *Window) percentile(agg *windowAgg, p float64) float64 {
+	if agg.count == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(p * float64(agg.count)))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for i, c := range agg.hist {
+		if c == 0 || seen+c < rank {
+			seen += c
+			continue
+		}
+		// 目标样本落在第 i 个分桶，用桶的上下界（并用 min/max 收紧）线性插值
+		lower, upper := agg.min, agg.max
+		if i > 0 && win.bounds[i-1] > lower {
+			lower = win.bounds[i-1]
+		}
+		if i < len(win.bounds) && win.bounds[i] < upper {
+			upper = win.bounds[i]
+		}
+		return lower + (upper-lower)*float64(rank-seen)/float64(c)
+	}
+	return agg.max
 }
+
+// Stop 兼容旧接口。窗口不再依赖后台 goroutine 滑动，不需要停止
+func (win *Window) Stop() {}
@@ -0,0 +1,158 @@
+package ratelimiter
+
+import (
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWindow_Slide(t *testing.T) {
+	clock := newFakeClock()
+	win, err := NewWindow(5*time.Second, time.Second, WithClock(clock.Now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		win.Add(1)
+		clock.Advance(time.Second)
+	}
+	// 只保留最近 5 秒，旧实现的窗口只滑动一次，这里会一直累加
+	if total := win.Total(); total != 4 {
+		t.Fatalf("total want 4 got %d", total)
+	}
+	win.Add(1)
+	if total := win.Total(); total != 5 {
+		t.Fatalf("total want 5 got %d", total)
+	}
+	if rate := win.Rate(); rate != 1 {
+		t.Fatalf("rate want 1 got %v", rate)
+	}
+
+	// 长时间没有写入，所有桶都过期
+	clock.Advance(time.Minute)
+	if stats := win.Snapshot(); stats.Count != 0 || stats.Sum != 0 || stats.P99 != 0 {
+		t.Fatalf("window should be empty, got %+v", stats)
+	}
+
+	win.Add(3)
+	win.Reset()
+	if total := win.Total(); total != 0 {
+		t.Fatalf("total after reset want 0 got %d", total)
+	}
+}
+
+func TestWindow_Stats(t *testing.T) {
+	clock := newFakeClock()
+	win, err := NewWindow(10*time.Second, time.Second, WithClock(clock.Now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 1ms ~ 1000ms 各一个样本，分布在 10 个桶里
+	for i := 1; i <= 1000; i++ {
+		win.AddDuration(time.Duration(i) * time.Millisecond)
+		if i%100 == 0 {
+			clock.Advance(time.Second)
+		}
+	}
+	clock.Advance(-time.Second)
+	stats := win.Snapshot()
+	if stats.Count != 1000 || stats.Min != 1 || stats.Max != 1000 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if stats.Mean != 500.5 {
+		t.Fatalf("mean want 500.5 got %v", stats.Mean)
+	}
+	if stats.Rate != 100 {
+		t.Fatalf("rate want 100 got %v", stats.Rate)
+	}
+	// 分位数是按直方图估算的，允许 5% 的误差
+	for _, c := range []struct{ p, want float64 }{{0.5, 500}, {0.9, 900}, {0.99, 990}} {
+		if got := win.Percentile(c.p); math.Abs(got-c.want) > c.want*0.05 {
+			t.Fatalf("p%v want ~%v got %v", c.p*100, c.want, got)
+		}
+	}
+
+	// 最旧的一秒滑出窗口
+	clock.Advance(time.Second)
+	if stats := win.Snapshot(); stats.Count != 900 || stats.Min != 101 {
+		t.Fatalf("oldest bucket should slide out, got %+v", stats)
+	}
+}
+
+func TestWindow_Histogram(t *testing.T) {
+	win, err := NewWindow(2*time.Second, time.Second, WithHistogram(0.5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 记录 0/1 表示失败/成功，均值即成功率
+	for i := 0; i < 100; i++ {
+		win.Record(float64(i % 2))
+	}
+	if win.Mean() != 0.5 {
+		t.Fatalf("mean want 0.5 got %v", win.Mean())
+	}
+	// 一半样本落在 (-inf, 0.5]，一半落在 (0.5, 1]
+	if p := win.Percentile(0.25); p < 0 || p > 0.5 {
+		t.Fatalf("p25 want in [0, 0.5] got %v", p)
+	}
+	if p := win.Percentile(0.99); p <= 0.5 || p > 1 {
+		t.Fatalf("p99 want in (0.5, 1] got %v", p)
+	}
+	if p := win.Percentile(1); p != 1 {
+		t.Fatalf("p100 want 1 got %v", p)
+	}
+	if _, err := NewWindow(2*time.Second, time.Second, WithHistogram(2, 1)); err == nil {
+		t.Fatal("unsorted bounds should be rejected")
+	}
+	if _, err := NewWindow(3*time.Second, 2*time.Second); err == nil {
+		t.Fatal("window must be a multiple of tick")
+	}
+}
+
+func TestWindow_Concurrent(t *testing.T) {
+	win, err := NewWindow(time.Minute, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 1; i <= 1000; i++ {
+				win.Record(float64(i))
+				if i%100 == 0 {
+					win.Snapshot()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	stats := win.Snapshot()
+	if stats.Count != 8000 || stats.Sum != 8*500500 || stats.Min != 1 || stats.Max != 1000 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func BenchmarkWindow_Record(b *testing.B) {
+	win, _ := NewWindow(10*time.Second, 100*time.Millisecond)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			win.AddDuration(3 * time.Millisecond)
+		}
+	})
+}
+
+func BenchmarkWindow_Snapshot(b *testing.B) {
+	win, _ := NewWindow(10*time.Second, 100*time.Millisecond)
+	for i := 0; i < 1000; i++ {
+		win.Add(int64(i))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		win.Snapshot()
+	}
+}
@@ -0,0 +1,300 @@
+package adaptive
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// 自适应并发限流，思路来自 Netflix 的 concurrency-limits：https://github.com/Netflix/concurrency-limits
+// ratelimiter 包里的限流器都是固定阈值（每秒多少个请求），下游变慢时固定阈值要么太松把下游压垮，要么太紧浪费容量。
+// 这里限制的是"同时在处理中的请求数"（inflight），并且根据每个请求的 RTT 动态调整这个上限：
+//   RTT 接近空载时的最小值 -> 下游有余量，提高上限
+//   RTT 明显变大或者请求被丢弃（超时/被拒绝）-> 下游开始排队，降低上限
+// 根据 Little 定律，吞吐 = 并发数 / RTT，控制住并发就控制住了排队。
+
+// Algorithm 并发上限的调整算法
+type Algorithm interface {
+	// Limit 当前的并发上限
+	Limit() int
+	// OnSample 每个请求结束时调用一次：rtt 为请求耗时，inflight 为该请求开始时的并发数，didDrop 表示请求被丢弃（超时、被下游拒绝）
+	OnSample(startTime time.Time, rtt time.Duration, inflight int, didDrop bool)
+}
+
+type bounds struct {
+	initial int
+	min     int
+	max     int
+}
+
+func (b bounds) clamp(limit float64) float64 {
+	return math.Max(float64(b.min), math.Min(float64(b.max), limit))
+}
+
+// =======================================================================================================
+// AIMD：加性增、乘性减，和 TCP 拥塞控制一样。没有丢弃时每个 RTT 上限 +1，出现丢弃或者 RTT 超过 Timeout 时上限乘以 BackoffRatio。
+// 只对"丢弃"敏感，对 RTT 的渐进变化不敏感，适合下游有明确超时/拒绝信号的场景。
+
+type AIMDConfig struct {
+	InitialLimit int           // 初始上限，默认 20
+	MinLimit     int           // 默认 1
+	MaxLimit     int           // 默认 200
+	BackoffRatio float64       // 乘性减系数，(0.5, 1)，默认 0.9
+	Timeout      time.Duration // RTT 超过该值视为丢弃，0 表示不根据 RTT 判断
+}
+
+type AIMD struct {
+	mu          sync.RWMutex
+	cfg         AIMDConfig
+	bounds      bounds
+	limit       float64
+	lastBackoff time.Time
+}
+
+func NewAIMD(cfg AIMDConfig) *AIMD {
+	if cfg.BackoffRatio <= 0.5 || cfg.BackoffRatio >= 1 {
+		cfg.BackoffRatio = 0.9
+	}
+	b := newBounds(cfg.InitialLimit, cfg.MinLimit, cfg.MaxLimit)
+	return &AIMD{cfg: cfg, bounds: b, limit: float64(b.initial)}
+}
+
+func (a *AIMD) Limit() int {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return int(a.limit)
+}
+
+func (a *AIMD) OnSample(startTime time.Time, rtt time.Duration, inflight int, didDrop bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if didDrop || (a.cfg.Timeout > 0 && rtt > a.cfg.Timeout) {
+		// 和 TCP 一样每个 RTT 最多减一次：上次减小上限之前就发出的请求是按旧上限发的，它们的丢弃不再重复惩罚
+		if startTime.Before(a.lastBackoff) {
+			return
+		}
+		a.limit = a.bounds.clamp(math.Floor(a.limit * a.cfg.BackoffRatio))
+		a.lastBackoff = startTime.Add(rtt)
+		return
+	}
+	// 并发数远没有达到上限时说明是调用方自己流量小（app-limited），RTT 不能说明上限是否合适，不调整
+	// 每个样本增加 1/limit，即每个 RTT 周期大约增加 1
+	if inflight*2 >= int(a.limit) {
+		a.limit = a.bounds.clamp(a.limit + 1/a.limit)
+	}
+}
+
+// =======================================================================================================
+// Vegas：来自 TCP Vegas。用观测到的最小 RTT 作为空载 RTT（rttNoLoad），估算下游的排队长度：
+//   queue = limit * (1 - rttNoLoad / rtt)
+// queue 小于 alpha 说明下游基本没有排队，可以增大上限；大于 beta 说明在排队，减小上限；介于两者之间保持不变。
+// alpha、beta 随上限按 log10 增长，上限越大容忍的排队越多。
+
+type VegasConfig struct {
+	InitialLimit int // 初始上限，默认 20
+	MinLimit     int // 默认 1
+	MaxLimit     int // 默认 200
+	// Smoothing 新旧上限的平滑系数，(0, 1]，默认 1 即不平滑
+	Smoothing float64
+	// ProbeMultiplier 每隔 ProbeMultiplier*limit 个样本重置一次 rttNoLoad，避免下游扩容（RTT 真的变小了）后估计值一直偏大，默认 30
+	ProbeMultiplier int
+}
+
+type Vegas struct {
+	mu          sync.RWMutex
+	cfg         VegasConfig
+	bounds      bounds
+	limit       float64
+	rttNoLoad   time.Duration
+	probeCount  int
+	probeJitter float64
+	rnd         *rand.Rand // 每个实例单独的随机数，由 mu 保护
+}
+
+func NewVegas(cfg VegasConfig) *Vegas {
+	if cfg.Smoothing <= 0 || cfg.Smoothing > 1 {
+		cfg.Smoothing = 1
+	}
+	if cfg.ProbeMultiplier <= 0 {
+		cfg.ProbeMultiplier = 30
+	}
+	b := newBounds(cfg.InitialLimit, cfg.MinLimit, cfg.MaxLimit)
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	return &Vegas{cfg: cfg, bounds: b, limit: float64(b.initial), probeJitter: rnd.Float64(), rnd: rnd}
+}
+
+func (v *Vegas) Limit() int {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return int(v.limit)
+}
+
+func (v *Vegas) OnSample(startTime time.Time, rtt time.Duration, inflight int, didDrop bool) {
+	if rtt <= 0 {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.probeCount++
+	if v.probeCount > int(float64(v.cfg.ProbeMultiplier)*v.limit*(1+v.probeJitter)) {
+		// 重新探测空载 RTT
+		v.probeCount = 0
+		v.probeJitter = v.rnd.Float64() // 随机抖动，避免多个实例同时探测
+		v.rttNoLoad = rtt
+		return
+	}
+	if v.rttNoLoad == 0 || rtt < v.rttNoLoad {
+		v.rttNoLoad = rtt
+		return
+	}
+
+	limit := v.limit
+	log := math.Max(1, math.Log10(limit))
+	alpha, beta, threshold := 3*log, 6*log, log
+
+	var newLimit float64
+	switch queue := math.Ceil(limit * (1 - float64(v.rttNoLoad)/float64(rtt))); {
+	case didDrop:
+		newLimit = limit - log
+	case inflight*2 < int(limit):
+		return // app-limited
+	case queue <= threshold:
+		newLimit = limit + beta
+	case queue < alpha:
+		newLimit = limit + log
+	case queue > beta:
+		newLimit = limit - log
+	default:
+		return
+	}
+	newLimit = v.bounds.clamp(newLimit)
+	v.limit = (1-v.cfg.Smoothing)*v.limit + v.cfg.Smoothing*newLimit
+}
+
+// =======================================================================================================
+// Gradient2：比较短期 RTT 和长期 RTT（指数移动平均）的比值作为梯度：
+//   gradient = clamp(Tolerance * longRtt / shortRtt, 0.5, 1)
+//   newLimit = limit * gradient + queueSize
+// RTT 没有变化时 gradient 为 1，上限按 queueSize 缓慢增长；短期 RTT 超过长期 RTT 的 Tolerance 倍时 gradient < 1，上限迅速下降。
+// 用长期均值代替 Vegas 的最小值，对 RTT 的自然抖动不那么敏感。
+
+type Gradient2Config struct {
+	InitialLimit int // 初始上限，默认 20
+	MinLimit     int // 默认 1
+	MaxLimit     int // 默认 200
+	// Smoothing 新旧上限的平滑系数，(0, 1]，默认 0.2
+	Smoothing float64
+	// RttTolerance 短期 RTT 可以比长期 RTT 大多少倍而不降低上限，>=1，默认 1.5
+	RttTolerance float64
+	// LongWindow 长期 RTT 指数移动平均的窗口（样本数），默认 600
+	LongWindow int
+	// QueueSize 允许的排队长度，默认 4
+	QueueSize func(limit int) int
+}
+
+type Gradient2 struct {
+	mu      sync.RWMutex
+	cfg     Gradient2Config
+	bounds  bounds
+	limit   float64
+	longRtt *ema
+}
+
+func NewGradient2(cfg Gradient2Config) *Gradient2 {
+	if cfg.Smoothing <= 0 || cfg.Smoothing > 1 {
+		cfg.Smoothing = 0.2
+	}
+	if cfg.RttTolerance < 1 {
+		cfg.RttTolerance = 1.5
+	}
+	if cfg.LongWindow <= 0 {
+		cfg.LongWindow = 600
+	}
+	if cfg.QueueSize == nil {
+		cfg.QueueSize = func(int) int { return 4 }
+	}
+	b := newBounds(cfg.InitialLimit, cfg.MinLimit, cfg.MaxLimit)
+	return &Gradient2{cfg: cfg, bounds: b, limit: float64(b.initial), longRtt: newEMA(cfg.LongWindow, 10)}
+}
+
+func (g *Gradient2) Limit() int {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return int(g.limit)
+}
+
+func (g *Gradient2) OnSample(startTime time.Time, rtt time.Duration, inflight int, didDrop bool) {
+	if rtt <= 0 {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	shortRtt := float64(rtt)
+	longRtt := g.longRtt.add(shortRtt)
+	// 负载降下来之后长期均值会明显偏大，让它更快地向短期值靠拢，否则 gradient 一直是 1，对新的拥塞反应迟钝
+	if longRtt/shortRtt > 2 {
+		longRtt = g.longRtt.update(func(v float64) float64 { return v * 0.95 })
+	}
+	if inflight < int(g.limit)/2 {
+		return // app-limited
+	}
+	gradient := math.Max(0.5, math.Min(1, g.cfg.RttTolerance*longRtt/shortRtt))
+	newLimit := g.limit*gradient + float64(g.cfg.QueueSize(int(g.limit)))
+	newLimit = g.limit*(1-g.cfg.Smoothing) + newLimit*g.cfg.Smoothing
+	g.limit = g.bounds.clamp(newLimit)
+}
+
+func newBounds(initial, min, max int) bounds {
+	if min <= 0 {
+		min = 1
+	}
+	if max <= 0 {
+		max = 200
+	}
+	if max < min {
+		max = min
+	}
+	if initial <= 0 {
+		initial = 20
+	}
+	if initial < min {
+		initial = min
+	}
+	if initial > max {
+		initial = max
+	}
+	return bounds{initial: initial, min: min, max: max}
+}
+
+// ema 指数移动平均，前 warmup 个样本先用算术平均，避免第一个样本权重过大
+type ema struct {
+	window int
+	warmup int
+	count  int
+	sum    float64
+	value  float64
+}
+
+func newEMA(window, warmup int) *ema {
+	return &ema{window: window, warmup: warmup}
+}
+
+func (e *ema) add(sample float64) float64 {
+	if e.count < e.warmup {
+		e.count++
+		e.sum += sample
+		e.value = e.sum / float64(e.count)
+		return e.value
+	}
+	factor := 2.0 / float64(e.window+1)
+	e.value = e.value*(1-factor) + sample*factor
+	return e.value
+}
+
+func (e *ema) update(fn func(float64) float64) float64 {
+	e.value = fn(e.value)
+	return e.value
+}
@@ -0,0 +1,61 @@
+package adaptive
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor 服务端并发限流：处理中的请求达到上限时直接返回 RESOURCE_EXHAUSTED，让调用方重试其他实例
+func UnaryServerInterceptor(l *Limiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		token, ok := l.TryAcquire()
+		if !ok {
+			return nil, status.Errorf(codes.ResourceExhausted, "server concurrency limit %d exceeded, method: %s", l.Limit(), info.FullMethod)
+		}
+		resp, err := handler(ctx, req)
+		release(token, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor 服务端 stream 并发限流，stream 的耗时和负载关系不大，只占用额度，不作为 RTT 样本
+func StreamServerInterceptor(l *Limiter) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		token, ok := l.TryAcquire()
+		if !ok {
+			return status.Errorf(codes.ResourceExhausted, "server concurrency limit %d exceeded, method: %s", l.Limit(), info.FullMethod)
+		}
+		defer token.OnIgnore()
+		return handler(srv, ss)
+	}
+}
+
+// UnaryClientInterceptor 客户端并发限流：下游变慢时减少发往下游的并发，超过上限的请求在本地快速失败，不再去压垮下游
+//
+//	grpc.Dial(addr, grpc.WithUnaryInterceptor(adaptive.UnaryClientInterceptor(adaptive.NewLimiter(adaptive.NewVegas(adaptive.VegasConfig{})))))
+func UnaryClientInterceptor(l *Limiter) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		token, ok := l.TryAcquire()
+		if !ok {
+			return status.Errorf(codes.ResourceExhausted, "client concurrency limit %d exceeded, method: %s", l.Limit(), method)
+		}
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		release(token, err)
+		return err
+	}
+}
+
+// release 根据 grpc 状态码反馈样本：超时、被限流、服务不可用说明下游过载
+func release(token *Token, err error) {
+	switch status.Code(err) {
+	case codes.OK:
+		token.OnSuccess()
+	case codes.DeadlineExceeded, codes.ResourceExhausted, codes.Unavailable:
+		token.OnDropped()
+	default:
+		token.OnIgnore()
+	}
+}
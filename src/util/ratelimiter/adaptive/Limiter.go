@@ -0,0 +1,144 @@
+package adaptive
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrLimitExceeded = errors.New("adaptive: concurrency limit exceeded")
+)
+
+// Limiter 并发限流器：inflight 达到 Algorithm 给出的上限时拒绝（TryAcquire）或者排队等待（Acquire）
+// 每个拿到的 Token 必须调用且只调用一次 OnSuccess / OnDropped / OnIgnore，用来释放并发数并把 RTT 样本反馈给 Algorithm
+//
+//	token, ok := limiter.TryAcquire()
+//	if !ok { return ErrLimitExceeded }
+//	err := callDownstream()
+//	if err == nil { token.OnSuccess() } else if isTimeout(err) { token.OnDropped() } else { token.OnIgnore() }
+type Limiter struct {
+	mu       sync.Mutex
+	alg      Algorithm
+	inflight int
+	waiters  *list.List // 排队等待的 Acquire，FIFO
+	clock    func() time.Time
+}
+
+type waiter struct {
+	ch    chan struct{}
+	woken bool
+}
+
+// NewLimiter 创建并发限流器
+func NewLimiter(alg Algorithm) *Limiter {
+	return &Limiter{alg: alg, waiters: list.New(), clock: time.Now}
+}
+
+// Limit 当前的并发上限
+func (l *Limiter) Limit() int {
+	return l.alg.Limit()
+}
+
+// Inflight 当前正在处理的请求数
+func (l *Limiter) Inflight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inflight
+}
+
+// TryAcquire 非阻塞获取，超过上限立即返回 false
+func (l *Limiter) TryAcquire() (*Token, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inflight >= l.alg.Limit() {
+		return nil, false
+	}
+	return l.acquireLocked(), true
+}
+
+// Acquire 阻塞获取，直到有空闲额度或者 ctx 结束
+func (l *Limiter) Acquire(ctx context.Context) (*Token, error) {
+	for {
+		l.mu.Lock()
+		if l.inflight < l.alg.Limit() {
+			token := l.acquireLocked()
+			// 上限变大时一次释放可能空出多个位置，继续唤醒下一个
+			if l.inflight < l.alg.Limit() {
+				l.wakeLocked()
+			}
+			l.mu.Unlock()
+			return token, nil
+		}
+		w := &waiter{ch: make(chan struct{})}
+		elem := l.waiters.PushBack(w)
+		l.mu.Unlock()
+
+		select {
+		case <-w.ch:
+		case <-ctx.Done():
+			l.mu.Lock()
+			if w.woken {
+				// 已经被唤醒但是不要了，把机会让给下一个
+				l.wakeLocked()
+			} else {
+				l.waiters.Remove(elem)
+			}
+			l.mu.Unlock()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (l *Limiter) acquireLocked() *Token {
+	l.inflight++
+	return &Token{limiter: l, start: l.clock(), inflight: l.inflight}
+}
+
+func (l *Limiter) wakeLocked() {
+	if front := l.waiters.Front(); front != nil {
+		w := l.waiters.Remove(front).(*waiter)
+		w.woken = true
+		close(w.ch)
+	}
+}
+
+func (l *Limiter) release(t *Token, sample bool, didDrop bool) {
+	if sample {
+		l.alg.OnSample(t.start, l.clock().Sub(t.start), t.inflight, didDrop)
+	}
+	l.mu.Lock()
+	l.inflight--
+	l.wakeLocked()
+	l.mu.Unlock()
+}
+
+// Token 一次获取到的并发额度
+type Token struct {
+	limiter  *Limiter
+	start    time.Time
+	inflight int
+	once     sync.Once
+}
+
+// OnSuccess 请求成功，RTT 作为有效样本
+func (t *Token) OnSuccess() {
+	t.once.Do(func() { t.limiter.release(t, true, false) })
+}
+
+// OnDropped 请求被丢弃（超时、被下游限流），算法会降低上限
+func (t *Token) OnDropped() {
+	t.once.Do(func() { t.limiter.release(t, true, true) })
+}
+
+// OnIgnore 请求失败但是和负载无关（参数错误等），只释放额度，不作为样本
+func (t *Token) OnIgnore() {
+	t.once.Do(func() { t.limiter.release(t, false, false) })
+}
+
+// IsDropped 判断错误是否意味着下游过载，超时和被限流都算
+func IsDropped(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrLimitExceeded)
+}
@@ -0,0 +1,75 @@
+package adaptive
+
+import (
+	"context"
+
+	"github.com/shark/src/util/customworkerpool/workerpool"
+)
+
+// 工作池接入并发限流：池子里的 worker 数是固定的，但是下游能承受的并发是变化的，
+// 用 Limiter 在 worker 和下游之间再加一道闸门，下游变慢时 worker 会阻塞在 Acquire 上，任务在池子的队列里排队。
+
+// Wrap 把任务包装成受并发限流保护的任务，可以直接作为 wokerpool.TaskHandler / goroutinePool.NewTask 的参数：
+// 任务执行前阻塞等待额度，执行完成后根据返回的错误反馈样本
+func Wrap(l *Limiter, fn func() error) func() error {
+	return func() error {
+		token, err := l.Acquire(context.Background())
+		if err != nil {
+			return err
+		}
+		return run(token, fn)
+	}
+}
+
+// run 执行 fn 并根据结果释放 token：成功时作为样本，超时、被限流时降低上限，其它错误和 panic 只释放额度
+func run(token *Token, fn func() error) (err error) {
+	finished := false
+	defer func() {
+		if !finished {
+			token.OnIgnore() // panic 继续向上抛
+		}
+	}()
+	err = fn()
+	finished = true
+	switch {
+	case err == nil:
+		token.OnSuccess()
+	case IsDropped(err):
+		token.OnDropped()
+	default:
+		token.OnIgnore()
+	}
+	return err
+}
+
+// ErrWorker 可选接口：PoolWorker 实现了 Err 时，DoWork 之后用它的返回值区分成功、丢弃和其它失败，
+// 没有实现时 DoWork 正常返回算成功
+type ErrWorker interface {
+	Err() error
+}
+
+// WrapPoolWorker 把 workerpool.PoolWorker 包装成受并发限流保护的任务，worker 拿到额度之后才真正执行
+func WrapPoolWorker(l *Limiter, work workerpool.PoolWorker) workerpool.PoolWorker {
+	return &limitedWorker{limiter: l, work: work}
+}
+
+type limitedWorker struct {
+	limiter *Limiter
+	work    workerpool.PoolWorker
+}
+
+func (w *limitedWorker) DoWork(workRoutine int) {
+	token, err := w.limiter.Acquire(context.Background())
+	if err != nil {
+		// Background 不会结束，Acquire 不会失败；DoWork 没法返回错误，万一失败也不丢任务
+		w.work.DoWork(workRoutine)
+		return
+	}
+	run(token, func() error {
+		w.work.DoWork(workRoutine)
+		if ew, ok := w.work.(ErrWorker); ok {
+			return ew.Err()
+		}
+		return nil
+	})
+}
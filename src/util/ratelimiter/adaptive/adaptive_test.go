@@ -0,0 +1,280 @@
+package adaptive
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 合成的下游延迟曲线：并发不超过 capacity 时 RTT 稳定在 base，超过之后开始排队，RTT 随并发平方增长
+func latency(base time.Duration, capacity, inflight int) time.Duration {
+	if inflight <= capacity {
+		return base
+	}
+	ratio := float64(inflight) / float64(capacity)
+	return time.Duration(float64(base) * ratio * ratio)
+}
+
+// simulate 离散事件模拟：调用方始终有 demand 个请求想发出，但同时在途的请求不能超过 alg.Limit()。
+// 每个请求的 RTT 由它发出时下游的并发数按 curve 决定，RTT 超过 timeout 视为被丢弃。
+// 每完成一个请求记录一次当时的上限，返回上限序列。
+func simulate(alg Algorithm, requests, demand int, curve func(inflight int) time.Duration, timeout time.Duration) []int {
+	type call struct {
+		start, end time.Time
+		inflight   int
+	}
+	var (
+		now      = time.Unix(0, 0)
+		inflight int
+		pending  []call // 按 end 排序的在途请求
+		limits   = make([]int, 0, requests)
+	)
+	fill := func() {
+		for inflight < alg.Limit() && inflight < demand {
+			inflight++
+			c := call{start: now, end: now.Add(curve(inflight)), inflight: inflight}
+			i := sort.Search(len(pending), func(i int) bool { return pending[i].end.After(c.end) })
+			pending = append(pending, call{})
+			copy(pending[i+1:], pending[i:])
+			pending[i] = c
+		}
+	}
+	fill()
+	for len(limits) < requests && len(pending) > 0 {
+		c := pending[0]
+		pending = pending[1:]
+		now = c.end
+		inflight--
+		rtt := c.end.Sub(c.start)
+		alg.OnSample(c.start, rtt, c.inflight, timeout > 0 && rtt > timeout)
+		limits = append(limits, alg.Limit())
+		fill()
+	}
+	return limits
+}
+
+func average(limits []int) float64 {
+	sum := 0
+	for _, l := range limits {
+		sum += l
+	}
+	return float64(sum) / float64(len(limits))
+}
+
+func algorithms() map[string]func() Algorithm {
+	return map[string]func() Algorithm{
+		"aimd": func() Algorithm {
+			return NewAIMD(AIMDConfig{InitialLimit: 10, MaxLimit: 500, Timeout: 30 * time.Millisecond})
+		},
+		"vegas": func() Algorithm {
+			return NewVegas(VegasConfig{InitialLimit: 10, MaxLimit: 500})
+		},
+		"gradient2": func() Algorithm {
+			return NewGradient2(Gradient2Config{InitialLimit: 10, MaxLimit: 500})
+		},
+	}
+}
+
+func TestAlgorithms_Converge(t *testing.T) {
+	const capacity = 50
+	curve := func(inflight int) time.Duration { return latency(10*time.Millisecond, capacity, inflight) }
+	for name, newAlg := range algorithms() {
+		t.Run(name, func(t *testing.T) {
+			limits := simulate(newAlg(), 50000, 1000, curve, 0)
+			avg := average(limits[25000:])
+			t.Logf("%s: limit after warm up %.1f (capacity %d)", name, avg, capacity)
+			// 不能一直停留在初始值，也不能一直涨到 MaxLimit 把下游压垮
+			if avg < capacity*0.6 || avg > capacity*3 {
+				t.Fatalf("%s does not converge near capacity %d, average limit %.1f, tail %v", name, capacity, avg, limits[len(limits)-10:])
+			}
+		})
+	}
+}
+
+func TestAlgorithms_ReactToDegradation(t *testing.T) {
+	for name, newAlg := range algorithms() {
+		t.Run(name, func(t *testing.T) {
+			alg := newAlg()
+			healthy := func(inflight int) time.Duration { return latency(10*time.Millisecond, 100, inflight) }
+			// 上限在容量附近来回波动，取后半段的平均值而不是某一时刻的值
+			before := average(simulate(alg, 50000, 1000, healthy, 0)[25000:])
+
+			// 下游容量降到原来的 1/5
+			degraded := func(inflight int) time.Duration { return latency(10*time.Millisecond, 20, inflight) }
+			limits := simulate(alg, 50000, 1000, degraded, 0)
+			after := average(limits[25000:])
+			t.Logf("%s: limit %.1f -> %.1f", name, before, after)
+			if after >= before*0.6 {
+				t.Fatalf("%s did not back off: before %.1f after %.1f", name, before, after)
+			}
+		})
+	}
+}
+
+func TestAlgorithms_AppLimited(t *testing.T) {
+	for name, newAlg := range algorithms() {
+		t.Run(name, func(t *testing.T) {
+			alg := newAlg()
+			initial := alg.Limit()
+			// 调用方只有 2 个并发，远小于上限，上限不应该被推高
+			simulate(alg, 5000, 2, func(int) time.Duration { return 10 * time.Millisecond }, 0)
+			if alg.Limit() != initial {
+				t.Fatalf("%s changed limit from %d to %d while app-limited", name, initial, alg.Limit())
+			}
+		})
+	}
+}
+
+func TestAIMD_BackoffOnDrop(t *testing.T) {
+	alg := NewAIMD(AIMDConfig{InitialLimit: 100})
+	start := time.Now()
+	alg.OnSample(start, time.Millisecond, 100, true)
+	if alg.Limit() != 90 {
+		t.Fatalf("want 90 got %d", alg.Limit())
+	}
+	// 同一批请求的丢弃只惩罚一次
+	alg.OnSample(start, time.Millisecond, 100, true)
+	if alg.Limit() != 90 {
+		t.Fatalf("want 90 got %d", alg.Limit())
+	}
+	// 大约一个 RTT 周期（90 个成功样本）之后上限 +1
+	for i := 0; i < 95; i++ {
+		alg.OnSample(start.Add(time.Millisecond), time.Millisecond, 90, false)
+	}
+	if alg.Limit() != 91 {
+		t.Fatalf("want 91 got %d", alg.Limit())
+	}
+}
+
+type fixedLimit int
+
+func (f fixedLimit) Limit() int { return int(f) }
+
+func (f fixedLimit) OnSample(time.Time, time.Duration, int, bool) {}
+
+func TestLimiter_TryAcquire(t *testing.T) {
+	l := NewLimiter(fixedLimit(2))
+	t1, ok1 := l.TryAcquire()
+	t2, ok2 := l.TryAcquire()
+	if !ok1 || !ok2 {
+		t.Fatal("first two acquires should succeed")
+	}
+	if _, ok := l.TryAcquire(); ok {
+		t.Fatal("third acquire should fail")
+	}
+	t1.OnSuccess()
+	t1.OnSuccess() // 重复释放无效
+	if l.Inflight() != 1 {
+		t.Fatalf("inflight want 1 got %d", l.Inflight())
+	}
+	t2.OnIgnore()
+	if l.Inflight() != 0 {
+		t.Fatalf("inflight want 0 got %d", l.Inflight())
+	}
+}
+
+func TestLimiter_Acquire(t *testing.T) {
+	l := NewLimiter(fixedLimit(3))
+	var (
+		wg      sync.WaitGroup
+		running int32
+		peak    int32
+	)
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := l.Acquire(context.Background())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			n := atomic.AddInt32(&running, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			token.OnSuccess()
+		}()
+	}
+	wg.Wait()
+	if peak > 3 {
+		t.Fatalf("peak concurrency %d exceeds limit 3", peak)
+	}
+
+	// 等待超时
+	token, _ := l.TryAcquire()
+	l2, _ := l.TryAcquire()
+	l3, _ := l.TryAcquire()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.Acquire(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("want DeadlineExceeded got %v", err)
+	}
+	token.OnSuccess()
+	l2.OnSuccess()
+	l3.OnSuccess()
+	if l.Inflight() != 0 {
+		t.Fatalf("inflight want 0 got %d", l.Inflight())
+	}
+}
+
+func TestWrap(t *testing.T) {
+	alg := NewAIMD(AIMDConfig{InitialLimit: 10})
+	l := NewLimiter(alg)
+	task := Wrap(l, func() error { return context.DeadlineExceeded })
+	if err := task(); err != context.DeadlineExceeded {
+		t.Fatalf("want DeadlineExceeded got %v", err)
+	}
+	if alg.Limit() != 9 {
+		t.Fatalf("timeout should back off limit to 9, got %d", alg.Limit())
+	}
+}
+
+type errWorker struct {
+	err   error
+	panic bool
+}
+
+func (w *errWorker) DoWork(int) {
+	if w.panic {
+		panic("boom")
+	}
+}
+
+func (w *errWorker) Err() error { return w.err }
+
+func TestWrapPoolWorker(t *testing.T) {
+	alg := NewAIMD(AIMDConfig{InitialLimit: 10})
+	l := NewLimiter(alg)
+	WrapPoolWorker(l, &errWorker{err: context.DeadlineExceeded}).DoWork(0)
+	if alg.Limit() != 9 || l.Inflight() != 0 {
+		t.Fatalf("dropped work should back off limit to 9, got %d, inflight %d", alg.Limit(), l.Inflight())
+	}
+
+	// panic 只释放额度，不作为样本
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("panic should propagate")
+			}
+		}()
+		WrapPoolWorker(l, &errWorker{panic: true}).DoWork(0)
+	}()
+	if alg.Limit() != 9 || l.Inflight() != 0 {
+		t.Fatalf("panic should only release the token, limit %d, inflight %d", alg.Limit(), l.Inflight())
+	}
+	if err := func() (err error) {
+		defer func() { recover() }()
+		return Wrap(l, func() error { panic("boom") })()
+	}(); err != nil || l.Inflight() != 0 {
+		t.Fatalf("panic in Wrap should release the token, inflight %d", l.Inflight())
+	}
+}
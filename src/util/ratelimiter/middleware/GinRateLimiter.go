@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GinKeyFunc 从 http 请求中提取限流 key
+type GinKeyFunc func(c *gin.Context) string
+
+// GinKeyByIP 按客户端 ip 限流
+func GinKeyByIP() GinKeyFunc {
+	return func(c *gin.Context) string {
+		return c.ClientIP()
+	}
+}
+
+// GinKeyByHeader 按请求头限流，例如 X-User-Id、X-Api-Key，请求头为空时退化成按 ip 限流
+func GinKeyByHeader(name string) GinKeyFunc {
+	return func(c *gin.Context) string {
+		if v := c.GetHeader(name); v != "" {
+			return v
+		}
+		return c.ClientIP()
+	}
+}
+
+// GinKeyByRoute 按路由模板限流，即接口维度的总体限流
+func GinKeyByRoute() GinKeyFunc {
+	return func(c *gin.Context) string {
+		return c.Request.Method + " " + c.FullPath()
+	}
+}
+
+// GinKeyJoin 组合多个 key，例如 ip + 路由表示每个 ip 对每个接口单独限流
+func GinKeyJoin(fns ...GinKeyFunc) GinKeyFunc {
+	return func(c *gin.Context) string {
+		key := ""
+		for i, fn := range fns {
+			if i > 0 {
+				key += "|"
+			}
+			key += fn(c)
+		}
+		return key
+	}
+}
+
+// Gin 返回 gin 限流中间件，被拒绝的请求返回 429，并带上 Retry-After 和 X-RateLimit-* 响应头
+//
+//	r.Use(middleware.Gin(middleware.GinKeyByIP(), middleware.Rule{Route: "/v1/*", Limiter: limiter}))
+func Gin(key GinKeyFunc, rules ...Rule) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" { // 404 的请求没有路由模板，用真实路径匹配
+			route = c.Request.URL.Path
+		}
+		rule := matchRule(rules, route, c.Request.Method)
+		if rule == nil {
+			c.Next()
+			return
+		}
+		res := allow(rule, key(c))
+		for k, v := range headers(res) {
+			c.Header(k, v)
+		}
+		if res != nil && !res.Allowed {
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"code": http.StatusTooManyRequests,
+				"msg":  "too many requests",
+			})
+			return
+		}
+		c.Next()
+	}
+}
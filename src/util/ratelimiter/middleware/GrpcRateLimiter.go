@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// GrpcKeyFunc 从 grpc 请求中提取限流 key，fullMethod 形如 /helloworld.Greeter/SayHello
+type GrpcKeyFunc func(ctx context.Context, fullMethod string) string
+
+// GrpcKeyByPeerIP 按调用方 ip 限流
+func GrpcKeyByPeerIP() GrpcKeyFunc {
+	return func(ctx context.Context, fullMethod string) string {
+		p, ok := peer.FromContext(ctx)
+		if !ok || p.Addr == nil {
+			return ""
+		}
+		addr := p.Addr.String()
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			return host
+		}
+		return addr
+	}
+}
+
+// GrpcKeyByMetadata 按 metadata 限流，例如调用方的 app-id，metadata 为空时退化成按 ip 限流
+func GrpcKeyByMetadata(name string) GrpcKeyFunc {
+	byIP := GrpcKeyByPeerIP()
+	return func(ctx context.Context, fullMethod string) string {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if v := md.Get(name); len(v) > 0 && v[0] != "" {
+				return v[0]
+			}
+		}
+		return byIP(ctx, fullMethod)
+	}
+}
+
+// GrpcKeyByMethod 按接口限流
+func GrpcKeyByMethod() GrpcKeyFunc {
+	return func(ctx context.Context, fullMethod string) string {
+		return fullMethod
+	}
+}
+
+// GrpcKeyJoin 组合多个 key
+func GrpcKeyJoin(fns ...GrpcKeyFunc) GrpcKeyFunc {
+	return func(ctx context.Context, fullMethod string) string {
+		keys := make([]string, 0, len(fns))
+		for _, fn := range fns {
+			keys = append(keys, fn(ctx, fullMethod))
+		}
+		return strings.Join(keys, "|")
+	}
+}
+
+// UnaryServerInterceptor grpc unary 限流拦截器，被拒绝的请求返回 RESOURCE_EXHAUSTED，并在 header metadata 中带上限流信息
+//
+//	grpc.NewServer(grpc.UnaryInterceptor(middleware.UnaryServerInterceptor(middleware.GrpcKeyByPeerIP(), rules...)))
+func UnaryServerInterceptor(key GrpcKeyFunc, rules ...Rule) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, err := grpcAdmit(ctx, key, rules, info.FullMethod)
+		if md != nil {
+			grpc.SetHeader(ctx, md)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor grpc stream 限流拦截器，在建立 stream 时判定一次
+func StreamServerInterceptor(key GrpcKeyFunc, rules ...Rule) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		md, err := grpcAdmit(ss.Context(), key, rules, info.FullMethod)
+		if md != nil {
+			ss.SetHeader(md)
+		}
+		if err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func grpcAdmit(ctx context.Context, key GrpcKeyFunc, rules []Rule, fullMethod string) (metadata.MD, error) {
+	rule := matchRule(rules, fullMethod, "")
+	if rule == nil {
+		return nil, nil
+	}
+	res := allow(rule, key(ctx, fullMethod))
+	if res == nil {
+		return nil, nil
+	}
+	md := metadata.MD{}
+	for k, v := range headers(res) {
+		md.Set(strings.ToLower(k), v)
+	}
+	if !res.Allowed {
+		return md, status.Errorf(codes.ResourceExhausted, "too many requests, method: %s", fullMethod)
+	}
+	return md, nil
+}
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shark/src/util/ratelimiter"
+)
+
+// 限流中间件：gin 的 HandlerFunc 和 grpc 的 unary/stream 拦截器共用同一套规则匹配和响应头逻辑
+// 规则按顺序匹配，第一个命中的规则生效；没有规则命中的请求直接放行。
+
+const (
+	HeaderLimit      = "X-RateLimit-Limit"
+	HeaderRemaining  = "X-RateLimit-Remaining"
+	HeaderReset      = "X-RateLimit-Reset"
+	HeaderRetryAfter = "Retry-After"
+)
+
+// Rule 一条限流规则
+// http 中 Route 匹配 gin 的路由模板（c.FullPath()，例如 /user/:name），grpc 中匹配 FullMethod（例如 /helloworld.Greeter/SayHello），
+// 以 * 结尾表示前缀匹配（例如 /v1/* 或者 /helloworld.Greeter/*），空串或者 * 匹配所有请求。
+// Method 只对 http 生效，空串匹配所有 http method；grpc 中忽略，http 和 grpc 共用规则时不会漏掉 grpc 请求。
+type Rule struct {
+	Route   string
+	Method  string
+	Limiter ratelimiter.Limiter
+	// Cost 每个请求消耗的额度，<=0 时为 1
+	Cost int64
+}
+
+// match method 为空（grpc）时不比较 Method
+func (r *Rule) match(route, method string) bool {
+	if r.Method != "" && method != "" && !strings.EqualFold(r.Method, method) {
+		return false
+	}
+	if r.Route == "" || r.Route == "*" {
+		return true
+	}
+	if strings.HasSuffix(r.Route, "*") {
+		return strings.HasPrefix(route, strings.TrimSuffix(r.Route, "*"))
+	}
+	return r.Route == route
+}
+
+func (r *Rule) cost() int64 {
+	if r.Cost <= 0 {
+		return 1
+	}
+	return r.Cost
+}
+
+func matchRule(rules []Rule, route, method string) *Rule {
+	for i := range rules {
+		if rules[i].match(route, method) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// allow 执行限流判定。限流器本身出错时返回 nil 放行（fail open），限流组件故障不能把业务拖垮
+func allow(rule *Rule, key string) *ratelimiter.Result {
+	res, err := rule.Limiter.AllowN(key, rule.cost())
+	if err != nil {
+		log.Printf("ratelimiter: limiter error, let request pass. key: %s, err: %v", key, err)
+		return nil
+	}
+	return &res
+}
+
+// headers 把限流结果转换成响应头，Reset / Retry-After 单位为秒，向上取整
+func headers(res *ratelimiter.Result) map[string]string {
+	if res == nil {
+		return nil
+	}
+	h := map[string]string{
+		HeaderLimit:     strconv.FormatInt(res.Limit, 10),
+		HeaderRemaining: strconv.FormatInt(res.Remaining, 10),
+		HeaderReset:     strconv.FormatInt(seconds(res.ResetAfter), 10),
+	}
+	if !res.Allowed && res.RetryAfter >= 0 {
+		h[HeaderRetryAfter] = strconv.FormatInt(seconds(res.RetryAfter), 10)
+	}
+	return h
+}
+
+func seconds(d time.Duration) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return int64(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,207 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shark/src/util/ratelimiter"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func newLimiter(t *testing.T, rate int64) ratelimiter.Limiter {
+	now := time.Unix(1600000000, 0)
+	l, err := ratelimiter.NewLocalLimiter(ratelimiter.PerMinute(rate), ratelimiter.WithClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+type brokenLimiter struct{}
+
+func (brokenLimiter) Allow(key string) (ratelimiter.Result, error) {
+	return ratelimiter.Result{}, errors.New("redis down")
+}
+
+func (brokenLimiter) AllowN(key string, n int64) (ratelimiter.Result, error) {
+	return ratelimiter.Result{}, errors.New("redis down")
+}
+
+func newRouter(mw gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(mw)
+	ok := func(c *gin.Context) { c.String(http.StatusOK, "ok") }
+	r.GET("/user/:name", ok)
+	r.GET("/v1/posts", ok)
+	r.POST("/v1/posts", ok)
+	r.GET("/health", ok)
+	return r
+}
+
+func doRequest(r http.Handler, method, path, ip string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = ip + ":1234"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestGin(t *testing.T) {
+	r := newRouter(Gin(GinKeyByIP(),
+		Rule{Route: "/user/:name", Limiter: newLimiter(t, 2)},
+		Rule{Route: "/v1/*", Method: http.MethodPost, Limiter: newLimiter(t, 1)},
+	))
+
+	for i := 0; i < 2; i++ {
+		w := doRequest(r, http.MethodGet, "/user/tom", "10.0.0.1")
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d want 200 got %d", i, w.Code)
+		}
+		if w.Header().Get(HeaderLimit) != "2" {
+			t.Fatalf("%s want 2 got %q", HeaderLimit, w.Header().Get(HeaderLimit))
+		}
+	}
+	// 同一个路由模板，不同的 name 共享额度
+	w := doRequest(r, http.MethodGet, "/user/jerry", "10.0.0.1")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("want 429 got %d", w.Code)
+	}
+	if w.Header().Get(HeaderRetryAfter) != "30" {
+		t.Fatalf("%s want 30 got %q", HeaderRetryAfter, w.Header().Get(HeaderRetryAfter))
+	}
+	if w.Header().Get(HeaderRemaining) != "0" {
+		t.Fatalf("%s want 0 got %q", HeaderRemaining, w.Header().Get(HeaderRemaining))
+	}
+	// 其他 ip 不受影响
+	if w := doRequest(r, http.MethodGet, "/user/tom", "10.0.0.2"); w.Code != http.StatusOK {
+		t.Fatalf("other ip want 200 got %d", w.Code)
+	}
+
+	// 前缀 + method 匹配
+	doRequest(r, http.MethodPost, "/v1/posts", "10.0.0.1")
+	if w := doRequest(r, http.MethodPost, "/v1/posts", "10.0.0.1"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("post want 429 got %d", w.Code)
+	}
+	if w := doRequest(r, http.MethodGet, "/v1/posts", "10.0.0.1"); w.Code != http.StatusOK || w.Header().Get(HeaderLimit) != "" {
+		t.Fatalf("get should not be limited, code %d", w.Code)
+	}
+	// 没有命中规则
+	for i := 0; i < 5; i++ {
+		if w := doRequest(r, http.MethodGet, "/health", "10.0.0.1"); w.Code != http.StatusOK {
+			t.Fatalf("unmatched route want 200 got %d", w.Code)
+		}
+	}
+}
+
+func TestGin_KeyByHeaderAndFailOpen(t *testing.T) {
+	r := newRouter(Gin(GinKeyByHeader("X-User-Id"), Rule{Route: "*", Limiter: newLimiter(t, 1)}))
+	req := func(user string) int {
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		req.Header.Set("X-User-Id", user)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	if req("a") != http.StatusOK || req("b") != http.StatusOK {
+		t.Fatal("first request of each user should pass")
+	}
+	if req("a") != http.StatusTooManyRequests {
+		t.Fatal("second request of user a should be limited")
+	}
+
+	broken := newRouter(Gin(GinKeyByIP(), Rule{Limiter: brokenLimiter{}}))
+	if w := doRequest(broken, http.MethodGet, "/health", "10.0.0.1"); w.Code != http.StatusOK {
+		t.Fatalf("limiter error should fail open, got %d", w.Code)
+	}
+}
+
+func peerCtx(ip string) context.Context {
+	return peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 5000}})
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	interceptor := UnaryServerInterceptor(GrpcKeyByPeerIP(),
+		Rule{Route: "/helloworld.Greeter/*", Limiter: newLimiter(t, 1)})
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "ok", nil }
+	call := func(ip, method string) error {
+		_, err := interceptor(peerCtx(ip), nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return err
+	}
+
+	if err := call("10.0.0.1", "/helloworld.Greeter/SayHello"); err != nil {
+		t.Fatal(err)
+	}
+	err := call("10.0.0.1", "/helloworld.Greeter/Say2Hello")
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("want RESOURCE_EXHAUSTED got %v", err)
+	}
+	if err := call("10.0.0.2", "/helloworld.Greeter/SayHello"); err != nil {
+		t.Fatalf("other peer should pass, got %v", err)
+	}
+	if err := call("10.0.0.1", "/ProductService/QueryProdInfoDetail"); err != nil {
+		t.Fatalf("unmatched method should pass, got %v", err)
+	}
+}
+
+func TestUnaryServerInterceptor_MethodRule(t *testing.T) {
+	// http 和 grpc 共用的规则，Method 对 grpc 不生效
+	interceptor := UnaryServerInterceptor(GrpcKeyByPeerIP(),
+		Rule{Route: "/helloworld.Greeter/*", Method: http.MethodPost, Limiter: newLimiter(t, 1)})
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "ok", nil }
+	info := &grpc.UnaryServerInfo{FullMethod: "/helloworld.Greeter/SayHello"}
+	if _, err := interceptor(peerCtx("10.0.0.1"), nil, info, handler); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := interceptor(peerCtx("10.0.0.1"), nil, info, handler); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("rule with Method should still limit grpc, got %v", err)
+	}
+}
+
+type fakeServerStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	header metadata.MD
+}
+
+func (s *fakeServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeServerStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	interceptor := StreamServerInterceptor(GrpcKeyByMetadata("app-id"), Rule{Limiter: newLimiter(t, 1)})
+	info := &grpc.StreamServerInfo{FullMethod: "/ProductService/QueryBatchProdInfoDetail"}
+	handler := func(srv interface{}, stream grpc.ServerStream) error { return nil }
+	ctx := metadata.NewIncomingContext(peerCtx("10.0.0.1"), metadata.Pairs("app-id", "crawler"))
+
+	first := &fakeServerStream{ctx: ctx}
+	if err := interceptor(nil, first, info, handler); err != nil {
+		t.Fatal(err)
+	}
+	second := &fakeServerStream{ctx: ctx}
+	err := interceptor(nil, second, info, handler)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("want RESOURCE_EXHAUSTED got %v", err)
+	}
+	if v := second.header.Get("retry-after"); len(v) != 1 || v[0] != "60" {
+		t.Fatalf("retry-after header want 60 got %v", v)
+	}
+	if v := second.header.Get("x-ratelimit-limit"); len(v) != 1 || v[0] != "1" {
+		t.Fatalf("x-ratelimit-limit header want 1 got %v", v)
+	}
+}
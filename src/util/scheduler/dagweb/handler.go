@@ -0,0 +1,197 @@
+package dagweb
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shark/src/util/scheduler"
+)
+
+// Server 查看任务图执行状态的 http 接口：
+//
+//	GET /runs                 执行记录列表，?name= 按图过滤
+//	GET /runs/:id             执行记录、每个任务的状态和依赖（json）
+//	GET /runs/:id/dot         graphviz dot
+//	GET /runs/:id/mermaid     mermaid flowchart
+//	GET /runs/:id/view        html 页面，用 templates/dag.html 渲染，执行中的任务图每 5 秒刷新一次
+type Server struct {
+	store  scheduler.RunStore
+	mu     sync.RWMutex
+	graphs map[string]*scheduler.TaskGraph // 图的名字 -> 定义，用于画出依赖关系
+}
+
+func NewServer(store scheduler.RunStore) *Server {
+	return &Server{store: store, graphs: make(map[string]*scheduler.TaskGraph)}
+}
+
+// AddGraph 登记图的定义，name 和执行时 WithName 的值一致。没有登记的图只能看到任务状态，看不到依赖关系
+func (s *Server) AddGraph(name string, g *scheduler.TaskGraph) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.graphs[name] = g
+}
+
+// LoadDefinitions 登记目录下所有的 toml/yaml 任务图定义，解析失败的文件打日志跳过
+func (s *Server) LoadDefinitions(dir string, registry *scheduler.Registry) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		switch strings.ToLower(filepath.Ext(f.Name())) {
+		case ".toml", ".yaml", ".yml":
+		default:
+			continue
+		}
+		def, err := scheduler.LoadDefinition(filepath.Join(dir, f.Name()))
+		if err != nil {
+			log.Printf("dagweb: %v", err)
+			continue
+		}
+		g, err := def.Build(registry)
+		if err != nil {
+			log.Printf("dagweb: %s: %v", f.Name(), err)
+			continue
+		}
+		s.AddGraph(def.Name, g)
+	}
+	return nil
+}
+
+// Register 注册路由，例如 server.Register(r.Group("/dags"))
+func (s *Server) Register(r gin.IRouter) {
+	r.GET("/runs", s.listRuns)
+	r.GET("/runs/:id", s.getRun)
+	r.GET("/runs/:id/dot", s.getDOT)
+	r.GET("/runs/:id/mermaid", s.getMermaid)
+	r.GET("/runs/:id/view", s.view)
+}
+
+// TaskView 单个任务的状态和依赖
+type TaskView struct {
+	Name     string              `json:"name"`
+	Deps     []string            `json:"deps"`
+	State    scheduler.TaskState `json:"state"`
+	Attempts int                 `json:"attempts"`
+	Error    string              `json:"error,omitempty"`
+	Start    time.Time           `json:"start"`
+	End      time.Time           `json:"end"`
+	Duration string              `json:"duration"`
+	Color    string              `json:"color"`
+}
+
+// RunView 执行记录和任务图
+type RunView struct {
+	RunID string             `json:"run_id"`
+	Name  string             `json:"name"`
+	State scheduler.RunState `json:"state"`
+	Start time.Time          `json:"start"`
+	End   time.Time          `json:"end"`
+	Tasks []TaskView         `json:"tasks"`
+}
+
+func (s *Server) listRuns(c *gin.Context) {
+	runs, err := s.store.ListRuns()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": http.StatusInternalServerError, "msg": err.Error()})
+		return
+	}
+	if name := c.Query("name"); name != "" {
+		filtered := runs[:0]
+		for _, run := range runs {
+			if run.Name == name {
+				filtered = append(filtered, run)
+			}
+		}
+		runs = filtered
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "ok", "data": runs})
+}
+
+// load 加载执行记录和对应的图，出错时已经写好了响应
+func (s *Server) load(c *gin.Context) (*scheduler.RunRecord, *scheduler.TaskGraph, bool) {
+	run, err := s.store.LoadRun(c.Param("id"))
+	if err == scheduler.ErrRunNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"code": http.StatusNotFound, "msg": err.Error()})
+		return nil, nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": http.StatusInternalServerError, "msg": err.Error()})
+		return nil, nil, false
+	}
+	return run, s.graph(run), true
+}
+
+// graph 登记过的图直接使用，否则用执行记录中的任务名拼一个没有依赖关系的图
+func (s *Server) graph(run *scheduler.RunRecord) *scheduler.TaskGraph {
+	s.mu.RLock()
+	g, ok := s.graphs[run.Name]
+	s.mu.RUnlock()
+	if ok {
+		return g
+	}
+	var tmp scheduler.TaskGraph
+	tmp = tmp.New()
+	for name := range run.Tasks {
+		tmp.AddTask(name, nil)
+	}
+	return &tmp
+}
+
+func newRunView(run *scheduler.RunRecord, g *scheduler.TaskGraph) RunView {
+	view := RunView{RunID: run.RunID, Name: run.Name, State: run.State, Start: run.Start, End: run.End}
+	for _, name := range g.TaskNames() {
+		task := TaskView{Name: name, Deps: g.Deps(name), State: scheduler.TaskPending}
+		if rec, ok := run.Tasks[name]; ok {
+			task.State, task.Attempts, task.Error, task.Start, task.End = rec.State, rec.Attempts, rec.Err, rec.Start, rec.End
+			if !rec.Start.IsZero() && !rec.End.IsZero() {
+				task.Duration = rec.End.Sub(rec.Start).Round(time.Millisecond).String()
+			}
+		}
+		task.Color = scheduler.StateColor(task.State)
+		view.Tasks = append(view.Tasks, task)
+	}
+	return view
+}
+
+func (s *Server) getRun(c *gin.Context) {
+	run, g, ok := s.load(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "ok", "data": newRunView(run, g)})
+}
+
+func (s *Server) getDOT(c *gin.Context) {
+	run, g, ok := s.load(c)
+	if !ok {
+		return
+	}
+	c.Data(http.StatusOK, "text/vnd.graphviz; charset=utf-8", []byte(g.DOT(run.Name, run.States())))
+}
+
+func (s *Server) getMermaid(c *gin.Context) {
+	run, g, ok := s.load(c)
+	if !ok {
+		return
+	}
+	c.String(http.StatusOK, g.Mermaid(run.States()))
+}
+
+func (s *Server) view(c *gin.Context) {
+	run, g, ok := s.load(c)
+	if !ok {
+		return
+	}
+	c.HTML(http.StatusOK, "dag.html", gin.H{
+		"run":     newRunView(run, g),
+		"mermaid": g.Mermaid(run.States()),
+		"refresh": run.State == scheduler.RunRunning,
+	})
+}
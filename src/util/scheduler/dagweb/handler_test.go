@@ -0,0 +1,88 @@
+package dagweb
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shark/src/util/scheduler"
+)
+
+func newTestServer(t *testing.T) *gin.Engine {
+	store := scheduler.NewMemoryStore()
+	var g scheduler.TaskGraph
+	g = g.New()
+	g.AddTask("extract", nil)
+	g.AddTask("load", []string{"extract"})
+	if _, err := g.Run(context.Background(), 1, scheduler.WithStore(store), scheduler.WithRunID("run-1"), scheduler.WithName("profile_tag")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Run(context.Background(), 1, scheduler.WithStore(store), scheduler.WithRunID("run-2"), scheduler.WithName("unknown")); err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewServer(store)
+	server.AddGraph("profile_tag", &g)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.LoadHTMLGlob("../../../../templates/*.html")
+	server.Register(r.Group("/dags"))
+	return r
+}
+
+func get(r http.Handler, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+func TestServer(t *testing.T) {
+	r := newTestServer(t)
+
+	w := get(r, "/dags/runs?name=profile_tag")
+	var list struct {
+		Data []scheduler.RunRecord `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || len(list.Data) != 1 || list.Data[0].RunID != "run-1" {
+		t.Fatalf("unexpected runs %s", w.Body)
+	}
+
+	w = get(r, "/dags/runs/run-1")
+	var run struct {
+		Data RunView `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &run); err != nil {
+		t.Fatal(err)
+	}
+	if run.Data.State != scheduler.RunSuccess || len(run.Data.Tasks) != 2 {
+		t.Fatalf("unexpected run %+v", run.Data)
+	}
+	load := run.Data.Tasks[1]
+	if load.Name != "load" || len(load.Deps) != 1 || load.Deps[0] != "extract" || load.State != scheduler.TaskSuccess {
+		t.Fatalf("unexpected task %+v", load)
+	}
+
+	// 没有登记定义的图也能看到任务状态
+	w = get(r, "/dags/runs/run-2")
+	if err := json.Unmarshal(w.Body.Bytes(), &run); err != nil || len(run.Data.Tasks) != 2 || len(run.Data.Tasks[1].Deps) != 0 {
+		t.Fatalf("unexpected run %s", w.Body)
+	}
+
+	if w := get(r, "/dags/runs/run-1/dot"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"extract" -> "load"`) {
+		t.Fatalf("unexpected dot %d %s", w.Code, w.Body)
+	}
+	if w := get(r, "/dags/runs/run-1/mermaid"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "t0 --> t1") {
+		t.Fatalf("unexpected mermaid %d %s", w.Code, w.Body)
+	}
+	w = get(r, "/dags/runs/run-1/view")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "profile_tag / run-1") || !strings.Contains(w.Body.String(), "t0 --&gt; t1") {
+		t.Fatalf("unexpected view %d %s", w.Code, w.Body)
+	}
+	if w := get(r, "/dags/runs/nope"); w.Code != http.StatusNotFound {
+		t.Fatalf("want 404 got %d", w.Code)
+	}
+}
@@ -0,0 +1,248 @@
+package scheduler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/shark/src/util/dag"
+	"gopkg.in/yaml.v2"
+)
+
+// Definition 配置文件描述的任务图，支持 toml 和 yaml，例如：
+//
+//	name = "profile_tag"
+//	parallelism = 4
+//
+//	[[tasks]]
+//	name = "extract"
+//	type = "shell"
+//	retries = 2
+//	retry_delay = "10s"
+//	timeout = "30m"
+//	[tasks.params]
+//	cmd = "hive -f extract.sql"
+//
+//	[[tasks]]
+//	name = "notify"
+//	type = "http"
+//	deps = ["extract"]
+//	trigger_rule = "all_done"
+//	[tasks.params]
+//	url = "http://localhost:8080/notify"
+type Definition struct {
+	Name        string           `toml:"name" yaml:"name"`
+	Parallelism int              `toml:"parallelism" yaml:"parallelism"`
+	FailFast    bool             `toml:"fail_fast" yaml:"fail_fast"`
+	Tasks       []TaskDefinition `toml:"tasks" yaml:"tasks"`
+}
+
+// TaskDefinition 单个任务的配置
+type TaskDefinition struct {
+	Name          string                 `toml:"name" yaml:"name"`
+	Type          string                 `toml:"type" yaml:"type"`
+	Deps          []string               `toml:"deps" yaml:"deps"`
+	Params        map[string]interface{} `toml:"params" yaml:"params"`
+	Retries       int                    `toml:"retries" yaml:"retries"`
+	RetryDelay    Duration               `toml:"retry_delay" yaml:"retry_delay"`
+	MaxRetryDelay Duration               `toml:"max_retry_delay" yaml:"max_retry_delay"`
+	Timeout       Duration               `toml:"timeout" yaml:"timeout"`
+	TriggerRule   TriggerRule            `toml:"trigger_rule" yaml:"trigger_rule"`
+}
+
+// Duration 配置文件中的时间，写成 "1m30s" 这样的字符串
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	return d.UnmarshalText([]byte(s))
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// LoadDefinition 从文件加载任务图定义，按扩展名区分格式：.toml、.yaml、.yml
+func LoadDefinition(path string) (*Definition, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	def, err := ParseDefinition(data, strings.TrimPrefix(filepath.Ext(path), "."))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if def.Name == "" {
+		def.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return def, nil
+}
+
+// ParseDefinition 解析任务图定义，format 为 toml 或者 yaml/yml
+func ParseDefinition(data []byte, format string) (*Definition, error) {
+	def := new(Definition)
+	switch strings.ToLower(format) {
+	case "toml":
+		md, err := toml.Decode(string(data), def)
+		if err != nil {
+			return nil, err
+		}
+		// 和 yaml 的 UnmarshalStrict 一致，拼错的字段报错而不是被忽略。
+		// params 是任意结构，toml 库会把其中嵌套的表也算作没有解析，跳过
+		var unknown []string
+		for _, k := range md.Undecoded() {
+			if len(k) >= 2 && k[0] == "tasks" && k[1] == "params" {
+				continue
+			}
+			unknown = append(unknown, k.String())
+		}
+		if len(unknown) > 0 {
+			return nil, fmt.Errorf("unknown fields in toml: %s", strings.Join(unknown, ", "))
+		}
+	case "yaml", "yml":
+		if err := yaml.UnmarshalStrict(data, def); err != nil {
+			return nil, err
+		}
+		for i := range def.Tasks {
+			def.Tasks[i].Params = normalizeParams(def.Tasks[i].Params)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported definition format %q", format)
+	}
+	return def, nil
+}
+
+// normalizeParams yaml 解析出来的嵌套 map 是 map[interface{}]interface{}，统一转成 map[string]interface{}
+func normalizeParams(params map[string]interface{}) map[string]interface{} {
+	for k, v := range params {
+		params[k] = normalizeValue(v)
+	}
+	return params
+}
+
+func normalizeValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = normalizeValue(e)
+		}
+		return m
+	case []interface{}:
+		for i, e := range v {
+			v[i] = normalizeValue(e)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// Validate 检查任务名是否重复、任务类型是否注册、依赖是否存在、触发规则是否合法以及是否有环，
+// 并用 registry 创建每个任务，提前发现参数错误
+func (def *Definition) Validate(registry *Registry) error {
+	_, err := def.Build(registry)
+	return err
+}
+
+// Build 根据定义创建任务图
+func (def *Definition) Build(registry *Registry) (*TaskGraph, error) {
+	if registry == nil {
+		registry = DefaultRegistry
+	}
+	if len(def.Tasks) == 0 {
+		return nil, fmt.Errorf("definition %s has no task", def.Name)
+	}
+	var g TaskGraph
+	g = g.New()
+	for _, task := range def.Tasks {
+		if task.Name == "" {
+			return nil, fmt.Errorf("task name is required")
+		}
+		if task.Type == "" {
+			task.Type = "noop"
+		}
+		factory, ok := registry.factory(task.Type)
+		if !ok {
+			return nil, fmt.Errorf("task %s: unknown type %s, registered types: %v", task.Name, task.Type, registry.Types())
+		}
+		fn, err := factory(task.Name, task.Params)
+		if err != nil {
+			return nil, fmt.Errorf("task %s: %v", task.Name, err)
+		}
+		if !g.AddTaskFunc(task.Name, task.Deps, fn) {
+			return nil, fmt.Errorf("duplicate task %s", task.Name)
+		}
+		policy := TaskPolicy{
+			Retries:       task.Retries,
+			RetryDelay:    time.Duration(task.RetryDelay),
+			MaxRetryDelay: time.Duration(task.MaxRetryDelay),
+			Timeout:       time.Duration(task.Timeout),
+			TriggerRule:   task.TriggerRule,
+		}
+		if !g.SetPolicy(task.Name, policy) {
+			return nil, fmt.Errorf("task %s: unknown trigger rule %s", task.Name, task.TriggerRule)
+		}
+	}
+	if err := g.validate(); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// Plan 执行计划：按层输出任务，同一层的任务之间没有依赖，可以并行执行。
+// 先用 InitGraph 检查依赖和环，再按 dag.DagSort 的拓扑序计算每个任务所在的层（最长依赖链的长度）
+func (def *Definition) Plan() ([][]string, error) {
+	var g TaskGraph
+	g = g.New()
+	deps := make(map[string][]string, len(def.Tasks))
+	for _, task := range def.Tasks {
+		if !g.AddTask(task.Name, task.Deps) {
+			return nil, fmt.Errorf("duplicate task %s", task.Name)
+		}
+		deps[task.Name] = task.Deps
+	}
+	if !g.InitGraph() {
+		// InitGraph 只返回 false，再用 validate 给出具体原因（缺少的任务、环上的路径）
+		if err := g.validate(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("invalid graph %s", def.Name)
+	}
+
+	level := make(map[string]int, len(deps))
+	var layers [][]string
+	for _, name := range dag.DagSort(deps) {
+		l := 0
+		for _, dep := range deps[name] {
+			if level[dep]+1 > l {
+				l = level[dep] + 1
+			}
+		}
+		level[name] = l
+		for len(layers) <= l {
+			layers = append(layers, nil)
+		}
+		layers[l] = append(layers[l], name)
+	}
+	for _, layer := range layers {
+		sort.Strings(layer)
+	}
+	return layers, nil
+}
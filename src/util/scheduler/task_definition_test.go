@@ -0,0 +1,212 @@
+package scheduler
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const tomlDefinition = `
+name = "profile_tag"
+parallelism = 2
+
+[[tasks]]
+name = "extract"
+type = "shell"
+retries = 2
+retry_delay = "10ms"
+timeout = "5s"
+[tasks.params]
+cmd = "echo $TABLE"
+[tasks.params.env]
+TABLE = "custom_user_profile_tag"
+
+[[tasks]]
+name = "transform"
+type = "noop"
+deps = ["extract"]
+
+[[tasks]]
+name = "audit"
+deps = ["extract"]
+
+[[tasks]]
+name = "load"
+type = "sleep"
+deps = ["transform", "audit"]
+[tasks.params]
+duration = "1ms"
+
+[[tasks]]
+name = "notify"
+deps = ["load"]
+trigger_rule = "all_done"
+`
+
+const yamlDefinition = `
+name: profile_tag
+parallelism: 2
+tasks:
+  - name: extract
+    type: shell
+    retries: 2
+    retry_delay: 10ms
+    timeout: 5s
+    params:
+      cmd: echo $TABLE
+      env:
+        TABLE: custom_user_profile_tag
+  - name: transform
+    type: noop
+    deps: [extract]
+  - name: audit
+    deps: [extract]
+  - name: load
+    type: sleep
+    deps: [transform, audit]
+    params:
+      duration: 1ms
+  - name: notify
+    deps: [load]
+    trigger_rule: all_done
+`
+
+func TestDefinition(t *testing.T) {
+	for format, data := range map[string]string{"toml": tomlDefinition, "yaml": yamlDefinition} {
+		t.Run(format, func(t *testing.T) {
+			def, err := ParseDefinition([]byte(data), format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if def.Name != "profile_tag" || def.Parallelism != 2 || len(def.Tasks) != 5 {
+				t.Fatalf("unexpected definition %+v", def)
+			}
+			extract := def.Tasks[0]
+			if extract.Retries != 2 || time.Duration(extract.RetryDelay) != 10*time.Millisecond || time.Duration(extract.Timeout) != 5*time.Second {
+				t.Fatalf("unexpected policy %+v", extract)
+			}
+			if def.Tasks[4].TriggerRule != AllDone {
+				t.Fatalf("trigger rule want all_done got %s", def.Tasks[4].TriggerRule)
+			}
+
+			layers, err := def.Plan()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := [][]string{{"extract"}, {"audit", "transform"}, {"load"}, {"notify"}}
+			if !reflect.DeepEqual(layers, want) {
+				t.Fatalf("plan want %v got %v", want, layers)
+			}
+
+			g, err := def.Build(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			report, err := g.Run(context.Background(), def.Parallelism)
+			if err != nil {
+				t.Fatalf("%v\n%s", err, report)
+			}
+			if g.graph["extract"].Policy.Retries != 2 {
+				t.Fatal("policy should be applied to the graph")
+			}
+		})
+	}
+}
+
+func TestDefinition_Invalid(t *testing.T) {
+	cases := map[string]string{
+		"unknown type":  "[[tasks]]\nname = \"a\"\ntype = \"spark\"",
+		"missing param": "[[tasks]]\nname = \"a\"\ntype = \"shell\"",
+		"duplicate":     "[[tasks]]\nname = \"a\"\n[[tasks]]\nname = \"a\"",
+		"unknown dep":   "[[tasks]]\nname = \"a\"\ndeps = [\"b\"]",
+		"cycle":         "[[tasks]]\nname = \"a\"\ndeps = [\"b\"]\n[[tasks]]\nname = \"b\"\ndeps = [\"a\"]",
+		"trigger rule":  "[[tasks]]\nname = \"a\"\ntrigger_rule = \"sometimes\"",
+		"empty":         "name = \"empty\"",
+	}
+	for name, data := range cases {
+		def, err := ParseDefinition([]byte(data), "toml")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if err := def.Validate(nil); err == nil {
+			t.Fatalf("%s: should be invalid", name)
+		}
+	}
+
+	def, _ := ParseDefinition([]byte(cases["cycle"]), "toml")
+	if _, err := def.Plan(); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Fatalf("plan should report cycle, got %v", err)
+	}
+	if _, err := ParseDefinition([]byte("tasks:\n  - name: a\n    retries: many"), "yaml"); err == nil {
+		t.Fatal("bad yaml should fail")
+	}
+	// 拼错的字段和 yaml 一样报错
+	if _, err := ParseDefinition([]byte("[[tasks]]\nname = \"a\"\nretires = 3"), "toml"); err == nil || !strings.Contains(err.Error(), "tasks.retires") {
+		t.Fatalf("unknown toml field should fail, got %v", err)
+	}
+	if _, err := ParseDefinition([]byte("tasks:\n  - name: a\n    retires: 3"), "yaml"); err == nil {
+		t.Fatal("unknown yaml field should fail")
+	}
+	if _, err := ParseDefinition([]byte("{}"), "json"); err == nil {
+		t.Fatal("unsupported format should fail")
+	}
+}
+
+func TestDefinition_DuplicateDeps(t *testing.T) {
+	def, err := ParseDefinition([]byte("tasks:\n  - name: a\n  - name: b\n    deps: [a, a]"), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Validate、Build、Plan 对重复的依赖结论一致
+	if err := def.Validate(nil); err != nil {
+		t.Fatal(err)
+	}
+	layers, err := def.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]string{{"a"}, {"b"}}; !reflect.DeepEqual(layers, want) {
+		t.Fatalf("plan want %v got %v", want, layers)
+	}
+	g, err := def.Build(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report, err := g.Run(context.Background(), 1); err != nil || report.Tasks["b"].State != TaskSuccess {
+		t.Fatalf("run %v\n%s", err, report)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	var got string
+	err := r.Register("echo", func(name string, params map[string]interface{}) (TaskFunc, error) {
+		return func(ctx context.Context) error {
+			got = paramString(params, "msg")
+			return nil
+		}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Register("echo", nil) == nil {
+		t.Fatal("duplicate type should be rejected")
+	}
+	def, _ := ParseDefinition([]byte("tasks:\n  - name: hello\n    type: echo\n    params:\n      msg: hi"), "yaml")
+	g, err := def.Build(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Run(context.Background(), 1); err != nil || got != "hi" {
+		t.Fatalf("custom task should run, got %q err %v", got, err)
+	}
+
+	fail, _ := ParseDefinition([]byte("tasks:\n  - name: fail\n    type: shell\n    params:\n      cmd: echo oops >&2; exit 3"), "yaml")
+	g, _ = fail.Build(nil)
+	report, err := g.Run(context.Background(), 1)
+	if err == nil || !strings.Contains(report.Tasks["fail"].Err.Error(), "oops") {
+		t.Fatalf("shell error should include output, got %v", err)
+	}
+}
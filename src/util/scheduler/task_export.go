@@ -0,0 +1,134 @@
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TaskNames 图中所有任务，按名字排序
+func (taskGraph *TaskGraph) TaskNames() []string {
+	names := make([]string, 0, len(taskGraph.graph))
+	for name := range taskGraph.graph {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Deps 任务的前置依赖，按名字排序，任务不存在时返回 nil
+func (taskGraph *TaskGraph) Deps(taskName string) []string {
+	if _, ok := taskGraph.graph[taskName]; !ok {
+		return nil
+	}
+	return taskGraph.deps(taskName)
+}
+
+// States 报告中每个任务的状态，用于导出图
+func (report *Report) States() map[string]TaskState {
+	states := make(map[string]TaskState, len(report.Tasks))
+	for name, res := range report.Tasks {
+		states[name] = res.State
+	}
+	return states
+}
+
+// States 执行记录中每个任务的状态，用于导出图
+func (run *RunRecord) States() map[string]TaskState {
+	states := make(map[string]TaskState, len(run.Tasks))
+	for name, task := range run.Tasks {
+		states[name] = task.State
+	}
+	return states
+}
+
+// stateColors 每种状态的填充色，和 Airflow 的配色接近
+var stateColors = map[TaskState]string{
+	TaskPending:  "#eeeeee",
+	TaskRunning:  "#90caf9",
+	TaskSuccess:  "#a5d6a7",
+	TaskFailed:   "#ef9a9a",
+	TaskSkipped:  "#f8bbd0",
+	TaskCanceled: "#ffe082",
+}
+
+// StateColor 状态对应的颜色，没有状态（还没有执行）时为白色
+func StateColor(state TaskState) string {
+	if c, ok := stateColors[state]; ok {
+		return c
+	}
+	return "#ffffff"
+}
+
+// DOT 导出 Graphviz dot 格式，states 为每个任务的状态（可以为 nil），按状态给节点着色。
+// dot -Tsvg graph.dot -o graph.svg
+func (taskGraph *TaskGraph) DOT(name string, states map[string]TaskState) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", dotQuote(name))
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box, style=\"rounded,filled\", fontname=\"Helvetica\"];\n")
+	names := taskGraph.TaskNames()
+	for _, task := range names {
+		label := task
+		if state, ok := states[task]; ok {
+			label = fmt.Sprintf("%s\n%s", task, state)
+		}
+		fmt.Fprintf(&b, "  %s [label=%s, fillcolor=%s];\n", dotQuote(task), dotQuote(label), dotQuote(StateColor(states[task])))
+	}
+	for _, task := range names {
+		for _, dep := range taskGraph.deps(task) {
+			fmt.Fprintf(&b, "  %s -> %s;\n", dotQuote(dep), dotQuote(task))
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func dotQuote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	return `"` + s + `"`
+}
+
+// Mermaid 导出 mermaid flowchart，可以直接贴到 markdown 或者用 mermaid.js 渲染。
+// 任务名可能包含 mermaid 不支持的字符，节点 id 用 t0、t1...，任务名放在标签里
+func (taskGraph *TaskGraph) Mermaid(states map[string]TaskState) string {
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	names := taskGraph.TaskNames()
+	ids := make(map[string]string, len(names))
+	for i, task := range names {
+		ids[task] = fmt.Sprintf("t%d", i)
+		label := mermaidEscape(task)
+		if state, ok := states[task]; ok {
+			label = fmt.Sprintf("%s<br/>%s", label, state)
+		}
+		fmt.Fprintf(&b, "  %s[\"%s\"]\n", ids[task], label)
+	}
+	for _, task := range names {
+		for _, dep := range taskGraph.deps(task) {
+			fmt.Fprintf(&b, "  %s --> %s\n", ids[dep], ids[task])
+		}
+	}
+	used := make(map[TaskState]bool)
+	for _, task := range names {
+		if state, ok := states[task]; ok {
+			fmt.Fprintf(&b, "  class %s %s\n", ids[task], state)
+			used[state] = true
+		}
+	}
+	var classes []string
+	for state := range used {
+		classes = append(classes, string(state))
+	}
+	sort.Strings(classes)
+	for _, state := range classes {
+		fmt.Fprintf(&b, "  classDef %s fill:%s,stroke:#555\n", state, StateColor(TaskState(state)))
+	}
+	return b.String()
+}
+
+func mermaidEscape(s string) string {
+	return strings.Replace(s, `"`, "#quot;", -1)
+}
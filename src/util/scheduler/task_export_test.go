@@ -0,0 +1,47 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	var g TaskGraph
+	g = g.New()
+	g.AddTask("extract", nil)
+	g.AddTask(`load "hive"`, []string{"extract"})
+	g.AddTaskFunc("report", []string{"extract"}, func(ctx context.Context) error { return errors.New("boom") })
+	report, _ := g.Run(context.Background(), 1)
+
+	dot := g.DOT("profile_tag", report.States())
+	for _, want := range []string{
+		`digraph "profile_tag" {`,
+		`"extract" -> "load \"hive\"";`,
+		`"report" [label="report\nfailed", fillcolor="` + StateColor(TaskFailed) + `"];`,
+	} {
+		if !strings.Contains(dot, want) {
+			t.Fatalf("dot should contain %s:\n%s", want, dot)
+		}
+	}
+
+	mermaid := g.Mermaid(report.States())
+	for _, want := range []string{
+		"flowchart LR",
+		`t1["load #quot;hive#quot;<br/>success"]`,
+		"t0 --> t1",
+		"t0 --> t2",
+		"class t2 failed",
+		"classDef failed fill:" + StateColor(TaskFailed),
+	} {
+		if !strings.Contains(mermaid, want) {
+			t.Fatalf("mermaid should contain %s:\n%s", want, mermaid)
+		}
+	}
+
+	// 没有状态时不着色
+	if strings.Contains(g.Mermaid(nil), "class ") {
+		t.Fatal("mermaid without states should not have classes")
+	}
+}
@@ -6,6 +6,9 @@ type TaskNode struct {
 	OutCounter int             // 剩余依赖任务
 	InCounter  int             // 剩余被依赖任务
 	Done       bool            // 任务是否完成
+	Fn         TaskFunc        // 任务的执行逻辑，Run 时使用
+	Branch     BranchFunc      // 分支任务的执行逻辑，不为空时代替 Fn
+	Policy     TaskPolicy      // 重试、超时、触发规则
 }
 
 // 初始化任务节点，根据本任务的前置依赖进行初始化
@@ -17,6 +20,9 @@ func NewNode(deps []string) *TaskNode {
 	taskNode.OutEdge = make(map[string]bool)
 	taskNode.InEdge = make(map[string]bool)
 	for _, dep := range deps {
+		if _, ok := taskNode.OutEdge[dep]; ok { // 重复的依赖只算一次，否则计数永远减不到 0
+			continue
+		}
 		// init
 		taskNode.OutEdge[dep] = false
 		taskNode.OutCounter += 1 // 本任务依赖的任务数目 + 1
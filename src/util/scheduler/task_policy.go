@@ -0,0 +1,230 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// TriggerRule 上游任务处于什么状态时执行本任务，和 Airflow 的 trigger_rule 含义一致
+type TriggerRule string
+
+const (
+	AllSuccess TriggerRule = "all_success" // 上游全部成功（默认）
+	AllDone    TriggerRule = "all_done"    // 上游全部结束，不管成功失败，适合清理、通知类任务
+	OneFailed  TriggerRule = "one_failed"  // 任意一个上游失败就立即执行，适合告警、补偿任务
+	OneSuccess TriggerRule = "one_success" // 任意一个上游成功就立即执行，适合分支汇合
+)
+
+// TaskPolicy 任务的重试、超时和触发规则
+type TaskPolicy struct {
+	// Retries 失败后最多重试几次，0 表示不重试
+	Retries int
+	// RetryDelay 第一次重试前等待的时间，之后每次翻倍，默认 1s
+	RetryDelay time.Duration
+	// MaxRetryDelay 重试等待时间的上限，默认 10min
+	MaxRetryDelay time.Duration
+	// Timeout 每次执行的超时时间，0 表示不限制
+	Timeout time.Duration
+	// TriggerRule 默认 AllSuccess
+	TriggerRule TriggerRule
+}
+
+// backoff 第 attempt 次重试前的等待时间，attempt 从 1 开始
+func (p TaskPolicy) backoff(attempt int) time.Duration {
+	delay, max := p.RetryDelay, p.MaxRetryDelay
+	if delay <= 0 {
+		delay = time.Second
+	}
+	if max <= 0 {
+		max = 10 * time.Minute
+	}
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
+
+func (p TaskPolicy) triggerRule() TriggerRule {
+	if p.TriggerRule == "" {
+		return AllSuccess
+	}
+	return p.TriggerRule
+}
+
+// SetPolicy 设置任务的重试、超时和触发规则，任务不存在或者规则不合法时返回 false
+func (taskGraph *TaskGraph) SetPolicy(taskName string, policy TaskPolicy) bool {
+	node, ok := taskGraph.graph[taskName]
+	if !ok {
+		return false
+	}
+	switch policy.triggerRule() {
+	case AllSuccess, AllDone, OneFailed, OneSuccess:
+	default:
+		return false
+	}
+	node.Policy = policy
+	return true
+}
+
+// BranchFunc 分支任务：返回接下来要执行的直接下游任务，没有被选中的直接下游会被跳过，
+// 和 Airflow 的 BranchPythonOperator 一样。被跳过的任务按各自的 TriggerRule 继续向下传递
+type BranchFunc func(ctx context.Context) ([]string, error)
+
+// AddBranchTask 添加一个分支任务
+func (taskGraph *TaskGraph) AddBranchTask(taskName string, deps []string, fn BranchFunc) bool {
+	if !taskGraph.AddTask(taskName, deps) {
+		return false
+	}
+	taskGraph.graph[taskName].Branch = fn
+	return true
+}
+
+var (
+	errUpstreamFailed = errors.New("upstream task failed")
+	errBranchSkipped  = errors.New("branch not taken")
+)
+
+type decision int
+
+const (
+	decisionWait decision = iota
+	decisionRun
+	decisionSkip
+)
+
+// decide 根据上游的状态和触发规则决定任务是执行、跳过还是继续等待。
+// OneFailed / OneSuccess 不需要等所有上游结束，满足条件立即执行；AllSuccess 有上游没有成功时立即跳过
+func (r *runner) decide(name string) (decision, error) {
+	var success, failed, done int
+	for _, dep := range r.deps[name] {
+		res := r.report.Tasks[dep]
+		switch res.State {
+		case TaskSuccess:
+			if res.Branch != nil && !contains(res.Branch, name) {
+				return decisionSkip, errBranchSkipped
+			}
+			success++
+			done++
+		case TaskFailed:
+			failed++
+			done++
+		case TaskSkipped, TaskCanceled:
+			done++
+		}
+	}
+	all := len(r.deps[name])
+	rule := r.graph.graph[name].Policy.triggerRule()
+	switch rule {
+	case AllSuccess:
+		if success == all {
+			return decisionRun, nil
+		}
+		if done > success {
+			return decisionSkip, errUpstreamFailed
+		}
+	case AllDone:
+		if done == all {
+			return decisionRun, nil
+		}
+	case OneFailed:
+		if failed > 0 {
+			return decisionRun, nil
+		}
+	case OneSuccess:
+		if success > 0 {
+			return decisionRun, nil
+		}
+	}
+	if done == all {
+		return decisionSkip, fmt.Errorf("trigger rule %s not met", rule)
+	}
+	return decisionWait, nil
+}
+
+// execute 按重试、超时策略执行任务，返回最后一次执行的错误
+func (r *runner) execute(ctx context.Context, name string, res *TaskResult) error {
+	node := r.graph.graph[name]
+	policy := node.Policy
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(policy.backoff(attempt)):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		res.Attempts++
+		err := r.attempt(ctx, node, policy.Timeout, res)
+		if err == nil || attempt >= policy.Retries || ctx.Err() != nil {
+			return err
+		}
+	}
+}
+
+// attempt 执行一次。超时后不再等待任务返回（任务应该响应 ctx 自己退出，否则 goroutine 会泄漏到它返回为止）
+func (r *runner) attempt(parent context.Context, node *TaskNode, timeout time.Duration, res *TaskResult) error {
+	ctx, cancel := parent, context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(parent, timeout)
+	}
+	defer cancel()
+
+	type outcome struct {
+		branch []string
+		err    error
+	}
+	ch := make(chan outcome, 1)
+	go func() {
+		var out outcome
+		out.err = safeCall(func() error {
+			if node.Branch == nil {
+				return callTask(ctx, node.Fn)
+			}
+			branch, err := node.Branch(ctx)
+			out.branch = branch
+			return err
+		})
+		ch <- out
+	}()
+
+	select {
+	case out := <-ch:
+		if out.err != nil || node.Branch == nil {
+			return out.err
+		}
+		dependents := r.dependents[res.Name]
+		for _, next := range out.branch {
+			if !contains(dependents, next) {
+				return fmt.Errorf("branch %s is not a downstream task of %s", next, res.Name)
+			}
+		}
+		res.Branch = append([]string{}, out.branch...)
+		return nil
+	case <-ctx.Done():
+		if parent.Err() == nil {
+			return fmt.Errorf("timed out after %s: %w", timeout, ctx.Err())
+		}
+		return ctx.Err()
+	}
+}
+
+func callTask(ctx context.Context, fn TaskFunc) error {
+	if fn == nil {
+		return nil
+	}
+	return fn(ctx)
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPolicy_Retry(t *testing.T) {
+	var g TaskGraph
+	g = g.New()
+	var calls int32
+	g.AddTaskFunc("flaky", nil, func(ctx context.Context) error {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			return errors.New("connection reset")
+		}
+		return nil
+	})
+	g.SetPolicy("flaky", TaskPolicy{Retries: 3, RetryDelay: 10 * time.Millisecond})
+
+	report, err := g.Run(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := report.Tasks["flaky"]
+	if res.Attempts != 3 {
+		t.Fatalf("want 3 attempts got %d", res.Attempts)
+	}
+	// 两次重试分别等待 10ms、20ms
+	if res.Duration() < 30*time.Millisecond {
+		t.Fatalf("retries should back off, took %s", res.Duration())
+	}
+
+	atomic.StoreInt32(&calls, -10)
+	report, err = g.Run(context.Background(), 1)
+	if err == nil || report.Tasks["flaky"].Attempts != 4 {
+		t.Fatalf("should give up after 3 retries, err %v", err)
+	}
+}
+
+func TestPolicy_Backoff(t *testing.T) {
+	p := TaskPolicy{RetryDelay: time.Second, MaxRetryDelay: 5 * time.Second}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, d := range want {
+		if got := p.backoff(i + 1); got != d {
+			t.Fatalf("attempt %d want %s got %s", i+1, d, got)
+		}
+	}
+}
+
+func TestPolicy_Timeout(t *testing.T) {
+	var g TaskGraph
+	g = g.New()
+	// 不响应 ctx 的任务也能按时结束
+	g.AddTaskFunc("stuck", nil, func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+	g.SetPolicy("stuck", TaskPolicy{Timeout: 20 * time.Millisecond, Retries: 1, RetryDelay: time.Millisecond})
+
+	start := time.Now()
+	report, err := g.Run(context.Background(), 1)
+	if err == nil || !errors.Is(report.Tasks["stuck"].Err, context.DeadlineExceeded) {
+		t.Fatalf("want timeout got %v", err)
+	}
+	if report.Tasks["stuck"].Attempts != 2 {
+		t.Fatalf("timeout should be retried, attempts %d", report.Tasks["stuck"].Attempts)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("timeout not enforced, took %s", time.Since(start))
+	}
+}
+
+func TestPolicy_TriggerRules(t *testing.T) {
+	var g TaskGraph
+	g = g.New()
+	slow := func(ctx context.Context) error {
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-ctx.Done():
+		}
+		return nil
+	}
+	g.AddTaskFunc("extract", nil, func(ctx context.Context) error { return errors.New("boom") })
+	g.AddTaskFunc("slow", nil, slow)
+	g.AddTaskFunc("load", []string{"extract", "slow"}, nil)
+	g.AddTaskFunc("alert", []string{"extract", "slow"}, nil)
+	g.AddTaskFunc("cleanup", []string{"extract", "slow"}, nil)
+	g.AddTaskFunc("any", []string{"extract", "slow"}, nil)
+	g.AddTaskFunc("never", []string{"slow"}, nil)
+	g.SetPolicy("alert", TaskPolicy{TriggerRule: OneFailed})
+	g.SetPolicy("cleanup", TaskPolicy{TriggerRule: AllDone})
+	g.SetPolicy("any", TaskPolicy{TriggerRule: OneSuccess})
+	g.SetPolicy("never", TaskPolicy{TriggerRule: OneFailed})
+	if g.SetPolicy("load", TaskPolicy{TriggerRule: "none_failed"}) {
+		t.Fatal("unknown trigger rule should be rejected")
+	}
+
+	report, _ := g.Run(context.Background(), 0)
+	want := map[string]TaskState{
+		"load": TaskSkipped, "alert": TaskSuccess, "cleanup": TaskSuccess, "any": TaskSuccess, "never": TaskSkipped,
+	}
+	for name, state := range want {
+		if report.Tasks[name].State != state {
+			t.Fatalf("task %s want %s got %s (%v)", name, state, report.Tasks[name].State, report.Tasks[name].Err)
+		}
+	}
+	// OneFailed 不等 slow 结束就执行，AllDone 要等
+	if !report.Tasks["alert"].Start.Before(report.Tasks["slow"].End) {
+		t.Fatal("one_failed task should start as soon as an upstream fails")
+	}
+	if report.Tasks["cleanup"].Start.Before(report.Tasks["slow"].End) {
+		t.Fatal("all_done task should wait for every upstream")
+	}
+}
+
+func TestBranch(t *testing.T) {
+	var g TaskGraph
+	g = g.New()
+	var ran []string
+	record := func(name string) TaskFunc {
+		return func(ctx context.Context) error {
+			ran = append(ran, name)
+			return nil
+		}
+	}
+	g.AddBranchTask("check_tag", nil, func(ctx context.Context) ([]string, error) {
+		return []string{"full_rebuild"}, nil
+	})
+	g.AddTaskFunc("full_rebuild", []string{"check_tag"}, record("full_rebuild"))
+	g.AddTaskFunc("incremental", []string{"check_tag"}, record("incremental"))
+	g.AddTaskFunc("incremental_post", []string{"incremental"}, record("incremental_post"))
+	g.AddTaskFunc("publish", []string{"full_rebuild", "incremental_post"}, record("publish"))
+	g.SetPolicy("publish", TaskPolicy{TriggerRule: OneSuccess})
+
+	report, err := g.Run(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(ran, ",") != "full_rebuild,publish" {
+		t.Fatalf("unexpected tasks ran: %v", ran)
+	}
+	if report.Tasks["incremental"].State != TaskSkipped || !errors.Is(report.Tasks["incremental"].Err, errBranchSkipped) {
+		t.Fatalf("branch not taken should be skipped, got %s", report.Tasks["incremental"].State)
+	}
+	if report.Tasks["incremental_post"].State != TaskSkipped {
+		t.Fatal("skip should propagate down the branch")
+	}
+
+	var bad TaskGraph
+	bad = bad.New()
+	bad.AddBranchTask("b", nil, func(ctx context.Context) ([]string, error) { return []string{"nope"}, nil })
+	bad.AddTask("c", []string{"b"})
+	if report, err := bad.Run(context.Background(), 1); err == nil || report.Tasks["c"].State != TaskSkipped {
+		t.Fatalf("unknown branch should fail the branch task, got %v", err)
+	}
+}
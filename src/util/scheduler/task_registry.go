@@ -0,0 +1,175 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TaskFactory 根据配置文件中的 params 创建任务的执行逻辑，name 为任务名，用于日志和错误信息
+type TaskFactory func(name string, params map[string]interface{}) (TaskFunc, error)
+
+// Registry 任务类型到执行逻辑的映射，配置文件中的 type 字段在这里查找
+type Registry struct {
+	mu        sync.RWMutex
+	factories map[string]TaskFactory
+}
+
+// NewRegistry 创建注册表，包含内置的 noop、sleep、shell、http 类型
+func NewRegistry() *Registry {
+	r := &Registry{factories: make(map[string]TaskFactory)}
+	r.Register("noop", noopTask)
+	r.Register("sleep", sleepTask)
+	r.Register("shell", shellTask)
+	r.Register("http", httpTask)
+	return r
+}
+
+// DefaultRegistry 默认注册表，业务在 init 中注册自己的任务类型
+var DefaultRegistry = NewRegistry()
+
+// Register 注册任务类型，重复注册时返回 error
+func (r *Registry) Register(taskType string, factory TaskFactory) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.factories[taskType]; ok {
+		return fmt.Errorf("scheduler: task type %s already registered", taskType)
+	}
+	r.factories[taskType] = factory
+	return nil
+}
+
+// Types 已经注册的任务类型
+func (r *Registry) Types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	types := make([]string, 0, len(r.factories))
+	for t := range r.factories {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+func (r *Registry) factory(taskType string) (TaskFactory, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	f, ok := r.factories[taskType]
+	return f, ok
+}
+
+// noop 什么也不做，用来汇聚依赖
+func noopTask(name string, params map[string]interface{}) (TaskFunc, error) {
+	return nil, nil
+}
+
+// sleep 等待 params.duration，例如 "30s"，用于调试和等待外部系统
+func sleepTask(name string, params map[string]interface{}) (TaskFunc, error) {
+	d, err := paramDuration(params, "duration")
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) error {
+		select {
+		case <-time.After(d):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}, nil
+}
+
+// shell 执行 params.cmd，可选 params.dir 为工作目录，params.env 为额外的环境变量
+func shellTask(name string, params map[string]interface{}) (TaskFunc, error) {
+	cmd := paramString(params, "cmd")
+	if cmd == "" {
+		return nil, fmt.Errorf("param cmd is required")
+	}
+	dir := paramString(params, "dir")
+	var env []string
+	if m, ok := params["env"].(map[string]interface{}); ok {
+		for k, v := range m {
+			env = append(env, fmt.Sprintf("%s=%v", k, v))
+		}
+		sort.Strings(env)
+	}
+	return func(ctx context.Context) error {
+		c := exec.CommandContext(ctx, "sh", "-c", cmd)
+		c.Dir = dir
+		c.Env = append(os.Environ(), env...)
+		out, err := c.CombinedOutput()
+		if err != nil {
+			if msg := tail(string(out), 512); msg != "" {
+				return fmt.Errorf("%v: %s", err, msg)
+			}
+			return err
+		}
+		if len(out) > 0 {
+			log.Printf("[%s] %s", name, strings.TrimRight(string(out), "\n"))
+		}
+		return nil
+	}, nil
+}
+
+// http 请求 params.url，默认 GET，响应码不是 2xx 时失败
+func httpTask(name string, params map[string]interface{}) (TaskFunc, error) {
+	url := paramString(params, "url")
+	if url == "" {
+		return nil, fmt.Errorf("param url is required")
+	}
+	method := strings.ToUpper(paramString(params, "method"))
+	if method == "" {
+		method = http.MethodGet
+	}
+	return func(ctx context.Context) error {
+		req, err := http.NewRequest(method, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			body, _ := ioutil.ReadAll(resp.Body)
+			return fmt.Errorf("%s %s: %s %s", method, url, resp.Status, tail(string(body), 512))
+		}
+		return nil
+	}, nil
+}
+
+func paramString(params map[string]interface{}, key string) string {
+	if v, ok := params[key]; ok && v != nil {
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+func paramDuration(params map[string]interface{}, key string) (time.Duration, error) {
+	s := paramString(params, key)
+	if s == "" {
+		return 0, fmt.Errorf("param %s is required", key)
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("param %s: %v", key, err)
+	}
+	return d, nil
+}
+
+func tail(s string, n int) string {
+	s = strings.TrimSpace(s)
+	if len(s) > n {
+		return "..." + s[len(s)-n:]
+	}
+	return s
+}
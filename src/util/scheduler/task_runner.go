@@ -0,0 +1,486 @@
+package scheduler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shark/src/util/dag"
+)
+
+// TaskFunc 任务的执行逻辑，ctx 被取消（fail-fast、调用方取消）时应尽快返回
+type TaskFunc func(ctx context.Context) error
+
+// AddTaskFunc 添加一个可执行的任务，fn 为 nil 时任务什么也不做，只用来汇聚依赖
+func (taskGraph *TaskGraph) AddTaskFunc(taskName string, deps []string, fn TaskFunc) bool {
+	if !taskGraph.AddTask(taskName, deps) {
+		return false
+	}
+	taskGraph.graph[taskName].Fn = fn
+	return true
+}
+
+// RunOption Run 的可选配置
+type RunOption func(*runOptions)
+
+type runOptions struct {
+	failFast bool
+	store    RunStore
+	runID    string
+	name     string
+}
+
+func newRunOptions(opts []RunOption) *runOptions {
+	o := &runOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithFailFast 任意一个任务失败后取消正在执行的任务，不再启动新任务。
+// 默认是继续执行和失败任务无关的分支，只跳过失败任务的下游
+func WithFailFast() RunOption {
+	return func(o *runOptions) {
+		o.failFast = true
+	}
+}
+
+// WithStore 把执行状态持久化到 store，每个任务状态变化都会写一次，之后可以用 Resume 从断点继续
+func WithStore(store RunStore) RunOption {
+	return func(o *runOptions) {
+		o.store = store
+	}
+}
+
+// WithRunID 指定本次执行的 id，默认按时间生成，例如 20201010T101010-123456
+func WithRunID(runID string) RunOption {
+	return func(o *runOptions) {
+		o.runID = runID
+	}
+}
+
+// WithName 图的名字，记录在执行记录里，方便按图查找执行记录
+func WithName(name string) RunOption {
+	return func(o *runOptions) {
+		o.name = name
+	}
+}
+
+// Run 按依赖关系执行整个图：满足触发规则（默认上游全部成功）的任务进入就绪队列，最多 parallelism 个任务同时执行（<=0 表示不限制）。
+// 和 GetTodoTasks/MarkTaskDone 不同，Run 不修改图本身的状态，同一个图可以多次执行。
+// 有任务失败时返回的 error 不为 nil，报告中记录了每个任务的状态和耗时
+func (taskGraph *TaskGraph) Run(ctx context.Context, parallelism int, opts ...RunOption) (*Report, error) {
+	o := newRunOptions(opts)
+	if err := taskGraph.validate(); err != nil {
+		return nil, err
+	}
+	if o.runID == "" {
+		o.runID = newRunID(time.Now())
+	}
+	r := newRunner(taskGraph, parallelism, o, nil)
+	return r.run(ctx)
+}
+
+// newRunID 时间加随机后缀。不能用 math/rand：全局的随机源默认没有播种，
+// 不同进程在同一秒启动的执行会得到相同的 runID，在共享的 store 中互相覆盖
+func newRunID(now time.Time) string {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return fmt.Sprintf("%s-%d-%d", now.Format("20060102T150405"), os.Getpid(), now.UnixNano()%1000000000)
+	}
+	return now.Format("20060102T150405") + "-" + hex.EncodeToString(b[:])
+}
+
+// Resume 从 store（必须通过 WithStore 指定）加载 runID 的执行记录，已经成功的任务不再执行，其余任务重新执行。
+// 图的定义应该和原来一致：新增的任务会被执行，删掉的任务被忽略
+func (taskGraph *TaskGraph) Resume(ctx context.Context, runID string, parallelism int, opts ...RunOption) (*Report, error) {
+	o := newRunOptions(opts)
+	if o.store == nil {
+		return nil, errors.New("scheduler: Resume requires WithStore")
+	}
+	if err := taskGraph.validate(); err != nil {
+		return nil, err
+	}
+	prev, err := o.store.LoadRun(runID)
+	if err != nil {
+		return nil, err
+	}
+	o.runID = runID
+	if o.name == "" {
+		o.name = prev.Name
+	}
+	r := newRunner(taskGraph, parallelism, o, prev)
+	return r.run(ctx)
+}
+
+// validate 检查依赖的任务是否存在以及是否有环，不修改图的状态（InitGraph 会修改，不能重复调用）
+func (taskGraph *TaskGraph) validate() error {
+	g, err := taskGraph.dag()
+	if err != nil {
+		return err
+	}
+	if _, err := g.Layers(); err != nil {
+		return fmt.Errorf("scheduler: graph has %v", strings.TrimPrefix(err.Error(), "dag: "))
+	}
+	return nil
+}
+
+// dag 用任务的依赖关系创建 dag.Graph，用于分层、查询上下游
+func (taskGraph *TaskGraph) dag() (*dag.Graph, error) {
+	m := make(map[string][]string, len(taskGraph.graph))
+	for name := range taskGraph.graph {
+		m[name] = taskGraph.deps(name)
+	}
+	g, err := dag.New(m)
+	if e, ok := err.(*dag.MissingError); ok {
+		return nil, fmt.Errorf("scheduler: task %s depends on unknown task %s", e.Node, e.Dep)
+	}
+	return g, err
+}
+
+// Upstream 任务所有直接和间接的上游，按名字排序
+func (taskGraph *TaskGraph) Upstream(taskName string) ([]string, error) {
+	g, err := taskGraph.dag()
+	if err != nil {
+		return nil, err
+	}
+	return g.Ancestors(taskName), nil
+}
+
+// Downstream 任务所有直接和间接的下游，按名字排序，部分重跑时需要和任务一起重跑
+func (taskGraph *TaskGraph) Downstream(taskName string) ([]string, error) {
+	g, err := taskGraph.dag()
+	if err != nil {
+		return nil, err
+	}
+	return g.Descendants(taskName), nil
+}
+
+// deps 任务的前置依赖，按名字排序
+func (taskGraph *TaskGraph) deps(taskName string) []string {
+	node := taskGraph.graph[taskName]
+	deps := make([]string, 0, len(node.OutEdge))
+	for dep := range node.OutEdge {
+		deps = append(deps, dep)
+	}
+	sort.Strings(deps)
+	return deps
+}
+
+// dependents 每个任务的直接下游，按名字排序
+func (taskGraph *TaskGraph) dependents() map[string][]string {
+	dependents := make(map[string][]string, len(taskGraph.graph))
+	for name, node := range taskGraph.graph {
+		for dep := range node.OutEdge {
+			dependents[dep] = append(dependents[dep], name)
+		}
+	}
+	for _, names := range dependents {
+		sort.Strings(names)
+	}
+	return dependents
+}
+
+// runner 一次执行的状态，只在 run 所在的 goroutine 中修改，任务 goroutine 通过 done channel 回报结果
+type runner struct {
+	graph       *TaskGraph
+	parallelism int
+	opts        *runOptions
+	report      *Report
+	deps        map[string][]string
+	dependents  map[string][]string
+	queued      map[string]bool // 已经进入就绪队列的任务
+	ready       []string
+	running     int
+	done        chan *TaskResult
+	failed      bool
+	resumed     []string // Resume 时已经成功、不需要再执行的任务
+}
+
+// newRunner prev 不为空时是 Resume，prev 中已经成功的任务直接标记为成功
+func newRunner(taskGraph *TaskGraph, parallelism int, opts *runOptions, prev *RunRecord) *runner {
+	if parallelism <= 0 {
+		parallelism = len(taskGraph.graph)
+	}
+	r := &runner{
+		graph:       taskGraph,
+		parallelism: parallelism,
+		opts:        opts,
+		report:      &Report{RunID: opts.runID, Name: opts.name, Tasks: make(map[string]*TaskResult, len(taskGraph.graph))},
+		deps:        make(map[string][]string, len(taskGraph.graph)),
+		dependents:  taskGraph.dependents(),
+		queued:      make(map[string]bool, len(taskGraph.graph)),
+		done:        make(chan *TaskResult),
+	}
+	for name := range taskGraph.graph {
+		r.deps[name] = taskGraph.deps(name)
+		res := &TaskResult{Name: name, State: TaskPending}
+		r.report.Tasks[name] = res
+		if prev != nil && prev.Tasks[name] != nil && prev.Tasks[name].State == TaskSuccess {
+			done := prev.Tasks[name]
+			res.State, res.Attempts, res.Start, res.End = TaskSuccess, done.Attempts, done.Start, done.End
+			if done.IsBranch || done.Branch != nil {
+				// 什么都没选中的分支任务 Branch 是空的非 nil 切片，下游要被跳过
+				res.Branch = append([]string{}, done.Branch...)
+			}
+			r.resumed = append(r.resumed, name)
+			continue
+		}
+		if len(r.deps[name]) == 0 {
+			r.ready = append(r.ready, name)
+		}
+	}
+	sort.Strings(r.ready)
+	sort.Strings(r.resumed)
+	return r
+}
+
+func (r *runner) run(parent context.Context) (*Report, error) {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	r.report.Start = time.Now()
+	r.saveRun(RunRunning)
+	// Resume 时从已经成功的任务开始推进下游
+	for _, name := range r.resumed {
+		r.report.order = append(r.report.order, name)
+		r.propagate(name)
+	}
+	for {
+		// 调用方取消或者 fail-fast 之后不再启动新任务，等正在执行的任务退出
+		for len(r.ready) > 0 && r.running < r.parallelism && ctx.Err() == nil {
+			name := r.ready[0]
+			r.ready = r.ready[1:]
+			r.start(ctx, name)
+		}
+		if r.running == 0 {
+			break
+		}
+		res := <-r.done
+		r.running--
+		r.finish(res, ctx.Err() != nil)
+		if r.failed && r.opts.failFast {
+			cancel()
+		}
+	}
+	r.report.End = time.Now()
+
+	// 没来得及执行的任务
+	for _, res := range r.report.Tasks {
+		if res.State == TaskPending {
+			res.State = TaskCanceled
+			r.saveTask(res)
+		}
+	}
+	err := r.report.Err()
+	if err != nil {
+		r.saveRun(RunFailed)
+	} else {
+		r.saveRun(RunSuccess)
+	}
+	return r.report, err
+}
+
+// saveRun / saveTask 持久化失败只打日志，不影响任务的执行
+func (r *runner) saveRun(state RunState) {
+	if r.opts.store == nil {
+		return
+	}
+	run := &RunRecord{RunID: r.report.RunID, Name: r.report.Name, State: state, Start: r.report.Start, End: r.report.End}
+	if err := r.opts.store.SaveRun(run); err != nil {
+		log.Printf("scheduler: save run %s error: %v", run.RunID, err)
+	}
+}
+
+func (r *runner) saveTask(res *TaskResult) {
+	if r.opts.store == nil {
+		return
+	}
+	if err := r.opts.store.SaveTask(r.report.RunID, newTaskRecord(res)); err != nil {
+		log.Printf("scheduler: save task %s of run %s error: %v", res.Name, r.report.RunID, err)
+	}
+}
+
+func (r *runner) start(ctx context.Context, name string) {
+	res := r.report.Tasks[name]
+	res.State = TaskRunning
+	res.Start = time.Now()
+	r.running++
+	r.saveTask(res)
+	go func() {
+		res.Err = r.execute(ctx, name, res)
+		res.End = time.Now()
+		r.done <- res
+	}()
+}
+
+// finish 任务结束，记录状态
+func (r *runner) finish(res *TaskResult, canceled bool) {
+	switch {
+	case res.Err == nil:
+		res.State = TaskSuccess
+	case canceled && errors.Is(res.Err, context.Canceled):
+		// 被 fail-fast 或者调用方取消而退出，不算任务本身失败
+		res.State = TaskCanceled
+	default:
+		res.State = TaskFailed
+		r.failed = true
+	}
+	r.report.order = append(r.report.order, res.Name)
+	r.saveTask(res)
+	r.propagate(res.Name)
+}
+
+// propagate 任务结束之后，根据下游任务的触发规则决定执行、跳过还是继续等待
+func (r *runner) propagate(name string) {
+	queue := []string{name}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		for _, next := range r.dependents[name] {
+			res := r.report.Tasks[next]
+			if res.State != TaskPending || r.queued[next] {
+				continue // OneFailed / OneSuccess 可能在所有上游结束之前就已经决定了
+			}
+			switch decision, reason := r.decide(next); decision {
+			case decisionRun:
+				r.queued[next] = true
+				r.ready = append(r.ready, next)
+			case decisionSkip:
+				// 跳过的任务也算结束，继续向下传递
+				res.State = TaskSkipped
+				res.Err = reason
+				r.report.order = append(r.report.order, next)
+				r.saveTask(res)
+				queue = append(queue, next)
+			}
+		}
+	}
+}
+
+// safeCall 执行任务，panic 转成 error，避免一个任务把整个进程带崩
+func safeCall(fn func() error) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("panic: %v\n%s", e, debug.Stack())
+		}
+	}()
+	return fn()
+}
+
+// TaskState 任务在一次执行中的状态
+type TaskState string
+
+const (
+	TaskPending  TaskState = "pending"
+	TaskRunning  TaskState = "running"
+	TaskSuccess  TaskState = "success"
+	TaskFailed   TaskState = "failed"
+	TaskSkipped  TaskState = "skipped"  // 上游失败、分支没有选中或者不满足触发规则，没有执行
+	TaskCanceled TaskState = "canceled" // fail-fast 或者调用方取消，没来得及执行
+)
+
+// TaskResult 单个任务的执行结果
+type TaskResult struct {
+	Name     string
+	State    TaskState
+	Err      error
+	Start    time.Time
+	End      time.Time
+	Attempts int      // 执行次数，包括重试
+	Branch   []string // 分支任务选中的下游
+}
+
+// Duration 任务耗时，没有执行的任务为 0
+func (res *TaskResult) Duration() time.Duration {
+	if res.Start.IsZero() || res.End.IsZero() {
+		return 0
+	}
+	return res.End.Sub(res.Start)
+}
+
+// Report 一次执行的报告
+type Report struct {
+	RunID string
+	Name  string
+	Tasks map[string]*TaskResult
+	Start time.Time
+	End   time.Time
+	order []string // 任务结束的顺序
+}
+
+// Duration 整个图的执行耗时
+func (report *Report) Duration() time.Duration {
+	return report.End.Sub(report.Start)
+}
+
+// Failed 执行失败的任务
+func (report *Report) Failed() []string {
+	var failed []string
+	for _, name := range report.order {
+		if report.Tasks[name].State == TaskFailed {
+			failed = append(failed, name)
+		}
+	}
+	return failed
+}
+
+// Err 有任务失败或者被取消时返回 error
+func (report *Report) Err() error {
+	var msgs []string
+	for _, name := range report.Failed() {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", name, report.Tasks[name].Err))
+	}
+	canceled := 0
+	for _, res := range report.Tasks {
+		if res.State == TaskCanceled {
+			canceled++
+		}
+	}
+	if len(msgs) == 0 && canceled == 0 {
+		return nil
+	}
+	if len(msgs) == 0 {
+		return fmt.Errorf("scheduler: %d task(s) canceled", canceled)
+	}
+	return fmt.Errorf("scheduler: %d task(s) failed: %s", len(msgs), strings.Join(msgs, "; "))
+}
+
+// String 按结束顺序输出每个任务的状态和耗时
+func (report *Report) String() string {
+	names := append([]string(nil), report.order...)
+	finished := make(map[string]bool, len(names))
+	for _, name := range names {
+		finished[name] = true
+	}
+	var rest []string // 没有执行的任务
+	for name := range report.Tasks {
+		if !finished[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	names = append(names, rest...)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-24s %-10s %12s  %s\n", "TASK", "STATE", "DURATION", "ERROR")
+	for _, name := range names {
+		res := report.Tasks[name]
+		errMsg := ""
+		if res.Err != nil {
+			errMsg = strings.SplitN(res.Err.Error(), "\n", 2)[0]
+		}
+		fmt.Fprintf(&b, "%-24s %-10s %12s  %s\n", name, res.State, res.Duration().Round(time.Microsecond), errMsg)
+	}
+	fmt.Fprintf(&b, "total %s", report.Duration().Round(time.Microsecond))
+	return b.String()
+}
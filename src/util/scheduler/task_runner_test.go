@@ -0,0 +1,184 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// recorder 记录任务的执行顺序和最大并发数
+type recorder struct {
+	mu       sync.Mutex
+	order    []string
+	inflight int32
+	peak     int32
+}
+
+func (rec *recorder) task(name string, d time.Duration, err error) TaskFunc {
+	return func(ctx context.Context) error {
+		n := atomic.AddInt32(&rec.inflight, 1)
+		defer atomic.AddInt32(&rec.inflight, -1)
+		for {
+			p := atomic.LoadInt32(&rec.peak)
+			if n <= p || atomic.CompareAndSwapInt32(&rec.peak, p, n) {
+				break
+			}
+		}
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		rec.mu.Lock()
+		rec.order = append(rec.order, name)
+		rec.mu.Unlock()
+		return err
+	}
+}
+
+func (rec *recorder) index(name string) int {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	for i, n := range rec.order {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// 和 Test_schedule 一样的图：job1 依赖 job2、job3、job5，job2、job3 依赖 job4
+func newTestGraph(rec *recorder, failed map[string]error) *TaskGraph {
+	var g TaskGraph
+	g = g.New()
+	add := func(name string, deps ...string) {
+		g.AddTaskFunc(name, deps, rec.task(name, 10*time.Millisecond, failed[name]))
+	}
+	add("job5")
+	add("job4")
+	add("job3", "job4")
+	add("job2", "job4")
+	add("job1", "job2", "job3", "job5")
+	return &g
+}
+
+func TestRun(t *testing.T) {
+	rec := &recorder{}
+	g := newTestGraph(rec, nil)
+	report, err := g.Run(context.Background(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dep := range []string{"job2", "job3", "job5"} {
+		if rec.index(dep) > rec.index("job1") {
+			t.Fatalf("job1 ran before its dependency %s, order %v", dep, rec.order)
+		}
+	}
+	if rec.index("job4") > rec.index("job2") || rec.index("job4") > rec.index("job3") {
+		t.Fatalf("job4 should run before job2 and job3, order %v", rec.order)
+	}
+	if rec.peak > 2 {
+		t.Fatalf("parallelism is 2, peak %d", rec.peak)
+	}
+	for name, res := range report.Tasks {
+		if res.State != TaskSuccess || res.Duration() < 10*time.Millisecond {
+			t.Fatalf("task %s: state %s duration %s", name, res.State, res.Duration())
+		}
+	}
+	if !strings.Contains(report.String(), "job1") {
+		t.Fatalf("report should contain every task:\n%s", report)
+	}
+
+	// Run 不修改图的状态，可以再执行一次
+	if _, err := g.Run(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRun_SkipDownstream(t *testing.T) {
+	boom := errors.New("boom")
+	rec := &recorder{}
+	g := newTestGraph(rec, map[string]error{"job3": boom})
+	report, err := g.Run(context.Background(), 0)
+	if err == nil || !strings.Contains(err.Error(), "job3") {
+		t.Fatalf("want error about job3 got %v", err)
+	}
+	want := map[string]TaskState{
+		"job4": TaskSuccess, "job5": TaskSuccess, "job2": TaskSuccess,
+		"job3": TaskFailed, "job1": TaskSkipped,
+	}
+	for name, state := range want {
+		if report.Tasks[name].State != state {
+			t.Fatalf("task %s want %s got %s", name, state, report.Tasks[name].State)
+		}
+	}
+	if failed := report.Failed(); len(failed) != 1 || failed[0] != "job3" {
+		t.Fatalf("failed tasks want [job3] got %v", failed)
+	}
+	if !errors.Is(report.Tasks["job3"].Err, boom) {
+		t.Fatalf("job3 error want boom got %v", report.Tasks["job3"].Err)
+	}
+}
+
+func TestRun_FailFast(t *testing.T) {
+	var g TaskGraph
+	g = g.New()
+	g.AddTaskFunc("fail", nil, func(ctx context.Context) error { return errors.New("boom") })
+	g.AddTaskFunc("slow", nil, func(ctx context.Context) error {
+		select {
+		case <-time.After(5 * time.Second):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	g.AddTaskFunc("after", []string{"slow"}, nil)
+	g.AddTaskFunc("panic", []string{"fail"}, func(ctx context.Context) error { panic("unreachable") })
+
+	start := time.Now()
+	report, err := g.Run(context.Background(), 0, WithFailFast())
+	if err == nil {
+		t.Fatal("want error")
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("fail fast should cancel the slow task")
+	}
+	want := map[string]TaskState{"fail": TaskFailed, "slow": TaskCanceled, "after": TaskSkipped, "panic": TaskSkipped}
+	for name, state := range want {
+		if report.Tasks[name].State != state {
+			t.Fatalf("task %s want %s got %s", name, state, report.Tasks[name].State)
+		}
+	}
+}
+
+func TestRun_Panic(t *testing.T) {
+	var g TaskGraph
+	g = g.New()
+	g.AddTaskFunc("panic", nil, func(ctx context.Context) error { panic("oops") })
+	report, err := g.Run(context.Background(), 1)
+	if err == nil || report.Tasks["panic"].State != TaskFailed || !strings.Contains(report.Tasks["panic"].Err.Error(), "oops") {
+		t.Fatalf("panic should be reported as failure, got %v", err)
+	}
+}
+
+func TestRun_InvalidGraph(t *testing.T) {
+	var g TaskGraph
+	g = g.New()
+	g.AddTask("a", []string{"b"})
+	g.AddTask("b", []string{"a"})
+	g.AddTask("c", nil)
+	if _, err := g.Run(context.Background(), 1); err == nil || !strings.Contains(err.Error(), "cycle a -> b -> a") {
+		t.Fatalf("want cycle error got %v", err)
+	}
+
+	var missing TaskGraph
+	missing = missing.New()
+	missing.AddTask("a", []string{"nope"})
+	if _, err := missing.Run(context.Background(), 1); err == nil || !strings.Contains(err.Error(), "unknown") {
+		t.Fatalf("want unknown task error got %v", err)
+	}
+}
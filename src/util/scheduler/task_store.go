@@ -0,0 +1,291 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrRunNotFound = errors.New("scheduler: run not found")
+
+// RunState 一次执行的整体状态
+type RunState string
+
+const (
+	RunRunning RunState = "running"
+	RunSuccess RunState = "success"
+	RunFailed  RunState = "failed"
+)
+
+// RunRecord 持久化的执行记录
+type RunRecord struct {
+	RunID string                 `json:"run_id"`
+	Name  string                 `json:"name"` // 图的名字，WithName 指定
+	State RunState               `json:"state"`
+	Start time.Time              `json:"start"`
+	End   time.Time              `json:"end"`
+	Tasks map[string]*TaskRecord `json:"tasks,omitempty"`
+}
+
+// TaskRecord 持久化的任务状态
+type TaskRecord struct {
+	Name     string    `json:"name"`
+	State    TaskState `json:"state"`
+	Attempts int       `json:"attempts"`
+	Err      string    `json:"error,omitempty"`
+	Branch   []string  `json:"branch,omitempty"`
+	IsBranch bool      `json:"is_branch,omitempty"` // 分支任务，Branch 为空表示没有选中任何下游，而不是普通任务
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+}
+
+func newTaskRecord(res *TaskResult) *TaskRecord {
+	rec := &TaskRecord{
+		Name:     res.Name,
+		State:    res.State,
+		Attempts: res.Attempts,
+		Branch:   res.Branch,
+		IsBranch: res.Branch != nil,
+		Start:    res.Start,
+		End:      res.End,
+	}
+	if res.Err != nil {
+		rec.Err = res.Err.Error()
+	}
+	return rec
+}
+
+// RunStore 执行状态的存储，每次任务状态变化都会调用 SaveTask，进程挂掉之后可以用 Resume 从断点继续
+type RunStore interface {
+	// SaveRun 保存执行本身的状态，不包括 Tasks
+	SaveRun(run *RunRecord) error
+	// SaveTask 保存一个任务的状态
+	SaveTask(runID string, task *TaskRecord) error
+	// LoadRun 加载执行记录和所有任务的状态，不存在时返回 ErrRunNotFound
+	LoadRun(runID string) (*RunRecord, error)
+	// ListRuns 所有执行记录，不包括 Tasks，按开始时间倒序
+	ListRuns() ([]*RunRecord, error)
+}
+
+// MemoryStore 内存存储，进程退出后丢失，用于测试和只需要查看执行状态的场景
+type MemoryStore struct {
+	mu   sync.RWMutex
+	runs map[string]*RunRecord
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{runs: make(map[string]*RunRecord)}
+}
+
+func (s *MemoryStore) SaveRun(run *RunRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	saveRun(s.runs, run)
+	return nil
+}
+
+func (s *MemoryStore) SaveTask(runID string, task *TaskRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return saveTask(s.runs[runID], runID, task)
+}
+
+func (s *MemoryStore) LoadRun(runID string) (*RunRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	run, ok := s.runs[runID]
+	if !ok {
+		return nil, ErrRunNotFound
+	}
+	return copyRun(run, true), nil
+}
+
+func (s *MemoryStore) ListRuns() ([]*RunRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	runs := make([]*RunRecord, 0, len(s.runs))
+	for _, run := range s.runs {
+		runs = append(runs, copyRun(run, false))
+	}
+	sortRuns(runs)
+	return runs, nil
+}
+
+// FileStore 本地文件存储，每次执行一个 json 文件，写入时先写临时文件再 rename，进程中途挂掉也不会写坏
+type FileStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) path(runID string) string {
+	return filepath.Join(s.dir, runID+".json")
+}
+
+func (s *FileStore) read(runID string) (*RunRecord, error) {
+	if strings.ContainsAny(runID, `/\`) || runID == "" || runID == "." || runID == ".." {
+		return nil, fmt.Errorf("scheduler: invalid run id %q", runID)
+	}
+	data, err := ioutil.ReadFile(s.path(runID))
+	if os.IsNotExist(err) {
+		return nil, ErrRunNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	run := new(RunRecord)
+	if err := json.Unmarshal(data, run); err != nil {
+		return nil, fmt.Errorf("scheduler: corrupted run file %s: %v", s.path(runID), err)
+	}
+	return run, nil
+}
+
+func (s *FileStore) write(run *RunRecord) error {
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path(run.RunID) + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(run.RunID))
+}
+
+func (s *FileStore) SaveRun(run *RunRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	runs := make(map[string]*RunRecord, 1)
+	if old, err := s.read(run.RunID); err == nil {
+		runs[run.RunID] = old
+	} else if err != ErrRunNotFound {
+		return err
+	}
+	saveRun(runs, run)
+	return s.write(runs[run.RunID])
+}
+
+func (s *FileStore) SaveTask(runID string, task *TaskRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run, err := s.read(runID)
+	if err != nil && err != ErrRunNotFound {
+		return err
+	}
+	if err := saveTask(run, runID, task); err != nil {
+		return err
+	}
+	return s.write(run)
+}
+
+func (s *FileStore) LoadRun(runID string) (*RunRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.read(runID)
+}
+
+func (s *FileStore) ListRuns() ([]*RunRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var runs []*RunRecord
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		run, err := s.read(strings.TrimSuffix(f.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, copyRun(run, false))
+	}
+	sortRuns(runs)
+	return runs, nil
+}
+
+func saveRun(runs map[string]*RunRecord, run *RunRecord) {
+	old, ok := runs[run.RunID]
+	saved := copyRun(run, false)
+	if ok {
+		saved.Tasks = old.Tasks
+	} else {
+		saved.Tasks = make(map[string]*TaskRecord)
+	}
+	runs[run.RunID] = saved
+}
+
+func saveTask(run *RunRecord, runID string, task *TaskRecord) error {
+	if run == nil {
+		return fmt.Errorf("scheduler: save task %s of unknown run %s", task.Name, runID)
+	}
+	if run.Tasks == nil {
+		run.Tasks = make(map[string]*TaskRecord)
+	}
+	t := *task
+	run.Tasks[task.Name] = &t
+	return nil
+}
+
+func copyRun(run *RunRecord, withTasks bool) *RunRecord {
+	c := *run
+	c.Tasks = nil
+	if withTasks {
+		c.Tasks = make(map[string]*TaskRecord, len(run.Tasks))
+		for name, task := range run.Tasks {
+			t := *task
+			c.Tasks[name] = &t
+		}
+	}
+	return &c
+}
+
+func sortRuns(runs []*RunRecord) {
+	sort.Slice(runs, func(i, j int) bool {
+		if !runs[i].Start.Equal(runs[j].Start) {
+			return runs[i].Start.After(runs[j].Start)
+		}
+		return runs[i].RunID > runs[j].RunID
+	})
+}
+
+// ClearTask 把 runID 中的任务和它的所有下游重置为 pending，之后 Resume 会重新执行这些任务，返回被重置的任务。
+// 用于修复了某个任务的 bug 或者上游数据之后重跑
+func (taskGraph *TaskGraph) ClearTask(store RunStore, runID, taskName string) ([]string, error) {
+	if _, ok := taskGraph.graph[taskName]; !ok {
+		return nil, fmt.Errorf("scheduler: unknown task %s", taskName)
+	}
+	run, err := store.LoadRun(runID)
+	if err != nil {
+		return nil, err
+	}
+	downstream, err := taskGraph.Downstream(taskName)
+	if err != nil {
+		return nil, err
+	}
+	var cleared []string
+	for _, name := range append([]string{taskName}, downstream...) {
+		if err := store.SaveTask(runID, &TaskRecord{Name: name, State: TaskPending}); err != nil {
+			return cleared, err
+		}
+		cleared = append(cleared, name)
+	}
+	// 执行记录也不再是成功状态
+	run.State = RunFailed
+	return cleared, store.SaveRun(run)
+}
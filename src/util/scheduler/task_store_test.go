@@ -0,0 +1,173 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// counter 记录每个任务执行了几次
+type counter struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (c *counter) task(name string, fail *bool) TaskFunc {
+	return func(ctx context.Context) error {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.calls == nil {
+			c.calls = make(map[string]int)
+		}
+		c.calls[name]++
+		if fail != nil && *fail {
+			return errors.New("boom")
+		}
+		return nil
+	}
+}
+
+// extract -> transform -> load -> report，audit 只依赖 extract
+func newPipeline(c *counter, fail *bool) *TaskGraph {
+	var g TaskGraph
+	g = g.New()
+	g.AddTaskFunc("extract", nil, c.task("extract", nil))
+	g.AddTaskFunc("transform", []string{"extract"}, c.task("transform", fail))
+	g.AddTaskFunc("load", []string{"transform"}, c.task("load", nil))
+	g.AddTaskFunc("report", []string{"load"}, c.task("report", nil))
+	g.AddTaskFunc("audit", []string{"extract"}, c.task("audit", nil))
+	return &g
+}
+
+func testStores(t *testing.T) map[string]RunStore {
+	dir, err := ioutil.TempDir("", "scheduler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	fs, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]RunStore{"memory": NewMemoryStore(), "file": fs}
+}
+
+func TestResume(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			c := &counter{}
+			fail := true
+			g := newPipeline(c, &fail)
+			report, err := g.Run(context.Background(), 2, WithStore(store), WithRunID("run-1"), WithName("profile_tag"))
+			if err == nil {
+				t.Fatal("transform should fail")
+			}
+			if report.RunID != "run-1" {
+				t.Fatalf("run id want run-1 got %s", report.RunID)
+			}
+
+			run, err := store.LoadRun("run-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if run.State != RunFailed || run.Name != "profile_tag" {
+				t.Fatalf("unexpected run record %+v", run)
+			}
+			want := map[string]TaskState{"extract": TaskSuccess, "audit": TaskSuccess, "transform": TaskFailed, "load": TaskSkipped, "report": TaskSkipped}
+			for task, state := range want {
+				if run.Tasks[task] == nil || run.Tasks[task].State != state {
+					t.Fatalf("persisted task %s want %s got %+v", task, state, run.Tasks[task])
+				}
+			}
+			if run.Tasks["transform"].Err != "boom" {
+				t.Fatalf("error should be persisted, got %q", run.Tasks["transform"].Err)
+			}
+
+			// 修好之后从断点继续，已经成功的任务不再执行
+			fail = false
+			if _, err := g.Resume(context.Background(), "run-1", 2, WithStore(store)); err != nil {
+				t.Fatal(err)
+			}
+			if c.calls["extract"] != 1 || c.calls["audit"] != 1 || c.calls["transform"] != 2 || c.calls["report"] != 1 {
+				t.Fatalf("unexpected calls %v", c.calls)
+			}
+			run, _ = store.LoadRun("run-1")
+			if run.State != RunSuccess || run.Name != "profile_tag" {
+				t.Fatalf("run should succeed after resume, got %+v", run)
+			}
+
+			// 清除 transform 及其下游，重跑这一段
+			cleared, err := g.ClearTask(store, "run-1", "transform")
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(cleared)
+			if strings.Join(cleared, ",") != "load,report,transform" {
+				t.Fatalf("cleared want [load report transform] got %v", cleared)
+			}
+			if _, err := g.Resume(context.Background(), "run-1", 2, WithStore(store)); err != nil {
+				t.Fatal(err)
+			}
+			if c.calls["extract"] != 1 || c.calls["transform"] != 3 || c.calls["load"] != 2 || c.calls["report"] != 2 {
+				t.Fatalf("unexpected calls after clear %v", c.calls)
+			}
+
+			runs, err := store.ListRuns()
+			if err != nil || len(runs) != 1 || runs[0].RunID != "run-1" || runs[0].Tasks != nil {
+				t.Fatalf("unexpected runs %v, err %v", runs, err)
+			}
+			if _, err := store.LoadRun("nope"); err != ErrRunNotFound {
+				t.Fatalf("want ErrRunNotFound got %v", err)
+			}
+		})
+	}
+}
+
+func TestResume_EmptyBranch(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			c := &counter{}
+			fail := true
+			var g TaskGraph
+			g = g.New()
+			g.AddBranchTask("choose", nil, func(ctx context.Context) ([]string, error) { return []string{}, nil })
+			g.AddTaskFunc("downstream", []string{"choose"}, c.task("downstream", nil))
+			g.AddTaskFunc("flaky", nil, c.task("flaky", &fail))
+			if _, err := g.Run(context.Background(), 2, WithStore(store), WithRunID("run-1")); err == nil {
+				t.Fatal("flaky should fail")
+			}
+			run, err := store.LoadRun("run-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rec := run.Tasks["choose"]; rec == nil || !rec.IsBranch || len(rec.Branch) != 0 {
+				t.Fatalf("persisted branch task %+v", rec)
+			}
+
+			// 分支任务没有选中任何下游，Resume 之后下游仍然被跳过
+			fail = false
+			report, err := g.Resume(context.Background(), "run-1", 2, WithStore(store))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.calls["downstream"] != 0 || report.Tasks["downstream"].State != TaskSkipped {
+				t.Fatalf("downstream should stay skipped, calls %v state %s", c.calls, report.Tasks["downstream"].State)
+			}
+		})
+	}
+}
+
+func TestResume_RequiresStore(t *testing.T) {
+	g := newPipeline(&counter{}, nil)
+	if _, err := g.Resume(context.Background(), "run-1", 1); err == nil {
+		t.Fatal("Resume without store should fail")
+	}
+	if _, err := g.Resume(context.Background(), "run-1", 1, WithStore(NewMemoryStore())); err != ErrRunNotFound {
+		t.Fatalf("want ErrRunNotFound got %v", err)
+	}
+}
@@ -0,0 +1,292 @@
+package skiplist
+
+import (
+	"bytes"
+	"sync"
+)
+
+// Comparator 比较两个 key：a < b 返回负数，a == b 返回 0，a > b 返回正数
+type Comparator func(a, b interface{}) int
+
+// IntComparator int 类型的 key
+func IntComparator(a, b interface{}) int {
+	x, y := a.(int), b.(int)
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// Int64Comparator int64 类型的 key
+func Int64Comparator(a, b interface{}) int {
+	x, y := a.(int64), b.(int64)
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// Float64Comparator float64 类型的 key
+func Float64Comparator(a, b interface{}) int {
+	x, y := a.(float64), b.(float64)
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// StringComparator string 类型的 key
+func StringComparator(a, b interface{}) int {
+	x, y := a.(string), b.(string)
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// BytesComparator []byte 类型的 key，按字节序
+func BytesComparator(a, b interface{}) int {
+	return bytes.Compare(a.([]byte), b.([]byte))
+}
+
+// Node OrderedMap 中的一个节点，保存在 SkipList 元素的 value 中
+type Node struct {
+	key   interface{}
+	value interface{}
+	elem  *Element
+}
+
+// Key 节点的 key
+func (n *Node) Key() interface{} {
+	return n.key
+}
+
+// Value 节点的值
+func (n *Node) Value() interface{} {
+	return n.value
+}
+
+func (n *Node) next() *Node {
+	return toNode(n.elem.next[0])
+}
+
+func (n *Node) prev() *Node {
+	return toNode(n.elem.backward)
+}
+
+func toNode(e *Element) *Node {
+	if e == nil {
+		return nil
+	}
+	return e.value.(*Node)
+}
+
+// OrderedMap 按 Comparator 排序的跳表，key 不重复。
+// 建立在 SkipList 上，排序由 cmp 决定，按排名查找和计算排名用 SkipList 每层的跨度，都是 O(log n)。
+// 并发安全，Range 和迭代器的回调中不能修改同一个 OrderedMap
+type OrderedMap struct {
+	mu   sync.RWMutex
+	cmp  Comparator
+	list *SkipList // 只使用不加锁的内部方法，由 mu 保护
+}
+
+// NewOrderedMap 创建按 cmp 排序的跳表
+func NewOrderedMap(cmp Comparator) *OrderedMap {
+	return &OrderedMap{cmp: cmp, list: NewSkipList()}
+}
+
+// before 排在 key 之前的元素
+func (m *OrderedMap) before(key interface{}) func(e *Element) bool {
+	return func(e *Element) bool { return m.cmp(toNode(e).key, key) < 0 }
+}
+
+// notAfter 排在 key 之前或者等于 key 的元素
+func (m *OrderedMap) notAfter(key interface{}) func(e *Element) bool {
+	return func(e *Element) bool { return m.cmp(toNode(e).key, key) <= 0 }
+}
+
+// Set 插入或者更新 key，key 已经存在时返回 true
+func (m *OrderedMap) Set(key, value interface{}) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	prevs, ranks, backward := m.list.getPrevElementNodes(m.before(key))
+	if n := toNode(prevs[0].next[0]); n != nil && m.cmp(n.key, key) == 0 {
+		n.value = value
+		return true
+	}
+	n := &Node{key: key, value: value}
+	n.elem = m.list.insert(prevs, ranks, backward, &Element{value: n})
+	return false
+}
+
+// Get 获取 key 对应的值
+func (m *OrderedMap) Get(key interface{}) (interface{}, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if n := m.ceiling(key); n != nil && m.cmp(n.key, key) == 0 {
+		return n.value, true
+	}
+	return nil, false
+}
+
+// Delete 删除 key，返回删除的值
+func (m *OrderedMap) Delete(key interface{}) (interface{}, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	prevs, _, _ := m.list.getPrevElementNodes(m.before(key))
+	n := toNode(prevs[0].next[0])
+	if n == nil || m.cmp(n.key, key) != 0 {
+		return nil, false
+	}
+	m.list.unlink(prevs, n.elem)
+	return n.value, true
+}
+
+// Len 节点数
+func (m *OrderedMap) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.list.length
+}
+
+// First 最小的节点，为空时返回 nil
+func (m *OrderedMap) First() *Node {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return toNode(m.list.next[0])
+}
+
+// Last 最大的节点，为空时返回 nil
+func (m *OrderedMap) Last() *Node {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	last, _ := m.list.seek(func(*Element) bool { return true })
+	return toNode(last)
+}
+
+// Ceiling 大于等于 key 的最小节点，不存在时返回 nil
+func (m *OrderedMap) Ceiling(key interface{}) *Node {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.ceiling(key)
+}
+
+// Floor 小于等于 key 的最大节点，不存在时返回 nil
+func (m *OrderedMap) Floor(key interface{}) *Node {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	last, _ := m.list.seek(m.notAfter(key))
+	return toNode(last)
+}
+
+// ceiling 调用方持有锁
+func (m *OrderedMap) ceiling(key interface{}) *Node {
+	last, _ := m.list.seek(m.before(key))
+	if last == nil {
+		return toNode(m.list.next[0])
+	}
+	return toNode(last.next[0])
+}
+
+// Rank key 的排名，从 0 开始，key 不存在时返回 -1
+func (m *OrderedMap) Rank(key interface{}) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	last, rank := m.list.seek(m.notAfter(key))
+	if last != nil && m.cmp(toNode(last).key, key) == 0 {
+		return rank - 1
+	}
+	return -1
+}
+
+// ByIndex 排名为 index（从 0 开始）的节点，越界时返回 nil
+func (m *OrderedMap) ByIndex(index int) *Node {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return toNode(m.list.byRank(index))
+}
+
+// Range 按顺序遍历 [from, to) 内的节点，from 为 nil 时从头开始，to 为 nil 时到末尾，fn 返回 false 时停止
+func (m *OrderedMap) Range(from, to interface{}, fn func(key, value interface{}) bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	x := toNode(m.list.next[0])
+	if from != nil {
+		x = m.ceiling(from)
+	}
+	for ; x != nil; x = x.next() {
+		if to != nil && m.cmp(x.key, to) >= 0 {
+			return
+		}
+		if !fn(x.key, x.value) {
+			return
+		}
+	}
+}
+
+// Iterator 正向或者反向的迭代器，每次 Next 时加读锁，遍历期间其它 goroutine 可以修改，
+// 已经删除的节点仍然可以继续向后遍历，修改是否可见不确定
+type Iterator struct {
+	m       *OrderedMap
+	node    *Node
+	pending *Node // 下一次 Next 返回的节点
+	reverse bool
+}
+
+// Iterator 从最小的 key 开始的正向迭代器
+func (m *OrderedMap) Iterator() *Iterator {
+	return &Iterator{m: m, pending: m.First()}
+}
+
+// ReverseIterator 从最大的 key 开始的反向迭代器
+func (m *OrderedMap) ReverseIterator() *Iterator {
+	return &Iterator{m: m, pending: m.Last(), reverse: true}
+}
+
+// Seek 从大于等于 key 的第一个节点开始的正向迭代器
+func (m *OrderedMap) Seek(key interface{}) *Iterator {
+	return &Iterator{m: m, pending: m.Ceiling(key)}
+}
+
+// SeekReverse 从小于等于 key 的最后一个节点开始的反向迭代器
+func (m *OrderedMap) SeekReverse(key interface{}) *Iterator {
+	return &Iterator{m: m, pending: m.Floor(key), reverse: true}
+}
+
+// Next 移动到下一个节点，没有更多节点时返回 false
+func (it *Iterator) Next() bool {
+	it.m.mu.RLock()
+	defer it.m.mu.RUnlock()
+	it.node = it.pending
+	if it.node == nil {
+		return false
+	}
+	if it.reverse {
+		it.pending = it.node.prev()
+	} else {
+		it.pending = it.node.next()
+	}
+	return true
+}
+
+// Key 当前节点的 key
+func (it *Iterator) Key() interface{} {
+	return it.node.key
+}
+
+// Value 当前节点的值
+func (it *Iterator) Value() interface{} {
+	return it.node.value
+}
@@ -0,0 +1,144 @@
+package skiplist
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestOrderedMap(t *testing.T) {
+	m := NewOrderedMap(IntComparator)
+	ref := map[int]int{}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 5000; i++ {
+		k := r.Intn(1000)
+		if r.Intn(3) == 0 {
+			_, ok := m.Delete(k)
+			if _, want := ref[k]; ok != want {
+				t.Fatalf("delete %d: got %v want %v", k, ok, want)
+			}
+			delete(ref, k)
+		} else {
+			m.Set(k, k*10)
+			ref[k] = k * 10
+		}
+	}
+	keys := make([]int, 0, len(ref))
+	for k := range ref {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	if m.Len() != len(keys) {
+		t.Fatalf("len want %d got %d", len(keys), m.Len())
+	}
+	for i, k := range keys {
+		if v, ok := m.Get(k); !ok || v != k*10 {
+			t.Fatalf("get %d: %v %v", k, v, ok)
+		}
+		if rank := m.Rank(k); rank != i {
+			t.Fatalf("rank of %d want %d got %d", k, i, rank)
+		}
+		if n := m.ByIndex(i); n == nil || n.Key() != k {
+			t.Fatalf("index %d want %d got %v", i, k, n)
+		}
+	}
+	if m.ByIndex(len(keys)) != nil || m.Rank(-1) != -1 {
+		t.Fatal("out of range lookups should miss")
+	}
+
+	// 正向、反向迭代
+	i := 0
+	for it := m.Iterator(); it.Next(); i++ {
+		if it.Key() != keys[i] {
+			t.Fatalf("iterator at %d want %d got %v", i, keys[i], it.Key())
+		}
+	}
+	i = len(keys) - 1
+	for it := m.ReverseIterator(); it.Next(); i-- {
+		if it.Key() != keys[i] {
+			t.Fatalf("reverse iterator at %d want %d got %v", i, keys[i], it.Key())
+		}
+	}
+	if i != -1 {
+		t.Fatalf("reverse iterator stopped early at %d", i)
+	}
+}
+
+func TestOrderedMapSeek(t *testing.T) {
+	m := NewOrderedMap(StringComparator)
+	for _, k := range []string{"b", "d", "f", "h"} {
+		m.Set(k, nil)
+	}
+	if n := m.Floor("e"); n.Key() != "d" {
+		t.Fatalf("floor(e) want d got %v", n.Key())
+	}
+	if n := m.Ceiling("e"); n.Key() != "f" {
+		t.Fatalf("ceiling(e) want f got %v", n.Key())
+	}
+	if m.Floor("a") != nil || m.Ceiling("i") != nil {
+		t.Fatal("floor/ceiling outside the range should be nil")
+	}
+	var got []interface{}
+	for it := m.Seek("c"); it.Next(); {
+		got = append(got, it.Key())
+	}
+	if len(got) != 3 || got[0] != "d" {
+		t.Fatalf("seek(c) got %v", got)
+	}
+	got = nil
+	for it := m.SeekReverse("g"); it.Next(); {
+		got = append(got, it.Key())
+	}
+	if len(got) != 3 || got[0] != "f" || got[2] != "b" {
+		t.Fatalf("seek reverse(g) got %v", got)
+	}
+	got = nil
+	m.Range("c", "h", func(k, v interface{}) bool {
+		got = append(got, k)
+		return true
+	})
+	if len(got) != 2 || got[0] != "d" || got[1] != "f" {
+		t.Fatalf("range [c, h) got %v", got)
+	}
+	if m.First().Key() != "b" || m.Last().Key() != "h" {
+		t.Fatal("first/last mismatch")
+	}
+}
+
+func TestOrderedMapConcurrent(t *testing.T) {
+	m := NewOrderedMap(IntComparator)
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				m.Set(g*1000+i, i)
+				if i%2 == 0 {
+					m.Delete(g*1000 + i)
+				}
+				for it := m.Iterator(); it.Next() && it.Key().(int) < 10; {
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if m.Len() != 2000 {
+		t.Fatalf("want 2000 got %d", m.Len())
+	}
+}
+
+func TestSkipListV2(t *testing.T) {
+	list := NewSkipList2(8)
+	for _, k := range []int{5, 1, 3, 9, 7} {
+		list.Add(k, k*10)
+	}
+	list.Add(3, 33)
+	if list.Length() != 5 || list.Find(3) != 33 || list.Find(9) != 90 {
+		t.Fatalf("len %d find(3)=%v find(9)=%v", list.Length(), list.Find(3), list.Find(9))
+	}
+	if !list.Remove(5) || list.Remove(5) || list.Find(5) != nil || list.Length() != 4 {
+		t.Fatal("remove 5 failed")
+	}
+}
@@ -32,15 +32,24 @@ const (
 )
 
 // elementNode 数组指针，指向元素
+// span[i] 是 next[i] 跨过的元素个数，即两者在最底层的距离，next[i] 为 nil 时是到末尾的元素个数，用来计算排名
 type elementNode struct {
 	next []*Element
+	span []int
 }
 
 // Element 跳转表数据结构 skipList里面的一个元素结构
 type Element struct {
 	elementNode
-	key   float64     // 用以排序和判断大小的关键字
-	value interface{} // 定义元素 附加
+	key      float64     // 用以排序和判断大小的关键字
+	member   string      // key 相同时按 member 排序，只有 ZSet 使用，SkipList 自己的接口中总是空串
+	value    interface{} // 定义元素 附加
+	backward *Element    // 最底层的前一个元素，用于反向遍历
+}
+
+// less 元素是否排在 (key, member) 之前
+func (e *Element) less(key float64, member string) bool {
+	return e.key < key || e.key == key && e.member < member
 }
 
 // Key 获取key的值
@@ -53,7 +62,8 @@ func (e *Element) Value() interface{} {
 	return e.value
 }
 
-// 定义整体的SkipList
+// 定义整体的SkipList，只支持 float64 类型的 key，需要其它类型的 key、迭代器时使用 OrderedMap。
+// 每层记录跨度，Rank 和 GetByRank 都是 O(log n)
 type SkipList struct {
 	elementNode              // 指针数组
 	maxLevel    int          // 最大深度
@@ -64,6 +74,7 @@ type SkipList struct {
 	mutex       sync.RWMutex // 保证线程安全
 	// prevNodesCache 的作用在哪里，这就是用来插入新元素的时候把元素中的指针数组把前后相同层的元素连接起来
 	prevNodesCache []*elementNode // 缓存
+	rankCache      []int          // prevNodesCache 中每个节点的排名
 }
 
 // NewSkipList 新建跳转表
@@ -87,8 +98,9 @@ func NewWithMaxLevel(maxLevel int) *SkipList {
 	}
 
 	return &SkipList{
-		elementNode:    elementNode{next: make([]*Element, maxLevel)}, // 需要初始化指针数组，指针数组的长度就是跳表的层次
+		elementNode:    elementNode{next: make([]*Element, maxLevel), span: make([]int, maxLevel)}, // 需要初始化指针数组，指针数组的长度就是跳表的层次
 		prevNodesCache: make([]*elementNode, maxLevel),
+		rankCache:      make([]int, maxLevel),
 		maxLevel:       maxLevel,
 		randSource:     rand.New(rand.NewSource(time.Now().UnixNano())),
 		probability:    DefaultProbability,
@@ -118,24 +130,38 @@ func (list *SkipList) SetProbability(newProbability float64) {
 func (list *SkipList) Set(key float64, value interface{}) *Element {
 	list.mutex.Lock()
 	defer list.mutex.Unlock() // 线程安全
+	return list.set(key, "", value)
+}
 
+func (list *SkipList) set(key float64, member string, value interface{}) *Element {
 	var element *Element
-	prevs := list.getPrevElementNodes(key)
-	if element = prevs[0].next[0]; element != nil && key == element.key {
+	prevs, ranks, backward := list.getPrevElementNodes(func(e *Element) bool { return e.less(key, member) })
+	if element = prevs[0].next[0]; element != nil && key == element.key && member == element.member {
 		element.value = value
 		return element
 	}
+	return list.insert(prevs, ranks, backward, &Element{key: key, member: member, value: value})
+}
 
-	element = &Element{
-		elementNode: elementNode{next: make([]*Element, list.randLevel())},
-		key:         key,
-		value:       value,
-	}
+// insert 把 element 插入到 getPrevElementNodes 找到的位置，随机分配层数
+func (list *SkipList) insert(prevs []*elementNode, ranks []int, backward *Element, element *Element) *Element {
+	level := list.randLevel()
+	element.elementNode = elementNode{next: make([]*Element, level), span: make([]int, level)}
+	element.backward = backward
 	list.length++
 
 	for i := range element.next { // 插入数据
 		element.next[i] = prevs[i].next[i]
 		prevs[i].next[i] = element // 记录位置
+		// ranks[0] 是新元素前一个元素的排名，新元素把原来的跨度分成两段
+		element.span[i] = prevs[i].span[i] - (ranks[0] - ranks[i])
+		prevs[i].span[i] = ranks[0] - ranks[i] + 1
+	}
+	for i := level; i < list.maxLevel; i++ { // 更高的层跨过了新元素
+		prevs[i].span[i]++
+	}
+	if element.next[0] != nil {
+		element.next[0].backward = element
 	}
 
 	return element
@@ -175,22 +201,95 @@ func (list *SkipList) Get(key float64) *Element {
 func (list *SkipList) Remove(key float64) *Element {
 	list.mutex.Lock()
 	defer list.mutex.Unlock() // 线程安全
+	return list.remove(key, "")
+}
+
+func (list *SkipList) remove(key float64, member string) *Element {
 	// 最核心代码位置：
 	var element *Element
-	prevs := list.getPrevElementNodes(key)
+	prevs, _, _ := list.getPrevElementNodes(func(e *Element) bool { return e.less(key, member) })
 	// 在 Set 函数中拿到 prevs 这样的一个数组后，在查找元素12中就可以通过prevs[0].next[0]可以索引到元素12，判断是否找到元素
-	if element = prevs[0].next[0]; element != nil && key == element.key {
-		for k, v := range element.next {
-			prevs[k].next[k] = v // 删除
+	if element = prevs[0].next[0]; element != nil && key == element.key && member == element.member {
+		list.unlink(prevs, element)
+		return element
+	}
+
+	return nil
+}
+
+// unlink 删除 prevs[0].next[0] 指向的 element。element 自己的指针不变，正在遍历它的迭代器可以继续向后走
+func (list *SkipList) unlink(prevs []*elementNode, element *Element) {
+	for k := range prevs {
+		if k < len(element.next) {
+			prevs[k].span[k] += element.span[k] - 1
+			prevs[k].next[k] = element.next[k] // 删除
+		} else {
+			prevs[k].span[k]--
 		}
+	}
+	if element.next[0] != nil {
+		element.next[0].backward = element.backward
+	}
+	list.length--
+}
 
-		list.length--
-		return element
+// Rank key 的排名，从 0 开始，不存在时返回 -1
+func (list *SkipList) Rank(key float64) int {
+	list.mutex.RLock()
+	defer list.mutex.RUnlock()
+	return list.rank(key, "")
+}
+
+func (list *SkipList) rank(key float64, member string) int {
+	element, rank := list.seek(func(e *Element) bool {
+		return e.less(key, member) || e.key == key && e.member == member
+	})
+	if element == nil || element.key != key || element.member != member {
+		return -1
 	}
+	return rank - 1
+}
 
+// GetByRank 排名为 rank 的元素，从 0 开始，超出范围时返回 nil
+func (list *SkipList) GetByRank(rank int) *Element {
+	list.mutex.RLock()
+	defer list.mutex.RUnlock()
+	return list.byRank(rank)
+}
+
+// byRank 沿着跨度向右走，走过的跨度之和等于 rank+1 时就是要找的元素
+func (list *SkipList) byRank(rank int) *Element {
+	if rank < 0 || rank >= list.length {
+		return nil
+	}
+	var prev *elementNode = &list.elementNode
+	traversed := 0
+	for i := list.maxLevel - 1; i >= 0; i-- {
+		for next := prev.next[i]; next != nil && traversed+prev.span[i] <= rank+1; next = prev.next[i] {
+			traversed += prev.span[i]
+			if traversed == rank+1 {
+				return next
+			}
+			prev = &next.elementNode
+		}
+	}
 	return nil
 }
 
+// seek 从最顶层开始查找，before 对排在目标之前的元素返回 true，要求 before 为 true 的元素都排在为 false 的元素之前。
+// 返回最后一个 before 为 true 的元素和它的排名（从 1 开始），没有时返回 nil 和 0
+func (list *SkipList) seek(before func(e *Element) bool) (last *Element, rank int) {
+	var prev *elementNode = &list.elementNode
+	for i := list.maxLevel - 1; i >= 0; i-- {
+		for next := prev.next[i]; next != nil && before(next); next = prev.next[i] {
+			rank += prev.span[i]
+			last = next
+			prev = &next.elementNode
+		}
+	}
+	return last, rank
+}
+
 // 用来记录我们在查找 key 的中途会经过的元素的指针数组
 // 在上面的查询元素12的例子中，prevs 记录的值分别就是 :
 //
@@ -198,17 +297,25 @@ func (list *SkipList) Remove(key float64) *Element {
 // prevs[2] == 6.elementCode
 // prevs[1] == 9.elecmentCode
 // prevs[0] == 9.elementCode
-func (list *SkipList) getPrevElementNodes(key float64) []*elementNode {
+//
+// before 和 seek 的相同，对排在目标之前的元素返回 true。
+// ranks[i] 是 prevs[i] 的排名（从 1 开始，头结点为 0），backward 是最底层的前一个元素，头结点时为 nil
+func (list *SkipList) getPrevElementNodes(before func(e *Element) bool) (prevs []*elementNode, ranks []int, backward *Element) {
 	var prev *elementNode = &list.elementNode // 保存前置结点
 	var next *Element
-	prevs := list.prevNodesCache // 缓冲集合
+	prevs = list.prevNodesCache // 缓冲集合
+	ranks = list.rankCache
+	rank := 0
 	for i := list.maxLevel - 1; i >= 0; i-- {
 		next = prev.next[i] // 循环跳到下一个
-		for next != nil && key > next.key {
+		for next != nil && before(next) {
+			rank += prev.span[i]
+			backward = next
 			prev = &next.elementNode // 继续向右边找。。
 			next = next.next[i]
 		}
 		prevs[i] = prev
+		ranks[i] = rank
 	}
-	return prevs
+	return prevs, ranks, backward
 }
@@ -12,7 +12,7 @@ type SkipListNode struct {
 	next []*SkipListNode // 指针切片 ，比如版本2对应的图中 Head指针对应的切片为：[5, 3, 1, 1]
 }
 
-// 定义跳跃表结构体
+// 定义跳跃表结构体，只支持 int 类型的 key，新代码使用 OrderedMap
 type SkipListV2 struct {
 	head   *SkipListNode // 头节点
 	tail   *SkipListNode // 尾节点
@@ -64,7 +64,7 @@ func (list *SkipListV2) Add(key int, data interface{}) {
 		for {
 			node1 := node.next[index]
 			if node1 == list.tail || node1.key > key {
-				update[index] = node1 // 找到第一个插入位置
+				update[index] = node // 找到插入位置的前一个节点
 				break
 			} else if node1.key == key {
 				// update
@@ -89,7 +89,7 @@ func (list *SkipListV2) Remove(key int) bool {
 	node := list.head
 	remove := make([]*SkipListNode, list.level, list.level)
 	var target *SkipListNode
-	for index := len(node.next) - 1; index >= 0; index++ {
+	for index := len(node.next) - 1; index >= 0; index-- {
 		for {
 
 			node1 := node.next[index]
@@ -119,7 +119,7 @@ func (list *SkipListV2) Remove(key int) bool {
 
 // 查找
 func (list *SkipListV2) Find(key int) interface{} {
-	list.mut.RUnlock()
+	list.mut.RLock()
 	defer list.mut.RUnlock()
 	node := list.head
 	for index := len(node.next) - 1; index >= 0; index-- {
@@ -141,7 +141,7 @@ func (list *SkipListV2) Find(key int) interface{} {
 // 获取数据总量的方法
 func (list *SkipListV2) Length() int {
 	// 允许多个线程同时读，但只要有一个线程在写，其他线程就必须等待：
-	list.mut.RUnlock()
+	list.mut.RLock()
 	defer list.mut.RUnlock()
 	return list.length
 }
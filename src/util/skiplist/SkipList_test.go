@@ -0,0 +1,48 @@
+package skiplist
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestSkipListRank(t *testing.T) {
+	list := NewSkipList()
+	model := map[float64]bool{}
+	r := rand.New(rand.NewSource(3))
+	for i := 0; i < 2000; i++ {
+		key := float64(r.Intn(300))
+		if r.Intn(3) == 0 {
+			list.Remove(key)
+			delete(model, key)
+		} else {
+			list.Set(key, i)
+			model[key] = true
+		}
+		if i%100 != 0 {
+			continue
+		}
+		var keys []float64
+		for k := range model {
+			keys = append(keys, k)
+		}
+		sort.Float64s(keys)
+		for rank, k := range keys {
+			if got := list.Rank(k); got != rank {
+				t.Fatalf("rank of %v want %d got %d", k, rank, got)
+			}
+			if e := list.GetByRank(rank); e == nil || e.Key() != k {
+				t.Fatalf("element at rank %d want %v got %v", rank, k, e)
+			}
+		}
+		if list.Rank(-1) != -1 || list.GetByRank(len(keys)) != nil {
+			t.Fatal("missing key should have no rank")
+		}
+		// 反向指针和正向链表一致
+		for e := list.GetByRank(len(keys) - 1); e != nil && e.backward != nil; e = e.backward {
+			if e.backward.next[0] != e {
+				t.Fatalf("backward of %v is broken", e.Key())
+			}
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package skiplist
+
+import (
+	"math"
+	"sync"
+)
+
+// ZSet 进程内的有序集合，语义参考 redis 的 ZSET：member -> score 的 map 加上按 (score, member) 排序的 SkipList，
+// SkipList 每层记录跨度，排名相关的操作都是 O(log n)
+type ZSet struct {
+	mu   sync.RWMutex
+	dict map[string]float64
+	zsl  *SkipList // 只使用不加锁的内部方法，由 mu 保护
+}
+
+// ZMember 成员和分数
+type ZMember struct {
+	Member string
+	Score  float64
+}
+
+// ZAddFlag ZAdd 的选项，可以组合
+type ZAddFlag int
+
+const (
+	// ZAddNX 只添加新成员，不更新已有成员
+	ZAddNX ZAddFlag = 1 << iota
+	// ZAddXX 只更新已有成员，不添加新成员
+	ZAddXX
+	// ZAddIncr 把 Score 加到原来的分数上（不存在时从 0 开始）
+	ZAddIncr
+)
+
+// ScoreRange 分数区间，MinEx/MaxEx 为 true 时不包含端点，无穷用 math.Inf
+type ScoreRange struct {
+	Min, Max     float64
+	MinEx, MaxEx bool
+}
+
+// LexRange 成员的字典序区间，只在所有成员分数相同时有意义。MinInf/MaxInf 为 true 时表示 redis 的 "-"/"+"
+type LexRange struct {
+	Min, Max       string
+	MinEx, MaxEx   bool
+	MinInf, MaxInf bool
+}
+
+// NewZSet 创建空的有序集合
+func NewZSet() *ZSet {
+	return &ZSet{dict: make(map[string]float64), zsl: NewSkipList()}
+}
+
+// ZAdd 添加或者更新成员，返回新添加的成员数。同时设置 ZAddNX 和 ZAddXX 时不做任何修改
+func (z *ZSet) ZAdd(flags ZAddFlag, members ...ZMember) int {
+	if flags&ZAddNX != 0 && flags&ZAddXX != 0 {
+		return 0
+	}
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	added := 0
+	for _, m := range members {
+		old, exists := z.dict[m.Member]
+		if exists && flags&ZAddNX != 0 || !exists && flags&ZAddXX != 0 {
+			continue
+		}
+		score := m.Score
+		if flags&ZAddIncr != 0 {
+			score += old
+		}
+		if math.IsNaN(score) {
+			continue
+		}
+		if exists {
+			if old == score {
+				continue
+			}
+			z.zsl.remove(old, m.Member)
+		} else {
+			added++
+		}
+		z.dict[m.Member] = score
+		z.zsl.set(score, m.Member, nil)
+	}
+	return added
+}
+
+// ZIncrBy 成员的分数加上 delta，不存在时从 0 开始，返回新的分数
+func (z *ZSet) ZIncrBy(member string, delta float64) float64 {
+	z.ZAdd(ZAddIncr, ZMember{Member: member, Score: delta})
+	score, _ := z.ZScore(member)
+	return score
+}
+
+// ZRem 删除成员，返回删除的个数
+func (z *ZSet) ZRem(members ...string) int {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	removed := 0
+	for _, member := range members {
+		if score, ok := z.dict[member]; ok {
+			delete(z.dict, member)
+			z.zsl.remove(score, member)
+			removed++
+		}
+	}
+	return removed
+}
+
+// ZScore 成员的分数
+func (z *ZSet) ZScore(member string) (float64, bool) {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	score, ok := z.dict[member]
+	return score, ok
+}
+
+// ZCard 成员数
+func (z *ZSet) ZCard() int {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	return len(z.dict)
+}
+
+// ZRank 按分数从小到大的排名，从 0 开始
+func (z *ZSet) ZRank(member string) (int, bool) {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	score, ok := z.dict[member]
+	if !ok {
+		return 0, false
+	}
+	return z.zsl.rank(score, member), true
+}
+
+// ZRevRank 按分数从大到小的排名，从 0 开始
+func (z *ZSet) ZRevRank(member string) (int, bool) {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	score, ok := z.dict[member]
+	if !ok {
+		return 0, false
+	}
+	return len(z.dict) - 1 - z.zsl.rank(score, member), true
+}
+
+// ZRange 排名在 [start, stop] 之间的成员，负数表示从末尾倒数，-1 为最后一个
+func (z *ZSet) ZRange(start, stop int) []ZMember {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	n := len(z.dict)
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop {
+		return nil
+	}
+	result := make([]ZMember, 0, stop-start+1)
+	for e := z.zsl.byRank(start); len(result) < stop-start+1; e = e.next[0] {
+		result = append(result, toMember(e))
+	}
+	return result
+}
+
+// ZRangeByScore 分数在 r 内的成员，按分数从小到大，跳过前 offset 个，最多返回 count 个（count < 0 时不限制）
+func (z *ZSet) ZRangeByScore(r ScoreRange, offset, count int) []ZMember {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	var result []ZMember
+	for e := z.zsl.first(r); count != 0 && e != nil; e = e.next[0] {
+		m := toMember(e)
+		if !r.lteMax(m.Score) {
+			break
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		result = append(result, m)
+		count--
+	}
+	return result
+}
+
+// ZRevRangeByScore 和 ZRangeByScore 相同，按分数从大到小
+func (z *ZSet) ZRevRangeByScore(r ScoreRange, offset, count int) []ZMember {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	var result []ZMember
+	last, _ := z.zsl.seek(func(e *Element) bool { return r.lteMax(e.key) })
+	for e := last; count != 0 && e != nil; e = e.backward {
+		m := toMember(e)
+		if !r.gteMin(m.Score) {
+			break
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		result = append(result, m)
+		count--
+	}
+	return result
+}
+
+// ZCount 分数在 r 内的成员数，通过两端的排名计算
+func (z *ZSet) ZCount(r ScoreRange) int {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	_, below := z.zsl.seek(func(e *Element) bool { return !r.gteMin(e.key) })
+	_, upTo := z.zsl.seek(func(e *Element) bool { return r.lteMax(e.key) })
+	if upTo < below {
+		return 0
+	}
+	return upTo - below
+}
+
+// ZRangeByLex 成员在字典序区间 r 内的成员，跳过前 offset 个，最多返回 count 个（count < 0 时不限制）。
+// 和 redis 一样要求所有成员分数相同，否则结果未定义
+func (z *ZSet) ZRangeByLex(r LexRange, offset, count int) []ZMember {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	var result []ZMember
+	last, _ := z.zsl.seek(func(e *Element) bool {
+		return !r.MinInf && (e.member < r.Min || r.MinEx && e.member == r.Min)
+	})
+	e := z.zsl.next[0]
+	if last != nil {
+		e = last.next[0]
+	}
+	for ; count != 0 && e != nil; e = e.next[0] {
+		m := toMember(e)
+		if !r.MaxInf && (m.Member > r.Max || r.MaxEx && m.Member == r.Max) {
+			break
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		result = append(result, m)
+		count--
+	}
+	return result
+}
+
+// ZPopMin 删除并返回分数最小的 count 个成员
+func (z *ZSet) ZPopMin(count int) []ZMember {
+	return z.pop(count, func(zsl *SkipList) *Element { return zsl.next[0] })
+}
+
+// ZPopMax 删除并返回分数最大的 count 个成员，按分数从大到小
+func (z *ZSet) ZPopMax(count int) []ZMember {
+	return z.pop(count, func(zsl *SkipList) *Element {
+		last, _ := zsl.seek(func(*Element) bool { return true })
+		return last
+	})
+}
+
+func (z *ZSet) pop(count int, next func(*SkipList) *Element) []ZMember {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	var result []ZMember
+	for ; count > 0; count-- {
+		e := next(z.zsl)
+		if e == nil {
+			break
+		}
+		m := toMember(e)
+		z.zsl.remove(e.key, e.member)
+		delete(z.dict, m.Member)
+		result = append(result, m)
+	}
+	return result
+}
+
+func toMember(e *Element) ZMember {
+	return ZMember{Member: e.member, Score: e.key}
+}
+
+// first 区间内分数最小的元素，没有时返回 nil 或者超出上界的元素
+func (zsl *SkipList) first(r ScoreRange) *Element {
+	last, _ := zsl.seek(func(e *Element) bool { return !r.gteMin(e.key) })
+	if last == nil {
+		return zsl.next[0]
+	}
+	return last.next[0]
+}
+
+func (r ScoreRange) gteMin(score float64) bool {
+	if r.MinEx {
+		return score > r.Min
+	}
+	return score >= r.Min
+}
+
+func (r ScoreRange) lteMax(score float64) bool {
+	if r.MaxEx {
+		return score < r.Max
+	}
+	return score <= r.Max
+}
@@ -0,0 +1,149 @@
+package skiplist
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// naiveZSet 用 map 加排序实现的参照模型
+type naiveZSet map[string]float64
+
+func (n naiveZSet) sorted() []ZMember {
+	var ms []ZMember
+	for m, s := range n {
+		ms = append(ms, ZMember{Member: m, Score: s})
+	}
+	sort.Slice(ms, func(i, j int) bool {
+		if ms[i].Score != ms[j].Score {
+			return ms[i].Score < ms[j].Score
+		}
+		return ms[i].Member < ms[j].Member
+	})
+	return ms
+}
+
+func (n naiveZSet) byScore(r ScoreRange) []ZMember {
+	var result []ZMember
+	for _, m := range n.sorted() {
+		if r.gteMin(m.Score) && r.lteMax(m.Score) {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+func TestZSetAgainstModel(t *testing.T) {
+	z := NewZSet()
+	model := naiveZSet{}
+	r := rand.New(rand.NewSource(7))
+	for i := 0; i < 3000; i++ {
+		member := fmt.Sprintf("m%03d", r.Intn(200))
+		score := float64(r.Intn(50))
+		switch r.Intn(6) {
+		case 0:
+			z.ZRem(member)
+			delete(model, member)
+		case 1:
+			z.ZAdd(ZAddIncr, ZMember{member, score})
+			model[member] += score
+		case 2:
+			z.ZAdd(ZAddXX, ZMember{member, score})
+			if _, ok := model[member]; ok {
+				model[member] = score
+			}
+		case 3:
+			z.ZAdd(ZAddNX, ZMember{member, score})
+			if _, ok := model[member]; !ok {
+				model[member] = score
+			}
+		default:
+			z.ZAdd(0, ZMember{member, score})
+			model[member] = score
+		}
+
+		if i%100 != 0 {
+			continue
+		}
+		all := model.sorted()
+		if z.ZCard() != len(all) {
+			t.Fatalf("card want %d got %d", len(all), z.ZCard())
+		}
+		if got := z.ZRange(0, -1); len(all) > 0 && !reflect.DeepEqual(got, all) {
+			t.Fatalf("range mismatch\nwant %v\ngot  %v", all, got)
+		}
+		for rank, m := range all {
+			if got, ok := z.ZRank(m.Member); !ok || got != rank {
+				t.Fatalf("rank of %s want %d got %d", m.Member, rank, got)
+			}
+			if got, _ := z.ZRevRank(m.Member); got != len(all)-1-rank {
+				t.Fatalf("revrank of %s want %d got %d", m.Member, len(all)-1-rank, got)
+			}
+		}
+		lo, hi := float64(r.Intn(60)), float64(r.Intn(120))
+		sr := ScoreRange{Min: lo, Max: hi, MinEx: r.Intn(2) == 0, MaxEx: r.Intn(2) == 0}
+		want := model.byScore(sr)
+		if got := z.ZCount(sr); got != len(want) {
+			t.Fatalf("count %+v want %d got %d", sr, len(want), got)
+		}
+		if got := z.ZRangeByScore(sr, 0, -1); len(want) > 0 && !reflect.DeepEqual(got, want) {
+			t.Fatalf("range by score %+v\nwant %v\ngot  %v", sr, want, got)
+		}
+		if len(want) > 3 {
+			if got := z.ZRangeByScore(sr, 1, 2); !reflect.DeepEqual(got, want[1:3]) {
+				t.Fatalf("limit want %v got %v", want[1:3], got)
+			}
+			if got := z.ZRevRangeByScore(sr, 0, 1); !reflect.DeepEqual(got, want[len(want)-1:]) {
+				t.Fatalf("rev range want %v got %v", want[len(want)-1:], got)
+			}
+		}
+	}
+}
+
+func TestZSetLexAndPop(t *testing.T) {
+	z := NewZSet()
+	for _, m := range []string{"a", "b", "c", "d", "e"} {
+		z.ZAdd(0, ZMember{m, 0})
+	}
+	members := func(ms []ZMember) string {
+		s := ""
+		for _, m := range ms {
+			s += m.Member
+		}
+		return s
+	}
+	cases := []struct {
+		r    LexRange
+		want string
+	}{
+		{LexRange{MinInf: true, MaxInf: true}, "abcde"},
+		{LexRange{Min: "b", Max: "d"}, "bcd"},
+		{LexRange{Min: "b", Max: "d", MinEx: true, MaxEx: true}, "c"},
+		{LexRange{MinInf: true, Max: "c", MaxEx: true}, "ab"},
+		{LexRange{Min: "bb", MaxInf: true}, "cde"},
+	}
+	for _, c := range cases {
+		if got := members(z.ZRangeByLex(c.r, 0, -1)); got != c.want {
+			t.Fatalf("lex %+v want %s got %s", c.r, c.want, got)
+		}
+	}
+	if got := members(z.ZRangeByLex(LexRange{MinInf: true, MaxInf: true}, 1, 2)); got != "bc" {
+		t.Fatalf("lex limit want bc got %s", got)
+	}
+
+	if score := z.ZIncrBy("a", 10); score != 10 {
+		t.Fatalf("incr want 10 got %v", score)
+	}
+	if got := members(z.ZPopMax(2)); got != "ae" {
+		t.Fatalf("pop max want ae got %s", got)
+	}
+	if got := members(z.ZPopMin(10)); got != "bcd" || z.ZCard() != 0 {
+		t.Fatalf("pop min want bcd got %s", got)
+	}
+	if z.ZAdd(ZAddNX|ZAddXX, ZMember{"x", 1}) != 0 || z.ZAdd(0, ZMember{"x", math.NaN()}) != 0 {
+		t.Fatal("NX|XX and NaN should not add")
+	}
+}
@@ -1,7 +1,7 @@
 package wokerpool
 
 import (
-	"scaffold/src/util/queue"
+	"github.com/shark/src/util/queue"
 	"sync"
 	"time"
 )
@@ -10,12 +10,13 @@ import (
 type TaskHandler func() error
 
 // WorkPool serves incoming connections via a pool of workers
+//
+// Deprecated: 使用 github.com/shark/src/util/workerpool.Pool，Wait 不再空转，单个任务出错不会关闭整个池子
 type WorkPool struct {
 	closed       int32
-	isQueTask    int32         // Mark whether queue retrieval is task. 标记是否队列取出任务
 	errChan      chan error    // error chan
 	timeout      time.Duration // max timeout
 	wg           sync.WaitGroup
 	task         chan TaskHandler
-	waitingQueue *queue.MyQueue
+	waitingQueue *queue.BoundedQueue
 }
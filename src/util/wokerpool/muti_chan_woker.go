@@ -14,6 +14,7 @@ import (
      步骤B和C依赖步骤A，步骤D依赖B和C。为了提高性能，故实现任务之间的并发。
 2、具体实现
    用四个队列分别完成任务中的每个步骤，队列之间是并发的，队列中可以顺序执行也可以并发执行（比如queue_B）
+3、通用的实现见 src/util/pipeline，支持每个阶段的并发数、按数据汇合（D 等待 B 和 C）、出错时取消所有阶段
 */
 
 //
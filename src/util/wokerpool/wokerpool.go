@@ -3,8 +3,7 @@ package wokerpool
 import (
 	"context"
 	"fmt"
-	"runtime"
-	"scaffold/src/util/queue"
+	"github.com/shark/src/util/queue"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -12,6 +11,14 @@ import (
 
 // New new workpool and set the max number of concurrencies
 func New(max int) *WorkPool { // 注册工作池，并设置最大并发数
+	return NewWithQueue(max, defaultQueueSize)
+}
+
+// defaultQueueSize New 的等待队列容量
+const defaultQueueSize = 1024
+
+// NewWithQueue 注册工作池，并设置最大并发数和等待队列的容量
+func NewWithQueue(max, queueSize int) *WorkPool {
 	if max < 1 {
 		max = 1
 	}
@@ -19,7 +26,7 @@ func New(max int) *WorkPool { // 注册工作池，并设置最大并发数
 	p := &WorkPool{
 		task:         make(chan TaskHandler, 2*max),
 		errChan:      make(chan error, 1),
-		waitingQueue: queue.New(), // 线程安全的双buffer阻塞队列
+		waitingQueue: queue.NewBounded(queueSize), // 有界阻塞队列，满了之后 Do 阻塞
 	}
 	// 开启任务循环逻辑♻️
 	go p.loop(max)
@@ -32,11 +39,12 @@ func (p *WorkPool) SetTimeout(timeout time.Duration) { // 设置超时时间
 }
 
 // Do Add to the workpool and return immediately
-func (p *WorkPool) Do(fn TaskHandler) { // 添加到工作池，并立即返回
+// 添加到工作池，队列满时阻塞。Wait 或者关闭之后提交的任务不会执行，返回 queue.ErrClosed
+func (p *WorkPool) Do(fn TaskHandler) error {
 	if p.IsClosed() { // 已关闭
-		return
+		return queue.ErrClosed
 	}
-	p.waitingQueue.Push(fn)
+	return p.waitingQueue.Push(fn)
 	// p.task <- fn
 }
 
@@ -47,19 +55,19 @@ func (p *WorkPool) DoWait(task TaskHandler) { // 添加到工作池，并等待
 	}
 
 	doneChan := make(chan struct{})
-	p.waitingQueue.Push(TaskHandler(func() error {
+	err := p.waitingQueue.Push(TaskHandler(func() error {
 		defer close(doneChan)
 		return task()
 	}))
+	if err != nil { // 队列已关闭
+		return
+	}
 	<-doneChan
 }
 
 // Wait Waiting for the worker thread to finish executing
 func (p *WorkPool) Wait() error { // 等待工作线程执行结束
-	p.waitingQueue.Wait()  // 等待队列结束
-	p.waitingQueue.Close() //
-	p.waitTask()           // wait que down
-	close(p.task)          // 关闭任务处理Channel
+	p.waitingQueue.Close() // 不再接受任务，startQueue 取完剩余的任务之后关闭任务处理Channel
 	p.wg.Wait()            // 等待结束
 	select {
 	case err := <-p.errChan:
@@ -87,36 +95,21 @@ func (p *WorkPool) IsClosed() bool { // 是否已经关闭
 }
 
 func (p *WorkPool) startQueue() {
-	p.isQueTask = 1
-	// 死循环 从任务队列里面拉取任务放到worker_pool的 goroutine 里面进行执行
+	defer close(p.task) // 队列关闭并且取完之后关闭任务处理Channel，worker 随之退出
+	// 从任务队列里面拉取任务放到worker_pool的 goroutine 里面进行执行，队列为空时阻塞在条件变量上
 	for {
-		tmp := p.waitingQueue.Pop()
-		if p.IsClosed() { // closed
-			p.waitingQueue.Close()
+		tmp, ok := p.waitingQueue.Pop()
+		if !ok {
 			break
 		}
-		if tmp != nil {
-			// 如果从Queue里面取出的任务不为空，则执行该任务
-			// 参看：in.(type) ，将interface类型转换成具体的type类型
-			fn := tmp.(TaskHandler)
-			if fn != nil {
-				p.task <- fn // 放入任务到worker_pool 的task_handler chan
-			}
-		} else {
+		if p.IsClosed() { // closed，有任务出错，丢弃剩余的任务
+			p.waitingQueue.Close()
+			p.waitingQueue.Drain()
 			break
 		}
-	}
-	atomic.StoreInt32(&p.isQueTask, 0)
-}
-
-// 阻塞直到任务执行完成
-func (p *WorkPool) waitTask() {
-	for {
-		runtime.Gosched() // 出让时间片
-		if p.IsDone() {
-			if atomic.LoadInt32(&p.isQueTask) == 0 {
-				break
-			}
+		// 参看：in.(type) ，将interface类型转换成具体的type类型
+		if fn := tmp.(TaskHandler); fn != nil {
+			p.task <- fn // 放入任务到worker_pool 的task_handler chan
 		}
 	}
 }
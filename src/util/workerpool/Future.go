@@ -0,0 +1,90 @@
+package workerpool
+
+import (
+	"context"
+	"sync"
+)
+
+// Future 提交到池子里的任务，用于等待任务完成、取消任务
+type Future interface {
+	// Done 任务结束（执行完成、被取消、被丢弃）时关闭
+	Done() <-chan struct{}
+	// Err 任务返回的错误，任务结束之前返回 nil
+	Err() error
+	// Wait 等待任务结束并返回任务的错误，ctx 结束时返回 ctx.Err()，不影响任务本身
+	Wait(ctx context.Context) error
+	// Cancel 取消任务：还在排队的任务不再执行，正在执行的任务 ctx 被取消
+	Cancel()
+}
+
+type future struct {
+	done    chan struct{}
+	once    sync.Once
+	err     error
+	cancel  context.CancelFunc
+	mu      sync.Mutex
+	started bool
+	dequeue func() // 排队时被取消，从队列中删除，释放队列和租户的额度
+}
+
+func newFuture(cancel context.CancelFunc) *future {
+	return &future{done: make(chan struct{}), cancel: cancel}
+}
+
+func (f *future) Done() <-chan struct{} {
+	return f.done
+}
+
+func (f *future) Err() error {
+	select {
+	case <-f.done:
+		return f.err
+	default:
+		return nil
+	}
+}
+
+func (f *future) Wait(ctx context.Context) error {
+	select {
+	case <-f.done:
+		return f.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (f *future) Cancel() {
+	f.cancel()
+	f.mu.Lock()
+	queued := !f.started
+	if queued {
+		// 还在排队，直接结束。已经被 worker 取走还没开始的任务由 worker 跳过
+		f.complete(context.Canceled)
+	}
+	f.mu.Unlock()
+	if queued && f.dequeue != nil {
+		f.dequeue()
+	}
+}
+
+// start worker 开始执行任务，任务已经结束（排队时被取消）时返回 false
+func (f *future) start() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	select {
+	case <-f.done:
+		return false
+	default:
+		f.started = true
+		return true
+	}
+}
+
+// complete 只有第一次调用生效，同时释放任务的 ctx
+func (f *future) complete(err error) {
+	f.once.Do(func() {
+		f.err = err
+		f.cancel()
+		close(f.done)
+	})
+}
@@ -0,0 +1,439 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// 统一的工作池，替代 wokerpool.WorkPool、customworkerpool/workerpool.WorkPool 和 goroutinePool.Pool：
+//   - Submit 返回 Future，可以等待单个任务的结果或者取消单个任务，任务出错不影响池子和其它任务
+//   - 队列有界，队列满时 Submit 阻塞到有空位或者 ctx 结束，TrySubmit 立即返回 ErrQueueFull
+//   - 每个任务有自己的 ctx，由 Submit 的 ctx 派生，Cancel、ShutdownNow 时被取消
+//   - Shutdown 优雅关闭，执行完队列里的任务；ShutdownNow 立即关闭，丢弃排队的任务并取消正在执行的任务
+//   - Wait 用条件变量等待所有任务执行完，不会空转 CPU
+//   - worker 数在 [min, max] 之间伸缩：排队的任务多于空闲的 worker 时扩容，空闲超过 idleTimeout 的 worker 退出
+//   - 任务可以带优先级和租户，严格按优先级调度，同一优先级内租户之间按权重公平调度，见 fairQueue
+
+var (
+	// ErrPoolClosed 池子已经关闭，不再接受任务；ShutdownNow 丢弃的任务也返回这个错误
+	ErrPoolClosed = errors.New("workerpool: pool closed")
+	// ErrQueueFull 队列已满，TrySubmit 返回
+	ErrQueueFull = errors.New("workerpool: queue full")
+	// ErrTenantQueueFull 租户排队的任务数达到上限，Submit 和 TrySubmit 都立即返回
+	ErrTenantQueueFull = errors.New("workerpool: tenant queue full")
+)
+
+// Func 任务的执行逻辑，ctx 被取消时应尽快返回
+type Func func(ctx context.Context) error
+
+// Option 池子的可选配置
+type Option func(*options)
+
+type options struct {
+	queueSize       int
+	minWorkers      int
+	idleTimeout     time.Duration
+	name            string
+	tenantQueueSize int
+	tenantWeights   map[string]int
+}
+
+// WithQueueSize 排队任务数的上限，默认为 worker 数的 2 倍，小于 0 时不限制
+func WithQueueSize(n int) Option {
+	return func(o *options) {
+		o.queueSize = n
+	}
+}
+
+// WithMinWorkers 常驻的 worker 数，默认和 New 的 workers 相同，即不伸缩
+func WithMinWorkers(n int) Option {
+	return func(o *options) {
+		o.minWorkers = n
+	}
+}
+
+// WithIdleTimeout 超过常驻数的 worker 空闲多久之后退出，默认 1 分钟
+func WithIdleTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.idleTimeout = d
+	}
+}
+
+// WithName 池子的名字，作为监控指标的 pool 标签
+func WithName(name string) Option {
+	return func(o *options) {
+		o.name = name
+	}
+}
+
+// WithTenantQueueSize 每个租户排队任务数的上限，默认不限制。
+// 超过上限时 Submit 不阻塞，直接返回 ErrTenantQueueFull，避免一个租户占满全局队列后阻塞其它租户的提交
+func WithTenantQueueSize(n int) Option {
+	return func(o *options) {
+		o.tenantQueueSize = n
+	}
+}
+
+// WithTenantWeight 租户的权重，同一优先级内每一轮最多连续执行 weight 个该租户的任务，默认为 1
+func WithTenantWeight(tenant string, weight int) Option {
+	return func(o *options) {
+		if o.tenantWeights == nil {
+			o.tenantWeights = make(map[string]int)
+		}
+		o.tenantWeights[tenant] = weight
+	}
+}
+
+// TaskOption 单个任务的可选配置
+type TaskOption func(*task)
+
+// WithPriority 任务的优先级，越大越先执行，默认为 0。只影响排队的顺序，不会打断正在执行的任务
+func WithPriority(priority int) TaskOption {
+	return func(t *task) {
+		t.priority = priority
+	}
+}
+
+// WithTenant 任务所属的租户（业务方、用户等），默认为空字符串，所有不带租户的任务算作同一个租户
+func WithTenant(tenant string) TaskOption {
+	return func(t *task) {
+		t.tenant = tenant
+	}
+}
+
+type task struct {
+	ctx      context.Context
+	fn       Func
+	future   *future
+	queued   time.Time
+	priority int
+	tenant   string
+}
+
+// Pool 工作池
+type Pool struct {
+	mu       sync.Mutex
+	notEmpty *sync.Cond // 有新任务或者池子关闭，唤醒 worker
+	notFull  *sync.Cond // 队列有空位或者池子关闭，唤醒阻塞的 Submit
+	idle     *sync.Cond // 队列为空且没有正在执行的任务，唤醒 Wait
+
+	name        string
+	queue       *fairQueue
+	capacity    int
+	tenantCap   int
+	running     map[*task]struct{} // 正在执行的任务，ShutdownNow 时取消它们
+	min, max    int
+	idleTimeout time.Duration
+	workers     int // 当前的 worker 数
+	idleWorkers int // 等待任务的 worker 数
+	closed      bool
+	exited      chan struct{} // 关闭后所有 worker 退出时关闭
+	stopReaper  chan struct{}
+	stats       stats
+}
+
+// New 创建工作池，workers 为 worker 数的上限。默认启动 workers 个 worker 并常驻，
+// 通过 WithMinWorkers 设置更小的常驻数之后按负载伸缩
+func New(workers int, opts ...Option) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+	o := &options{queueSize: 2 * workers, minWorkers: workers, idleTimeout: time.Minute}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.minWorkers < 0 {
+		o.minWorkers = 0
+	}
+	if o.minWorkers > workers {
+		o.minWorkers = workers
+	}
+	p := &Pool{
+		name:        o.name,
+		queue:       newFairQueue(o.tenantWeights),
+		capacity:    o.queueSize,
+		tenantCap:   o.tenantQueueSize,
+		running:     make(map[*task]struct{}),
+		min:         o.minWorkers,
+		max:         workers,
+		idleTimeout: o.idleTimeout,
+		exited:      make(chan struct{}),
+		stopReaper:  make(chan struct{}),
+		stats:       newStats(),
+	}
+	p.notEmpty = sync.NewCond(&p.mu)
+	p.notFull = sync.NewCond(&p.mu)
+	p.idle = sync.NewCond(&p.mu)
+	p.mu.Lock()
+	for i := 0; i < p.min; i++ {
+		p.spawn()
+	}
+	p.mu.Unlock()
+	if p.min < p.max && p.idleTimeout > 0 {
+		go p.reaper()
+	}
+	return p
+}
+
+// spawn 启动一个 worker，调用方持有锁
+func (p *Pool) spawn() {
+	p.workers++
+	if p.workers > p.stats.peakWorkers {
+		p.stats.peakWorkers = p.workers
+	}
+	go p.worker()
+}
+
+// reaper 定期唤醒空闲的 worker，让空闲超时的 worker 检查后退出。sync.Cond 不支持超时等待
+func (p *Pool) reaper() {
+	ticker := time.NewTicker(p.idleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.mu.Lock()
+			p.notEmpty.Broadcast()
+			p.mu.Unlock()
+		case <-p.stopReaper:
+			return
+		}
+	}
+}
+
+// Submit 提交任务，队列满时阻塞到有空位。ctx 在任务开始执行之前结束时任务不再执行，Future 返回 ctx.Err()
+func (p *Pool) Submit(ctx context.Context, fn Func, opts ...TaskOption) (Future, error) {
+	return p.submit(ctx, fn, true, opts)
+}
+
+// TrySubmit 提交任务，队列满时立即返回 ErrQueueFull
+func (p *Pool) TrySubmit(ctx context.Context, fn Func, opts ...TaskOption) (Future, error) {
+	return p.submit(ctx, fn, false, opts)
+}
+
+// Go 提交任务，不关心结果，兼容旧的 Do(func() error) 用法
+func (p *Pool) Go(fn func() error) error {
+	_, err := p.Submit(context.Background(), func(ctx context.Context) error {
+		return fn()
+	})
+	return err
+}
+
+func (p *Pool) submit(ctx context.Context, fn Func, block bool, opts []TaskOption) (Future, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	t := &task{fn: fn}
+	for _, opt := range opts {
+		opt(t)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for {
+		var err error
+		switch {
+		case p.closed:
+			err = ErrPoolClosed
+		case p.tenantCap > 0 && p.queue.tenantLen(t.tenant) >= p.tenantCap:
+			err = ErrTenantQueueFull
+		case !p.full():
+		case !block:
+			err = ErrQueueFull
+		default:
+			// 等到有空位之后重新检查
+			if err = p.waitNotFull(ctx); err == nil {
+				continue
+			}
+		}
+		if err != nil {
+			p.stats.rejected++
+			return nil, err
+		}
+		break
+	}
+	taskCtx, cancel := context.WithCancel(ctx)
+	t.ctx, t.future, t.queued = taskCtx, newFuture(cancel), time.Now()
+	t.future.dequeue = func() { p.dequeue(t) }
+	p.queue.push(t)
+	p.stats.submitted++
+	// 排队的任务多于空闲的 worker 时扩容
+	if p.queue.len() > p.idleWorkers && p.workers < p.max {
+		p.spawn()
+	}
+	p.notEmpty.Signal()
+	return t.future, nil
+}
+
+// dequeue 删除排队时被取消的任务，任务已经被 worker 取走时什么都不做
+func (p *Pool) dequeue(t *task) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.queue.remove(t) {
+		return
+	}
+	p.stats.observe(time.Since(t.queued), 0, context.Canceled)
+	p.notFull.Signal()
+	if p.queue.len() == 0 && len(p.running) == 0 {
+		p.idle.Broadcast()
+	}
+}
+
+func (p *Pool) full() bool {
+	return p.capacity >= 0 && p.queue.len() >= p.capacity
+}
+
+// waitNotFull 在持有锁的情况下等待队列有空位，ctx 结束时返回 ctx.Err()。
+// sync.Cond 不支持 ctx，ctx 结束时由单独的 goroutine 广播唤醒
+func (p *Pool) waitNotFull(ctx context.Context) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			p.mu.Lock()
+			p.notFull.Broadcast()
+			p.mu.Unlock()
+		case <-stop:
+		}
+	}()
+	p.notFull.Wait()
+	return ctx.Err()
+}
+
+func (p *Pool) worker() {
+	for {
+		p.mu.Lock()
+		p.idleWorkers++
+		idleSince := time.Now()
+		for p.queue.len() == 0 && !p.closed {
+			if p.workers > p.min && p.idleTimeout > 0 && time.Since(idleSince) >= p.idleTimeout {
+				break
+			}
+			p.notEmpty.Wait()
+		}
+		p.idleWorkers--
+		if p.queue.len() == 0 {
+			// 空闲超时或者关闭并且队列已经清空
+			p.workers--
+			if p.closed && p.workers == 0 {
+				close(p.exited)
+			}
+			p.mu.Unlock()
+			return
+		}
+		t := p.queue.pop()
+		p.running[t] = struct{}{}
+		p.notFull.Signal()
+		p.mu.Unlock()
+
+		start := time.Now()
+		err := p.run(t)
+		t.future.complete(err)
+
+		p.mu.Lock()
+		delete(p.running, t)
+		p.stats.observe(start.Sub(t.queued), time.Since(start), err)
+		if p.queue.len() == 0 && len(p.running) == 0 {
+			p.idle.Broadcast()
+		}
+		p.mu.Unlock()
+	}
+}
+
+// run 执行任务，任务的 ctx 已经结束时直接返回，panic 转成 error
+func (p *Pool) run(t *task) (err error) {
+	if !t.future.start() {
+		return t.future.err
+	}
+	if err := t.ctx.Err(); err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("workerpool: panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	return t.fn(t.ctx)
+}
+
+// Wait 阻塞到队列为空并且没有正在执行的任务，不会关闭池子，之后还可以继续提交任务
+func (p *Pool) Wait() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.queue.len() > 0 || len(p.running) > 0 {
+		p.idle.Wait()
+	}
+}
+
+// Shutdown 优雅关闭：不再接受新任务，等待排队和正在执行的任务完成。
+// ctx 结束时返回 ctx.Err()，剩下的任务仍然会在后台执行完
+func (p *Pool) Shutdown(ctx context.Context) error {
+	p.close()
+	select {
+	case <-p.exited:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ShutdownNow 立即关闭：不再接受新任务，丢弃排队的任务（Future 返回 ErrPoolClosed），
+// 取消正在执行的任务的 ctx，返回被丢弃的任务数。不等待正在执行的任务退出，需要等待时再调用 Shutdown
+func (p *Pool) ShutdownNow() int {
+	p.mu.Lock()
+	dropped := p.queue.drain()
+	for t := range p.running {
+		t.future.cancel()
+	}
+	p.mu.Unlock()
+	p.close()
+
+	for _, t := range dropped {
+		t.future.complete(ErrPoolClosed)
+	}
+	p.mu.Lock()
+	if len(p.running) == 0 {
+		p.idle.Broadcast()
+	}
+	p.mu.Unlock()
+	return len(dropped)
+}
+
+func (p *Pool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	p.closed = true
+	if p.workers == 0 {
+		close(p.exited)
+	}
+	close(p.stopReaper)
+	p.notEmpty.Broadcast()
+	p.notFull.Broadcast()
+}
+
+// Running 正在执行的任务数
+func (p *Pool) Running() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.running)
+}
+
+// Queued 排队中的任务数
+func (p *Pool) Queued() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.queue.len()
+}
+
+// TenantQueued 租户排队中的任务数
+func (p *Pool) TenantQueued(tenant string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.queue.tenantLen(tenant)
+}
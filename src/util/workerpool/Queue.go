@@ -0,0 +1,162 @@
+package workerpool
+
+import "sort"
+
+// fairQueue 池子的排队队列：不同优先级之间严格按优先级出队，同一优先级内按租户做 DRR（deficit round robin）：
+// 租户轮流出队，每轮最多出队 weight 个任务，一个租户提交大量任务时其它租户仍然能按权重分到 worker。
+// 不设置优先级和租户时所有任务在同一个租户里，退化为 FIFO。由 Pool.mu 保护
+type fairQueue struct {
+	levels  map[int]*level // 优先级 -> 该优先级的队列
+	prios   []int          // 有任务的优先级，从高到低
+	tenants map[string]int // 每个租户排队的任务数
+	weights map[string]int // 租户的权重，默认为 1
+	n       int
+}
+
+// level 同一优先级的队列
+type level struct {
+	flows  map[string]*flow
+	active []*flow // 有任务的租户，按轮转顺序，队头正在出队
+}
+
+// flow 一个租户在某个优先级的任务
+type flow struct {
+	tenant  string
+	tasks   []*task
+	deficit int // 本轮还能出队的任务数
+}
+
+func newFairQueue(weights map[string]int) *fairQueue {
+	return &fairQueue{
+		levels:  make(map[int]*level),
+		tenants: make(map[string]int),
+		weights: weights,
+	}
+}
+
+func (q *fairQueue) len() int {
+	return q.n
+}
+
+func (q *fairQueue) tenantLen(tenant string) int {
+	return q.tenants[tenant]
+}
+
+func (q *fairQueue) weight(tenant string) int {
+	if w, ok := q.weights[tenant]; ok && w > 0 {
+		return w
+	}
+	return 1
+}
+
+func (q *fairQueue) push(t *task) {
+	lv, ok := q.levels[t.priority]
+	if !ok {
+		lv = &level{flows: make(map[string]*flow)}
+		q.levels[t.priority] = lv
+		i := sort.Search(len(q.prios), func(i int) bool { return q.prios[i] < t.priority })
+		q.prios = append(q.prios, 0)
+		copy(q.prios[i+1:], q.prios[i:])
+		q.prios[i] = t.priority
+	}
+	f, ok := lv.flows[t.tenant]
+	if !ok {
+		// 新加入的租户排在队尾，带着一轮的额度
+		f = &flow{tenant: t.tenant, deficit: q.weight(t.tenant)}
+		lv.flows[t.tenant] = f
+		lv.active = append(lv.active, f)
+	}
+	f.tasks = append(f.tasks, t)
+	q.tenants[t.tenant]++
+	q.n++
+}
+
+// pop 取出最高优先级中轮到的租户的第一个任务，队列为空时返回 nil
+func (q *fairQueue) pop() *task {
+	if q.n == 0 {
+		return nil
+	}
+	prio := q.prios[0]
+	lv := q.levels[prio]
+	f := lv.active[0]
+	for f.deficit < 1 {
+		// 额度用完，补充下一轮的额度后排到队尾
+		f.deficit += q.weight(f.tenant)
+		lv.active = append(lv.active[1:], f)
+		f = lv.active[0]
+	}
+	t := f.tasks[0]
+	f.tasks[0] = nil
+	f.tasks = f.tasks[1:]
+	f.deficit--
+	if len(f.tasks) == 0 {
+		q.leave(prio, lv, 0)
+	}
+	q.dec(t.tenant)
+	return t
+}
+
+// remove 删除排队中的任务，任务不在队列中时返回 false
+func (q *fairQueue) remove(t *task) bool {
+	lv, ok := q.levels[t.priority]
+	if !ok {
+		return false
+	}
+	f, ok := lv.flows[t.tenant]
+	if !ok {
+		return false
+	}
+	for i, queued := range f.tasks {
+		if queued != t {
+			continue
+		}
+		copy(f.tasks[i:], f.tasks[i+1:])
+		f.tasks[len(f.tasks)-1] = nil
+		f.tasks = f.tasks[:len(f.tasks)-1]
+		if len(f.tasks) == 0 {
+			for j := range lv.active {
+				if lv.active[j] == f {
+					q.leave(t.priority, lv, j)
+					break
+				}
+			}
+		}
+		q.dec(t.tenant)
+		return true
+	}
+	return false
+}
+
+// leave 没有任务的租户离开轮转，额度清零；优先级没有任务时一起删除
+func (q *fairQueue) leave(prio int, lv *level, i int) {
+	f := lv.active[i]
+	delete(lv.flows, f.tenant)
+	copy(lv.active[i:], lv.active[i+1:])
+	lv.active[len(lv.active)-1] = nil
+	lv.active = lv.active[:len(lv.active)-1]
+	if len(lv.active) == 0 {
+		delete(q.levels, prio)
+		for j, p := range q.prios {
+			if p == prio {
+				q.prios = append(q.prios[:j], q.prios[j+1:]...)
+				break
+			}
+		}
+	}
+}
+
+func (q *fairQueue) dec(tenant string) {
+	if q.tenants[tenant]--; q.tenants[tenant] == 0 {
+		delete(q.tenants, tenant)
+	}
+	q.n--
+}
+
+// drain 取出所有任务，按出队顺序
+func (q *fairQueue) drain() []*task {
+	tasks := make([]*task, 0, q.n)
+	for q.n > 0 {
+		tasks = append(tasks, q.pop())
+	}
+	return tasks
+}
@@ -0,0 +1,173 @@
+package workerpool
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// latencyBuckets 任务耗时直方图的桶（秒），和 Prometheus 客户端的默认桶一致
+var latencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// stats 池子的累计统计，由 Pool.mu 保护
+type stats struct {
+	peakWorkers int
+	submitted   uint64
+	completed   uint64
+	failed      uint64
+	rejected    uint64
+	waitSum     time.Duration
+	latencySum  time.Duration
+	maxLatency  time.Duration
+	buckets     []uint64 // 和 latencyBuckets 对应，非累计
+}
+
+func newStats() stats {
+	return stats{buckets: make([]uint64, len(latencyBuckets))}
+}
+
+// observe 记录一个执行完的任务，wait 为排队时间，latency 为执行时间
+func (s *stats) observe(wait, latency time.Duration, err error) {
+	s.completed++
+	if err != nil {
+		s.failed++
+	}
+	s.waitSum += wait
+	s.latencySum += latency
+	if latency > s.maxLatency {
+		s.maxLatency = latency
+	}
+	i := sort.SearchFloat64s(latencyBuckets, latency.Seconds())
+	if i < len(s.buckets) {
+		s.buckets[i]++
+	}
+}
+
+// Stats 池子的状态快照
+type Stats struct {
+	Workers     int           // 当前的 worker 数
+	PeakWorkers int           // worker 数的峰值
+	Active      int           // 正在执行任务的 worker 数
+	Idle        int           // 空闲的 worker 数
+	Queued      int           // 排队中的任务数
+	Submitted   uint64        // 累计提交的任务数
+	Completed   uint64        // 累计结束的任务数，包括失败的任务
+	Failed      uint64        // 累计返回错误的任务数
+	Rejected    uint64        // 累计被拒绝的提交：队列满、池子已关闭、等待空位时 ctx 结束
+	AvgWait     time.Duration // 平均排队时间
+	AvgLatency  time.Duration // 平均执行时间
+	MaxLatency  time.Duration // 最大执行时间
+}
+
+// Stats 返回池子的状态快照
+func (p *Pool) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	st := Stats{
+		Workers:     p.workers,
+		PeakWorkers: p.stats.peakWorkers,
+		Active:      len(p.running),
+		Idle:        p.idleWorkers,
+		Queued:      p.queue.len(),
+		Submitted:   p.stats.submitted,
+		Completed:   p.stats.completed,
+		Failed:      p.stats.failed,
+		Rejected:    p.stats.rejected,
+		MaxLatency:  p.stats.maxLatency,
+	}
+	if n := p.stats.completed; n > 0 {
+		st.AvgWait = p.stats.waitSum / time.Duration(n)
+		st.AvgLatency = p.stats.latencySum / time.Duration(n)
+	}
+	return st
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]*Pool)
+)
+
+// Register 登记池子，MetricsHandler 输出所有登记过的池子的指标，名字为 WithName 设置的名字
+func Register(p *Pool) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[p.name] = p
+}
+
+// Unregister 取消登记，池子关闭之后调用
+func Unregister(p *Pool) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if registry[p.name] == p {
+		delete(registry, p.name)
+	}
+}
+
+// MetricsHandler 以 Prometheus 文本格式输出登记过的池子的指标，例如 r.GET("/metrics/pool", gin.WrapH(workerpool.MetricsHandler()))
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		registryMu.Lock()
+		pools := make([]*Pool, 0, len(registry))
+		for _, p := range registry {
+			pools = append(pools, p)
+		}
+		registryMu.Unlock()
+		sort.Slice(pools, func(i, j int) bool { return pools[i].name < pools[j].name })
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WriteMetrics(w, pools...)
+	})
+}
+
+// WriteMetrics 以 Prometheus 文本格式输出池子的指标，pool 标签为池子的名字
+func WriteMetrics(w io.Writer, pools ...*Pool) {
+	type sample struct {
+		labels string
+		st     Stats
+		p      *Pool
+	}
+	samples := make([]sample, 0, len(pools))
+	for _, p := range pools {
+		samples = append(samples, sample{labels: fmt.Sprintf("pool=%q", p.name), st: p.Stats(), p: p})
+	}
+	metric := func(typ, name, help string, value func(Stats) float64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+		for _, s := range samples {
+			fmt.Fprintf(w, "%s{%s} %s\n", name, s.labels, formatFloat(value(s.st)))
+		}
+	}
+	gauge := func(name, help string, value func(Stats) float64) { metric("gauge", name, help, value) }
+	counter := func(name, help string, value func(Stats) float64) { metric("counter", name, help, value) }
+	gauge("workerpool_workers", "Current number of workers.", func(st Stats) float64 { return float64(st.Workers) })
+	gauge("workerpool_active_workers", "Number of workers running a task.", func(st Stats) float64 { return float64(st.Active) })
+	gauge("workerpool_idle_workers", "Number of workers waiting for a task.", func(st Stats) float64 { return float64(st.Idle) })
+	gauge("workerpool_queued_tasks", "Number of tasks waiting in the queue.", func(st Stats) float64 { return float64(st.Queued) })
+	counter("workerpool_submitted_total", "Tasks accepted by the pool.", func(st Stats) float64 { return float64(st.Submitted) })
+	counter("workerpool_completed_total", "Tasks finished, including failed ones.", func(st Stats) float64 { return float64(st.Completed) })
+	counter("workerpool_failed_total", "Tasks that returned an error.", func(st Stats) float64 { return float64(st.Failed) })
+	counter("workerpool_rejected_total", "Submissions rejected because the queue was full or the pool was closed.", func(st Stats) float64 { return float64(st.Rejected) })
+
+	const hist = "workerpool_task_duration_seconds"
+	fmt.Fprintf(w, "# HELP %s Task execution time.\n# TYPE %s histogram\n", hist, hist)
+	for _, s := range samples {
+		s.p.mu.Lock()
+		buckets := append([]uint64(nil), s.p.stats.buckets...)
+		sum, count := s.p.stats.latencySum, s.p.stats.completed
+		s.p.mu.Unlock()
+		var cumulative uint64
+		for i, le := range latencyBuckets {
+			cumulative += buckets[i]
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", hist, s.labels, formatFloat(le), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", hist, s.labels, count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", hist, s.labels, formatFloat(sum.Seconds()))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", hist, s.labels, count)
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
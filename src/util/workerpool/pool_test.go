@@ -0,0 +1,436 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPool_Submit(t *testing.T) {
+	p := New(4, WithQueueSize(-1))
+	var sum int64
+	var futures []Future
+	for i := 1; i <= 100; i++ {
+		n := int64(i)
+		f, err := p.Submit(context.Background(), func(ctx context.Context) error {
+			atomic.AddInt64(&sum, n)
+			if n%10 == 0 {
+				return errors.New("bad number")
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		futures = append(futures, f)
+	}
+	p.Wait()
+	if sum != 5050 {
+		t.Fatalf("sum want 5050 got %d", sum)
+	}
+	failed := 0
+	for _, f := range futures {
+		if f.Err() != nil {
+			failed++
+		}
+	}
+	// 任务出错不影响其它任务和池子
+	if failed != 10 {
+		t.Fatalf("failed want 10 got %d", failed)
+	}
+	f, err := p.Submit(context.Background(), func(ctx context.Context) error { panic("oops") })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Wait(context.Background()); err == nil || !strings.Contains(err.Error(), "oops") {
+		t.Fatalf("panic should become error, got %v", err)
+	}
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Submit(context.Background(), func(ctx context.Context) error { return nil }); err != ErrPoolClosed {
+		t.Fatalf("want ErrPoolClosed got %v", err)
+	}
+}
+
+// block 占住 worker 直到 release 被关闭
+func block(release chan struct{}) Func {
+	return func(ctx context.Context) error {
+		select {
+		case <-release:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func TestPool_BoundedQueue(t *testing.T) {
+	p := New(1, WithQueueSize(2))
+	release := make(chan struct{})
+	running, _ := p.Submit(context.Background(), block(release))
+	for p.Running() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := p.TrySubmit(context.Background(), block(release)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := p.TrySubmit(context.Background(), block(release)); err != ErrQueueFull {
+		t.Fatalf("want ErrQueueFull got %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.Submit(ctx, block(release)); err != context.DeadlineExceeded {
+		t.Fatalf("blocked submit should time out, got %v", err)
+	}
+
+	// 有空位之后阻塞的 Submit 返回
+	done := make(chan error)
+	go func() {
+		_, err := p.Submit(context.Background(), block(release))
+		done <- err
+	}()
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err := running.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	p.Wait()
+	if p.Queued() != 0 || p.Running() != 0 {
+		t.Fatalf("pool should be idle, queued %d running %d", p.Queued(), p.Running())
+	}
+}
+
+func TestPool_Cancel(t *testing.T) {
+	p := New(1)
+	release := make(chan struct{})
+	defer close(release)
+	running, _ := p.Submit(context.Background(), block(release))
+	var ran int32
+	queued, _ := p.Submit(context.Background(), func(ctx context.Context) error {
+		atomic.StoreInt32(&ran, 1)
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	byCtx, _ := p.Submit(ctx, func(ctx context.Context) error {
+		atomic.StoreInt32(&ran, 1)
+		return nil
+	})
+
+	// 排队中的任务取消后立即结束
+	queued.Cancel()
+	if err := queued.Wait(context.Background()); err != context.Canceled {
+		t.Fatalf("want Canceled got %v", err)
+	}
+	// 提交时的 ctx 结束，排队中的任务不再执行
+	cancel()
+	// 正在执行的任务通过 ctx 感知取消
+	running.Cancel()
+	if err := running.Wait(context.Background()); err != context.Canceled {
+		t.Fatalf("want Canceled got %v", err)
+	}
+	if err := byCtx.Wait(context.Background()); err != context.Canceled {
+		t.Fatalf("want Canceled got %v", err)
+	}
+	p.Wait()
+	if atomic.LoadInt32(&ran) != 0 {
+		t.Fatal("canceled tasks should not run")
+	}
+}
+
+func TestPool_CancelReleasesQueue(t *testing.T) {
+	p := New(1, WithQueueSize(4), WithTenantQueueSize(2))
+	release := make(chan struct{})
+	p.Submit(context.Background(), block(release))
+	for p.Running() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	var ran int32
+	fn := func(ctx context.Context) error {
+		atomic.AddInt32(&ran, 1)
+		return nil
+	}
+	// 排队中被取消的任务立即让出队列和租户的额度
+	for round := 0; round < 3; round++ {
+		var futures []Future
+		for i := 0; i < 2; i++ {
+			f, err := p.TrySubmit(context.Background(), fn, WithTenant("a"))
+			if err != nil {
+				t.Fatalf("round %d: %v", round, err)
+			}
+			futures = append(futures, f)
+		}
+		for _, f := range futures {
+			f.Cancel()
+		}
+		if p.Queued() != 0 || p.TenantQueued("a") != 0 {
+			t.Fatalf("round %d: canceled tasks still queued: %d", round, p.Queued())
+		}
+	}
+	for i := 0; i < 4; i++ {
+		tenant := []string{"a", "b"}[i%2]
+		if _, err := p.TrySubmit(context.Background(), fn, WithTenant(tenant)); err != nil {
+			t.Fatalf("submit up to the limit: %v", err)
+		}
+	}
+	close(release)
+	p.Wait()
+	if n := atomic.LoadInt32(&ran); n != 4 {
+		t.Fatalf("want 4 tasks run got %d", n)
+	}
+	if s := p.Stats(); s.Completed != 11 || s.Failed != 6 {
+		t.Fatalf("canceled tasks should be counted as failed, got %+v", s)
+	}
+}
+
+func TestPool_Shutdown(t *testing.T) {
+	p := New(2, WithQueueSize(-1))
+	var done int32
+	for i := 0; i < 10; i++ {
+		p.Submit(context.Background(), func(ctx context.Context) error {
+			time.Sleep(2 * time.Millisecond)
+			atomic.AddInt32(&done, 1)
+			return nil
+		})
+	}
+	// 优雅关闭执行完所有排队的任务
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if done != 10 {
+		t.Fatalf("graceful shutdown should finish queued tasks, done %d", done)
+	}
+
+	p = New(2, WithQueueSize(-1))
+	release := make(chan struct{})
+	defer close(release)
+	var running []Future
+	for i := 0; i < 2; i++ {
+		f, _ := p.Submit(context.Background(), block(release))
+		running = append(running, f)
+	}
+	for p.Running() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	var queued []Future
+	for i := 0; i < 5; i++ {
+		f, _ := p.Submit(context.Background(), block(release))
+		queued = append(queued, f)
+	}
+	if n := p.ShutdownNow(); n != 5 {
+		t.Fatalf("dropped want 5 got %d", n)
+	}
+	for _, f := range queued {
+		if err := f.Wait(context.Background()); err != ErrPoolClosed {
+			t.Fatalf("dropped task want ErrPoolClosed got %v", err)
+		}
+	}
+	for _, f := range running {
+		if err := f.Wait(context.Background()); err != context.Canceled {
+			t.Fatalf("running task want Canceled got %v", err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := p.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPool_Elastic(t *testing.T) {
+	p := New(4, WithMinWorkers(1), WithIdleTimeout(20*time.Millisecond), WithQueueSize(-1))
+	defer p.ShutdownNow()
+	if st := p.Stats(); st.Workers != 1 || st.Idle+st.Active > 1 {
+		t.Fatalf("should start with min workers, got %+v", st)
+	}
+	release := make(chan struct{})
+	for i := 0; i < 6; i++ {
+		p.Submit(context.Background(), block(release))
+	}
+	for p.Running() < 4 {
+		time.Sleep(time.Millisecond)
+	}
+	if st := p.Stats(); st.Workers != 4 || st.Active != 4 || st.Queued != 2 {
+		t.Fatalf("should grow to max workers under pressure, got %+v", st)
+	}
+	close(release)
+	p.Wait()
+
+	// 空闲超时之后缩回常驻数
+	deadline := time.Now().Add(time.Second)
+	for p.Stats().Workers > 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	st := p.Stats()
+	if st.Workers != 1 || st.PeakWorkers != 4 || st.Completed != 6 || st.Submitted != 6 {
+		t.Fatalf("should shrink to min workers, got %+v", st)
+	}
+
+	// 缩容之后仍然可以继续扩容
+	f, err := p.Submit(context.Background(), func(ctx context.Context) error { return errors.New("bad") })
+	if err != nil || f.Wait(context.Background()) == nil {
+		t.Fatalf("task should run after shrinking, err %v", err)
+	}
+}
+
+func TestPool_Metrics(t *testing.T) {
+	p := New(1, WithQueueSize(1), WithName("etl"))
+	Register(p)
+	defer Unregister(p)
+	release := make(chan struct{})
+	p.Submit(context.Background(), block(release))
+	for p.Running() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	p.Submit(context.Background(), func(ctx context.Context) error { return errors.New("bad") })
+	if _, err := p.TrySubmit(context.Background(), block(release)); err != ErrQueueFull {
+		t.Fatalf("want ErrQueueFull got %v", err)
+	}
+	close(release)
+	p.Wait()
+
+	st := p.Stats()
+	if st.Completed != 2 || st.Failed != 1 || st.Rejected != 1 || st.MaxLatency <= 0 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+
+	w := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	for _, want := range []string{
+		"# TYPE workerpool_workers gauge",
+		`workerpool_workers{pool="etl"} 1`,
+		`workerpool_completed_total{pool="etl"} 2`,
+		`workerpool_failed_total{pool="etl"} 1`,
+		`workerpool_rejected_total{pool="etl"} 1`,
+		"# TYPE workerpool_task_duration_seconds histogram",
+		`workerpool_task_duration_seconds_bucket{pool="etl",le="+Inf"} 2`,
+		`workerpool_task_duration_seconds_count{pool="etl"} 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("metrics should contain %s:\n%s", want, body)
+		}
+	}
+}
+
+// recorder 按执行顺序记录任务的标签
+type recorder struct {
+	mu    sync.Mutex
+	order []string
+}
+
+func (r *recorder) task(label string) Func {
+	return func(ctx context.Context) error {
+		r.mu.Lock()
+		r.order = append(r.order, label)
+		r.mu.Unlock()
+		return nil
+	}
+}
+
+// paused 只有一个 worker 并且被占住的池子，排好队之后调用返回的函数开始执行
+func paused(opts ...Option) (*Pool, func()) {
+	p := New(1, append([]Option{WithQueueSize(-1)}, opts...)...)
+	release := make(chan struct{})
+	p.Submit(context.Background(), block(release))
+	for p.Running() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	return p, func() {
+		close(release)
+		p.Wait()
+	}
+}
+
+func TestPool_Priority(t *testing.T) {
+	p, start := paused()
+	r := &recorder{}
+	p.Submit(context.Background(), r.task("low-1"))
+	p.Submit(context.Background(), r.task("high-1"), WithPriority(10))
+	p.Submit(context.Background(), r.task("mid"), WithPriority(5))
+	p.Submit(context.Background(), r.task("low-2"))
+	p.Submit(context.Background(), r.task("high-2"), WithPriority(10))
+	start()
+	want := "high-1,high-2,mid,low-1,low-2"
+	if got := strings.Join(r.order, ","); got != want {
+		t.Fatalf("order want %s got %s", want, got)
+	}
+}
+
+func TestPool_FairShare(t *testing.T) {
+	p, start := paused()
+	r := &recorder{}
+	// flood 先提交大量任务，a、b 之后才提交
+	for i := 0; i < 1000; i++ {
+		p.Submit(context.Background(), r.task("flood"), WithTenant("flood"))
+	}
+	for i := 0; i < 10; i++ {
+		p.Submit(context.Background(), r.task("a"), WithTenant("a"))
+		p.Submit(context.Background(), r.task("b"), WithTenant("b"))
+	}
+	start()
+
+	// 三个租户轮流执行，a、b 的任务在前 30 个任务内全部执行完，不会排在 flood 的 1000 个任务之后
+	last := 0
+	for i, label := range r.order {
+		if label != "flood" {
+			last = i
+		}
+	}
+	if last >= 30 {
+		t.Fatalf("a and b should finish within 30 tasks, last at %d: %v", last, r.order[:40])
+	}
+	if len(r.order) != 1020 {
+		t.Fatalf("all tasks should run, got %d", len(r.order))
+	}
+}
+
+func TestPool_TenantWeight(t *testing.T) {
+	p, start := paused(WithTenantWeight("gold", 3))
+	r := &recorder{}
+	for i := 0; i < 30; i++ {
+		p.Submit(context.Background(), r.task("gold"), WithTenant("gold"))
+		p.Submit(context.Background(), r.task("free"), WithTenant("free"))
+	}
+	start()
+	gold := 0
+	for _, label := range r.order[:20] {
+		if label == "gold" {
+			gold++
+		}
+	}
+	if gold != 15 {
+		t.Fatalf("gold should get 3/4 of the first 20 slots, got %d: %v", gold, r.order[:20])
+	}
+}
+
+func TestPool_TenantQueueSize(t *testing.T) {
+	p, start := paused(WithTenantQueueSize(5))
+	r := &recorder{}
+	rejected := 0
+	for i := 0; i < 20; i++ {
+		if _, err := p.Submit(context.Background(), r.task("flood"), WithTenant("flood")); err == ErrTenantQueueFull {
+			rejected++
+		}
+	}
+	if rejected != 15 || p.TenantQueued("flood") != 5 {
+		t.Fatalf("flood should be limited to 5 queued tasks, rejected %d", rejected)
+	}
+	// 其它租户不受影响
+	if _, err := p.Submit(context.Background(), r.task("a"), WithTenant("a")); err != nil {
+		t.Fatal(err)
+	}
+	start()
+	if len(r.order) != 6 || p.Stats().Rejected != 15 {
+		t.Fatalf("unexpected order %v, stats %+v", r.order, p.Stats())
+	}
+}